@@ -10,14 +10,32 @@ const (
 	ACCESS_BALANCE_OWNER     = "Owner"
 )
 
+// A balance without status is active. Dormant balances are only credited until they are reactivated.
+const (
+	BALANCE_STATUS_ACTIVE       = "ACTIVE"
+	BALANCE_STATUS_FROZEN_DEBIT = "FROZEN_DEBIT"
+	BALANCE_STATUS_FROZEN_ALL   = "FROZEN_ALL"
+	BALANCE_STATUS_CLOSED       = "CLOSED"
+	BALANCE_STATUS_DORMANT      = "DORMANT"
+)
+
+// Statuses that block a withdraw or a deposit
+var (
+	BalanceDebitBlockedStatuses  = []string{BALANCE_STATUS_FROZEN_DEBIT, BALANCE_STATUS_FROZEN_ALL, BALANCE_STATUS_CLOSED, BALANCE_STATUS_DORMANT}
+	BalanceCreditBlockedStatuses = []string{BALANCE_STATUS_FROZEN_ALL, BALANCE_STATUS_CLOSED}
+)
+
 type Balance struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	CorporateID primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
 	Owner       ActorObject        `json:"owner" bson:"owner,omitempty"`
 	Name        string             `json:"name" bson:"name,omitempty"`
 	Amount      int                `json:"amount" bson:"amount"`
+	Held        int                `json:"held" bson:"held"`
 	VA          []VirtualAccount   `json:"va" bson:"va,omitempty"`
 	Currency    string             `json:"currency" bson:"currency,omitempty"`
+	Version     int                `json:"version" bson:"version"`
+	Status      string             `json:"status" bson:"status,omitempty"`
 }
 
 type VirtualAccount struct {
@@ -25,6 +43,51 @@ type VirtualAccount struct {
 	AccountNumber string `json:"account_number" bson:"account_number,omitempty"`
 }
 
+// Amount is the ledger amount, held funds of pending transactions can not be spent
+func (domain Balance) Available() int {
+	return domain.Amount - domain.Held
+}
+
+// ActiveVA leaves out the placeholder older balances show for an account that was never created
+func (domain Balance) ActiveVA() []VirtualAccount {
+	va := []VirtualAccount{}
+	for _, account := range domain.VA {
+		if account.AccountNumber != "" && account.AccountNumber != VA_LEGACY_PLACEHOLDER {
+			va = append(va, account)
+		}
+	}
+
+	return va
+}
+
+func (domain Balance) CurrentStatus() string {
+	if domain.Status == "" {
+		return BALANCE_STATUS_ACTIVE
+	}
+
+	return domain.Status
+}
+
+func (domain Balance) CanDebit() bool {
+	for _, status := range BalanceDebitBlockedStatuses {
+		if domain.CurrentStatus() == status {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (domain Balance) CanCredit() bool {
+	for _, status := range BalanceCreditBlockedStatuses {
+		if domain.CurrentStatus() == status {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (domain *Balance) SetDocumentID(ID primitive.ObjectID) {
 	domain.ID = ID
 }
@@ -0,0 +1,31 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const BALANCE_STATUS_AUDIT_COLLECTION string = "balance_status_audit"
+
+const ACTOR_TYPE_SYSTEM = "system"
+
+// BalanceStatusAudit records who moved a balance from one status to another and why
+type BalanceStatusAudit struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BalanceID       primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	From            string             `json:"from" bson:"from,omitempty"`
+	To              string             `json:"to" bson:"to,omitempty"`
+	Actor           ActorObject        `json:"actor" bson:"actor,omitempty"`
+	Reason          string             `json:"reason" bson:"reason,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *BalanceStatusAudit) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *BalanceStatusAudit) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *BalanceStatusAudit) CollectionName() string {
+	return BALANCE_STATUS_AUDIT_COLLECTION
+}
@@ -0,0 +1,36 @@
+package domain
+
+const BANK_INQUIRY_COLLECTION string = "bank_inquiry"
+
+const (
+	NAME_MATCH_PASS  = "PASS"
+	NAME_MATCH_FLAG  = "FLAG"
+	NAME_MATCH_BLOCK = "BLOCK"
+)
+
+// BankInquiry caches the answer of an account inquiry, its ID is the bank code and account number.
+// An invalid account is cached too, with the error code it got, for a shorter time. ExpiresAt is a unix second.
+type BankInquiry struct {
+	ID            string `json:"id" bson:"_id"`
+	BankCode      string `json:"bank_code" bson:"bank_code,omitempty"`
+	AccountNumber string `json:"account_number" bson:"account_number,omitempty"`
+	AccountName   string `json:"account_name" bson:"account_name,omitempty"`
+	Valid         bool   `json:"valid" bson:"valid"`
+	ErrorCode     int    `json:"error_code" bson:"error_code,omitempty"`
+	ExpiresAt     int64  `json:"expires_at" bson:"expires_at"`
+	Time          string `json:"time" bson:"time,omitempty"`
+}
+
+func BankInquiryID(bankCode string, accountNumber string) string {
+	return bankCode + ":" + accountNumber
+}
+
+// NameMatch compares the holder name answered by the inquiry with the name expected by the sender,
+// Score goes from 0 to 100
+type NameMatch struct {
+	Expected    string `json:"expected" bson:"expected,omitempty"`
+	AccountName string `json:"account_name" bson:"account_name,omitempty"`
+	Score       int    `json:"score" bson:"score"`
+	Decision    string `json:"decision" bson:"decision,omitempty"`
+	Reason      string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
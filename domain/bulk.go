@@ -55,6 +55,8 @@ type Inquiry struct {
 	BankName      string `json:"bank_name" bson:"bank_name"`
 	Valid         bool   `json:"valid"  bson:"valid"`
 	Reason        string `json:"reason"  bson:"reason"`
+	NameScore     int    `json:"name_score" bson:"name_score"`
+	NameDecision  string `json:"name_decision,omitempty" bson:"name_decision,omitempty"`
 }
 
 // Interface for mongo document result
@@ -12,6 +12,8 @@ type CallbackHistory struct {
 	RequestBody     string             `json:"request_body" bson:"request_body,omitempty"`
 	ResponseBody    string             `json:"response_body" bson:"response_body,omitempty"`
 	ResponseStatus  string             `json:"response_status" bson:"response_status,omitempty"`
+	WebhookID       primitive.ObjectID `json:"webhook_id" bson:"webhook_id,omitempty"`
+	Attempt         int                `json:"attempt" bson:"attempt,omitempty"`
 }
 
 // Interface for mongo document result
@@ -16,6 +16,9 @@ type Corporate struct {
 	MainBalance primitive.ObjectID `json:"main_balance" bson:"main_balance"`
 	ListBalance []AccessBalance    `json:"list_balance" bson:"list_balance"`
 
+	// SuspenseBalance holds the payments received for the corporate that could not be credited
+	SuspenseBalance primitive.ObjectID `json:"suspense_balance" bson:"suspense_balance,omitempty"`
+
 	FeeCorporate Fee `json:"fee_corporate" bson:"fee_corporate"` // null if corporate is principal
 	FeeUser      Fee `json:"fee_user" bson:"fee_user"`
 
@@ -61,6 +64,7 @@ type Corporate struct {
 	FeeTransfer               int                  `json:"fee_transfer" bson:"fee_transfer,omitempty"`
 }
 
+// Fee is the fixed fee charged when no FeeSchedule of the payer is effective
 type Fee struct {
 	Topup             int    `json:"topup" bson:"topup,omitempty"`
 	Deduct            int    `json:"deduct" bson:"deduct,omitempty"`
@@ -0,0 +1,24 @@
+package dto
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type BalanceReplay struct {
+	BalanceID      primitive.ObjectID      `json:"balance_id"`
+	CorporateID    primitive.ObjectID      `json:"corporate_id"`
+	Name           string                  `json:"name"`
+	Currency       string                  `json:"currency"`
+	At             string                  `json:"at"`
+	Amount         int                     `json:"amount"`
+	StatementCount int                     `json:"statement_count"`
+	Mismatches     []BalanceReplayMismatch `json:"mismatches"`
+}
+
+// Mismatch is recorded where the drift between stored and replayed running balance changes
+type BalanceReplayMismatch struct {
+	StatementID primitive.ObjectID `json:"statement_id"`
+	Reference   string             `json:"reference"`
+	Time        string             `json:"time"`
+	Stored      int                `json:"stored"`
+	Replayed    int                `json:"replayed"`
+	Difference  int                `json:"difference"`
+}
@@ -0,0 +1,31 @@
+package dto
+
+// GatewayRoute is the order of gateways a transfer is sent through, gateways that are down are
+// kept at the end as a last resort
+type GatewayRoute struct {
+	Version  int      `json:"version"`
+	Rule     string   `json:"rule"`
+	Gateways []string `json:"gateways"`
+	Down     []string `json:"down"`
+}
+
+// GatewayHealthState is the breaker of a gateway and its calls within the rolling window
+type GatewayHealthState struct {
+	Gateway          string              `json:"gateway"`
+	State            string              `json:"state"`
+	Down             bool                `json:"down"`
+	Reason           string              `json:"reason"`
+	OpenUntil        string              `json:"open_until"`
+	Success          int                 `json:"success"`
+	Failure          int                 `json:"failure"`
+	AverageLatencyMs int64               `json:"average_latency_ms"`
+	Banks            []GatewayBankHealth `json:"banks"`
+}
+
+type GatewayBankHealth struct {
+	BankCode         string         `json:"bank_code"`
+	Success          int            `json:"success"`
+	Failure          int            `json:"failure"`
+	AverageLatencyMs int64          `json:"average_latency_ms"`
+	Errors           map[string]int `json:"errors"`
+}
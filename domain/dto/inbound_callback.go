@@ -0,0 +1,8 @@
+package dto
+
+import "github.com/kangdjoker/takeme-core/domain"
+
+type CallbackPaymentResult struct {
+	Transaction domain.Transaction `json:"transaction" bson:"transaction"`
+	Balance     domain.Balance     `json:"balance" bson:"balance"`
+}
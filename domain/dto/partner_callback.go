@@ -0,0 +1,8 @@
+package dto
+
+type PartnerDeliveryReport struct {
+	Checked   int `json:"checked"`
+	Delivered int `json:"delivered"`
+	Pending   int `json:"pending"`
+	Failed    int `json:"failed"`
+}
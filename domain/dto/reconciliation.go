@@ -0,0 +1,15 @@
+package dto
+
+import "github.com/kangdjoker/takeme-core/domain"
+
+type ReconciliationReport struct {
+	RunID               string                       `json:"run_id"`
+	From                string                       `json:"from"`
+	To                  string                       `json:"to"`
+	BalancesChecked     int                          `json:"balances_checked"`
+	TransactionsChecked int                          `json:"transactions_checked"`
+	RollbacksChecked    int                          `json:"rollbacks_checked"`
+	Critical            int                          `json:"critical"`
+	Warning             int                          `json:"warning"`
+	Issues              []domain.ReconciliationIssue `json:"issues"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+type TransferRequeryReport struct {
+	Checked   int `json:"checked"`
+	Resolved  int `json:"resolved"`
+	Pending   int `json:"pending"`
+	Escalated int `json:"escalated"`
+}
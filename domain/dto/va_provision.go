@@ -0,0 +1,8 @@
+package dto
+
+type VAProvisionReport struct {
+	Checked int `json:"checked"`
+	Active  int `json:"active"`
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+type WebhookReport struct {
+	Checked   int `json:"checked"`
+	Delivered int `json:"delivered"`
+	Pending   int `json:"pending"`
+	Dead      int `json:"dead"`
+}
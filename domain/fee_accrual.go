@@ -0,0 +1,31 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const FEE_ACCRUAL_COLLECTION string = "fee_accrual"
+
+// FeeAccrual is the net fee a corporate paid to ReceiverID for one transaction type in a month,
+// Period is formatted as 2006-01
+type FeeAccrual struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Period          string             `json:"period" bson:"period,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	ReceiverID      primitive.ObjectID `json:"receiver_id" bson:"receiver_id,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Currency        string             `json:"currency" bson:"currency,omitempty"`
+	Count           int                `json:"count" bson:"count"`
+	Amount          int                `json:"amount" bson:"amount"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *FeeAccrual) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *FeeAccrual) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *FeeAccrual) CollectionName() string {
+	return FEE_ACCRUAL_COLLECTION
+}
@@ -0,0 +1,57 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const FEE_QUOTE_COLLECTION string = "fee_quote"
+
+const (
+	FEE_QUOTE_ACTIVE_STATUS  = "Active"
+	FEE_QUOTE_USED_STATUS    = "Used"
+	FEE_QUOTE_EXPIRED_STATUS = "Expired"
+)
+
+// FeeQuote holds the fee shown for a transaction before it is made, a transaction executed with
+// the quote before ExpiredAt is charged exactly this fee
+type FeeQuote struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Payer           string             `json:"payer" bson:"payer,omitempty"`
+	PayerID         primitive.ObjectID `json:"payer_id" bson:"payer_id,omitempty"`
+	FromBalanceID   primitive.ObjectID `json:"from_balance_id" bson:"from_balance_id,omitempty"`
+	Destination     string             `json:"destination" bson:"destination,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Currency        string             `json:"currency" bson:"currency,omitempty"`
+	SubAmount       int                `json:"sub_amount" bson:"sub_amount"`
+	TotalFee        int                `json:"total_fee" bson:"total_fee"`
+	TotalDebit      int                `json:"total_debit" bson:"total_debit"`
+	NetCredit       int                `json:"net_credit" bson:"net_credit"`
+	CreditCurrency  string             `json:"credit_currency" bson:"credit_currency,omitempty"`
+	Legs            []FeeQuoteLeg      `json:"legs" bson:"legs"`
+	DetailsFee      []DetailFee        `json:"-" bson:"details_fee"`
+	FeeWaivers      []FeeWaiver        `json:"fee_waivers,omitempty" bson:"fee_waivers,omitempty"`
+	Status          string             `json:"status" bson:"status,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+	ExpiredAt       string             `json:"expired_at" bson:"expired_at,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+}
+
+// FeeQuoteLeg is the fee one payer pays to CorporateID
+type FeeQuoteLeg struct {
+	Payer       string             `json:"payer" bson:"payer,omitempty"`
+	PayerID     primitive.ObjectID `json:"payer_id" bson:"payer_id,omitempty"`
+	CorporateID primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Amount      int                `json:"amount" bson:"amount"`
+	Details     []DetailFee        `json:"details" bson:"details"`
+}
+
+func (domain *FeeQuote) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *FeeQuote) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *FeeQuote) CollectionName() string {
+	return FEE_QUOTE_COLLECTION
+}
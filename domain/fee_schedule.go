@@ -0,0 +1,80 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const FEE_SCHEDULE_COLLECTION string = "fee_schedule"
+
+// Level a fee schedule is attached at, a schedule of the user wins over one of its corporate,
+// which wins over one of the principal
+const (
+	FEE_LEVEL_PRINCIPAL = "PRINCIPAL"
+	FEE_LEVEL_CORPORATE = "CORPORATE"
+	FEE_LEVEL_USER      = "USER"
+)
+
+const (
+	FEE_COMPONENT_FLAT       = "FLAT"
+	FEE_COMPONENT_PERCENTAGE = "PERCENTAGE"
+	FEE_COMPONENT_MIN_CAP    = "MIN_CAP"
+	FEE_COMPONENT_MAX_CAP    = "MAX_CAP"
+)
+
+// FeeSchedule prices one transaction type for one payer, ACTOR_TYPE_USER pays its corporate and
+// ACTOR_TYPE_CORPORATE pays its parent. Amounts are in the unit of the bare int fields of Transaction.
+// The tier with the highest FromAmount not above the sub amount replaces Flat and Percentage, the sum
+// is then kept within MinFee and MaxFee. A later EffectiveAt of the same owner replaces the schedule.
+type FeeSchedule struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Level           string             `json:"level" bson:"level,omitempty"`
+	OwnerID         primitive.ObjectID `json:"owner_id" bson:"owner_id,omitempty"`
+	Payer           string             `json:"payer" bson:"payer,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Currency        string             `json:"currency" bson:"currency,omitempty"`
+	Flat            int                `json:"flat" bson:"flat"`
+	Percentage      string             `json:"percentage" bson:"percentage,omitempty"`
+	Tiers           []FeeTier          `json:"tiers" bson:"tiers,omitempty"`
+	MinFee          int                `json:"min_fee" bson:"min_fee"`
+	MaxFee          int                `json:"max_fee" bson:"max_fee"`
+	EffectiveAt     string             `json:"effective_at" bson:"effective_at,omitempty"`
+	Active          bool               `json:"active" bson:"active"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+type FeeTier struct {
+	FromAmount int    `json:"from_amount" bson:"from_amount"`
+	Flat       int    `json:"flat" bson:"flat"`
+	Percentage string `json:"percentage" bson:"percentage,omitempty"`
+}
+
+func (domain *FeeSchedule) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *FeeSchedule) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *FeeSchedule) CollectionName() string {
+	return FEE_SCHEDULE_COLLECTION
+}
+
+// FeeFromLegacy reads the fixed fee of a transaction type out of a corporate Fee
+func FeeFromLegacy(fee Fee, transactionType string) FeeSchedule {
+	schedule := FeeSchedule{TransactionType: transactionType, Active: true}
+
+	switch transactionType {
+	case TOPUP:
+		schedule.Flat = fee.Topup
+	case DEDUCT:
+		schedule.Flat = fee.Deduct
+	case TRANSFER_WALLET:
+		schedule.Flat = fee.TransferBalance
+	case TRANSFER_BANK, BILLER:
+		// billers have always been charged the transfer bank fee
+		schedule.Flat = fee.TransferBank
+	case ACCEPT_PAYMENT_CARD:
+		schedule.Percentage = fee.AcceptPaymentCard
+	}
+
+	return schedule
+}
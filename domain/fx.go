@@ -0,0 +1,80 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	FX_RATE_COLLECTION  string = "fx_rate"
+	FX_QUOTE_COLLECTION string = "fx_quote"
+)
+
+const (
+	FX_QUOTE_ACTIVE_STATUS  = "Active"
+	FX_QUOTE_USED_STATUS    = "Used"
+	FX_QUOTE_EXPIRED_STATUS = "Expired"
+)
+
+// FXRate is the price of one BaseCurrency in QuoteCurrency, valid from EffectiveAt until a later
+// rate of the same pair takes over. A rate without corporate applies to every corporate.
+type FXRate struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID   primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	BaseCurrency  string             `json:"base_currency" bson:"base_currency,omitempty"`
+	QuoteCurrency string             `json:"quote_currency" bson:"quote_currency,omitempty"`
+	Rate          string             `json:"rate" bson:"rate,omitempty"`
+	EffectiveAt   string             `json:"effective_at" bson:"effective_at,omitempty"`
+	Time          string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *FXRate) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *FXRate) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *FXRate) CollectionName() string {
+	return FX_RATE_COLLECTION
+}
+
+// FXQuote locks a rate for one conversion until ExpiredAt
+type FXQuote struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	RateID          primitive.ObjectID `json:"rate_id" bson:"rate_id,omitempty"`
+	FromBalanceID   primitive.ObjectID `json:"from_balance_id" bson:"from_balance_id,omitempty"`
+	ToBalanceID     primitive.ObjectID `json:"to_balance_id" bson:"to_balance_id,omitempty"`
+	FromCurrency    string             `json:"from_currency" bson:"from_currency,omitempty"`
+	ToCurrency      string             `json:"to_currency" bson:"to_currency,omitempty"`
+	Rate            string             `json:"rate" bson:"rate,omitempty"`
+	FromAmount      int                `json:"from_amount" bson:"from_amount"`
+	ToAmount        int                `json:"to_amount" bson:"to_amount"`
+	Status          string             `json:"status" bson:"status,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+	ExpiredAt       string             `json:"expired_at" bson:"expired_at,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+}
+
+func (domain *FXQuote) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *FXQuote) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *FXQuote) CollectionName() string {
+	return FX_QUOTE_COLLECTION
+}
+
+// TransactionFX is the conversion applied to a cross currency transaction. Sub amount, fee and
+// amount of the transaction stay in FromCurrency, the receiver is credited ToAmount.
+type TransactionFX struct {
+	QuoteID      primitive.ObjectID `json:"quote_id" bson:"quote_id,omitempty"`
+	RateID       primitive.ObjectID `json:"rate_id" bson:"rate_id,omitempty"`
+	Rate         string             `json:"rate" bson:"rate,omitempty"`
+	FromCurrency string             `json:"from_currency" bson:"from_currency,omitempty"`
+	ToCurrency   string             `json:"to_currency" bson:"to_currency,omitempty"`
+	FromAmount   int                `json:"from_amount" bson:"from_amount"`
+	ToAmount     int                `json:"to_amount" bson:"to_amount"`
+}
@@ -0,0 +1,37 @@
+package domain
+
+const (
+	GATEWAY_HEALTH_COLLECTION string = "gateway_health"
+	GATEWAY_METRIC_COLLECTION string = "gateway_metric"
+)
+
+const (
+	GATEWAY_BREAKER_CLOSED    = "CLOSED"
+	GATEWAY_BREAKER_OPEN      = "OPEN"
+	GATEWAY_BREAKER_HALF_OPEN = "HALF_OPEN"
+)
+
+// GatewayHealth tells whether a gateway should be avoided, its ID is the gateway code. Down is set
+// by an operator, State is the circuit breaker fed by the calls made to the gateway. An open breaker
+// lets one probe call through once OpenUntil, a unix second, has passed.
+type GatewayHealth struct {
+	ID        string `json:"code" bson:"_id"`
+	Down      bool   `json:"down" bson:"down"`
+	Reason    string `json:"reason" bson:"reason,omitempty"`
+	State     string `json:"state" bson:"state,omitempty"`
+	OpenUntil int64  `json:"open_until" bson:"open_until"`
+	Time      string `json:"time" bson:"time,omitempty"`
+}
+
+// GatewayMetric counts the calls made to a gateway for one bank within one minute, its ID is derived
+// from the three so concurrent calls meet on the same document
+type GatewayMetric struct {
+	ID        string         `json:"id" bson:"_id"`
+	Gateway   string         `json:"gateway" bson:"gateway,omitempty"`
+	BankCode  string         `json:"bank_code" bson:"bank_code,omitempty"`
+	Minute    int64          `json:"minute" bson:"minute"`
+	Success   int            `json:"success" bson:"success"`
+	Failure   int            `json:"failure" bson:"failure"`
+	LatencyMs int64          `json:"latency_ms" bson:"latency_ms"`
+	Errors    map[string]int `json:"errors" bson:"errors,omitempty"`
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const GATEWAY_ROUTING_COLLECTION string = "gateway_routing"
+
+// GatewayRouting is one version of the rules deciding which gateways a bank transfer is sent through.
+// Versions are never changed once published, the one activated last is in use.
+type GatewayRouting struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Version     int                `json:"version" bson:"version"`
+	Note        string             `json:"note" bson:"note,omitempty"`
+	Rules       []GatewayRule      `json:"rules" bson:"rules"`
+	Default     []string           `json:"default" bson:"default"`
+	Activation  int64              `json:"activation" bson:"activation"`
+	ActivatedAt string             `json:"activated_at" bson:"activated_at,omitempty"`
+	Time        string             `json:"time" bson:"time,omitempty"`
+}
+
+// GatewayRule routes the transfers matching all of its conditions to Gateways in order, a condition
+// left empty matches every transfer. The time of day is a 15:04 range that may wrap midnight and
+// WhenDown makes the rule apply only while one of those gateways is unhealthy.
+type GatewayRule struct {
+	Name         string               `json:"name" bson:"name,omitempty"`
+	BankCodes    []string             `json:"bank_codes" bson:"bank_codes,omitempty"`
+	CorporateIDs []primitive.ObjectID `json:"corporate_ids" bson:"corporate_ids,omitempty"`
+	MinAmount    int                  `json:"min_amount" bson:"min_amount"`
+	MaxAmount    int                  `json:"max_amount" bson:"max_amount"`
+	FromTime     string               `json:"from_time" bson:"from_time,omitempty"`
+	ToTime       string               `json:"to_time" bson:"to_time,omitempty"`
+	WhenDown     []string             `json:"when_down" bson:"when_down,omitempty"`
+	Gateways     []string             `json:"gateways" bson:"gateways"`
+}
+
+func (domain *GatewayRouting) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *GatewayRouting) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *GatewayRouting) CollectionName() string {
+	return GATEWAY_ROUTING_COLLECTION
+}
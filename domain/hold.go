@@ -0,0 +1,44 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const HOLD_COLLECTION string = "hold"
+
+const (
+	HOLD_ACTIVE_STATUS   = "Active"
+	HOLD_CAPTURED_STATUS = "Captured"
+	HOLD_RELEASED_STATUS = "Released"
+	HOLD_EXPIRED_STATUS  = "Expired"
+)
+
+// Hold reserves funds of a pending transaction. Its statements are only posted when the hold
+// is captured, a released or expired hold leaves no trace on the statement history. A hold past
+// its expiry whose transfer is still pending at a gateway is escalated once and kept active.
+type Hold struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	Status          string             `json:"status" bson:"status,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+	ExpiredAt       string             `json:"expired_at" bson:"expired_at,omitempty"`
+	SettledTime     string             `json:"settled_time" bson:"settled_time,omitempty"`
+	EscalatedTime   string             `json:"escalated_time" bson:"escalated_time,omitempty"`
+	Reserves        []HoldReserve      `json:"reserves" bson:"reserves"`
+	Statements      []Statement        `json:"statements" bson:"statements"`
+}
+
+type HoldReserve struct {
+	BalanceID primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	Amount    int                `json:"amount" bson:"amount"`
+}
+
+func (domain *Hold) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Hold) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Hold) CollectionName() string {
+	return HOLD_COLLECTION
+}
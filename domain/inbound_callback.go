@@ -0,0 +1,40 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson"
+
+const INBOUND_CALLBACK_COLLECTION string = "inbound_callback"
+
+const (
+	INBOUND_CALLBACK_RECEIVED   = "RECEIVED"
+	INBOUND_CALLBACK_PROCESSING = "PROCESSING"
+	INBOUND_CALLBACK_PROCESSED  = "PROCESSED"
+	INBOUND_CALLBACK_FAILED     = "FAILED"
+)
+
+const (
+	CALLBACK_EVENT_VA_PAID   = "VA_PAID"
+	CALLBACK_EVENT_CARD_PAID = "CARD_PAID"
+	CALLBACK_EVENT_TRANSFER  = "TRANSFER_"
+)
+
+// InboundCallback records a callback delivered by a gateway, its ID is the gateway code, the
+// gateway reference and the event so every retry of the provider meets the same document. The
+// result of the first successful processing is kept to answer the replays.
+type InboundCallback struct {
+	ID          string   `json:"id" bson:"_id"`
+	Gateway     string   `json:"gateway" bson:"gateway,omitempty"`
+	Reference   string   `json:"reference" bson:"reference,omitempty"`
+	Event       string   `json:"event" bson:"event,omitempty"`
+	Status      string   `json:"status" bson:"status"`
+	Attempts    int      `json:"attempts" bson:"attempts"`
+	Replays     int      `json:"replays" bson:"replays"`
+	LockedUntil int64    `json:"locked_until" bson:"locked_until"`
+	Error       string   `json:"error" bson:"error,omitempty"`
+	Result      bson.Raw `json:"-" bson:"result,omitempty"`
+	ProcessedAt string   `json:"processed_at" bson:"processed_at,omitempty"`
+	Time        string   `json:"time" bson:"time,omitempty"`
+}
+
+func InboundCallbackID(gateway string, reference string, event string) string {
+	return gateway + ":" + reference + ":" + event
+}
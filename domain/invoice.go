@@ -0,0 +1,67 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const INVOICE_COLLECTION string = "invoice"
+
+const (
+	INVOICE_ISSUED_STATUS  = "Issued"
+	INVOICE_PAID_STATUS    = "Paid"
+	INVOICE_OVERDUE_STATUS = "Overdue"
+	INVOICE_VOID_STATUS    = "Void"
+	INVOICE_CARRIED_STATUS = "Carried"
+)
+
+const INVOICE_LINE_CARRIED = "CARRIED"
+
+// Invoice bills a corporate for the fees it accrued to IssuerID in one month. A month netting to a
+// credit is kept Carried and its sub total is brought into the invoice of the next month.
+type Invoice struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Number      string             `json:"number" bson:"number,omitempty"`
+	Period      string             `json:"period" bson:"period,omitempty"`
+	CorporateID primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Name        string             `json:"name" bson:"name,omitempty"`
+	Address     string             `json:"address" bson:"address,omitempty"`
+	TaxID       string             `json:"tax_id" bson:"tax_id,omitempty"`
+	IssuerID    primitive.ObjectID `json:"issuer_id" bson:"issuer_id,omitempty"`
+	IssuerName  string             `json:"issuer_name" bson:"issuer_name,omitempty"`
+	IssuerTaxID string             `json:"issuer_tax_id" bson:"issuer_tax_id,omitempty"`
+	Currency    string             `json:"currency" bson:"currency,omitempty"`
+	Lines       []InvoiceLine      `json:"lines" bson:"lines"`
+	SubTotal    int                `json:"sub_total" bson:"sub_total"`
+	TaxLines    []InvoiceTaxLine   `json:"tax_lines" bson:"tax_lines"`
+	TotalTax    int                `json:"total_tax" bson:"total_tax"`
+	Total       int                `json:"total" bson:"total"`
+	Status      string             `json:"status" bson:"status,omitempty"`
+	IssuedAt    string             `json:"issued_at" bson:"issued_at,omitempty"`
+	DueAt       string             `json:"due_at" bson:"due_at,omitempty"`
+	PaidAt      string             `json:"paid_at" bson:"paid_at,omitempty"`
+	Time        string             `json:"time" bson:"time,omitempty"`
+}
+
+type InvoiceLine struct {
+	TransactionType string `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Description     string `json:"description" bson:"description,omitempty"`
+	Count           int    `json:"count" bson:"count"`
+	Amount          int    `json:"amount" bson:"amount"`
+}
+
+type InvoiceTaxLine struct {
+	Name   string `json:"name" bson:"name,omitempty"`
+	Rate   string `json:"rate" bson:"rate,omitempty"`
+	Base   int    `json:"base" bson:"base"`
+	Amount int    `json:"amount" bson:"amount"`
+}
+
+func (domain *Invoice) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Invoice) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Invoice) CollectionName() string {
+	return INVOICE_COLLECTION
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const JOURNAL_COLLECTION string = "journal"
+
+const (
+	JOURNAL_TYPE_COMMIT   = "COMMIT"
+	JOURNAL_TYPE_ROLLBACK = "ROLLBACK"
+)
+
+const (
+	JOURNAL_ACCOUNT_BALANCE  = "BALANCE"
+	JOURNAL_ACCOUNT_EXTERNAL = "EXTERNAL"
+	JOURNAL_ACCOUNT_FX       = "FX"
+)
+
+// Journal is the double-entry record of one commit. The withdraws and deposits
+// of its legs must net to zero for every currency.
+type Journal struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Type            string             `json:"type" bson:"type,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+	Legs            []JournalLeg       `json:"legs" bson:"legs"`
+}
+
+// JournalLeg is either a posting on a balance or the contra posting on an
+// external account (bank, card network, dashboard) that money enters or leaves through.
+type JournalLeg struct {
+	AccountType string             `json:"account_type" bson:"account_type,omitempty"`
+	BalanceID   primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	Account     string             `json:"account" bson:"account,omitempty"`
+	Type        string             `json:"type" bson:"type,omitempty"`
+	Reference   string             `json:"reference" bson:"reference,omitempty"`
+	Withdraw    int                `json:"withdraw" bson:"withdraw"`
+	Deposit     int                `json:"deposit" bson:"deposit"`
+	Currency    string             `json:"currency" bson:"currency,omitempty"`
+}
+
+// Interface for mongo document result
+func (domain *Journal) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Journal) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Journal) CollectionName() string {
+	return JOURNAL_COLLECTION
+}
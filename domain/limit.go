@@ -0,0 +1,63 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	LIMIT_COLLECTION       string = "limit"
+	LIMIT_USAGE_COLLECTION string = "limit_usage"
+)
+
+const (
+	LIMIT_VERIFIED   = "VERIFIED"
+	LIMIT_UNVERIFIED = "UNVERIFIED"
+)
+
+// Limit caps the transactions matching its scope. An empty scope field matches every value and a
+// zero cap means no cap. Daily and monthly caps are counted per balance.
+type Limit struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	BalanceID       primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Verification    string             `json:"verification" bson:"verification,omitempty"`
+	MinAmount       int                `json:"min_amount" bson:"min_amount"`
+	MaxAmount       int                `json:"max_amount" bson:"max_amount"`
+	DailyAmount     int                `json:"daily_amount" bson:"daily_amount"`
+	DailyCount      int                `json:"daily_count" bson:"daily_count"`
+	MonthlyAmount   int                `json:"monthly_amount" bson:"monthly_amount"`
+	MonthlyCount    int                `json:"monthly_count" bson:"monthly_count"`
+	Active          bool               `json:"active" bson:"active"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *Limit) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Limit) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Limit) CollectionName() string {
+	return LIMIT_COLLECTION
+}
+
+// LimitUsage is the amount and count used of one limit by one balance within a period,
+// its ID is derived from the three so concurrent commits meet on the same document
+type LimitUsage struct {
+	ID        string             `json:"id" bson:"_id"`
+	LimitID   primitive.ObjectID `json:"limit_id" bson:"limit_id,omitempty"`
+	BalanceID primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	Period    string             `json:"period" bson:"period,omitempty"`
+	Amount    int                `json:"amount" bson:"amount"`
+	Count     int                `json:"count" bson:"count"`
+}
+
+// The balance a transaction is limited on, the one it is paid from or for a topup the one it fills
+func LimitBalanceID(transaction Transaction) primitive.ObjectID {
+	if transaction.Type == TOPUP || transaction.Type == DEDUCT {
+		return transaction.ToBalanceID
+	}
+
+	return transaction.FromBalanceID
+}
@@ -0,0 +1,272 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	CURRENCY_IDR = "IDR"
+	CURRENCY_USD = "USD"
+)
+
+// ISO-4217 minor unit exponent of the currencies we settle
+var currencyExponent = map[string]int{
+	"AED": 2,
+	"AUD": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"MYR": 2,
+	"PHP": 2,
+	"SAR": 2,
+	"SGD": 2,
+	"THB": 2,
+	"TWD": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+// Exponent of the bare int amounts stored before Money existed. IDR was always kept in whole
+// rupiah, other currencies were charged through Stripe in their ISO minor unit.
+var legacyExponent = map[string]int{
+	"IDR": 0,
+}
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrMoneyOverflow    = errors.New("money overflow")
+	ErrInvalidRate      = errors.New("invalid rate")
+)
+
+// Money is an amount in the minor unit of its ISO-4217 currency
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// NormalizeCurrency turns stored codes like "idr" into ISO-4217, documents without currency are IDR
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return CURRENCY_IDR
+	}
+
+	return currency
+}
+
+func IsSameCurrency(a string, b string) bool {
+	return NormalizeCurrency(a) == NormalizeCurrency(b)
+}
+
+func Currencies() []string {
+	currencies := []string{}
+	for currency := range currencyExponent {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	return currencies
+}
+
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponent[NormalizeCurrency(currency)]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+
+	return exponent, nil
+}
+
+func NewMoney(amount int64, currency string) (Money, error) {
+	currency = NormalizeCurrency(currency)
+	_, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MoneyFromLegacy reads a bare int amount of a stored document
+func MoneyFromLegacy(amount int, currency string) (Money, error) {
+	money, err := NewMoney(int64(amount), currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return money.Multiply(pow10(money.Exponent() - money.legacyExponent()))
+}
+
+// Legacy returns the amount in the unit of the bare int fields, rounding half to even
+func (money Money) Legacy() int {
+	divisor := pow10(money.Exponent() - money.legacyExponent())
+	rounded, _ := roundHalfEven(new(big.Rat).SetFrac(big.NewInt(money.Amount), big.NewInt(divisor)))
+
+	return int(rounded)
+}
+
+func (money Money) Exponent() int {
+	exponent, _ := CurrencyExponent(money.Currency)
+	return exponent
+}
+
+// LegacyExponent is the exponent of the bare int amounts stored in the currency
+func LegacyExponent(currency string) int {
+	return Money{Currency: NormalizeCurrency(currency)}.legacyExponent()
+}
+
+func (money Money) legacyExponent() int {
+	exponent, ok := legacyExponent[NormalizeCurrency(money.Currency)]
+	if !ok {
+		return money.Exponent()
+	}
+
+	return exponent
+}
+
+// roundLegacy rounds value, an amount in the minor unit of the currency of money, half to even on
+// the unit of the bare int fields
+func (money Money) roundLegacy(value *big.Rat) (Money, error) {
+	scale := pow10(money.Exponent() - money.legacyExponent())
+	amount, err := roundHalfEven(value.Quo(value, new(big.Rat).SetInt64(scale)))
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: amount, Currency: money.Currency}.Multiply(scale)
+}
+
+func (money Money) Add(other Money) (Money, error) {
+	if !IsSameCurrency(money.Currency, other.Currency) {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	if (other.Amount > 0 && money.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && money.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: money.Amount + other.Amount, Currency: money.Currency}, nil
+}
+
+func (money Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return money.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+func (money Money) Multiply(factor int64) (Money, error) {
+	result := new(big.Int).Mul(big.NewInt(money.Amount), big.NewInt(factor))
+	if !result.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: result.Int64(), Currency: money.Currency}, nil
+}
+
+// MultiplyRate applies a decimal rate such as "0.029", rounding half to even once on the unit of the
+// bare int fields so Legacy of the result is exact
+func (money Money) MultiplyRate(rate string) (Money, error) {
+	ratio, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok {
+		return Money{}, ErrInvalidRate
+	}
+
+	return money.roundLegacy(ratio.Mul(ratio, new(big.Rat).SetInt64(money.Amount)))
+}
+
+// Convert applies a rate quoted in major units, 1 money.Currency = rate currency, rounding like
+// MultiplyRate
+func (money Money) Convert(currency string, rate string) (Money, error) {
+	target, err := NewMoney(0, currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	ratio, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || ratio.Sign() <= 0 {
+		return Money{}, ErrInvalidRate
+	}
+
+	value := new(big.Rat).Mul(ratio, new(big.Rat).SetInt64(money.Amount))
+	value.Mul(value, new(big.Rat).SetFrac(big.NewInt(pow10(target.Exponent())), big.NewInt(pow10(money.Exponent()))))
+
+	return target.roundLegacy(value)
+}
+
+// InverseRate turns the rate of base to quote into the rate of quote to base
+func InverseRate(rate string) (string, error) {
+	ratio, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || ratio.Sign() <= 0 {
+		return "", ErrInvalidRate
+	}
+
+	return ratio.Inv(ratio).FloatString(12), nil
+}
+
+func (money Money) IsZero() bool {
+	return money.Amount == 0
+}
+
+func (money Money) IsNegative() bool {
+	return money.Amount < 0
+}
+
+func (money Money) String() string {
+	exponent := money.Exponent()
+	if exponent == 0 {
+		return fmt.Sprintf("%v %d", money.Currency, money.Amount)
+	}
+
+	sign := ""
+	amount := new(big.Int).SetInt64(money.Amount)
+	if amount.Sign() < 0 {
+		sign = "-"
+		amount.Neg(amount)
+	}
+
+	unit, fraction := new(big.Int).QuoRem(amount, big.NewInt(pow10(exponent)), new(big.Int))
+	return fmt.Sprintf("%v %v%v.%0*d", money.Currency, sign, unit, exponent, fraction.Int64())
+}
+
+func roundHalfEven(value *big.Rat) (int64, error) {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+
+	// compare twice the remainder against the denominator to find which half we are in
+	twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+	compare := twice.Cmp(value.Denom())
+	if compare > 0 || (compare == 0 && quotient.Bit(0) == 1) {
+		if value.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if !quotient.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+
+	return quotient.Int64(), nil
+}
+
+func pow10(exponent int) int64 {
+	result := int64(1)
+	for i := 0; i < exponent; i++ {
+		result = result * 10
+	}
+
+	return result
+}
@@ -0,0 +1,160 @@
+package domain
+
+import "testing"
+
+func TestMoneyFromLegacy(t *testing.T) {
+	tests := []struct {
+		amount   int
+		currency string
+		minor    int64
+	}{
+		{amount: 10000, currency: "idr", minor: 1000000},
+		{amount: 1050, currency: CURRENCY_USD, minor: 1050},
+		{amount: 300, currency: "JPY", minor: 300},
+	}
+
+	for _, test := range tests {
+		money, err := MoneyFromLegacy(test.amount, test.currency)
+		if err != nil {
+			t.Fatalf("MoneyFromLegacy(%v, %v): %v", test.amount, test.currency, err)
+		}
+		if money.Amount != test.minor {
+			t.Errorf("MoneyFromLegacy(%v, %v) = %v, want %v", test.amount, test.currency, money.Amount, test.minor)
+		}
+		if money.Legacy() != test.amount {
+			t.Errorf("Legacy of %v = %v, want %v", money, money.Legacy(), test.amount)
+		}
+	}
+
+	_, err := MoneyFromLegacy(100, "XXX")
+	if err != ErrUnknownCurrency {
+		t.Errorf("MoneyFromLegacy of unknown currency = %v, want %v", err, ErrUnknownCurrency)
+	}
+}
+
+func TestLegacyExponent(t *testing.T) {
+	tests := map[string]int{"idr": 0, CURRENCY_USD: 2, "JPY": 0, "": 0}
+
+	for currency, exponent := range tests {
+		if LegacyExponent(currency) != exponent {
+			t.Errorf("LegacyExponent(%q) = %v, want %v", currency, LegacyExponent(currency), exponent)
+		}
+	}
+}
+
+func TestMoneyLegacyRoundsHalfToEven(t *testing.T) {
+	tests := []struct {
+		minor  int64
+		legacy int
+	}{
+		{minor: 149, legacy: 1},
+		{minor: 150, legacy: 2},
+		{minor: 250, legacy: 2},
+		{minor: 251, legacy: 3},
+		{minor: -250, legacy: -2},
+		{minor: -350, legacy: -4},
+	}
+
+	for _, test := range tests {
+		money := Money{Amount: test.minor, Currency: CURRENCY_IDR}
+		if money.Legacy() != test.legacy {
+			t.Errorf("Legacy of %v = %v, want %v", money, money.Legacy(), test.legacy)
+		}
+	}
+}
+
+func TestMoneyMultiplyRate(t *testing.T) {
+	tests := []struct {
+		legacy   int
+		currency string
+		rate     string
+		want     int
+	}{
+		// 1.495 rounds once to 1, rounding first to 1.50 would charge 2
+		{legacy: 299, currency: CURRENCY_IDR, rate: "0.005", want: 1},
+		{legacy: 300, currency: CURRENCY_IDR, rate: "0.005", want: 2},
+		{legacy: 500, currency: CURRENCY_IDR, rate: "0.005", want: 2},
+		{legacy: 100000, currency: CURRENCY_IDR, rate: "0.11", want: 11000},
+		{legacy: 1000, currency: CURRENCY_USD, rate: "0.029", want: 29},
+		{legacy: 1050, currency: CURRENCY_USD, rate: "0.029", want: 30},
+		{legacy: 1000, currency: CURRENCY_USD, rate: "0", want: 0},
+	}
+
+	for _, test := range tests {
+		money, err := MoneyFromLegacy(test.legacy, test.currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := money.MultiplyRate(test.rate)
+		if err != nil {
+			t.Fatalf("%v MultiplyRate(%v): %v", money, test.rate, err)
+		}
+		if result.Legacy() != test.want {
+			t.Errorf("%v MultiplyRate(%v) = %v, want %v", money, test.rate, result.Legacy(), test.want)
+		}
+	}
+
+	_, err := Money{Amount: 100, Currency: CURRENCY_IDR}.MultiplyRate("2%")
+	if err != ErrInvalidRate {
+		t.Errorf("MultiplyRate of invalid rate = %v, want %v", err, ErrInvalidRate)
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		money    Money
+		currency string
+		rate     string
+		want     int
+	}{
+		{money: Money{Amount: 100, Currency: CURRENCY_USD}, currency: CURRENCY_IDR, rate: "15500", want: 15500},
+		// 1.495 rupiah rounds once to 1
+		{money: Money{Amount: 1, Currency: CURRENCY_USD}, currency: CURRENCY_IDR, rate: "149.5", want: 1},
+		{money: Money{Amount: 1550000, Currency: CURRENCY_IDR}, currency: CURRENCY_USD, rate: "0.0000645", want: 100},
+	}
+
+	for _, test := range tests {
+		result, err := test.money.Convert(test.currency, test.rate)
+		if err != nil {
+			t.Fatalf("%v Convert(%v, %v): %v", test.money, test.currency, test.rate, err)
+		}
+		if result.Currency != test.currency || result.Legacy() != test.want {
+			t.Errorf("%v Convert(%v, %v) = %v, want %v", test.money, test.currency, test.rate, result, test.want)
+		}
+	}
+
+	_, err := Money{Amount: 100, Currency: CURRENCY_USD}.Convert(CURRENCY_IDR, "-1")
+	if err != ErrInvalidRate {
+		t.Errorf("Convert with negative rate = %v, want %v", err, ErrInvalidRate)
+	}
+}
+
+func TestMoneyAddCurrencyMismatch(t *testing.T) {
+	_, err := Money{Amount: 100, Currency: CURRENCY_IDR}.Add(Money{Amount: 100, Currency: CURRENCY_USD})
+	if err != ErrCurrencyMismatch {
+		t.Errorf("Add of another currency = %v, want %v", err, ErrCurrencyMismatch)
+	}
+
+	sum, err := Money{Amount: 100, Currency: "idr"}.Add(Money{Amount: 50, Currency: CURRENCY_IDR})
+	if err != nil || sum.Amount != 150 {
+		t.Errorf("Add = %v %v, want 150", sum, err)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: Money{Amount: 1050, Currency: CURRENCY_USD}, want: "USD 10.50"},
+		{money: Money{Amount: -5, Currency: CURRENCY_USD}, want: "USD -0.05"},
+		{money: Money{Amount: 300, Currency: "JPY"}, want: "JPY 300"},
+	}
+
+	for _, test := range tests {
+		if test.money.String() != test.want {
+			t.Errorf("String = %v, want %v", test.money.String(), test.want)
+		}
+	}
+}
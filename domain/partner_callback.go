@@ -0,0 +1,81 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const PARTNER_CALLBACK_COLLECTION string = "partner_callback"
+const PARTNER_DELIVERY_COLLECTION string = "partner_delivery"
+
+const (
+	PARTNER_DELIVERY_PENDING   = "PENDING"
+	PARTNER_DELIVERY_DELIVERED = "DELIVERED"
+	PARTNER_DELIVERY_FAILED    = "FAILED"
+)
+
+// PartnerCallback is a partner sharing our gateway accounts, the gateway callbacks matching one of its
+// rules are its own and are forwarded to URL signed with Secret instead of being processed here
+type PartnerCallback struct {
+	ID          primitive.ObjectID    `json:"id" bson:"_id,omitempty"`
+	Name        string                `json:"name" bson:"name,omitempty"`
+	URL         string                `json:"url" bson:"url,omitempty"`
+	Secret      string                `json:"-" bson:"secret,omitempty"`
+	Rules       []PartnerCallbackRule `json:"rules" bson:"rules"`
+	Active      bool                  `json:"active" bson:"active"`
+	CreatedTime string                `json:"created_time" bson:"created_time,omitempty"`
+	Time        string                `json:"time" bson:"time,omitempty"`
+}
+
+// PartnerCallbackRule matches the routing key of a callback, the external id of a VA payment or the
+// transaction code of a transfer, by Prefix or by the regular expression Pattern. Gateway and Event,
+// a prefix of the callback event, narrow the rule when set.
+type PartnerCallbackRule struct {
+	Gateway string `json:"gateway" bson:"gateway,omitempty"`
+	Event   string `json:"event" bson:"event,omitempty"`
+	Prefix  string `json:"prefix" bson:"prefix,omitempty"`
+	Pattern string `json:"pattern" bson:"pattern,omitempty"`
+}
+
+// PartnerDelivery is a callback forwarded to a partner, its ID is the partner, the gateway, the event
+// and the gateway reference so the retries of the provider are forwarded once. It is posted again
+// once NextAt, a unix second, has passed and fails for good after too many attempts.
+type PartnerDelivery struct {
+	ID             string                   `json:"id" bson:"_id"`
+	PartnerID      primitive.ObjectID       `json:"partner_id" bson:"partner_id,omitempty"`
+	Gateway        string                   `json:"gateway" bson:"gateway,omitempty"`
+	Event          string                   `json:"event" bson:"event,omitempty"`
+	Key            string                   `json:"key" bson:"key,omitempty"`
+	Reference      string                   `json:"reference" bson:"reference,omitempty"`
+	Payload        string                   `json:"payload" bson:"payload,omitempty"`
+	Status         string                   `json:"status" bson:"status"`
+	Attempts       int                      `json:"attempts" bson:"attempts"`
+	NextAt         int64                    `json:"next_at" bson:"next_at"`
+	LastStatusCode int                      `json:"last_status_code" bson:"last_status_code,omitempty"`
+	LastError      string                   `json:"last_error" bson:"last_error,omitempty"`
+	Log            []PartnerDeliveryAttempt `json:"log" bson:"log,omitempty"`
+	DeliveredAt    string                   `json:"delivered_at" bson:"delivered_at,omitempty"`
+	Time           string                   `json:"time" bson:"time,omitempty"`
+}
+
+// PartnerDeliveryAttempt is one post of the callback to the partner and its answer
+type PartnerDeliveryAttempt struct {
+	StatusCode int    `json:"status_code" bson:"status_code,omitempty"`
+	Response   string `json:"response" bson:"response,omitempty"`
+	Error      string `json:"error" bson:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms" bson:"duration_ms"`
+	Time       string `json:"time" bson:"time,omitempty"`
+}
+
+func PartnerDeliveryID(partnerID primitive.ObjectID, gateway string, event string, reference string) string {
+	return partnerID.Hex() + ":" + gateway + ":" + event + ":" + reference
+}
+
+func (domain *PartnerCallback) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *PartnerCallback) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *PartnerCallback) CollectionName() string {
+	return PARTNER_CALLBACK_COLLECTION
+}
@@ -0,0 +1,64 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	PROMOTION_COLLECTION       string = "promotion"
+	PROMOTION_USAGE_COLLECTION string = "promotion_usage"
+)
+
+const (
+	PROMOTION_QUOTA_MONTHLY  = "MONTHLY"
+	PROMOTION_QUOTA_CAMPAIGN = "CAMPAIGN"
+)
+
+// Promotion waives the fee CorporateID receives from a payer for transactions made between StartAt
+// and EndAt. Quota is the number of waived transactions per payer in the quota period and Budget the
+// total fee the campaign may waive, zero means no cap. An empty transaction type matches every type.
+type Promotion struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name            string             `json:"name" bson:"name,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Payer           string             `json:"payer" bson:"payer,omitempty"`
+	TransactionType string             `json:"transaction_type" bson:"transaction_type,omitempty"`
+	Currency        string             `json:"currency" bson:"currency,omitempty"`
+	StartAt         string             `json:"start_at" bson:"start_at,omitempty"`
+	EndAt           string             `json:"end_at" bson:"end_at,omitempty"`
+	Quota           int                `json:"quota" bson:"quota"`
+	QuotaPeriod     string             `json:"quota_period" bson:"quota_period,omitempty"`
+	Budget          int                `json:"budget" bson:"budget"`
+	Spent           int                `json:"spent" bson:"spent"`
+	Active          bool               `json:"active" bson:"active"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *Promotion) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Promotion) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Promotion) CollectionName() string {
+	return PROMOTION_COLLECTION
+}
+
+// PromotionUsage counts the transactions one payer had waived by a promotion within a period
+type PromotionUsage struct {
+	ID          string             `json:"id" bson:"_id"`
+	PromotionID primitive.ObjectID `json:"promotion_id" bson:"promotion_id,omitempty"`
+	PayerID     primitive.ObjectID `json:"payer_id" bson:"payer_id,omitempty"`
+	Period      string             `json:"period" bson:"period,omitempty"`
+	Count       int                `json:"count" bson:"count"`
+}
+
+// FeeWaiver records the fee leg of a transaction a promotion did not charge
+type FeeWaiver struct {
+	PromotionID primitive.ObjectID `json:"promotion_id" bson:"promotion_id,omitempty"`
+	Payer       string             `json:"payer" bson:"payer,omitempty"`
+	PayerID     primitive.ObjectID `json:"payer_id" bson:"payer_id,omitempty"`
+	CorporateID primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Amount      int                `json:"amount" bson:"amount"`
+	UsageID     string             `json:"-" bson:"usage_id,omitempty"`
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const RECONCILIATION_ISSUE_COLLECTION string = "reconciliation_issue"
+
+const (
+	RECONCILIATION_SEVERITY_CRITICAL = "CRITICAL"
+	RECONCILIATION_SEVERITY_WARNING  = "WARNING"
+)
+
+const (
+	RECONCILIATION_BALANCE_DRIFT                 = "BALANCE_DRIFT"
+	RECONCILIATION_MISSING_TRANSACTION_STATEMENT = "MISSING_TRANSACTION_STATEMENT"
+	RECONCILIATION_MISSING_FEE_STATEMENT         = "MISSING_FEE_STATEMENT"
+	RECONCILIATION_UNBALANCED_FEE_STATEMENT      = "UNBALANCED_FEE_STATEMENT"
+	RECONCILIATION_ORPHAN_ROLLBACK               = "ORPHAN_ROLLBACK"
+	RECONCILIATION_DUPLICATE_ROLLBACK            = "DUPLICATE_ROLLBACK"
+	RECONCILIATION_MISSING_ROLLBACK              = "MISSING_ROLLBACK"
+)
+
+type ReconciliationIssue struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RunID           string             `json:"run_id" bson:"run_id,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+	Type            string             `json:"type" bson:"type,omitempty"`
+	Severity        string             `json:"severity" bson:"severity,omitempty"`
+	BalanceID       primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	Reference       string             `json:"reference" bson:"reference,omitempty"`
+	Expected        int                `json:"expected" bson:"expected"`
+	Actual          int                `json:"actual" bson:"actual"`
+	Description     string             `json:"description" bson:"description,omitempty"`
+}
+
+func CreateReconciliationIssue(runID string, issueType string, severity string, description string) ReconciliationIssue {
+	return ReconciliationIssue{
+		RunID:       runID,
+		Time:        time.Now().Format(os.Getenv("TIME_FORMAT")),
+		Type:        issueType,
+		Severity:    severity,
+		Description: description,
+	}
+}
+
+// Interface for mongo document result
+func (domain *ReconciliationIssue) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *ReconciliationIssue) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *ReconciliationIssue) CollectionName() string {
+	return RECONCILIATION_ISSUE_COLLECTION
+}
@@ -8,15 +8,19 @@ const (
 	STATEMENT_TYPE_TRANSACTION = "TRANSACTION"
 )
 
+const STATEMENT_ROLLBACK_SUFFIX = ":rollback"
+
 type Statement struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	BalanceID   primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	JournalID   primitive.ObjectID `json:"journal_id" bson:"journal_id,omitempty"`
 	Time        string             `json:"time" bson:"time,omitempty"`
 	Description string             `json:"description" bson:"description,omitempty"`
 	Reference   string             `json:"reference" bson:"reference,omitempty"`
 	Withdraw    int                `json:"withdraw" bson:"withdraw"`
 	Deposit     int                `json:"deposit" bson:"deposit"`
 	Balance     int                `json:"balance" bson:"balance"`
+	Currency    string             `json:"currency" bson:"currency,omitempty"`
 	Type        string             `json:"type" bson:"type,omitempty"`
 }
 
@@ -0,0 +1,50 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const SUSPENSE_ITEM_COLLECTION string = "suspense_item"
+
+// An open item waits on the suspense balance until an operator assigns or refunds it
+const (
+	SUSPENSE_OPEN     = "OPEN"
+	SUSPENSE_ASSIGNED = "ASSIGNED"
+	SUSPENSE_REFUNDED = "REFUNDED"
+)
+
+// SuspenseItem is an incoming payment credited to the suspense balance of the corporate because the
+// balance it was meant for could not be found or credited. TransactionCode is the SUSPENSE_IN that
+// booked it, ResolutionTransactionCode the transfer that assigned or refunded it.
+type SuspenseItem struct {
+	ID                        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID               primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	BalanceID                 primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	Gateway                   string             `json:"gateway" bson:"gateway,omitempty"`
+	Reference                 string             `json:"reference" bson:"reference,omitempty"`
+	ExternalID                string             `json:"external_id" bson:"external_id,omitempty"`
+	AccountNumber             string             `json:"account_number" bson:"account_number,omitempty"`
+	InvoiceID                 primitive.ObjectID `json:"invoice_id" bson:"invoice_id,omitempty"`
+	From                      TransactionObject  `json:"from" bson:"from"`
+	Amount                    int                `json:"amount" bson:"amount"`
+	Currency                  string             `json:"currency" bson:"currency,omitempty"`
+	Reason                    string             `json:"reason" bson:"reason,omitempty"`
+	Status                    string             `json:"status" bson:"status,omitempty"`
+	TransactionCode           string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	ResolutionTransactionCode string             `json:"resolution_transaction_code" bson:"resolution_transaction_code,omitempty"`
+	AssignedBalanceID         primitive.ObjectID `json:"assigned_balance_id" bson:"assigned_balance_id,omitempty"`
+	Note                      string             `json:"note" bson:"note,omitempty"`
+	ResolvedBy                ActorObject        `json:"resolved_by" bson:"resolved_by,omitempty"`
+	ResolvedAt                string             `json:"resolved_at" bson:"resolved_at,omitempty"`
+	Time                      string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *SuspenseItem) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *SuspenseItem) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *SuspenseItem) CollectionName() string {
+	return SUSPENSE_ITEM_COLLECTION
+}
@@ -22,6 +22,9 @@ const (
 	TRANSFER_BANK       = "TRANSFER_TO_BANK"
 	PAY_QR              = "PAY_QR"
 	BILLER              = "PAY_BILLER"
+	SWEEP_BALANCE       = "SWEEP_BALANCE"
+	SUSPENSE_IN         = "SUSPENSE_IN"
+	SUSPENSE_ASSIGN     = "SUSPENSE_ASSIGN"
 )
 
 const (
@@ -101,7 +104,14 @@ type Transaction struct {
 	GatewayReference  string             `json:"gateway_reference" bson:"gateway_reference"`
 	GatewayStrategies []GatewayStrategy  `json:"gateway_strategies" bson:"gateway_strategies"`
 	GatewayHistories  []GatewayHistory   `json:"gateway_histories" bson:"gateway_histories"`
+	GatewayRouting    int                `json:"gateway_routing,omitempty" bson:"gateway_routing,omitempty"`
 	Currency          string             `json:"currency" bson:"currency,omitempty"`
+	FX                *TransactionFX     `json:"fx,omitempty" bson:"fx,omitempty"`
+	LimitUsages       []string           `json:"-" bson:"limit_usages,omitempty"`
+	FeeQuoteID        string             `json:"fee_quote_id,omitempty" bson:"fee_quote_id,omitempty"`
+	FeeWaivers        []FeeWaiver        `json:"fee_waivers,omitempty" bson:"fee_waivers,omitempty"`
+	PromotionUsages   []string           `json:"-" bson:"promotion_usages,omitempty"`
+	NameMatch         *NameMatch         `json:"name_match,omitempty" bson:"name_match,omitempty"`
 	RequestId         string             `json:"request_id" bson:"request_id,omitempty"`
 }
 
@@ -118,8 +128,12 @@ func (model *Transaction) CollectionName() string {
 	return TRANSACTION_COLLECTION
 }
 
+// DetailFee is one component of a fee leg, CorporateID receives it from Payer
 type DetailFee struct {
 	CorporateID primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Payer       string             `json:"payer" bson:"payer,omitempty"`
+	PayerID     primitive.ObjectID `json:"payer_id" bson:"payer_id,omitempty"`
+	ScheduleID  primitive.ObjectID `json:"schedule_id" bson:"schedule_id,omitempty"`
 	Name        string             `json:"name" bson:"name,omitempty"`
 	Amount      int                `json:"amount" bson:"amount"`
 }
@@ -0,0 +1,25 @@
+package domain
+
+const TRANSFER_REQUERY_COLLECTION string = "transfer_requery"
+
+const (
+	REQUERY_ACTIVE    = "ACTIVE"
+	REQUERY_ESCALATED = "ESCALATED"
+	REQUERY_RESOLVED  = "RESOLVED"
+)
+
+// TransferRequery follows a pending bank transfer whose callback did not come, its ID is the
+// transaction code. The gateway is asked again once NextAt, a unix second, has passed and after
+// too many attempts the transfer is escalated for manual review.
+type TransferRequery struct {
+	ID              string `json:"transaction_code" bson:"_id"`
+	Gateway         string `json:"gateway" bson:"gateway,omitempty"`
+	Reference       string `json:"reference" bson:"reference,omitempty"`
+	Status          string `json:"status" bson:"status"`
+	Attempts        int    `json:"attempts" bson:"attempts"`
+	NextAt          int64  `json:"next_at" bson:"next_at"`
+	GatewayStatus   string `json:"gateway_status" bson:"gateway_status,omitempty"`
+	LastError       string `json:"last_error" bson:"last_error,omitempty"`
+	EscalatedReason string `json:"escalated_reason" bson:"escalated_reason,omitempty"`
+	Time            string `json:"time" bson:"time,omitempty"`
+}
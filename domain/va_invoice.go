@@ -0,0 +1,72 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const VA_INVOICE_COLLECTION string = "va_invoice"
+
+// A pending invoice waits for its payment, it leaves pending only once
+const (
+	VA_INVOICE_PENDING   = "PENDING"
+	VA_INVOICE_PAID      = "PAID"
+	VA_INVOICE_EXPIRED   = "EXPIRED"
+	VA_INVOICE_CANCELLED = "CANCELLED"
+	VA_INVOICE_SUSPENDED = "SUSPENDED"
+)
+
+// What to do with a payment that does not match the invoice
+const (
+	VA_INVOICE_MISMATCH_REJECT  = "REJECT"
+	VA_INVOICE_MISMATCH_SUSPEND = "SUSPEND"
+)
+
+const (
+	VA_INVOICE_PAYMENT_ACCEPTED  = "ACCEPTED"
+	VA_INVOICE_PAYMENT_REJECTED  = "REJECTED"
+	VA_INVOICE_PAYMENT_SUSPENDED = "SUSPENDED"
+)
+
+// VAInvoice is a one-off VA closed to Amount that credits BalanceID when paid before ExpiresAt.
+// ExternalID is the reference of the corporate, unique per corporate.
+type VAInvoice struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	BalanceID       primitive.ObjectID `json:"balance_id" bson:"balance_id,omitempty"`
+	ExternalID      string             `json:"external_id" bson:"external_id,omitempty"`
+	Name            string             `json:"name" bson:"name,omitempty"`
+	BankCode        string             `json:"bank_code" bson:"bank_code,omitempty"`
+	Provider        string             `json:"provider" bson:"provider,omitempty"`
+	AccountNumber   string             `json:"account_number" bson:"account_number,omitempty"`
+	Reference       string             `json:"-" bson:"reference,omitempty"`
+	Amount          int                `json:"amount" bson:"amount"`
+	Currency        string             `json:"currency" bson:"currency,omitempty"`
+	OnMismatch      string             `json:"on_mismatch" bson:"on_mismatch,omitempty"`
+	Status          string             `json:"status" bson:"status,omitempty"`
+	ExpiresAt       string             `json:"expires_at" bson:"expires_at,omitempty"`
+	ExpiresAtUnix   int64              `json:"-" bson:"expires_at_unix"`
+	Payments        []VAInvoicePayment `json:"payments" bson:"payments,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	PaidAt          string             `json:"paid_at" bson:"paid_at,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+// VAInvoicePayment is one payment received on the invoice VA and what became of it
+type VAInvoicePayment struct {
+	Reference       string `json:"reference" bson:"reference,omitempty"`
+	Amount          int    `json:"amount" bson:"amount"`
+	Status          string `json:"status" bson:"status,omitempty"`
+	Reason          string `json:"reason" bson:"reason,omitempty"`
+	TransactionCode string `json:"transaction_code" bson:"transaction_code,omitempty"`
+	Time            string `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *VAInvoice) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *VAInvoice) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *VAInvoice) CollectionName() string {
+	return VA_INVOICE_COLLECTION
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const VA_PROVISION_COLLECTION string = "va_provision"
+
+const (
+	VA_PENDING = "PENDING"
+	VA_ACTIVE  = "ACTIVE"
+	VA_FAILED  = "FAILED"
+	VA_CLOSED  = "CLOSED"
+)
+
+// Account number older balances got when Xendit failed, it is not a real account
+const VA_LEGACY_PLACEHOLDER = "Call administrator for fix this"
+
+// VAProvision is the virtual account of one bank for a balance, its ID is balance:bank. A pending
+// account is created at its provider once NextAt, a unix second, has passed and fails after too many
+// attempts. Only active accounts are copied to the balance.
+type VAProvision struct {
+	ID            string             `json:"id" bson:"_id"`
+	BalanceID     primitive.ObjectID `json:"balance_id" bson:"balance_id"`
+	BankCode      string             `json:"bank_code" bson:"bank_code"`
+	Provider      string             `json:"provider" bson:"provider"`
+	Name          string             `json:"name" bson:"name"`
+	Status        string             `json:"status" bson:"status"`
+	AccountNumber string             `json:"account_number" bson:"account_number,omitempty"`
+	Reference     string             `json:"reference" bson:"reference,omitempty"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	NextAt        int64              `json:"next_at" bson:"next_at"`
+	LastError     string             `json:"last_error" bson:"last_error,omitempty"`
+	Time          string             `json:"time" bson:"time,omitempty"`
+}
+
+func VAProvisionID(balanceID primitive.ObjectID, bankCode string) string {
+	return balanceID.Hex() + ":" + bankCode
+}
+
+func (domain VAProvision) ToVirtualAccount() VirtualAccount {
+	return VirtualAccount{
+		BankCode:      domain.BankCode,
+		AccountNumber: domain.AccountNumber,
+	}
+}
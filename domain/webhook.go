@@ -0,0 +1,51 @@
+package domain
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const WEBHOOK_COLLECTION string = "webhook_outbox"
+
+const (
+	WEBHOOK_PENDING   = "PENDING"
+	WEBHOOK_DELIVERED = "DELIVERED"
+	WEBHOOK_DEAD      = "DEAD"
+)
+
+const (
+	WEBHOOK_EVENT_TOPUP          = "TOPUP"
+	WEBHOOK_EVENT_DEDUCT         = "DEDUCT"
+	WEBHOOK_EVENT_TRANSFER       = "TRANSFER"
+	WEBHOOK_EVENT_ACCEPT_PAYMENT = "ACCEPT_PAYMENT"
+	WEBHOOK_EVENT_VA_INVOICE     = "VA_INVOICE"
+	WEBHOOK_EVENT_BULK           = "BULK"
+)
+
+// Webhook is a callback to a corporate waiting in the outbox, TransactionCode is the transaction it
+// tells about or the bulk id of a bulk callback. It is posted again once NextAt, a unix second, has
+// passed and is dead after too many attempts until an operator redelivers it.
+type Webhook struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CorporateID     primitive.ObjectID `json:"corporate_id" bson:"corporate_id,omitempty"`
+	Event           string             `json:"event" bson:"event,omitempty"`
+	TransactionCode string             `json:"transaction_code" bson:"transaction_code,omitempty"`
+	URL             string             `json:"url" bson:"url,omitempty"`
+	Payload         string             `json:"payload" bson:"payload,omitempty"`
+	Status          string             `json:"status" bson:"status"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	NextAt          int64              `json:"next_at" bson:"next_at"`
+	LastStatusCode  int                `json:"last_status_code" bson:"last_status_code,omitempty"`
+	LastError       string             `json:"last_error" bson:"last_error,omitempty"`
+	DeliveredAt     string             `json:"delivered_at" bson:"delivered_at,omitempty"`
+	Time            string             `json:"time" bson:"time,omitempty"`
+}
+
+func (domain *Webhook) SetDocumentID(ID primitive.ObjectID) {
+	domain.ID = ID
+}
+
+func (domain *Webhook) GetDocumentID() primitive.ObjectID {
+	return domain.ID
+}
+
+func (domain *Webhook) CollectionName() string {
+	return WEBHOOK_COLLECTION
+}
@@ -1,9 +1,13 @@
 package service
 
 import (
+	"context"
+
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -87,11 +91,200 @@ func BalanceByIDNoSession(ID string) (domain.Balance, error) {
 	return model, nil
 }
 
+func BalancesNoSession(paramLog *basic.ParamLog) ([]domain.Balance, error) {
+	var results []domain.Balance
+	cursor, err := database.FindAscendingByID(paramLog, domain.BALANCE_COLLECTION, bson.M{})
+	if err != nil {
+		return []domain.Balance{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func BalancesByCorporateIDNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID) ([]domain.Balance, error) {
+	query := bson.M{"corporate_id": corporateID}
+
+	var results []domain.Balance
+	cursor, err := database.FindAscendingByID(paramLog, domain.BALANCE_COLLECTION, query)
+	if err != nil {
+		return []domain.Balance{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func BalancesByIDsNoSession(paramLog *basic.ParamLog, IDs []primitive.ObjectID) ([]domain.Balance, error) {
+	query := bson.M{"_id": bson.M{"$in": IDs}}
+
+	var results []domain.Balance
+	cursor, err := database.FindAscendingByID(paramLog, domain.BALANCE_COLLECTION, query)
+	if err != nil {
+		return []domain.Balance{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// BalanceUpdate only writes when nobody changed the balance since it was read
 func BalanceUpdate(paramLog *basic.ParamLog, model domain.Balance, session mongo.SessionContext) error {
-	err := database.SessionUpdateOne(paramLog, &model, session)
+	filter := bson.M{"version": balanceVersionQuery(model.Version)}
+	model.Version = model.Version + 1
+
+	result, err := database.SessionUpdateOneWithFilter(paramLog, &model, filter, session)
 	if err != nil {
+		if database.IsWriteConflict(err) {
+			return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Balance write conflict "+model.ID.Hex())
+		}
 		return err
 	}
 
+	if result.MatchedCount == 0 {
+		return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Balance version changed "+model.ID.Hex())
+	}
+
 	return nil
 }
+
+// BalanceIncrement atomically adds amount (negative for withdraw), a withdraw only matches
+// when the available amount still covers it and neither matches a balance whose status blocks it.
+// Returns mongo.ErrNoDocuments when a guard fails.
+func BalanceIncrement(paramLog *basic.ParamLog, ID primitive.ObjectID, amount int, session mongo.SessionContext) (domain.Balance, error) {
+	filter := bson.M{"_id": ID, "status": bson.M{"$nin": domain.BalanceCreditBlockedStatuses}}
+	if amount < 0 {
+		filter["$expr"] = availableAtLeast(-amount)
+		filter["status"] = bson.M{"$nin": domain.BalanceDebitBlockedStatuses}
+	}
+
+	update := bson.M{"$inc": bson.M{"amount": amount, "version": 1}}
+
+	return balanceFindOneAndUpdate(paramLog, ID, filter, update, session)
+}
+
+// BalanceReserve moves amount from available to held when the available amount covers it
+func BalanceReserve(paramLog *basic.ParamLog, ID primitive.ObjectID, amount int, session mongo.SessionContext) (domain.Balance, error) {
+	filter := bson.M{"_id": ID, "$expr": availableAtLeast(amount), "status": bson.M{"$nin": domain.BalanceDebitBlockedStatuses}}
+	update := bson.M{"$inc": bson.M{"held": amount, "version": 1}}
+
+	return balanceFindOneAndUpdate(paramLog, ID, filter, update, session)
+}
+
+func BalanceReleaseReserve(paramLog *basic.ParamLog, ID primitive.ObjectID, amount int, session mongo.SessionContext) (domain.Balance, error) {
+	filter := bson.M{"_id": ID, "held": bson.M{"$gte": amount}}
+	update := bson.M{"$inc": bson.M{"held": -amount, "version": 1}}
+
+	return balanceFindOneAndUpdate(paramLog, ID, filter, update, session)
+}
+
+// BalanceCaptureReserve withdraws amount that was held before
+func BalanceCaptureReserve(paramLog *basic.ParamLog, ID primitive.ObjectID, amount int, session mongo.SessionContext) (domain.Balance, error) {
+	filter := bson.M{"_id": ID, "held": bson.M{"$gte": amount}}
+	update := bson.M{"$inc": bson.M{"amount": -amount, "held": -amount, "version": 1}}
+
+	return balanceFindOneAndUpdate(paramLog, ID, filter, update, session)
+}
+
+// BalanceUpdateStatus moves a balance out of status from, returns mongo.ErrNoDocuments when
+// the balance is not in that status anymore
+func BalanceUpdateStatus(paramLog *basic.ParamLog, ID primitive.ObjectID, from string, to string,
+	session mongo.SessionContext) (domain.Balance, error) {
+	filter := bson.M{"_id": ID, "status": balanceStatusQuery(from)}
+	update := bson.M{"$set": bson.M{"status": to}, "$inc": bson.M{"version": 1}}
+
+	return balanceFindOneAndUpdate(paramLog, ID, filter, update, session)
+}
+
+func balanceFindOneAndUpdate(paramLog *basic.ParamLog, ID primitive.ObjectID, filter bson.M, update bson.M,
+	session mongo.SessionContext) (domain.Balance, error) {
+	model := domain.Balance{}
+	err := database.SessionFindOneAndUpdate(domain.BALANCE_COLLECTION, filter, update, session).Decode(&model)
+	if err != nil {
+		if database.IsWriteConflict(err) {
+			return domain.Balance{}, utils.ErrorConflict(paramLog, utils.BalanceConflict, "Balance write conflict "+ID.Hex())
+		}
+		return domain.Balance{}, err
+	}
+
+	return model, nil
+}
+
+func availableAtLeast(amount int) bson.M {
+	return bson.M{"$gte": bson.A{
+		bson.M{"$subtract": bson.A{"$amount", bson.M{"$ifNull": bson.A{"$held", 0}}}},
+		amount,
+	}}
+}
+
+// Documents created before the status field existed are active
+func balanceStatusQuery(status string) interface{} {
+	if status == domain.BALANCE_STATUS_ACTIVE {
+		return bson.M{"$in": bson.A{domain.BALANCE_STATUS_ACTIVE, nil}}
+	}
+
+	return status
+}
+
+// Documents created before the version field existed have no version at all
+func balanceVersionQuery(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+
+	return version
+}
+
+// BalanceSetVA replaces the virtual account of the bank shown on the balance
+func BalanceSetVA(paramLog *basic.ParamLog, ID primitive.ObjectID, va domain.VirtualAccount) error {
+	err := BalanceRemoveVA(paramLog, ID, va.BankCode)
+	if err != nil {
+		return err
+	}
+
+	changes := bson.D{
+		{Key: "$push", Value: bson.M{"va": va}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	_, err = database.Update(paramLog, domain.BALANCE_COLLECTION, bson.M{"_id": ID}, changes)
+
+	return err
+}
+
+func BalanceRemoveVA(paramLog *basic.ParamLog, ID primitive.ObjectID, bankCode string) error {
+	changes := bson.D{
+		{Key: "$pull", Value: bson.M{"va": bson.M{"bank_code": bankCode}}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	_, err := database.Update(paramLog, domain.BALANCE_COLLECTION, bson.M{"_id": ID}, changes)
+
+	return err
+}
+
+// BalancesWithVANumberNoSession finds the balances showing the account number on one of their VA
+func BalancesWithVANumberNoSession(paramLog *basic.ParamLog, accountNumber string) ([]domain.Balance, error) {
+	var results []domain.Balance
+	cursor, err := database.FindAscendingByID(paramLog, domain.BALANCE_COLLECTION, bson.M{"va.account_number": accountNumber})
+	if err != nil {
+		return []domain.Balance{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func BalanceStatusAuditSaveOne(model *domain.BalanceStatusAudit, session mongo.SessionContext) error {
+	err := database.SessionSaveOne(model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func BalanceStatusAuditsByBalanceID(paramLog *basic.ParamLog, balanceID primitive.ObjectID) ([]domain.BalanceStatusAudit, error) {
+	query := bson.M{"balance_id": balanceID}
+
+	var results []domain.BalanceStatusAudit
+	cursor, err := database.FindAscendingByID(paramLog, domain.BALANCE_STATUS_AUDIT_COLLECTION, query)
+	if err != nil {
+		return []domain.BalanceStatusAudit{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.BalanceStatusAudit{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BankInquiryCachedNoSession returns the cached inquiry of the account when it has not expired at now,
+// mongo.ErrNoDocuments otherwise
+func BankInquiryCachedNoSession(bankCode string, accountNumber string, now int64) (domain.BankInquiry, error) {
+	model := domain.BankInquiry{}
+	query := bson.M{"_id": domain.BankInquiryID(bankCode, accountNumber), "expires_at": bson.M{"$gt": now}}
+	err := database.FindOne(domain.BANK_INQUIRY_COLLECTION, query).Decode(&model)
+	if err != nil {
+		return domain.BankInquiry{}, err
+	}
+
+	return model, nil
+}
+
+func BankInquirySet(paramLog *basic.ParamLog, model domain.BankInquiry) error {
+	update := bson.M{"$set": bson.M{
+		"bank_code":      model.BankCode,
+		"account_number": model.AccountNumber,
+		"account_name":   model.AccountName,
+		"valid":          model.Valid,
+		"error_code":     model.ErrorCode,
+		"expires_at":     model.ExpiresAt,
+		"time":           model.Time,
+	}}
+
+	return database.UpsertQuery(paramLog, domain.BANK_INQUIRY_COLLECTION, bson.M{"_id": model.ID}, update)
+}
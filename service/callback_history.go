@@ -1,12 +1,16 @@
 package service
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func CreateCallbackHistoryRefused(paramLog *basic.ParamLog, transactionCode string, url string, requestBody string) (domain.CallbackHistory, error) {
@@ -53,3 +57,40 @@ func CallbackHistorySaveOne(paramLog *basic.ParamLog, model *domain.CallbackHist
 
 	return nil
 }
+
+// CreateWebhookCallbackHistory records one attempt of an outbox webhook
+func CreateWebhookCallbackHistory(paramLog *basic.ParamLog, webhook domain.Webhook, attempt int, responseBody string,
+	responseStatus string) (domain.CallbackHistory, error) {
+	model := domain.CallbackHistory{
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+		URL:             webhook.URL,
+		RequestBody:     webhook.Payload,
+		TransactionCode: webhook.TransactionCode,
+		ResponseBody:    responseBody,
+		ResponseStatus:  responseStatus,
+		WebhookID:       webhook.ID,
+		Attempt:         attempt,
+	}
+
+	err := CallbackHistorySaveOne(paramLog, &model)
+	if err != nil {
+		return domain.CallbackHistory{}, err
+	}
+
+	return model, nil
+}
+
+func CallbackHistoriesByWebhookNoSession(paramLog *basic.ParamLog, webhookID primitive.ObjectID) ([]domain.CallbackHistory, error) {
+	var results []domain.CallbackHistory
+	cursor, err := database.FindAscendingByID(paramLog, domain.CALLBACK_HISTORY_COLLECTION, bson.M{"webhook_id": webhookID})
+	if err != nil {
+		return []domain.CallbackHistory{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.CallbackHistory{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
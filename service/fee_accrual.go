@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FeeAccrualUpsert replaces the accrual of the same period, corporate, receiver, type and currency
+func FeeAccrualUpsert(paramLog *basic.ParamLog, model *domain.FeeAccrual) error {
+	filter := bson.M{
+		"period":           model.Period,
+		"corporate_id":     model.CorporateID,
+		"receiver_id":      model.ReceiverID,
+		"transaction_type": model.TransactionType,
+		"currency":         model.Currency,
+	}
+
+	err := database.UpsertOne(paramLog, domain.FEE_ACCRUAL_COLLECTION, filter, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FeeAccrualsByPeriodNoSession(paramLog *basic.ParamLog, period string) ([]domain.FeeAccrual, error) {
+	query := bson.M{"period": period}
+
+	var results []domain.FeeAccrual
+	cursor, err := database.FindAscendingByID(paramLog, domain.FEE_ACCRUAL_COLLECTION, query)
+	if err != nil {
+		return []domain.FeeAccrual{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.FeeAccrual{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
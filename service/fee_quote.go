@@ -0,0 +1,45 @@
+package service
+
+import (
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func FeeQuoteSaveOne(paramLog *basic.ParamLog, model *domain.FeeQuote) error {
+	err := database.SaveOne(paramLog, domain.FEE_QUOTE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FeeQuoteByIDNoSession(ID string) (domain.FeeQuote, error) {
+	model := domain.FeeQuote{}
+	cursor := database.FindOneByID(domain.FEE_QUOTE_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	return model, nil
+}
+
+// FeeQuoteUse marks an active quote as used by the transaction, it returns mongo.ErrNoDocuments
+// when the quote was used already
+func FeeQuoteUse(quoteID primitive.ObjectID, transactionCode string, session mongo.SessionContext) (domain.FeeQuote, error) {
+	filter := bson.M{"_id": quoteID, "status": domain.FEE_QUOTE_ACTIVE_STATUS}
+	update := bson.M{"$set": bson.M{"status": domain.FEE_QUOTE_USED_STATUS, "transaction_code": transactionCode}}
+
+	model := domain.FeeQuote{}
+	err := database.SessionFindOneAndUpdate(domain.FEE_QUOTE_COLLECTION, filter, update, session).Decode(&model)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	return model, nil
+}
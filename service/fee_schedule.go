@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func FeeScheduleSaveOne(paramLog *basic.ParamLog, model *domain.FeeSchedule) error {
+	err := database.SaveOne(paramLog, domain.FEE_SCHEDULE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FeeScheduleUpdateOne(paramLog *basic.ParamLog, model *domain.FeeSchedule) error {
+	err := database.UpdateOne(paramLog, domain.FEE_SCHEDULE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FeeSchedulesActiveNoSession returns every active version the owner set for the payer and transaction type
+func FeeSchedulesActiveNoSession(paramLog *basic.ParamLog, level string, ownerID primitive.ObjectID, payer string,
+	transactionType string) ([]domain.FeeSchedule, error) {
+	query := bson.M{
+		"active":           true,
+		"level":            level,
+		"owner_id":         ownerID,
+		"payer":            payer,
+		"transaction_type": transactionType,
+	}
+
+	var results []domain.FeeSchedule
+	cursor, err := database.Find(paramLog, domain.FEE_SCHEDULE_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.FeeSchedule{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.FeeSchedule{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func FXRateSaveOne(paramLog *basic.ParamLog, model *domain.FXRate) error {
+	err := database.SaveOne(paramLog, domain.FX_RATE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FXRatesByPairNoSession returns every version of a pair set for the corporate
+func FXRatesByPairNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, baseCurrency string,
+	quoteCurrency string) ([]domain.FXRate, error) {
+	query := bson.M{
+		"corporate_id":   bson.M{"$eq": corporateID},
+		"base_currency":  baseCurrency,
+		"quote_currency": quoteCurrency,
+	}
+	if corporateID.IsZero() {
+		query["corporate_id"] = bson.M{"$exists": false}
+	}
+
+	var results []domain.FXRate
+	cursor, err := database.Find(paramLog, domain.FX_RATE_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.FXRate{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.FXRate{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func FXQuoteSaveOne(paramLog *basic.ParamLog, model *domain.FXQuote) error {
+	err := database.SaveOne(paramLog, domain.FX_QUOTE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FXQuoteByIDNoSession(ID string) (domain.FXQuote, error) {
+	model := domain.FXQuote{}
+	cursor := database.FindOneByID(domain.FX_QUOTE_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.FXQuote{}, err
+	}
+
+	return model, nil
+}
+
+// FXQuoteUse marks an active quote as used by the transaction, it returns mongo.ErrNoDocuments
+// when the quote was used already
+func FXQuoteUse(quoteID primitive.ObjectID, transactionCode string, session mongo.SessionContext) (domain.FXQuote, error) {
+	filter := bson.M{"_id": quoteID, "status": domain.FX_QUOTE_ACTIVE_STATUS}
+	update := bson.M{"$set": bson.M{"status": domain.FX_QUOTE_USED_STATUS, "transaction_code": transactionCode}}
+
+	model := domain.FXQuote{}
+	err := database.SessionFindOneAndUpdate(domain.FX_QUOTE_COLLECTION, filter, update, session).Decode(&model)
+	if err != nil {
+		return domain.FXQuote{}, err
+	}
+
+	return model, nil
+}
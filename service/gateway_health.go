@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func GatewayHealthSet(paramLog *basic.ParamLog, model domain.GatewayHealth) error {
+	filter := bson.M{"_id": model.ID}
+	update := bson.M{
+		"$set":         bson.M{"down": model.Down, "reason": model.Reason, "time": model.Time},
+		"$setOnInsert": bson.M{"state": domain.GATEWAY_BREAKER_CLOSED, "open_until": 0},
+	}
+
+	return database.UpsertQuery(paramLog, domain.GATEWAY_HEALTH_COLLECTION, filter, update)
+}
+
+func GatewayHealthByCodeNoSession(code string) (domain.GatewayHealth, error) {
+	model := domain.GatewayHealth{}
+	err := database.FindOne(domain.GATEWAY_HEALTH_COLLECTION, bson.M{"_id": code}).Decode(&model)
+	if err != nil {
+		return domain.GatewayHealth{}, err
+	}
+
+	return model, nil
+}
+
+func GatewayHealthsNoSession(paramLog *basic.ParamLog) ([]domain.GatewayHealth, error) {
+	var results []domain.GatewayHealth
+	cursor, err := database.FindAscendingByID(paramLog, domain.GATEWAY_HEALTH_COLLECTION, bson.M{})
+	if err != nil {
+		return []domain.GatewayHealth{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.GatewayHealth{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// GatewayBreakerChange moves the breaker to state only when it is in one of the from states, a
+// gateway never tracked starts closed. It tells whether this call made the change.
+func GatewayBreakerChange(paramLog *basic.ParamLog, code string, from []string, state string, openUntil int64, time string) (bool, error) {
+	err := database.UpsertQuery(paramLog, domain.GATEWAY_HEALTH_COLLECTION, bson.M{"_id": code},
+		bson.M{"$setOnInsert": bson.M{"down": false, "state": domain.GATEWAY_BREAKER_CLOSED, "open_until": 0}})
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"_id": code, "state": bson.M{"$in": from}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"state": state, "open_until": openUntil, "time": time}}}
+
+	result, err := database.Update(paramLog, domain.GATEWAY_HEALTH_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// GatewayBreakerProbe half opens a breaker whose open time has passed, only one caller wins the
+// probe until openUntil
+func GatewayBreakerProbe(paramLog *basic.ParamLog, code string, now int64, openUntil int64, time string) (bool, error) {
+	filter := bson.M{
+		"_id":        code,
+		"state":      bson.M{"$in": bson.A{domain.GATEWAY_BREAKER_OPEN, domain.GATEWAY_BREAKER_HALF_OPEN}},
+		"open_until": bson.M{"$lte": now},
+	}
+	changes := bson.D{{Key: "$set", Value: bson.M{"state": domain.GATEWAY_BREAKER_HALF_OPEN, "open_until": openUntil, "time": time}}}
+
+	result, err := database.Update(paramLog, domain.GATEWAY_HEALTH_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func GatewayMetricRecord(paramLog *basic.ParamLog, model domain.GatewayMetric, errorCode string) error {
+	increment := bson.M{"success": model.Success, "failure": model.Failure, "latency_ms": model.LatencyMs}
+	if errorCode != "" {
+		increment["errors."+errorCode] = 1
+	}
+
+	update := bson.M{
+		"$inc": increment,
+		"$setOnInsert": bson.M{
+			"gateway":   model.Gateway,
+			"bank_code": model.BankCode,
+			"minute":    model.Minute,
+		},
+	}
+
+	return database.UpsertQuery(paramLog, domain.GATEWAY_METRIC_COLLECTION, bson.M{"_id": model.ID}, update)
+}
+
+// GatewayMetricsSinceNoSession returns the metrics of the minutes from since on, of every gateway
+// when gateway is empty
+func GatewayMetricsSinceNoSession(paramLog *basic.ParamLog, gateway string, since int64) ([]domain.GatewayMetric, error) {
+	query := bson.M{"minute": bson.M{"$gte": since}}
+	if gateway != "" {
+		query["gateway"] = gateway
+	}
+
+	var results []domain.GatewayMetric
+	cursor, err := database.FindAscendingByID(paramLog, domain.GATEWAY_METRIC_COLLECTION, query)
+	if err != nil {
+		return []domain.GatewayMetric{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.GatewayMetric{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func GatewayRoutingSaveOne(paramLog *basic.ParamLog, model *domain.GatewayRouting) error {
+	err := database.SaveOne(paramLog, domain.GATEWAY_ROUTING_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GatewayRoutingActiveNoSession returns the version activated last
+func GatewayRoutingActiveNoSession() (domain.GatewayRouting, error) {
+	model := domain.GatewayRouting{}
+	err := database.FindOneSorted(domain.GATEWAY_ROUTING_COLLECTION, bson.M{}, bson.D{{Key: "activation", Value: -1}}).Decode(&model)
+	if err != nil {
+		return domain.GatewayRouting{}, err
+	}
+
+	return model, nil
+}
+
+func GatewayRoutingLatestNoSession() (domain.GatewayRouting, error) {
+	model := domain.GatewayRouting{}
+	err := database.FindOneSorted(domain.GATEWAY_ROUTING_COLLECTION, bson.M{}, bson.D{{Key: "version", Value: -1}}).Decode(&model)
+	if err != nil {
+		return domain.GatewayRouting{}, err
+	}
+
+	return model, nil
+}
+
+func GatewayRoutingByVersionNoSession(version int) (domain.GatewayRouting, error) {
+	model := domain.GatewayRouting{}
+	err := database.FindOne(domain.GATEWAY_ROUTING_COLLECTION, bson.M{"version": version}).Decode(&model)
+	if err != nil {
+		return domain.GatewayRouting{}, err
+	}
+
+	return model, nil
+}
+
+func GatewayRoutingsNoSession(paramLog *basic.ParamLog) ([]domain.GatewayRouting, error) {
+	var results []domain.GatewayRouting
+	cursor, err := database.FindAscendingByID(paramLog, domain.GATEWAY_ROUTING_COLLECTION, bson.M{})
+	if err != nil {
+		return []domain.GatewayRouting{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.GatewayRouting{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func GatewayRoutingActivate(paramLog *basic.ParamLog, model domain.GatewayRouting) error {
+	update := bson.M{"$set": bson.M{"activation": model.Activation, "activated_at": model.ActivatedAt}}
+
+	return database.UpdateQuery(paramLog, domain.GATEWAY_ROUTING_COLLECTION, model.ID, update)
+}
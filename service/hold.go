@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateHold(transactionCode string, time string, expiredAt string, statements []domain.Statement) domain.Hold {
+	reserves := []domain.HoldReserve{}
+	for _, statement := range statements {
+		if statement.Withdraw == 0 {
+			continue
+		}
+
+		found := false
+		for index, reserve := range reserves {
+			if reserve.BalanceID == statement.BalanceID {
+				reserves[index].Amount = reserve.Amount + statement.Withdraw
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			reserves = append(reserves, domain.HoldReserve{
+				BalanceID: statement.BalanceID,
+				Amount:    statement.Withdraw,
+			})
+		}
+	}
+
+	return domain.Hold{
+		TransactionCode: transactionCode,
+		Status:          domain.HOLD_ACTIVE_STATUS,
+		Time:            time,
+		ExpiredAt:       expiredAt,
+		Reserves:        reserves,
+		Statements:      statements,
+	}
+}
+
+func HoldSaveOne(model *domain.Hold, session mongo.SessionContext) error {
+	err := database.SessionSaveOne(model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func HoldByID(ID string, session mongo.SessionContext) (domain.Hold, error) {
+	model := domain.Hold{}
+	cursor := database.SessionFindOneByID(domain.HOLD_COLLECTION, ID, session)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	return model, nil
+}
+
+func HoldByTransactionCodeNoSession(paramLog *basic.ParamLog, transactionCode string) (domain.Hold, error) {
+	var hold domain.Hold
+	query := bson.M{"transaction_code": transactionCode}
+	cursor := database.FindOne(domain.HOLD_COLLECTION, query)
+	err := cursor.Decode(&hold)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	return hold, nil
+}
+
+func HoldsActiveNoSession(paramLog *basic.ParamLog) ([]domain.Hold, error) {
+	query := bson.M{"status": domain.HOLD_ACTIVE_STATUS}
+
+	var results []domain.Hold
+	cursor, err := database.Find(paramLog, domain.HOLD_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.Hold{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Hold{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func HoldUpdateOne(paramLog *basic.ParamLog, model *domain.Hold, session mongo.SessionContext) error {
+	err := database.SessionUpdateOne(paramLog, model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// HoldEscalate marks the active hold escalated, it tells whether it was not already
+func HoldEscalate(paramLog *basic.ParamLog, ID primitive.ObjectID, time string) (bool, error) {
+	filter := bson.M{"_id": ID, "status": domain.HOLD_ACTIVE_STATUS, "escalated_time": bson.M{"$exists": false}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"escalated_time": time}}}
+
+	result, err := database.Update(paramLog, domain.HOLD_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func InboundCallbackByIDNoSession(ID string) (domain.InboundCallback, error) {
+	model := domain.InboundCallback{}
+	err := database.FindOne(domain.INBOUND_CALLBACK_COLLECTION, bson.M{"_id": ID}).Decode(&model)
+	if err != nil {
+		return domain.InboundCallback{}, err
+	}
+
+	return model, nil
+}
+
+// InboundCallbackClaim records the callback when it is new and takes it for processing when it was
+// never processed, failed before or its lock expired. It tells whether this call won the claim.
+func InboundCallbackClaim(paramLog *basic.ParamLog, model domain.InboundCallback, now int64, lockedUntil int64) (bool, error) {
+	err := database.UpsertQuery(paramLog, domain.INBOUND_CALLBACK_COLLECTION, bson.M{"_id": model.ID},
+		bson.M{"$setOnInsert": bson.M{
+			"gateway":      model.Gateway,
+			"reference":    model.Reference,
+			"event":        model.Event,
+			"status":       domain.INBOUND_CALLBACK_RECEIVED,
+			"attempts":     0,
+			"replays":      0,
+			"locked_until": 0,
+			"time":         model.Time,
+		}})
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id": model.ID,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{domain.INBOUND_CALLBACK_RECEIVED, domain.INBOUND_CALLBACK_FAILED}}},
+			bson.M{"status": domain.INBOUND_CALLBACK_PROCESSING, "locked_until": bson.M{"$lte": now}},
+		},
+	}
+	changes := bson.D{
+		{Key: "$set", Value: bson.M{"status": domain.INBOUND_CALLBACK_PROCESSING, "locked_until": lockedUntil}},
+		{Key: "$inc", Value: bson.M{"attempts": 1}},
+	}
+
+	result, err := database.Update(paramLog, domain.INBOUND_CALLBACK_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func InboundCallbackProcessed(paramLog *basic.ParamLog, ID string, result bson.Raw, time string) error {
+	filter := bson.M{"_id": ID, "status": domain.INBOUND_CALLBACK_PROCESSING}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"status":       domain.INBOUND_CALLBACK_PROCESSED,
+		"result":       result,
+		"error":        "",
+		"locked_until": 0,
+		"processed_at": time,
+	}}}
+
+	_, err := database.Update(paramLog, domain.INBOUND_CALLBACK_COLLECTION, filter, changes)
+	return err
+}
+
+func InboundCallbackFailed(paramLog *basic.ParamLog, ID string, reason string) error {
+	filter := bson.M{"_id": ID, "status": domain.INBOUND_CALLBACK_PROCESSING}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"status":       domain.INBOUND_CALLBACK_FAILED,
+		"error":        reason,
+		"locked_until": 0,
+	}}}
+
+	_, err := database.Update(paramLog, domain.INBOUND_CALLBACK_COLLECTION, filter, changes)
+	return err
+}
+
+func InboundCallbackReplayed(paramLog *basic.ParamLog, ID string) error {
+	changes := bson.D{{Key: "$inc", Value: bson.M{"replays": 1}}}
+
+	_, err := database.Update(paramLog, domain.INBOUND_CALLBACK_COLLECTION, bson.M{"_id": ID}, changes)
+	return err
+}
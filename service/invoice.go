@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func InvoiceSaveOne(paramLog *basic.ParamLog, model *domain.Invoice) error {
+	err := database.SaveOne(paramLog, domain.INVOICE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func InvoiceUpdateOne(paramLog *basic.ParamLog, model *domain.Invoice) error {
+	err := database.UpdateOne(paramLog, domain.INVOICE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func InvoiceByIDNoSession(ID string) (domain.Invoice, error) {
+	model := domain.Invoice{}
+	cursor := database.FindOneByID(domain.INVOICE_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return model, nil
+}
+
+func InvoiceByNumberNoSession(number string) (domain.Invoice, error) {
+	model := domain.Invoice{}
+	cursor := database.FindOne(domain.INVOICE_COLLECTION, bson.M{"number": number})
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return model, nil
+}
+
+func InvoicesByCorporateNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, page string, limit string) ([]domain.Invoice, error) {
+	query := bson.M{"corporate_id": corporateID}
+
+	var results []domain.Invoice
+	cursor, err := database.FindOrderByID(paramLog, domain.INVOICE_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Invoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func InvoicesByStatusNoSession(paramLog *basic.ParamLog, status string) ([]domain.Invoice, error) {
+	query := bson.M{"status": status}
+
+	var results []domain.Invoice
+	cursor, err := database.FindAscendingByID(paramLog, domain.INVOICE_COLLECTION, query)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Invoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func InvoicesByPeriodStatusNoSession(paramLog *basic.ParamLog, period string, status string) ([]domain.Invoice, error) {
+	query := bson.M{"period": period, "status": status}
+
+	var results []domain.Invoice
+	cursor, err := database.FindAscendingByID(paramLog, domain.INVOICE_COLLECTION, query)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Invoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateJournal turns statements into balance legs. The counterparty legs are taken from the
+// transaction and never from the statements, so a statement for a wrong amount unbalances the journal.
+// When externalAccount is not empty the sub amount enters the ledger from it when inbound and leaves to
+// it otherwise, a conversion moves its from and to amounts through the FX account of the pair instead.
+// A rollback journal reverses the counterparty legs.
+func CreateJournal(transaction domain.Transaction, journalType string, time string,
+	statements []domain.Statement, externalAccount string, inbound bool) domain.Journal {
+	legs := []domain.JournalLeg{}
+	hasTransaction := false
+
+	for _, statement := range statements {
+		if statement.Deposit == 0 && statement.Withdraw == 0 {
+			continue
+		}
+
+		currency := statement.Currency
+		if currency == "" {
+			currency = domain.NormalizeCurrency(transaction.Currency)
+		}
+
+		legs = append(legs, domain.JournalLeg{
+			AccountType: domain.JOURNAL_ACCOUNT_BALANCE,
+			BalanceID:   statement.BalanceID,
+			Type:        statement.Type,
+			Reference:   statement.Reference,
+			Withdraw:    statement.Withdraw,
+			Deposit:     statement.Deposit,
+			Currency:    currency,
+		})
+
+		if statement.Type == domain.STATEMENT_TYPE_TRANSACTION {
+			hasTransaction = true
+		}
+	}
+
+	counterparty := []domain.JournalLeg{}
+	if hasTransaction && transaction.FX != nil {
+		account := transaction.FX.FromCurrency + "/" + transaction.FX.ToCurrency
+		counterparty = append(counterparty,
+			counterpartyLeg(transaction, domain.JOURNAL_ACCOUNT_FX, account, transaction.FX.FromCurrency, transaction.FX.FromAmount, false),
+			counterpartyLeg(transaction, domain.JOURNAL_ACCOUNT_FX, account, transaction.FX.ToCurrency, transaction.FX.ToAmount, true))
+	} else if hasTransaction && externalAccount != "" {
+		counterparty = append(counterparty, counterpartyLeg(transaction, domain.JOURNAL_ACCOUNT_EXTERNAL, externalAccount,
+			transaction.Currency, transaction.SubAmount, inbound))
+	}
+
+	for _, leg := range counterparty {
+		if journalType == domain.JOURNAL_TYPE_ROLLBACK {
+			leg.Withdraw, leg.Deposit = leg.Deposit, leg.Withdraw
+		}
+		if leg.Withdraw == 0 && leg.Deposit == 0 {
+			continue
+		}
+		legs = append(legs, leg)
+	}
+
+	return domain.Journal{
+		TransactionCode: transaction.TransactionCode,
+		TransactionType: transaction.Type,
+		Type:            journalType,
+		Time:            time,
+		Legs:            legs,
+	}
+}
+
+// counterpartyLeg withdraws the amount from the account when it pays the balances and deposits it
+// otherwise
+func counterpartyLeg(transaction domain.Transaction, accountType string, account string, currency string,
+	amount int, pays bool) domain.JournalLeg {
+	leg := domain.JournalLeg{
+		AccountType: accountType,
+		Account:     account,
+		Type:        domain.STATEMENT_TYPE_TRANSACTION,
+		Reference:   transaction.TransactionCode,
+		Currency:    domain.NormalizeCurrency(currency),
+	}
+	if pays {
+		leg.Withdraw = amount
+	} else {
+		leg.Deposit = amount
+	}
+
+	return leg
+}
+
+func JournalSaveOne(model *domain.Journal, session mongo.SessionContext) error {
+	err := database.SessionSaveOne(model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func JournalsByTransactionCode(paramLog *basic.ParamLog, transactionCode string) ([]domain.Journal, error) {
+	query := bson.M{"transaction_code": transactionCode}
+
+	var results []domain.Journal
+	cursor, err := database.Find(paramLog, domain.JOURNAL_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.Journal{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Journal{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func LimitSaveOne(paramLog *basic.ParamLog, model *domain.Limit) error {
+	err := database.SaveOne(paramLog, domain.LIMIT_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func LimitUpdateOne(paramLog *basic.ParamLog, model *domain.Limit) error {
+	err := database.UpdateOne(paramLog, domain.LIMIT_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func LimitByIDNoSession(ID string) (domain.Limit, error) {
+	model := domain.Limit{}
+	cursor := database.FindOneByID(domain.LIMIT_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Limit{}, err
+	}
+
+	return model, nil
+}
+
+// LimitsActiveMatchingNoSession returns the active limits whose scope covers the given values,
+// a scope field that is not set matches every value
+func LimitsActiveMatchingNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, balanceID primitive.ObjectID,
+	transactionType string, verification string) ([]domain.Limit, error) {
+	query := bson.M{
+		"active":           true,
+		"corporate_id":     bson.M{"$in": bson.A{corporateID, nil}},
+		"balance_id":       bson.M{"$in": bson.A{balanceID, nil}},
+		"transaction_type": bson.M{"$in": bson.A{transactionType, nil}},
+		"verification":     bson.M{"$in": bson.A{verification, nil}},
+	}
+
+	var results []domain.Limit
+	cursor, err := database.Find(paramLog, domain.LIMIT_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.Limit{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Limit{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func LimitUsageByIDNoSession(ID string) (domain.LimitUsage, error) {
+	model := domain.LimitUsage{}
+	err := database.FindOne(domain.LIMIT_USAGE_COLLECTION, bson.M{"_id": ID}).Decode(&model)
+	if err != nil {
+		return domain.LimitUsage{}, err
+	}
+
+	return model, nil
+}
+
+// LimitUsageConsume adds the amount and one count to the usage only while it stays within the caps,
+// a zero cap is not checked. A usage over its caps fails the upsert with a duplicate key error.
+func LimitUsageConsume(usage domain.LimitUsage, amountCap int, countCap int, session mongo.SessionContext) (domain.LimitUsage, error) {
+	filter := bson.M{"_id": usage.ID}
+	if amountCap > 0 {
+		filter["amount"] = bson.M{"$lte": amountCap - usage.Amount}
+	}
+	if countCap > 0 {
+		filter["count"] = bson.M{"$lte": countCap - 1}
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"amount": usage.Amount, "count": 1},
+		"$setOnInsert": bson.M{
+			"limit_id":   usage.LimitID,
+			"balance_id": usage.BalanceID,
+			"period":     usage.Period,
+		},
+	}
+
+	model := domain.LimitUsage{}
+	err := database.SessionFindOneAndUpsert(domain.LIMIT_USAGE_COLLECTION, filter, update, session).Decode(&model)
+	if err != nil {
+		return domain.LimitUsage{}, err
+	}
+
+	return model, nil
+}
+
+func LimitUsageRelease(ID string, amount int, session mongo.SessionContext) error {
+	filter := bson.M{"_id": ID}
+	update := bson.M{"$inc": bson.M{"amount": -amount, "count": -1}}
+
+	err := database.SessionFindOneAndUpdate(domain.LIMIT_USAGE_COLLECTION, filter, update, session).Err()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return nil
+}
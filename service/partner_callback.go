@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func PartnerCallbackSaveOne(paramLog *basic.ParamLog, model *domain.PartnerCallback) error {
+	err := database.SaveOne(paramLog, domain.PARTNER_CALLBACK_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PartnerCallbackUpdateOne replaces the partner, an empty secret keeps the one it has
+func PartnerCallbackUpdateOne(paramLog *basic.ParamLog, model *domain.PartnerCallback) error {
+	return database.UpdateOne(paramLog, domain.PARTNER_CALLBACK_COLLECTION, model)
+}
+
+func PartnerCallbackByIDNoSession(ID string) (domain.PartnerCallback, error) {
+	model := domain.PartnerCallback{}
+	cursor := database.FindOneByID(domain.PARTNER_CALLBACK_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.PartnerCallback{}, err
+	}
+
+	return model, nil
+}
+
+// PartnerCallbacksActiveNoSession lists the active partners in the order their rules are tried
+func PartnerCallbacksActiveNoSession(paramLog *basic.ParamLog) ([]domain.PartnerCallback, error) {
+	var results []domain.PartnerCallback
+	cursor, err := database.FindAscendingByID(paramLog, domain.PARTNER_CALLBACK_COLLECTION, bson.M{"active": true})
+	if err != nil {
+		return []domain.PartnerCallback{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.PartnerCallback{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func PartnerCallbacksNoSession(paramLog *basic.ParamLog, page string, limit string) ([]domain.PartnerCallback, error) {
+	var results []domain.PartnerCallback
+	cursor, err := database.FindOrderByID(paramLog, domain.PARTNER_CALLBACK_COLLECTION, bson.M{}, page, limit)
+	if err != nil {
+		return []domain.PartnerCallback{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.PartnerCallback{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func PartnerDeliveryByIDNoSession(ID string) (domain.PartnerDelivery, error) {
+	model := domain.PartnerDelivery{}
+	err := database.FindOne(domain.PARTNER_DELIVERY_COLLECTION, bson.M{"_id": ID}).Decode(&model)
+	if err != nil {
+		return domain.PartnerDelivery{}, err
+	}
+
+	return model, nil
+}
+
+func PartnerDeliveriesDueNoSession(paramLog *basic.ParamLog, now int64) ([]domain.PartnerDelivery, error) {
+	query := bson.M{"status": domain.PARTNER_DELIVERY_PENDING, "next_at": bson.M{"$lte": now}}
+
+	var results []domain.PartnerDelivery
+	cursor, err := database.FindAscendingByID(paramLog, domain.PARTNER_DELIVERY_COLLECTION, query)
+	if err != nil {
+		return []domain.PartnerDelivery{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.PartnerDelivery{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// PartnerDeliveriesNoSession lists the deliveries of the partner, of every partner when partnerID is zero
+func PartnerDeliveriesNoSession(paramLog *basic.ParamLog, partnerID primitive.ObjectID, status string,
+	page string, limit string) ([]domain.PartnerDelivery, error) {
+	query := bson.M{}
+	if !partnerID.IsZero() {
+		query["partner_id"] = partnerID
+	}
+	if status != "" {
+		query["status"] = status
+	}
+
+	var results []domain.PartnerDelivery
+	cursor, err := database.FindOrderByID(paramLog, domain.PARTNER_DELIVERY_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.PartnerDelivery{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.PartnerDelivery{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// PartnerDeliveryQueue adds the delivery when the callback was not forwarded yet, a replay of the
+// provider leaves the delivery it already has untouched
+func PartnerDeliveryQueue(paramLog *basic.ParamLog, model domain.PartnerDelivery) error {
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"partner_id": model.PartnerID,
+			"gateway":    model.Gateway,
+			"event":      model.Event,
+			"key":        model.Key,
+			"reference":  model.Reference,
+			"payload":    model.Payload,
+			"status":     domain.PARTNER_DELIVERY_PENDING,
+			"attempts":   0,
+			"next_at":    0,
+			"time":       model.Time,
+		},
+	}
+
+	return database.UpsertQuery(paramLog, domain.PARTNER_DELIVERY_COLLECTION, bson.M{"_id": model.ID}, update)
+}
+
+// PartnerDeliveryClaim takes a due pending delivery, the claim pushes next_at to leaseUntil so
+// concurrent workers skip it. It tells whether this call won the claim.
+func PartnerDeliveryClaim(paramLog *basic.ParamLog, ID string, now int64, leaseUntil int64) (bool, error) {
+	filter := bson.M{"_id": ID, "status": domain.PARTNER_DELIVERY_PENDING, "next_at": bson.M{"$lte": now}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"next_at": leaseUntil}}}
+
+	result, err := database.Update(paramLog, domain.PARTNER_DELIVERY_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// PartnerDeliveryAttempted writes the outcome of a claimed delivery and adds the attempt to its log
+func PartnerDeliveryAttempted(paramLog *basic.ParamLog, model domain.PartnerDelivery, attempt domain.PartnerDeliveryAttempt) error {
+	filter := bson.M{"_id": model.ID, "status": domain.PARTNER_DELIVERY_PENDING}
+	changes := bson.D{
+		{Key: "$set", Value: bson.M{
+			"status":           model.Status,
+			"attempts":         model.Attempts,
+			"next_at":          model.NextAt,
+			"last_status_code": model.LastStatusCode,
+			"last_error":       model.LastError,
+			"delivered_at":     model.DeliveredAt,
+			"time":             model.Time,
+		}},
+		{Key: "$push", Value: bson.M{"log": attempt}},
+	}
+
+	_, err := database.Update(paramLog, domain.PARTNER_DELIVERY_COLLECTION, filter, changes)
+
+	return err
+}
+
+// PartnerDeliveryRequeue puts a delivery that is no longer pending back from its first attempt, it
+// tells whether there was one
+func PartnerDeliveryRequeue(paramLog *basic.ParamLog, ID string, time string) (bool, error) {
+	filter := bson.M{"_id": ID, "status": bson.M{"$ne": domain.PARTNER_DELIVERY_PENDING}}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"status":     domain.PARTNER_DELIVERY_PENDING,
+		"attempts":   0,
+		"next_at":    0,
+		"last_error": "",
+		"time":       time,
+	}}}
+
+	result, err := database.Update(paramLog, domain.PARTNER_DELIVERY_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func PromotionSaveOne(paramLog *basic.ParamLog, model *domain.Promotion) error {
+	err := database.SaveOne(paramLog, domain.PROMOTION_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func PromotionUpdateOne(paramLog *basic.ParamLog, model *domain.Promotion) error {
+	err := database.UpdateOne(paramLog, domain.PROMOTION_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func PromotionByIDNoSession(ID string) (domain.Promotion, error) {
+	model := domain.Promotion{}
+	cursor := database.FindOneByID(domain.PROMOTION_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Promotion{}, err
+	}
+
+	return model, nil
+}
+
+// PromotionsActiveNoSession returns the active promotions of the receiving corporate for the payer,
+// oldest first, a promotion without transaction type matches every type
+func PromotionsActiveNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, payer string,
+	transactionType string) ([]domain.Promotion, error) {
+	query := bson.M{
+		"active":           true,
+		"corporate_id":     corporateID,
+		"payer":            payer,
+		"transaction_type": bson.M{"$in": bson.A{transactionType, nil}},
+	}
+
+	var results []domain.Promotion
+	cursor, err := database.FindAscendingByID(paramLog, domain.PROMOTION_COLLECTION, query)
+	if err != nil {
+		return []domain.Promotion{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Promotion{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// PromotionSpend adds the waived amount to what the promotion spent only while it stays within the
+// budget, a zero budget is not checked. It returns mongo.ErrNoDocuments when the budget ran out.
+func PromotionSpend(promotion domain.Promotion, amount int, session mongo.SessionContext) error {
+	filter := bson.M{"_id": promotion.ID}
+	if promotion.Budget > 0 {
+		filter["spent"] = bson.M{"$lte": promotion.Budget - amount}
+	}
+
+	update := bson.M{"$inc": bson.M{"spent": amount}}
+
+	return database.SessionFindOneAndUpdate(domain.PROMOTION_COLLECTION, filter, update, session).Err()
+}
+
+func PromotionRefund(promotionID primitive.ObjectID, amount int, session mongo.SessionContext) error {
+	filter := bson.M{"_id": promotionID}
+	update := bson.M{"$inc": bson.M{"spent": -amount}}
+
+	err := database.SessionFindOneAndUpdate(domain.PROMOTION_COLLECTION, filter, update, session).Err()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return nil
+}
+
+func PromotionUsageByIDNoSession(ID string) (domain.PromotionUsage, error) {
+	model := domain.PromotionUsage{}
+	err := database.FindOne(domain.PROMOTION_USAGE_COLLECTION, bson.M{"_id": ID}).Decode(&model)
+	if err != nil {
+		return domain.PromotionUsage{}, err
+	}
+
+	return model, nil
+}
+
+// PromotionUsageConsume adds one count to the usage only while it stays within the quota, a zero
+// quota is not checked. A usage over its quota fails the upsert with a duplicate key error.
+func PromotionUsageConsume(usage domain.PromotionUsage, quota int, session mongo.SessionContext) (domain.PromotionUsage, error) {
+	filter := bson.M{"_id": usage.ID}
+	if quota > 0 {
+		filter["count"] = bson.M{"$lte": quota - 1}
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"count": 1},
+		"$setOnInsert": bson.M{
+			"promotion_id": usage.PromotionID,
+			"payer_id":     usage.PayerID,
+			"period":       usage.Period,
+		},
+	}
+
+	model := domain.PromotionUsage{}
+	err := database.SessionFindOneAndUpsert(domain.PROMOTION_USAGE_COLLECTION, filter, update, session).Decode(&model)
+	if err != nil {
+		return domain.PromotionUsage{}, err
+	}
+
+	return model, nil
+}
+
+func PromotionUsageRelease(ID string, session mongo.SessionContext) error {
+	filter := bson.M{"_id": ID}
+	update := bson.M{"$inc": bson.M{"count": -1}}
+
+	err := database.SessionFindOneAndUpdate(domain.PROMOTION_USAGE_COLLECTION, filter, update, session).Err()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return nil
+}
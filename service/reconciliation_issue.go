@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func ReconciliationIssueSaveOne(paramLog *basic.ParamLog, model *domain.ReconciliationIssue) error {
+	err := database.SaveOne(paramLog, domain.RECONCILIATION_ISSUE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func ReconciliationIssuesByRunID(paramLog *basic.ParamLog, runID string) ([]domain.ReconciliationIssue, error) {
+	query := bson.M{"run_id": runID}
+
+	var results []domain.ReconciliationIssue
+	cursor, err := database.Find(paramLog, domain.RECONCILIATION_ISSUE_COLLECTION, query, "", "")
+	if err != nil {
+		return []domain.ReconciliationIssue{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.ReconciliationIssue{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
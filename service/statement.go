@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/utils"
@@ -13,57 +14,70 @@ import (
 )
 
 func WithdrawFeeStatement(balanceID primitive.ObjectID, time string, transactionCode string,
-	amount int) domain.Statement {
+	amount domain.Money) domain.Statement {
 	return domain.Statement{
 		BalanceID:   balanceID,
 		Time:        time,
 		Description: "Withdraw for fee from " + transactionCode,
 		Reference:   transactionCode,
-		Withdraw:    amount,
+		Withdraw:    amount.Legacy(),
 		Deposit:     0,
+		Currency:    amount.Currency,
 		Type:        domain.STATEMENT_TYPE_FEE,
 	}
 }
 
 func DepositFeeStatement(balanceID primitive.ObjectID, time string, transactionCode string,
-	amount int) domain.Statement {
+	amount domain.Money) domain.Statement {
 	return domain.Statement{
 		BalanceID:   balanceID,
 		Time:        time,
 		Description: "Deposit for fee from " + transactionCode,
 		Reference:   transactionCode,
 		Withdraw:    0,
-		Deposit:     amount,
+		Deposit:     amount.Legacy(),
+		Currency:    amount.Currency,
 		Type:        domain.STATEMENT_TYPE_FEE,
 	}
 }
 
 func WithdrawTransactionStatement(balanceID primitive.ObjectID, time string, transactionCode string,
-	amount int) domain.Statement {
+	amount domain.Money) domain.Statement {
 	return domain.Statement{
 		BalanceID:   balanceID,
 		Time:        time,
 		Description: "Withdraw for " + transactionCode,
 		Reference:   transactionCode,
-		Withdraw:    amount,
+		Withdraw:    amount.Legacy(),
 		Deposit:     0,
+		Currency:    amount.Currency,
 		Type:        domain.STATEMENT_TYPE_TRANSACTION,
 	}
 }
 
 func DepositTransactionStatement(balanceID primitive.ObjectID, time string, transactionCode string,
-	amount int) domain.Statement {
+	amount domain.Money) domain.Statement {
 	return domain.Statement{
 		BalanceID:   balanceID,
 		Time:        time,
 		Description: "Deposit for " + transactionCode,
 		Reference:   transactionCode,
 		Withdraw:    0,
-		Deposit:     amount,
+		Deposit:     amount.Legacy(),
+		Currency:    amount.Currency,
 		Type:        domain.STATEMENT_TYPE_TRANSACTION,
 	}
 }
 
+// DepositConversionStatement credits the converted amount of a cross currency transaction
+func DepositConversionStatement(balanceID primitive.ObjectID, time string, transactionCode string,
+	amount domain.Money, fx domain.TransactionFX) domain.Statement {
+	statement := DepositTransactionStatement(balanceID, time, transactionCode, amount)
+	statement.Description = "Deposit for " + transactionCode + " converted from " + fx.FromCurrency + " at " + fx.Rate
+
+	return statement
+}
+
 func StatementsByBalanceID(paramLog *basic.ParamLog, balanceID primitive.ObjectID, page string, limit string) ([]domain.Statement, error) {
 	query := bson.M{"balance_id": balanceID}
 
@@ -78,6 +92,129 @@ func StatementsByBalanceID(paramLog *basic.ParamLog, balanceID primitive.ObjectI
 	return results, nil
 }
 
+// StatementsByBalanceIDUntil returns statements in posting order, the object id carries the posting time
+func StatementsByBalanceIDUntil(paramLog *basic.ParamLog, balanceID primitive.ObjectID, until time.Time) ([]domain.Statement, error) {
+	query := bson.M{
+		"balance_id": balanceID,
+		"_id":        bson.M{"$lt": primitive.NewObjectIDFromTimestamp(until.Add(time.Second))},
+	}
+
+	var results []domain.Statement
+	cursor, err := database.FindAscendingByID(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Statement{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// StatementSumByBalance nets deposits minus withdraws of every balance that has statements
+func StatementSumByBalance(paramLog *basic.ParamLog) (map[primitive.ObjectID]int, error) {
+	query := []bson.M{
+		{"$group": bson.M{
+			"_id":   "$balance_id",
+			"total": bson.M{"$sum": bson.M{"$subtract": bson.A{"$deposit", "$withdraw"}}},
+		}},
+	}
+
+	var results []struct {
+		BalanceID primitive.ObjectID `bson:"_id"`
+		Total     int                `bson:"total"`
+	}
+	cursor, err := database.Aggregate(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return map[primitive.ObjectID]int{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return map[primitive.ObjectID]int{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	sums := map[primitive.ObjectID]int{}
+	for _, result := range results {
+		sums[result.BalanceID] = result.Total
+	}
+
+	return sums, nil
+}
+
+// StatementLastIDByBalance returns the newest statement ID of every balance, the ID carries its time
+func StatementLastIDByBalance(paramLog *basic.ParamLog) (map[primitive.ObjectID]primitive.ObjectID, error) {
+	query := []bson.M{
+		{"$group": bson.M{
+			"_id":  "$balance_id",
+			"last": bson.M{"$max": "$_id"},
+		}},
+	}
+
+	var results []struct {
+		BalanceID primitive.ObjectID `bson:"_id"`
+		Last      primitive.ObjectID `bson:"last"`
+	}
+	cursor, err := database.Aggregate(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return map[primitive.ObjectID]primitive.ObjectID{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return map[primitive.ObjectID]primitive.ObjectID{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	lasts := map[primitive.ObjectID]primitive.ObjectID{}
+	for _, result := range results {
+		lasts[result.BalanceID] = result.Last
+	}
+
+	return lasts, nil
+}
+
+func StatementsByReferences(paramLog *basic.ParamLog, references []string) ([]domain.Statement, error) {
+	query := bson.M{"reference": bson.M{"$in": references}}
+
+	var results []domain.Statement
+	cursor, err := database.FindAscendingByID(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Statement{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func StatementsRollbackBetween(paramLog *basic.ParamLog, from time.Time, to time.Time) ([]domain.Statement, error) {
+	query := bson.M{
+		"reference": bson.M{"$regex": ":rollback$"},
+		"_id": bson.M{
+			"$gte": primitive.NewObjectIDFromTimestamp(from),
+			"$lt":  primitive.NewObjectIDFromTimestamp(to),
+		},
+	}
+
+	var results []domain.Statement
+	cursor, err := database.FindAscendingByID(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Statement{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
 func StatementSaveOne(model domain.Statement, session mongo.SessionContext) error {
 	err := database.SessionSaveOne(model, session)
 	if err != nil {
@@ -86,3 +223,26 @@ func StatementSaveOne(model domain.Statement, session mongo.SessionContext) erro
 
 	return nil
 }
+
+func StatementsFeeBetween(paramLog *basic.ParamLog, from time.Time, to time.Time) ([]domain.Statement, error) {
+	query := bson.M{
+		"type": domain.STATEMENT_TYPE_FEE,
+		"_id": bson.M{
+			"$gte": primitive.NewObjectIDFromTimestamp(from),
+			"$lt":  primitive.NewObjectIDFromTimestamp(to),
+		},
+	}
+
+	var results []domain.Statement
+	cursor, err := database.FindAscendingByID(paramLog, domain.STATEMENT_COLLECTION_NAME, query)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Statement{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func SuspenseItemSaveOne(model *domain.SuspenseItem, session mongo.SessionContext) error {
+	err := database.SessionSaveOne(model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func SuspenseItemSaveOneNoSession(paramLog *basic.ParamLog, model *domain.SuspenseItem) error {
+	err := database.SaveOne(paramLog, domain.SUSPENSE_ITEM_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func SuspenseItemByIDNoSession(ID string) (domain.SuspenseItem, error) {
+	model := domain.SuspenseItem{}
+	cursor := database.FindOneByID(domain.SUSPENSE_ITEM_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.SuspenseItem{}, err
+	}
+
+	return model, nil
+}
+
+func SuspenseItemByTransactionCodeNoSession(transactionCode string) (domain.SuspenseItem, error) {
+	model := domain.SuspenseItem{}
+	cursor := database.FindOne(domain.SUSPENSE_ITEM_COLLECTION, bson.M{"transaction_code": transactionCode})
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.SuspenseItem{}, err
+	}
+
+	return model, nil
+}
+
+// SuspenseItemsNoSession lists the items of the corporate, of every corporate when corporateID is zero
+func SuspenseItemsNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, status string,
+	page string, limit string) ([]domain.SuspenseItem, error) {
+	query := bson.M{}
+	if !corporateID.IsZero() {
+		query["corporate_id"] = corporateID
+	}
+	if status != "" {
+		query["status"] = status
+	}
+
+	var results []domain.SuspenseItem
+	cursor, err := database.FindOrderByID(paramLog, domain.SUSPENSE_ITEM_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.SuspenseItem{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.SuspenseItem{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// SuspenseItemTransition moves the item out of status from, it tells whether the item was still in it
+func SuspenseItemTransition(paramLog *basic.ParamLog, ID primitive.ObjectID, from string, set bson.M) (bool, error) {
+	filter := bson.M{"_id": ID, "status": from}
+	changes := bson.D{{Key: "$set", Value: set}}
+
+	result, err := database.Update(paramLog, domain.SUSPENSE_ITEM_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// SuspenseItemReopen opens again the item refunded by the transfer, it tells whether there was one
+func SuspenseItemReopen(paramLog *basic.ParamLog, transactionCode string, time string) (bool, error) {
+	filter := bson.M{"resolution_transaction_code": transactionCode, "status": domain.SUSPENSE_REFUNDED}
+	changes := bson.D{{Key: "$set", Value: bson.M{"status": domain.SUSPENSE_OPEN, "resolution_transaction_code": "", "time": time}}}
+
+	result, err := database.Update(paramLog, domain.SUSPENSE_ITEM_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kangdjoker/takeme-core/domain"
@@ -73,6 +74,19 @@ func TransactionByGatewayReferenceNoSession(paramLog *basic.ParamLog, code strin
 	return transaction, nil
 }
 
+// TransactionByGatewayPaymentNoSession finds the transaction of the type already made for the payment
+// the gateway knows by reference, it returns mongo.ErrNoDocuments when there is none
+func TransactionByGatewayPaymentNoSession(gateway string, reference string, transactionType string) (domain.Transaction, error) {
+	var transaction domain.Transaction
+	query := bson.M{"gateway": gateway, "gateway_reference": reference, "type": transactionType}
+	err := database.FindOne(domain.TRANSACTION_COLLECTION, query).Decode(&transaction)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
 func TransactionByCodeNoSession(paramLog *basic.ParamLog, code string) (domain.Transaction, error) {
 	var transaction domain.Transaction
 	query := bson.M{"transaction_code": code}
@@ -147,3 +161,108 @@ func TransactionsByActorNoSession(paramLog *basic.ParamLog, accountNumber string
 
 	return transaction, nil
 }
+
+func TransactionsByStatusBetween(paramLog *basic.ParamLog, status string, from time.Time, to time.Time) ([]domain.Transaction, error) {
+	query := bson.M{
+		"status": status,
+		"_id": bson.M{
+			"$gte": primitive.NewObjectIDFromTimestamp(from),
+			"$lt":  primitive.NewObjectIDFromTimestamp(to),
+		},
+	}
+
+	var transactions []domain.Transaction
+	cursor, err := database.FindAscendingByID(paramLog, domain.TRANSACTION_COLLECTION, query)
+	if err != nil {
+		return []domain.Transaction{}, err
+	}
+
+	err = cursor.All(context.TODO(), &transactions)
+	if err != nil {
+		return []domain.Transaction{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return transactions, nil
+}
+
+// TransactionsPendingTransferBefore returns the bank transfers handed to a gateway before the time
+// that are still pending
+func TransactionsPendingTransferBefore(paramLog *basic.ParamLog, before time.Time) ([]domain.Transaction, error) {
+	query := bson.M{
+		"type":              domain.TRANSFER_BANK,
+		"status":            domain.PENDING_STATUS,
+		"gateway":           bson.M{"$ne": ""},
+		"gateway_reference": bson.M{"$ne": ""},
+		"_id":               bson.M{"$lt": primitive.NewObjectIDFromTimestamp(before)},
+	}
+
+	var transactions []domain.Transaction
+	cursor, err := database.FindAscendingByID(paramLog, domain.TRANSACTION_COLLECTION, query)
+	if err != nil {
+		return []domain.Transaction{}, err
+	}
+
+	err = cursor.All(context.TODO(), &transactions)
+	if err != nil {
+		return []domain.Transaction{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return transactions, nil
+}
+
+func TransactionsByCodes(paramLog *basic.ParamLog, codes []string) ([]domain.Transaction, error) {
+	query := bson.M{"transaction_code": bson.M{"$in": codes}}
+
+	var transactions []domain.Transaction
+	cursor, err := database.FindAscendingByID(paramLog, domain.TRANSACTION_COLLECTION, query)
+	if err != nil {
+		return []domain.Transaction{}, err
+	}
+
+	err = cursor.All(context.TODO(), &transactions)
+	if err != nil {
+		return []domain.Transaction{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return transactions, nil
+}
+
+// TransactionTakeLimitUsages unsets the limit usages of the transaction and returns it as it was,
+// it returns mongo.ErrNoDocuments when the usages were taken already
+func TransactionTakeLimitUsages(code string, session mongo.SessionContext) (domain.Transaction, error) {
+	filter := bson.M{"transaction_code": code, "limit_usages": bson.M{"$exists": true}}
+
+	model := domain.Transaction{}
+	err := database.SessionFindOne(domain.TRANSACTION_COLLECTION, filter, session).Decode(&model)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	update := bson.M{"$unset": bson.M{"limit_usages": ""}}
+	err = database.SessionFindOneAndUpdate(domain.TRANSACTION_COLLECTION, filter, update, session).Err()
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	return model, nil
+}
+
+// TransactionTakePromotionUsages unsets the promotion usages of the transaction and returns it as it
+// was, it returns mongo.ErrNoDocuments when the usages were taken already
+func TransactionTakePromotionUsages(code string, session mongo.SessionContext) (domain.Transaction, error) {
+	filter := bson.M{"transaction_code": code, "promotion_usages": bson.M{"$exists": true}}
+
+	model := domain.Transaction{}
+	err := database.SessionFindOne(domain.TRANSACTION_COLLECTION, filter, session).Decode(&model)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	update := bson.M{"$unset": bson.M{"promotion_usages": ""}}
+	err = database.SessionFindOneAndUpdate(domain.TRANSACTION_COLLECTION, filter, update, session).Err()
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	return model, nil
+}
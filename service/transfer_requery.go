@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TransferRequeryByCodeNoSession(code string) (domain.TransferRequery, error) {
+	model := domain.TransferRequery{}
+	err := database.FindOne(domain.TRANSFER_REQUERY_COLLECTION, bson.M{"_id": code}).Decode(&model)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	return model, nil
+}
+
+// TransferRequeryClaim starts following the transfer when it is not yet and takes the requery when
+// it is due, the claim pushes next_at to leaseUntil so concurrent workers skip it. It tells whether
+// this call won the claim.
+func TransferRequeryClaim(paramLog *basic.ParamLog, model domain.TransferRequery, now int64, leaseUntil int64) (bool, error) {
+	err := database.UpsertQuery(paramLog, domain.TRANSFER_REQUERY_COLLECTION, bson.M{"_id": model.ID},
+		bson.M{"$setOnInsert": bson.M{
+			"gateway":   model.Gateway,
+			"reference": model.Reference,
+			"status":    domain.REQUERY_ACTIVE,
+			"attempts":  0,
+			"next_at":   0,
+			"time":      model.Time,
+		}})
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"_id": model.ID, "status": domain.REQUERY_ACTIVE, "next_at": bson.M{"$lte": now}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"next_at": leaseUntil}}}
+
+	result, err := database.Update(paramLog, domain.TRANSFER_REQUERY_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func TransferRequerySet(paramLog *basic.ParamLog, model domain.TransferRequery) error {
+	update := bson.M{"$set": bson.M{
+		"gateway":          model.Gateway,
+		"reference":        model.Reference,
+		"status":           model.Status,
+		"attempts":         model.Attempts,
+		"next_at":          model.NextAt,
+		"gateway_status":   model.GatewayStatus,
+		"last_error":       model.LastError,
+		"escalated_reason": model.EscalatedReason,
+		"time":             model.Time,
+	}}
+
+	return database.UpsertQuery(paramLog, domain.TRANSFER_REQUERY_COLLECTION, bson.M{"_id": model.ID}, update)
+}
+
+// TransferRequeryEscalate puts the transfer up for manual review, following it when it is not yet
+func TransferRequeryEscalate(paramLog *basic.ParamLog, model domain.TransferRequery) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":           domain.REQUERY_ESCALATED,
+			"escalated_reason": model.EscalatedReason,
+			"time":             model.Time,
+		},
+		"$setOnInsert": bson.M{
+			"gateway":   model.Gateway,
+			"reference": model.Reference,
+			"attempts":  0,
+			"next_at":   0,
+		},
+	}
+
+	return database.UpsertQuery(paramLog, domain.TRANSFER_REQUERY_COLLECTION, bson.M{"_id": model.ID}, update)
+}
+
+func TransferRequeriesByStatusNoSession(paramLog *basic.ParamLog, status string, page string, limit string) ([]domain.TransferRequery, error) {
+	query := bson.M{"status": status}
+
+	var results []domain.TransferRequery
+	cursor, err := database.FindOrderByID(paramLog, domain.TRANSFER_REQUERY_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.TransferRequery{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.TransferRequery{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
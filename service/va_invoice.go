@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func VAInvoiceSaveOne(paramLog *basic.ParamLog, model *domain.VAInvoice) error {
+	err := database.SaveOne(paramLog, domain.VA_INVOICE_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func VAInvoiceByIDNoSession(ID string) (domain.VAInvoice, error) {
+	model := domain.VAInvoice{}
+	cursor := database.FindOneByID(domain.VA_INVOICE_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.VAInvoice{}, err
+	}
+
+	return model, nil
+}
+
+func VAInvoiceByExternalIDNoSession(corporateID primitive.ObjectID, externalID string) (domain.VAInvoice, error) {
+	model := domain.VAInvoice{}
+	query := bson.M{"corporate_id": corporateID, "external_id": externalID}
+	err := database.FindOne(domain.VA_INVOICE_COLLECTION, query).Decode(&model)
+	if err != nil {
+		return domain.VAInvoice{}, err
+	}
+
+	return model, nil
+}
+
+func VAInvoicesByCorporateNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, status string,
+	page string, limit string) ([]domain.VAInvoice, error) {
+	query := bson.M{"corporate_id": corporateID}
+	if status != "" {
+		query["status"] = status
+	}
+
+	var results []domain.VAInvoice
+	cursor, err := database.FindOrderByID(paramLog, domain.VA_INVOICE_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.VAInvoice{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.VAInvoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+func VAInvoicesExpiredNoSession(paramLog *basic.ParamLog, now int64) ([]domain.VAInvoice, error) {
+	query := bson.M{"status": domain.VA_INVOICE_PENDING, "expires_at_unix": bson.M{"$gt": 0, "$lte": now}}
+
+	var results []domain.VAInvoice
+	cursor, err := database.FindAscendingByID(paramLog, domain.VA_INVOICE_COLLECTION, query)
+	if err != nil {
+		return []domain.VAInvoice{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.VAInvoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// VAInvoiceTransition moves the invoice out of status from, it tells whether the invoice was still in it
+func VAInvoiceTransition(paramLog *basic.ParamLog, ID primitive.ObjectID, from string, set bson.M) (bool, error) {
+	filter := bson.M{"_id": ID, "status": from}
+	changes := bson.D{{Key: "$set", Value: set}}
+
+	result, err := database.Update(paramLog, domain.VA_INVOICE_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func VAInvoiceAddPayment(paramLog *basic.ParamLog, ID primitive.ObjectID, payment domain.VAInvoicePayment) error {
+	changes := bson.D{{Key: "$push", Value: bson.M{"payments": payment}}}
+	_, err := database.Update(paramLog, domain.VA_INVOICE_COLLECTION, bson.M{"_id": ID}, changes)
+
+	return err
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func VAProvisionByIDNoSession(ID string) (domain.VAProvision, error) {
+	model := domain.VAProvision{}
+	err := database.FindOne(domain.VA_PROVISION_COLLECTION, bson.M{"_id": ID}).Decode(&model)
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+
+	return model, nil
+}
+
+// VAProvisionByAccountNumberNoSession finds the balance of a paid account number, closed accounts included
+func VAProvisionByAccountNumberNoSession(provider string, accountNumber string) (domain.VAProvision, error) {
+	model := domain.VAProvision{}
+	query := bson.M{"provider": provider, "account_number": accountNumber}
+	err := database.FindOne(domain.VA_PROVISION_COLLECTION, query).Decode(&model)
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+
+	return model, nil
+}
+
+func VAProvisionsByBalanceNoSession(paramLog *basic.ParamLog, balanceID primitive.ObjectID) ([]domain.VAProvision, error) {
+	return vaProvisions(paramLog, bson.M{"balance_id": balanceID})
+}
+
+func VAProvisionsDueNoSession(paramLog *basic.ParamLog, now int64) ([]domain.VAProvision, error) {
+	return vaProvisions(paramLog, bson.M{"status": domain.VA_PENDING, "next_at": bson.M{"$lte": now}})
+}
+
+func VAProvisionsByStatusNoSession(paramLog *basic.ParamLog, status string, page string, limit string) ([]domain.VAProvision, error) {
+	query := bson.M{"status": status}
+
+	var results []domain.VAProvision
+	cursor, err := database.FindOrderByID(paramLog, domain.VA_PROVISION_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.VAProvision{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.VAProvision{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// VAProvisionQueue puts the account back to pending from its first attempt with the given provider,
+// the account number it had is kept until the new one is created
+func VAProvisionQueue(paramLog *basic.ParamLog, model domain.VAProvision) error {
+	update := bson.M{
+		"$set": bson.M{
+			"provider":   model.Provider,
+			"name":       model.Name,
+			"status":     domain.VA_PENDING,
+			"attempts":   0,
+			"next_at":    0,
+			"last_error": "",
+			"time":       model.Time,
+		},
+		"$setOnInsert": bson.M{
+			"balance_id": model.BalanceID,
+			"bank_code":  model.BankCode,
+		},
+	}
+
+	return database.UpsertQuery(paramLog, domain.VA_PROVISION_COLLECTION, bson.M{"_id": model.ID}, update)
+}
+
+// VAProvisionClaim takes a due pending account, the claim pushes next_at to leaseUntil so concurrent
+// workers skip it. It tells whether this call won the claim.
+func VAProvisionClaim(paramLog *basic.ParamLog, ID string, now int64, leaseUntil int64) (bool, error) {
+	filter := bson.M{"_id": ID, "status": domain.VA_PENDING, "next_at": bson.M{"$lte": now}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"next_at": leaseUntil}}}
+
+	result, err := database.Update(paramLog, domain.VA_PROVISION_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// VAProvisionUpdate writes the account only while it is still in status, it tells whether it did
+func VAProvisionUpdate(paramLog *basic.ParamLog, model domain.VAProvision, status string) (bool, error) {
+	filter := bson.M{"_id": model.ID, "status": status}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"provider":       model.Provider,
+		"status":         model.Status,
+		"account_number": model.AccountNumber,
+		"reference":      model.Reference,
+		"attempts":       model.Attempts,
+		"next_at":        model.NextAt,
+		"last_error":     model.LastError,
+		"time":           model.Time,
+	}}}
+
+	result, err := database.Update(paramLog, domain.VA_PROVISION_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+func vaProvisions(paramLog *basic.ParamLog, query bson.M) ([]domain.VAProvision, error) {
+	var results []domain.VAProvision
+	cursor, err := database.FindAscendingByID(paramLog, domain.VA_PROVISION_COLLECTION, query)
+	if err != nil {
+		return []domain.VAProvision{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.VAProvision{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func WebhookSaveOne(model *domain.Webhook, session mongo.SessionContext) error {
+	err := database.SessionSaveOne(model, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func WebhookSaveOneNoSession(paramLog *basic.ParamLog, model *domain.Webhook) error {
+	err := database.SaveOne(paramLog, domain.WEBHOOK_COLLECTION, model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func WebhookByIDNoSession(ID string) (domain.Webhook, error) {
+	model := domain.Webhook{}
+	cursor := database.FindOneByID(domain.WEBHOOK_COLLECTION, ID)
+	err := cursor.Decode(&model)
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+
+	return model, nil
+}
+
+func WebhooksDueNoSession(paramLog *basic.ParamLog, now int64) ([]domain.Webhook, error) {
+	query := bson.M{"status": domain.WEBHOOK_PENDING, "next_at": bson.M{"$lte": now}}
+
+	var results []domain.Webhook
+	cursor, err := database.FindAscendingByID(paramLog, domain.WEBHOOK_COLLECTION, query)
+	if err != nil {
+		return []domain.Webhook{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Webhook{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// WebhooksNoSession lists the webhooks of the corporate, of every corporate when corporateID is zero
+func WebhooksNoSession(paramLog *basic.ParamLog, corporateID primitive.ObjectID, status string,
+	page string, limit string) ([]domain.Webhook, error) {
+	query := bson.M{}
+	if !corporateID.IsZero() {
+		query["corporate_id"] = corporateID
+	}
+	if status != "" {
+		query["status"] = status
+	}
+
+	var results []domain.Webhook
+	cursor, err := database.FindOrderByID(paramLog, domain.WEBHOOK_COLLECTION, query, page, limit)
+	if err != nil {
+		return []domain.Webhook{}, err
+	}
+
+	err = cursor.All(context.TODO(), &results)
+	if err != nil {
+		return []domain.Webhook{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return results, nil
+}
+
+// WebhookClaim takes a due pending webhook, the claim pushes next_at to leaseUntil so concurrent
+// workers skip it. It tells whether this call won the claim.
+func WebhookClaim(paramLog *basic.ParamLog, ID primitive.ObjectID, now int64, leaseUntil int64) (bool, error) {
+	filter := bson.M{"_id": ID, "status": domain.WEBHOOK_PENDING, "next_at": bson.M{"$lte": now}}
+	changes := bson.D{{Key: "$set", Value: bson.M{"next_at": leaseUntil}}}
+
+	result, err := database.Update(paramLog, domain.WEBHOOK_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// WebhookAttempted writes the outcome of a claimed webhook
+func WebhookAttempted(paramLog *basic.ParamLog, model domain.Webhook) error {
+	filter := bson.M{"_id": model.ID, "status": domain.WEBHOOK_PENDING}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"status":           model.Status,
+		"attempts":         model.Attempts,
+		"next_at":          model.NextAt,
+		"last_status_code": model.LastStatusCode,
+		"last_error":       model.LastError,
+		"delivered_at":     model.DeliveredAt,
+		"time":             model.Time,
+	}}}
+
+	_, err := database.Update(paramLog, domain.WEBHOOK_COLLECTION, filter, changes)
+
+	return err
+}
+
+// WebhookRequeue puts a webhook that is no longer pending back from its first attempt, it tells
+// whether there was one
+func WebhookRequeue(paramLog *basic.ParamLog, ID primitive.ObjectID, time string) (bool, error) {
+	filter := bson.M{"_id": ID, "status": bson.M{"$ne": domain.WEBHOOK_PENDING}}
+	changes := bson.D{{Key: "$set", Value: bson.M{
+		"status":     domain.WEBHOOK_PENDING,
+		"attempts":   0,
+		"next_at":    0,
+		"last_error": "",
+		"time":       time,
+	}}}
+
+	result, err := database.Update(paramLog, domain.WEBHOOK_COLLECTION, filter, changes)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
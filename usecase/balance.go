@@ -10,7 +10,7 @@ import (
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/database"
-	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
@@ -20,6 +20,7 @@ import (
 
 func CreateBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corporate domain.Corporate, balanceName string) (domain.Balance, error) {
 	var balance domain.Balance
+	var ownerName string
 
 	if utils.IsContainSpecialCharacter(balanceName) {
 		return domain.Balance{}, utils.ErrorBadRequest(paramLog, utils.InvalidNameFormat, "Name balance error")
@@ -65,12 +66,7 @@ func CreateBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corporat
 			return err
 		}
 
-		createVABalance(paramLog, &balance, user.FullName)
-		err = service.BalanceUpdate(paramLog, balance, session)
-		if err != nil {
-			session.AbortTransaction(session)
-			return err
-		}
+		ownerName = user.FullName
 
 		return database.CommitWithRetry(session)
 	}
@@ -87,6 +83,8 @@ func CreateBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corporat
 			fmt.Sprintf("Failed initialize balance for user (%v)", user.GetActorID()))
 	}
 
+	queueBalanceVA(paramLog, balance, ownerName)
+
 	return balance, nil
 }
 
@@ -137,13 +135,6 @@ func CreateBalanceCorporate(paramLog *basic.ParamLog, corp domain.ActorAble, cor
 			return err
 		}
 
-		createVABalance(paramLog, &balance, corporate.Name)
-		err = service.BalanceUpdate(paramLog, balance, session)
-		if err != nil {
-			session.AbortTransaction(session)
-			return err
-		}
-
 		return database.CommitWithRetry(session)
 	}
 
@@ -159,11 +150,14 @@ func CreateBalanceCorporate(paramLog *basic.ParamLog, corp domain.ActorAble, cor
 			fmt.Sprintf("Failed initialize balance for corporate (%v)", corporate.GetActorID()))
 	}
 
+	queueBalanceVA(paramLog, balance, corporate.Name)
+
 	return balance, nil
 }
 
 func InitializeBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corporate domain.Corporate, balanceName string) (domain.Balance, error) {
 	var balance domain.Balance
+	var ownerName string
 	createBalanceForUser := func(session mongo.SessionContext) error {
 
 		err := session.StartTransaction(options.Transaction().
@@ -207,12 +201,7 @@ func InitializeBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corp
 			return err
 		}
 
-		createVABalance(paramLog, &balance, user.FullName)
-		err = service.BalanceUpdate(paramLog, balance, session)
-		if err != nil {
-			session.AbortTransaction(session)
-			return err
-		}
+		ownerName = user.FullName
 
 		return database.CommitWithRetry(session)
 	}
@@ -229,6 +218,8 @@ func InitializeBalanceUser(paramLog *basic.ParamLog, user domain.ActorAble, corp
 			fmt.Sprintf("Failed initialize balance for user (%v)", user.GetActorID()))
 	}
 
+	queueBalanceVA(paramLog, balance, ownerName)
+
 	return balance, nil
 }
 
@@ -276,13 +267,6 @@ func InitializeBalanceCorporate(paramLog *basic.ParamLog, corp domain.ActorAble,
 			return err
 		}
 
-		createVABalance(paramLog, &balance, corporate.Name)
-		err = service.BalanceUpdate(paramLog, balance, session)
-		if err != nil {
-			session.AbortTransaction(session)
-			return err
-		}
-
 		return database.CommitWithRetry(session)
 	}
 
@@ -298,28 +282,22 @@ func InitializeBalanceCorporate(paramLog *basic.ParamLog, corp domain.ActorAble,
 			fmt.Sprintf("Failed initialize balance for corporate (%v)", corporate.GetActorID()))
 	}
 
+	queueBalanceVA(paramLog, balance, corporate.Name)
+
 	return balance, nil
 }
 
 func WithdrawBalance(paramLog *basic.ParamLog, statement domain.Statement, session mongo.SessionContext) error {
-	balanceID := statement.BalanceID.Hex()
 	amount := statement.Withdraw
 
-	balance, err := service.BalanceByID(balanceID, session)
-	if err != nil {
-		return err
-	}
-	basic.LogInformation(paramLog, "balance.Amount: "+strconv.Itoa(balance.Amount)+", "+strconv.Itoa(amount))
-	if balance.Amount < amount {
-		return utils.ErrorBadRequest(paramLog, utils.InsufficientBalance, "Insufficient balance")
+	balance, err := service.BalanceIncrement(paramLog, statement.BalanceID, -amount, session)
+	if err == mongo.ErrNoDocuments {
+		return balanceGuardError(paramLog, statement.BalanceID, true, session)
 	}
-
-	balance.Amount = balance.Amount - amount
-
-	err = service.BalanceUpdate(paramLog, balance, session)
 	if err != nil {
 		return err
 	}
+	basic.LogInformation(paramLog, "balance.Amount: "+strconv.Itoa(balance.Amount)+", "+strconv.Itoa(amount))
 
 	statement.Balance = balance.Amount
 
@@ -332,23 +310,17 @@ func WithdrawBalance(paramLog *basic.ParamLog, statement domain.Statement, sessi
 }
 
 func DepositBalance(paramLog *basic.ParamLog, statement domain.Statement, session mongo.SessionContext) error {
-	balanceID := statement.BalanceID.Hex()
 	amount := statement.Deposit
 
-	balance, err := service.BalanceByID(balanceID, session)
-	if err != nil {
-		return err
+	balance, err := service.BalanceIncrement(paramLog, statement.BalanceID, amount, session)
+	if err == mongo.ErrNoDocuments {
+		return balanceGuardError(paramLog, statement.BalanceID, false, session)
 	}
-	basic.LogInformation2(paramLog, "BalanceByID", balance)
-
-	balance.Amount = balance.Amount + amount
-
-	err = service.BalanceUpdate(paramLog, balance, session)
 	if err != nil {
 		return err
 	}
 
-	basic.LogInformation2(paramLog, "BalanceUpdate", balance)
+	basic.LogInformation2(paramLog, "BalanceIncrement", balance)
 	statement.Balance = balance.Amount
 
 	err = service.StatementSaveOne(statement, session)
@@ -360,6 +332,24 @@ func DepositBalance(paramLog *basic.ParamLog, statement domain.Statement, sessio
 	return nil
 }
 
+// balanceGuardError tells why a guarded balance update matched nothing
+func balanceGuardError(paramLog *basic.ParamLog, balanceID primitive.ObjectID, debit bool, session mongo.SessionContext) error {
+	balance, err := service.BalanceByID(balanceID.Hex(), session)
+	if err != nil {
+		return err
+	}
+
+	if balance.CurrentStatus() == domain.BALANCE_STATUS_CLOSED {
+		return utils.ErrorBadRequest(paramLog, utils.BalanceClosed, "Balance closed "+balanceID.Hex())
+	}
+
+	if (debit && !balance.CanDebit()) || (!debit && !balance.CanCredit()) {
+		return utils.ErrorBadRequest(paramLog, utils.BalanceFrozen, "Balance "+balance.CurrentStatus()+" "+balanceID.Hex())
+	}
+
+	return utils.ErrorBadRequest(paramLog, utils.InsufficientBalance, "Insufficient balance")
+}
+
 func StatementByBalanceID(paramLog *basic.ParamLog, balanceID string, page string, limit string) ([]domain.Statement, error) {
 	balance, err := service.BalanceByIDNoSession(balanceID)
 	if err != nil || balance.Owner.Type == "" {
@@ -540,61 +530,3 @@ func ProccedRAB(paramLog *basic.ParamLog, requestID string, status string, owner
 
 	return request, nil
 }
-
-func createVABalance(paramLog *basic.ParamLog, balance *domain.Balance, ownerName string) {
-
-	balanceName := ownerName + " " + balance.Name
-	gatewayXendit := gateway.XenditGateway{}
-
-	mandiriAccountNumber, err := gatewayXendit.CreateVA(paramLog, balance.ID.Hex(), balanceName, "MANDIRI")
-	if err != nil {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "MANDIRI",
-			AccountNumber: "Call administrator for fix this",
-		})
-	} else {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "MANDIRI",
-			AccountNumber: mandiriAccountNumber,
-		})
-	}
-
-	bniAccountNumber, err := gatewayXendit.CreateVA(paramLog, balance.ID.Hex(), balanceName, "BNI")
-	if err != nil {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "BNI",
-			AccountNumber: "Call administrator for fix this",
-		})
-	} else {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "BNI",
-			AccountNumber: bniAccountNumber,
-		})
-	}
-
-	briAccountNumber, err := gatewayXendit.CreateVA(paramLog, balance.ID.Hex(), balanceName, "BRI")
-	if err != nil {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "BRI",
-			AccountNumber: "Call administrator for fix this",
-		})
-	} else {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "BRI",
-			AccountNumber: briAccountNumber,
-		})
-	}
-
-	permataAccountNumber, err := gatewayXendit.CreateVA(paramLog, balance.ID.Hex(), balanceName, "PERMATA")
-	if err != nil {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "PERMATA",
-			AccountNumber: "Call administrator for fix this",
-		})
-	} else {
-		balance.VA = append(balance.VA, domain.VirtualAccount{
-			BankCode:      "PERMATA",
-			AccountNumber: permataAccountNumber,
-		})
-	}
-}
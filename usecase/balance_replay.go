@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ReplayBalance(paramLog *basic.ParamLog, balanceID string, at time.Time) (dto.BalanceReplay, error) {
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil || balance.Owner.Type == "" {
+		return dto.BalanceReplay{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	return replayBalance(paramLog, balance, at)
+}
+
+func ReplayCorporateBalances(paramLog *basic.ParamLog, corporateID string, at time.Time) ([]dto.BalanceReplay, error) {
+	ID, err := primitive.ObjectIDFromHex(corporateID)
+	if err != nil {
+		return []dto.BalanceReplay{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Invalid corporate id")
+	}
+
+	balances, err := service.BalancesByCorporateIDNoSession(paramLog, ID)
+	if err != nil {
+		return []dto.BalanceReplay{}, err
+	}
+
+	result := []dto.BalanceReplay{}
+	for _, balance := range balances {
+		replay, err := replayBalance(paramLog, balance, at)
+		if err != nil {
+			return []dto.BalanceReplay{}, err
+		}
+
+		result = append(result, replay)
+	}
+
+	return result, nil
+}
+
+func replayBalance(paramLog *basic.ParamLog, balance domain.Balance, at time.Time) (dto.BalanceReplay, error) {
+	statements, err := service.StatementsByBalanceIDUntil(paramLog, balance.ID, at)
+	if err != nil {
+		return dto.BalanceReplay{}, err
+	}
+
+	amount := 0
+	drift := 0
+	mismatches := []dto.BalanceReplayMismatch{}
+	for _, statement := range statements {
+		amount = amount + statement.Deposit - statement.Withdraw
+
+		difference := statement.Balance - amount
+		if difference != drift {
+			mismatches = append(mismatches, dto.BalanceReplayMismatch{
+				StatementID: statement.ID,
+				Reference:   statement.Reference,
+				Time:        statement.Time,
+				Stored:      statement.Balance,
+				Replayed:    amount,
+				Difference:  difference,
+			})
+			drift = difference
+		}
+	}
+
+	return dto.BalanceReplay{
+		BalanceID:      balance.ID,
+		CorporateID:    balance.CorporateID,
+		Name:           balance.Name,
+		Currency:       balance.Currency,
+		At:             at.Format(os.Getenv("TIME_FORMAT")),
+		Amount:         amount,
+		StatementCount: len(statements),
+		Mismatches:     mismatches,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const DEFAULT_BALANCE_DORMANT_DAY = 365
+
+// Transitions an operator may apply. A balance is only closed through CloseBalance so its remainder
+// is swept first, a closed balance never changes again.
+var balanceStatusTransitions = map[string][]string{
+	domain.BALANCE_STATUS_ACTIVE:       {domain.BALANCE_STATUS_FROZEN_DEBIT, domain.BALANCE_STATUS_FROZEN_ALL, domain.BALANCE_STATUS_DORMANT},
+	domain.BALANCE_STATUS_FROZEN_DEBIT: {domain.BALANCE_STATUS_ACTIVE, domain.BALANCE_STATUS_FROZEN_ALL},
+	domain.BALANCE_STATUS_FROZEN_ALL:   {domain.BALANCE_STATUS_ACTIVE, domain.BALANCE_STATUS_FROZEN_DEBIT},
+	domain.BALANCE_STATUS_DORMANT:      {domain.BALANCE_STATUS_ACTIVE, domain.BALANCE_STATUS_FROZEN_DEBIT, domain.BALANCE_STATUS_FROZEN_ALL},
+}
+
+func IsBalanceStatusTransitionAllowed(from string, to string) bool {
+	for _, status := range balanceStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ChangeBalanceStatus freezes, unfreezes or parks a balance as dormant on behalf of the corporate owning it
+func ChangeBalanceStatus(paramLog *basic.ParamLog, actor domain.ActorAble, balanceID string, status string,
+	reason string) (domain.Balance, error) {
+	if strings.TrimSpace(reason) == "" {
+		return domain.Balance{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Reason is required")
+	}
+
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil {
+		return domain.Balance{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	if actor.GetActorType() != domain.ACTOR_TYPE_CORPORATE || balance.CorporateID != actor.GetActorID() {
+		return domain.Balance{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceAccess, "Invalid balance access")
+	}
+
+	return changeBalanceStatus(paramLog, balance, status, actor.ToActorObject(), reason)
+}
+
+func changeBalanceStatus(paramLog *basic.ParamLog, balance domain.Balance, status string, actor domain.ActorObject,
+	reason string) (domain.Balance, error) {
+	var result domain.Balance
+	function := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			session.AbortTransaction(session)
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Balance status start transaction failed")
+		}
+
+		current, err := service.BalanceByID(balance.ID.Hex(), session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if !IsBalanceStatusTransitionAllowed(current.CurrentStatus(), status) {
+			session.AbortTransaction(session)
+			return utils.ErrorBadRequest(paramLog, utils.InvalidBalanceStatus,
+				"Balance can not move from "+current.CurrentStatus()+" to "+status)
+		}
+
+		result, err = SetBalanceStatus(paramLog, current, status, actor, reason, "", session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		return database.CommitWithRetry(session)
+	}
+
+	err := database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, function)
+		},
+	)
+
+	if err != nil {
+		return domain.Balance{}, err
+	}
+
+	return result, nil
+}
+
+// SetBalanceStatus moves the balance to status within the session and records the audit
+func SetBalanceStatus(paramLog *basic.ParamLog, balance domain.Balance, status string, actor domain.ActorObject,
+	reason string, transactionCode string, session mongo.SessionContext) (domain.Balance, error) {
+	updated, err := service.BalanceUpdateStatus(paramLog, balance.ID, balance.CurrentStatus(), status, session)
+	if err == mongo.ErrNoDocuments {
+		return domain.Balance{}, utils.ErrorConflict(paramLog, utils.BalanceConflict, "Balance status changed "+balance.ID.Hex())
+	}
+	if err != nil {
+		return domain.Balance{}, err
+	}
+
+	audit := domain.BalanceStatusAudit{
+		BalanceID:       balance.ID,
+		From:            balance.CurrentStatus(),
+		To:              status,
+		Actor:           actor,
+		Reason:          reason,
+		TransactionCode: transactionCode,
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+	}
+
+	err = service.BalanceStatusAuditSaveOne(&audit, session)
+	if err != nil {
+		return domain.Balance{}, err
+	}
+
+	return updated, nil
+}
+
+func BalanceStatusAudits(paramLog *basic.ParamLog, balanceID string) ([]domain.BalanceStatusAudit, error) {
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil {
+		return []domain.BalanceStatusAudit{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	return service.BalanceStatusAuditsByBalanceID(paramLog, balance.ID)
+}
+
+// MarkDormantBalances parks active balances without any statement for BALANCE_DORMANT_DAY days,
+// meant to be run by the host scheduler
+func MarkDormantBalances(paramLog *basic.ParamLog) (int, error) {
+	day, err := strconv.Atoi(os.Getenv("BALANCE_DORMANT_DAY"))
+	if err != nil || day <= 0 {
+		day = DEFAULT_BALANCE_DORMANT_DAY
+	}
+	cutoff := time.Now().AddDate(0, 0, -day)
+
+	lasts, err := service.StatementLastIDByBalance(paramLog)
+	if err != nil {
+		return 0, err
+	}
+
+	balances, err := service.BalancesNoSession(paramLog)
+	if err != nil {
+		return 0, err
+	}
+
+	actor := domain.ActorObject{Type: domain.ACTOR_TYPE_SYSTEM, Name: "MarkDormantBalances"}
+	reason := fmt.Sprintf("No activity for %v days", day)
+
+	marked := 0
+	for _, balance := range balances {
+		if balance.CurrentStatus() != domain.BALANCE_STATUS_ACTIVE {
+			continue
+		}
+
+		last, ok := lasts[balance.ID]
+		if !ok {
+			last = balance.ID
+		}
+
+		if !last.Timestamp().Before(cutoff) {
+			continue
+		}
+
+		_, err := changeBalanceStatus(paramLog, balance, domain.BALANCE_STATUS_DORMANT, actor, reason)
+		if err != nil {
+			basic.LogError2(paramLog, "MarkDormantBalances", err)
+			continue
+		}
+		marked++
+	}
+
+	return marked, nil
+}
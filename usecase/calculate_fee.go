@@ -2,13 +2,12 @@ package usecase
 
 import (
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/service"
-	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // source = user
@@ -41,6 +40,19 @@ import (
 // ==============================================
 // corporate transactionalStatement -
 
+// ============================================================== //
+
+// A corporate under a corporate pays its parent the same way, each level up to the principal
+// takes its own fee
+// source = user
+// corporate_level = reseller
+// to bank
+// ==============================================
+// source transactionStatement - & feeStatement -
+// reseller feeStatement + & feeStatement -
+// corporate feeStatement + & feeStatement -
+// principal feeStatement +
+
 type CalculateFee struct {
 	result          []domain.Statement
 	corporate       domain.Corporate
@@ -58,6 +70,35 @@ func (self *CalculateFee) Initialize(corporate domain.Corporate, balance domain.
 	self.transactionType = transaction.Type
 }
 
+// ApplyPromotions waives the fee legs a promotion covers and returns the transaction with the waivers
+// recorded and its fee lowered by the payer's waived leg. It is only applied to a transaction being made,
+// a stored transaction already carries its waivers.
+func (self *CalculateFee) ApplyPromotions(paramLog *basic.ParamLog) (domain.Transaction, error) {
+	waivers, err := FeeWaivers(paramLog, self.transaction)
+	if err != nil {
+		return self.transaction, err
+	}
+
+	legs := feeLegs(self.transaction.DetailsFee)
+	for _, waiver := range waivers {
+		if legs[0].Payer != waiver.Payer || legs[0].PayerID != waiver.PayerID {
+			continue
+		}
+
+		// the amount either includes the fee the payer is charged or has it taken off
+		if self.transaction.Amount == self.transaction.SubAmount+self.transaction.TotalFee {
+			self.transaction.Amount = self.transaction.Amount - waiver.Amount
+		} else if self.transaction.Amount == self.transaction.SubAmount-self.transaction.TotalFee {
+			self.transaction.Amount = self.transaction.Amount + waiver.Amount
+		}
+		self.transaction.TotalFee = self.transaction.TotalFee - waiver.Amount
+	}
+
+	self.transaction.FeeWaivers = waivers
+
+	return self.transaction, nil
+}
+
 func (self *CalculateFee) CalculateByOwnerAndTransaction(paramLog *basic.ParamLog) ([]domain.Statement, error) {
 	var err error
 	if self.balanceType == domain.ACTOR_TYPE_USER {
@@ -69,49 +110,59 @@ func (self *CalculateFee) CalculateByOwnerAndTransaction(paramLog *basic.ParamLo
 	return self.result, err
 }
 
-func (self *CalculateFee) RollbackFeeStatement(statements []domain.Statement) []domain.Statement {
+func (self *CalculateFee) RollbackFeeStatement(paramLog *basic.ParamLog, statements []domain.Statement) ([]domain.Statement, error) {
 	var result []domain.Statement
 	for _, element := range statements {
 
 		if element.Withdraw != 0 {
+			amount, err := domain.MoneyFromLegacy(element.Withdraw, element.Currency)
+			if err != nil {
+				return []domain.Statement{}, MoneyError(paramLog, err)
+			}
+
 			s := service.DepositFeeStatement(
 				element.BalanceID,
 				time.Now().Format(os.Getenv("TIME_FORMAT")),
 				element.Reference,
-				element.Withdraw,
+				amount,
 			)
 			result = append(result, s)
 		} else {
+			amount, err := domain.MoneyFromLegacy(element.Deposit, element.Currency)
+			if err != nil {
+				return []domain.Statement{}, MoneyError(paramLog, err)
+			}
+
 			s := service.WithdrawFeeStatement(
 				element.BalanceID,
 				time.Now().Format(os.Getenv("TIME_FORMAT")),
 				element.Reference,
-				element.Deposit,
+				amount,
 			)
 			result = append(result, s)
 		}
 	}
 
-	return result
+	return result, nil
 }
 
 func (self *CalculateFee) balanceUser(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) error {
 	if self.transactionType == domain.TRANSFER_BANK {
-		a, err := balanceUserTransferBank(corporate, userBalance, transaction)
+		a, err := balanceUserTransferBank(paramLog, corporate, userBalance, transaction)
 		if err != nil {
 			return err
 		}
 
 		self.result = a
 	} else if self.transactionType == domain.TOPUP {
-		a, err := balanceUserTopupBank(corporate, userBalance, transaction)
+		a, err := balanceUserTopupBank(paramLog, corporate, userBalance, transaction)
 		if err != nil {
 			return err
 		}
 
 		self.result = a
 	} else if self.transactionType == domain.TRANSFER_WALLET {
-		a, err := balanceUserTransferBalance(corporate, userBalance, transaction)
+		a, err := balanceUserTransferBalance(paramLog, corporate, userBalance, transaction)
 		if err != nil {
 			return err
 		}
@@ -131,28 +182,28 @@ func (self *CalculateFee) balanceUser(paramLog *basic.ParamLog, corporate domain
 
 func (self *CalculateFee) balanceCorporate(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) error {
 	if self.transactionType == domain.TRANSFER_BANK {
-		a, err := balanceCorporateTransferBank(corporate, corporateBalance, transaction)
+		a, err := balanceCorporateTransferBank(paramLog, corporate, corporateBalance, transaction)
 		if err != nil {
 			return err
 		}
 
 		self.result = a
 	} else if self.transactionType == domain.TOPUP {
-		a, err := balanceCorporateTopupBank(corporate, corporateBalance, transaction)
+		a, err := balanceCorporateTopupBank(paramLog, corporate, corporateBalance, transaction)
 		if err != nil {
 			return err
 		}
 
 		self.result = a
 	} else if self.transactionType == domain.TRANSFER_WALLET {
-		a, err := balanceCorporateTransferBalance(corporate, corporateBalance, transaction)
+		a, err := balanceCorporateTransferBalance(paramLog, corporate, corporateBalance, transaction)
 		if err != nil {
 			return err
 		}
 
 		self.result = a
 	} else if self.transactionType == domain.DEDUCT {
-		a, err := balanceCorporateDeductBalance(corporate, corporateBalance, transaction)
+		a, err := balanceCorporateDeductBalance(paramLog, corporate, corporateBalance, transaction)
 		if err != nil {
 			return err
 		}
@@ -170,8 +221,12 @@ func (self *CalculateFee) balanceCorporate(paramLog *basic.ParamLog, corporate d
 	return nil
 }
 
-func balanceUserTransferBank(corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	userFee := corporate.FeeUser.TransferBank
+func balanceUserTransferBank(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	userFee, err := userLegFee(paramLog, corporate, userBalance, transaction)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
 	userBalanceID := userBalance.ID
 	corporateBalanceID := corporate.MainBalance
 
@@ -183,48 +238,25 @@ func balanceUserTransferBank(corporate domain.Corporate, userBalance domain.Bala
 	result = append(result, withdrawUser)
 	result = append(result, depositCorporate)
 
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.TransferBank
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+	cascade, err := feeCascade(paramLog, corporate, transaction)
+	if err != nil {
+		return result, err
 	}
+	result = append(result, cascade...)
 
 	return result, nil
 }
 
-func balanceCorporateTransferBank(corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	var result []domain.Statement
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.TransferBank
-		corporateBalanceID := corporate.MainBalance
-		principalBalanceID := principal.MainBalance
+func balanceCorporateTransferBank(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	return feeCascade(paramLog, corporate, transaction)
+}
 
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+func balanceUserTopupBank(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	userFee, err := userLegFee(paramLog, corporate, userBalance, transaction)
+	if err != nil {
+		return []domain.Statement{}, err
 	}
 
-	return result, nil
-}
-
-func balanceUserTopupBank(corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	userFee := corporate.FeeUser.Topup
 	userBalanceID := userBalance.ID
 	corporateBalanceID := corporate.MainBalance
 
@@ -236,48 +268,25 @@ func balanceUserTopupBank(corporate domain.Corporate, userBalance domain.Balance
 	result = append(result, withdrawUser)
 	result = append(result, depositCorporate)
 
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.Topup
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+	cascade, err := feeCascade(paramLog, corporate, transaction)
+	if err != nil {
+		return result, err
 	}
+	result = append(result, cascade...)
 
 	return result, nil
 }
 
-func balanceCorporateTopupBank(corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	var result []domain.Statement
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.Topup
-		corporateBalanceID := corporate.MainBalance
-		principalBalanceID := principal.MainBalance
+func balanceCorporateTopupBank(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	return feeCascade(paramLog, corporate, transaction)
+}
 
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+func balanceUserTransferBalance(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	userFee, err := userLegFee(paramLog, corporate, userBalance, transaction)
+	if err != nil {
+		return []domain.Statement{}, err
 	}
 
-	return result, nil
-}
-
-func balanceUserTransferBalance(corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	userFee := corporate.FeeUser.TransferBalance
 	userBalanceID := userBalance.ID
 	corporateBalanceID := corporate.MainBalance
 
@@ -289,90 +298,32 @@ func balanceUserTransferBalance(corporate domain.Corporate, userBalance domain.B
 	result = append(result, withdrawUser)
 	result = append(result, depositCorporate)
 
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.TransferBalance
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+	cascade, err := feeCascade(paramLog, corporate, transaction)
+	if err != nil {
+		return result, err
 	}
+	result = append(result, cascade...)
 
 	return result, nil
 }
 
-func balanceCorporateTransferBalance(corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	var result []domain.Statement
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.TransferBalance
-		corporateBalanceID := corporate.MainBalance
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
-	}
-
-	return result, nil
+func balanceCorporateTransferBalance(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	return feeCascade(paramLog, corporate, transaction)
 }
 
-func balanceCorporateDeductBalance(corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
-	var result []domain.Statement
-	if IsNotPrincipal(corporate) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
-		if err != nil {
-			return result, err
-		}
-
-		corporateFee := corporate.FeeCorporate.Deduct
-		corporateBalanceID := corporate.MainBalance
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
-	}
-
-	return result, nil
+func balanceCorporateDeductBalance(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
+	return feeCascade(paramLog, corporate, transaction)
 }
 
 // TODO PROVIDE LOGIC FOR PRINCIPAL CAN ACCEPT MONEY FROM MULTICURRENCY TRANSACTION
 func balanceCorporateAcceptPaymentCard(paramLog *basic.ParamLog, corporate domain.Corporate, corporateBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
 	var result []domain.Statement
-	if IsNotPrincipal(corporate) && IsNotIDRCurrency(transaction.Currency) {
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
+	if IsNotIDRCurrency(transaction.Currency) {
+		cascade, err := feeCascade(paramLog, corporate, transaction)
 		if err != nil {
 			return result, err
 		}
-
-		percentageFee, err := strconv.ParseFloat(corporate.FeeCorporate.AcceptPaymentCard, 64)
-		if err != nil {
-			return result, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert accept payment card fee")
-		}
-
-		corporateFee := int(float64(transaction.SubAmount) * percentageFee)
-
-		corporateBalanceID := corporate.MainBalance
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+		result = append(result, cascade...)
 	}
 
 	return result, nil
@@ -381,13 +332,11 @@ func balanceCorporateAcceptPaymentCard(paramLog *basic.ParamLog, corporate domai
 // TODO PROVIDE LOGIC FOR PRINCIPAL CAN ACCEPT MONEY FROM MULTICURRENCY TRANSACTION
 func balanceUserAcceptPaymentCard(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) ([]domain.Statement, error) {
 	var result []domain.Statement
-	percentageFee, err := strconv.ParseFloat(corporate.FeeUser.AcceptPaymentCard, 64)
+	userFee, err := userLegFee(paramLog, corporate, userBalance, transaction)
 	if err != nil {
-		return result, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert accept payment card fee")
+		return result, err
 	}
 
-	userFee := int(float64(transaction.SubAmount) * percentageFee)
-
 	userBalanceID := userBalance.ID
 	corporateBalanceID := corporate.MainBalance
 
@@ -397,26 +346,12 @@ func balanceUserAcceptPaymentCard(paramLog *basic.ParamLog, corporate domain.Cor
 	result = append(result, withdrawUser)
 	result = append(result, depositCorporate)
 
-	if IsNotPrincipal(corporate) && IsNotIDRCurrency(transaction.Currency) {
-
-		percentageFee, err := strconv.ParseFloat(corporate.FeeCorporate.AcceptPaymentCard, 64)
-		if err != nil {
-			return result, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert accept payment card fee")
-		}
-
-		principal, err := service.CorporateByIDNoSession(corporate.Parent.Hex())
+	if IsNotIDRCurrency(transaction.Currency) {
+		cascade, err := feeCascade(paramLog, corporate, transaction)
 		if err != nil {
 			return result, err
 		}
-
-		corporateFee := int(float64(transaction.SubAmount) * percentageFee)
-		principalBalanceID := principal.MainBalance
-
-		withdrawCorporate := service.WithdrawFeeStatement(corporateBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-		depositPrincipal := service.DepositFeeStatement(principalBalanceID, transaction.Time, transaction.TransactionCode, corporateFee)
-
-		result = append(result, withdrawCorporate)
-		result = append(result, depositPrincipal)
+		result = append(result, cascade...)
 	}
 
 	return result, nil
@@ -431,9 +366,74 @@ func IsNotPrincipal(corporate domain.Corporate) bool {
 }
 
 func IsNotIDRCurrency(currency string) bool {
-	if currency != "idr" {
+	if domain.NormalizeCurrency(currency) != domain.CURRENCY_IDR {
 		return true
 	}
 
 	return false
 }
+
+func userLegFee(paramLog *basic.ParamLog, corporate domain.Corporate, userBalance domain.Balance, transaction domain.Transaction) (domain.Money, error) {
+	return legFee(paramLog, corporate, domain.ACTOR_TYPE_USER, userBalance.Owner.ID, transaction)
+}
+
+// feeCascade makes every corporate from the given one up to the principal pay its parent,
+// one statement pair per hop
+func feeCascade(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction) ([]domain.Statement, error) {
+	chain, err := CorporateChain(paramLog, corporate)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	var result []domain.Statement
+	for i := 0; i < len(chain)-1; i++ {
+		fee, err := legFee(paramLog, chain[i], domain.ACTOR_TYPE_CORPORATE, chain[i].ID, transaction)
+		if err != nil {
+			return result, err
+		}
+
+		withdrawCorporate := service.WithdrawFeeStatement(chain[i].MainBalance, transaction.Time, transaction.TransactionCode, fee)
+		depositParent := service.DepositFeeStatement(chain[i+1].MainBalance, transaction.Time, transaction.TransactionCode, fee)
+		result = append(result, withdrawCorporate)
+		result = append(result, depositParent)
+	}
+
+	return result, nil
+}
+
+// The fee details recorded on the transaction are posted as they are so a rollback reverses exactly
+// what was committed, transactions without details of the payer are priced by the schedule.
+// A transaction has one user leg, corporate legs are told apart by the paying corporate.
+func legFee(paramLog *basic.ParamLog, corporate domain.Corporate, payer string, payerID primitive.ObjectID,
+	transaction domain.Transaction) (domain.Money, error) {
+	found := false
+	total := 0
+	for _, detail := range transaction.DetailsFee {
+		if detail.Payer == payer && (payer == domain.ACTOR_TYPE_USER || detail.PayerID == payerID) {
+			found = true
+			total = total + detail.Amount
+		}
+	}
+
+	if found {
+		for _, waiver := range transaction.FeeWaivers {
+			if waiver.Payer == payer && (payer == domain.ACTOR_TYPE_USER || waiver.PayerID == payerID) {
+				total = total - waiver.Amount
+			}
+		}
+
+		return feeMoney(paramLog, total, transaction.Currency)
+	}
+
+	subAmount, err := domain.MoneyFromLegacy(transaction.SubAmount, transaction.Currency)
+	if err != nil {
+		return domain.Money{}, MoneyError(paramLog, err)
+	}
+
+	fee, _, err := FeeLeg(paramLog, corporate, payer, payerID, transaction.Type, subAmount)
+	if err != nil {
+		return domain.Money{}, err
+	}
+
+	return fee, nil
+}
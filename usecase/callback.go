@@ -1,245 +1,37 @@
 package usecase
 
 import (
-	"encoding/json"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/kangdjoker/takeme-core/domain"
-	"github.com/kangdjoker/takeme-core/service"
-	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 )
 
+// PublishBulkCallback tells the corporate the bulk changed status, the outbox retries it until delivered
 func PublishBulkCallback(paramLog *basic.ParamLog, corporate domain.Corporate, actor domain.ActorObject, bulkID string,
 	bulkStatus string, url string) {
-	minute := 1
-
-	for {
-		payload := createBulkPayload(corporate, actor, bulkID, bulkStatus)
-		err := callbackBulkHTTP(paramLog, corporate, payload, url)
-		if err != nil {
-			minute = minute * 5
-			time.Sleep(time.Duration(minute) * time.Minute)
-			continue
-		}
-
-		return
-	}
+	PublishWebhooks(paramLog, BulkWebhook(corporate, actor, bulkID, bulkStatus, url))
 }
 
 func PublishTopupCallback(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) {
-	minute := 1
-
-	for {
-		payload := createTopupPayload(corporate, balance, transaction)
-		err := callbackTopupHTTP(paramLog, corporate, transaction, payload)
-		if err != nil {
-			minute = minute * 5
-			time.Sleep(time.Duration(minute) * time.Minute)
-			continue
-		}
-
-		return
-	}
+	PublishWebhooks(paramLog, TopupWebhook(corporate, balance, transaction))
 }
 
 func PublishDeductCallback(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) {
-	minute := 1
-
-	for {
-		payload := createDeductPayload(corporate, balance, transaction)
-		err := callbackDeductHTTP(paramLog, corporate, transaction, payload)
-		if err != nil {
-			minute = minute * 5
-			time.Sleep(time.Duration(minute) * time.Minute)
-			continue
-		}
-
-		return
-	}
+	PublishWebhooks(paramLog, DeductWebhook(corporate, balance, transaction))
 }
 
 func PublishTransferCallback(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction) {
-	// minute := 1
-
-	// for {
-	payload := createTransferPayload(corporate, transaction)
-	// err := callbackTransferHTTP(paramLog, corporate, transaction, payload)
-	callbackTransferHTTP(paramLog, corporate, transaction, payload)
-	// if err != nil {
-	// 	minute = minute * 5
-	// 	time.Sleep(time.Duration(minute) * time.Minute)
-	// 	continue
-	// }
-
-	// return
-	// }
+	PublishWebhooks(paramLog, TransferWebhook(corporate, transaction))
 }
 
 func PublishAcceptPaymentCallback(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) {
-	minute := 1
-
-	for {
-		payload := createAcceptPaymentPayload(corporate, balance, transaction)
-		err := callbackAcceptPaymentHTTP(paramLog, corporate, transaction, payload)
-		if err != nil {
-			minute = minute * 5
-			time.Sleep(time.Duration(minute) * time.Minute)
-			continue
-		}
-
-		return
-	}
-}
-
-func callbackTopupHTTP(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction, payload TopupCallbackPayload) error {
-	url := corporate.VACallbackURL
-
-	if url == "" {
-		return nil
-	}
-
-	callbackToken := corporate.CallbackToken
-
-	client := resty.New().SetTimeout(30 * time.Second)
-	resp, err := client.R().
-		SetHeaders(map[string]string{
-			"Content-Type":   "application/json",
-			"callback-token": callbackToken,
-		}).SetBody(payload).Post(url)
-
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, resp.Request.Body, "Callback topup corporate")
-
-	reqBody, _ := json.Marshal(payload)
-
-	if resp.StatusCode() != 200 || err != nil {
-		go service.CreateCallbackHistoryRefused(paramLog, transaction.TransactionCode, url, string(reqBody))
-		return utils.ErrorInternalServer(paramLog, utils.CallbackError, "Callback topup corporate connection refused or Timeout")
-	}
-
-	go service.CreateCallbackHistory(paramLog, transaction.TransactionCode, url,
-		string(reqBody), string(resp.Body()), strconv.Itoa(resp.StatusCode()))
-
-	return nil
-}
-
-func callbackDeductHTTP(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction, payload DeductCallbackPayload) error {
-	url := corporate.DeductCallbackURL
-
-	if url == "" {
-		return nil
-	}
-
-	callbackToken := corporate.CallbackToken
-
-	client := resty.New().SetTimeout(30 * time.Second)
-	resp, err := client.R().
-		SetHeaders(map[string]string{
-			"Content-Type":   "application/json",
-			"callback-token": callbackToken,
-		}).SetBody(payload).Post(url)
-
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, resp.Request.Body, "Callback deduct corporate")
-
-	reqBody, _ := json.Marshal(payload)
-
-	if resp.StatusCode() != 200 || err != nil {
-		go service.CreateCallbackHistoryRefused(paramLog, transaction.TransactionCode, url, string(reqBody))
-		return utils.ErrorInternalServer(paramLog, utils.CallbackError, "Callback deduct corporate connection refused or Timeout")
-	}
-
-	go service.CreateCallbackHistory(paramLog, transaction.TransactionCode, url,
-		string(reqBody), string(resp.Body()), strconv.Itoa(resp.StatusCode()))
-
-	return nil
-}
-
-func callbackTransferHTTP(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction, payload TransferCallbackPayload) error {
-	url := corporate.TransferCallbackURL
-
-	if url == "" {
-		return nil
-	}
-
-	callbackToken := corporate.CallbackToken
-
-	client := resty.New().SetTimeout(30 * time.Second)
-	resp, err := client.R().
-		SetHeaders(map[string]string{
-			"Content-Type":   "application/json",
-			"callback-token": callbackToken,
-		}).SetBody(payload).Post(url)
-
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, resp.Body, "Callback transfer corporate")
-
-	reqBody, _ := json.Marshal(payload)
-
-	if resp.StatusCode() != 200 || err != nil {
-		go service.CreateCallbackHistoryRefused(paramLog, transaction.TransactionCode, url, string(reqBody))
-		return utils.ErrorInternalServer(paramLog, utils.CallbackError, "Callback transfer corporate connection refused or Timeout")
-	}
-
-	go service.CreateCallbackHistory(paramLog, transaction.TransactionCode, url,
-		string(reqBody), string(resp.Body()), strconv.Itoa(resp.StatusCode()))
-
-	return nil
+	PublishWebhooks(paramLog, AcceptPaymentWebhook(corporate, balance, transaction))
 }
 
-func callbackBulkHTTP(paramLog *basic.ParamLog, corporate domain.Corporate, payload interface{}, url string) error {
-	if url == "" {
-		return nil
-	}
-
-	callbackToken := corporate.CallbackToken
-
-	client := resty.New().SetTimeout(30 * time.Second)
-	resp, err := client.R().
-		SetHeaders(map[string]string{
-			"Content-Type":   "application/json",
-			"callback-token": callbackToken,
-		}).SetBody(payload).Post(url)
-
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, resp.Body, "Callback bulk corporate")
-
-	if resp.StatusCode() != 200 || err != nil {
-		return utils.ErrorInternalServer(paramLog, utils.CallbackError, "Callback bulk corporate connection refused or Timeout")
-	}
-
-	return nil
-}
-
-func callbackAcceptPaymentHTTP(paramLog *basic.ParamLog, corporate domain.Corporate, transaction domain.Transaction, payload AcceptPaymentCallbackPayload) error {
-	url := corporate.AccecptPaymentCallbackURL
-
-	if url == "" {
-		return nil
-	}
-
-	callbackToken := corporate.CallbackToken
-
-	client := resty.New().SetTimeout(30 * time.Second)
-	resp, err := client.R().
-		SetHeaders(map[string]string{
-			"Content-Type":   "application/json",
-			"callback-token": callbackToken,
-		}).SetBody(payload).Post(url)
-
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, resp.Request.Body, "Callback topup corporate")
-
-	reqBody, _ := json.Marshal(payload)
-
-	if resp.StatusCode() != 200 || err != nil {
-		go service.CreateCallbackHistoryRefused(paramLog, transaction.TransactionCode, url, string(reqBody))
-		return utils.ErrorInternalServer(paramLog, utils.CallbackError, "Callback topup corporate connection refused or Timeout")
-	}
-
-	go service.CreateCallbackHistory(paramLog, transaction.TransactionCode, url,
-		string(reqBody), string(resp.Body()), strconv.Itoa(resp.StatusCode()))
-
-	return nil
+func PublishVAInvoiceCallback(paramLog *basic.ParamLog, corporate domain.Corporate, invoice domain.VAInvoice, transaction domain.Transaction) {
+	PublishWebhooks(paramLog, VAInvoiceWebhook(corporate, invoice, transaction))
 }
 
 func createTopupPayload(corporate domain.Corporate, balance domain.Balance,
@@ -260,6 +52,26 @@ func createTopupPayload(corporate domain.Corporate, balance domain.Balance,
 	}
 }
 
+func createVAInvoicePayload(invoice domain.VAInvoice, transaction domain.Transaction) VAInvoiceCallbackPayload {
+
+	return VAInvoiceCallbackPayload{
+		ExternalID: invoice.ExternalID,
+		InvoiceID:  invoice.ID.Hex(),
+		BalanceID:  invoice.BalanceID.Hex(),
+		VA: VACBPayload{
+			BankCode: invoice.BankCode,
+			Number:   invoice.AccountNumber,
+		},
+		CorporateID:     invoice.CorporateID.Hex(),
+		TransactionCode: transaction.TransactionCode,
+		Amount:          transaction.Amount,
+		InvoiceAmount:   invoice.Amount,
+		Status:          invoice.Status,
+		PaidAt:          invoice.PaidAt,
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+	}
+}
+
 func createDeductPayload(corporate domain.Corporate, balance domain.Balance,
 	transaction domain.Transaction) DeductCallbackPayload {
 
@@ -330,6 +142,20 @@ type VACBPayload struct {
 	Number   string `json:"number" bson:"number"`
 }
 
+type VAInvoiceCallbackPayload struct {
+	ExternalID      string      `json:"external_id" bson:"external_id,omitempty"`
+	InvoiceID       string      `json:"invoice_id" bson:"invoice_id,omitempty"`
+	BalanceID       string      `json:"balance_id" bson:"balance_id,omitempty"`
+	VA              VACBPayload `json:"va" bson:"va"`
+	CorporateID     string      `json:"corporate_id" bson:"corporate_id,omitempty"`
+	TransactionCode string      `json:"transaction_code" bson:"transaction_code,omitempty"`
+	Amount          int         `json:"amount" bson:"amount,omitempty"`
+	InvoiceAmount   int         `json:"invoice_amount" bson:"invoice_amount,omitempty"`
+	Status          string      `json:"status" bson:"status,omitempty"`
+	PaidAt          string      `json:"paid_at" bson:"paid_at,omitempty"`
+	Time            string      `json:"time" bson:"time,omitempty"`
+}
+
 type DeductCallbackPayload struct {
 	ExternalID      string             `json:"external_id" bson:"external_id,omitempty"`
 	BalanceID       string             `json:"balance_id" bson:"balance_id,omitempty"`
@@ -2,6 +2,8 @@ package usecase
 
 import (
 	"context"
+	"os"
+	"strconv"
 
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/domain/dto"
@@ -9,6 +11,7 @@ import (
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
@@ -131,3 +134,40 @@ func CorporateCheck(paramLog *basic.ParamLog, corporate domain.Corporate) (dto.C
 
 	return result, nil
 }
+
+const DEFAULT_CORPORATE_HIERARCHY_MAX_DEPTH = 5
+
+// CorporateChain returns the corporate followed by its parent, grandparent and so on up to the
+// principal. A hierarchy that loops or is deeper than CORPORATE_HIERARCHY_MAX_DEPTH is refused.
+func CorporateChain(paramLog *basic.ParamLog, corporate domain.Corporate) ([]domain.Corporate, error) {
+	maxDepth, err := strconv.Atoi(os.Getenv("CORPORATE_HIERARCHY_MAX_DEPTH"))
+	if err != nil || maxDepth <= 0 {
+		maxDepth = DEFAULT_CORPORATE_HIERARCHY_MAX_DEPTH
+	}
+
+	chain := []domain.Corporate{corporate}
+	visited := map[primitive.ObjectID]bool{corporate.ID: true}
+	current := corporate
+	for IsNotPrincipal(current) {
+		if visited[current.Parent] {
+			return []domain.Corporate{}, utils.ErrorInternalServer(paramLog, utils.CorporateHierarchyInvalid,
+				"Corporate hierarchy loops at "+current.Parent.Hex())
+		}
+
+		if len(chain) > maxDepth {
+			return []domain.Corporate{}, utils.ErrorInternalServer(paramLog, utils.CorporateHierarchyInvalid,
+				"Corporate hierarchy deeper than "+strconv.Itoa(maxDepth)+" from "+corporate.ID.Hex())
+		}
+
+		parent, err := service.CorporateByIDNoSession(current.Parent.Hex())
+		if err != nil {
+			return []domain.Corporate{}, err
+		}
+
+		visited[parent.ID] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,496 @@
+package usecase
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const FEE_PERIOD_FORMAT = "2006-01"
+
+const (
+	DEFAULT_INVOICE_DUE_DAY  = 14
+	DEFAULT_INVOICE_VAT_RATE = "0.11"
+)
+
+var invoiceStatusTransitions = map[string][]string{
+	domain.INVOICE_ISSUED_STATUS:  {domain.INVOICE_PAID_STATUS, domain.INVOICE_OVERDUE_STATUS, domain.INVOICE_VOID_STATUS},
+	domain.INVOICE_OVERDUE_STATUS: {domain.INVOICE_PAID_STATUS, domain.INVOICE_VOID_STATUS},
+}
+
+// RunMonthlyFeeInvoicing accrues the fees of the previous month and invoices them
+func RunMonthlyFeeInvoicing(paramLog *basic.ParamLog) ([]domain.Invoice, error) {
+	now := time.Now()
+	period := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0).Format(FEE_PERIOD_FORMAT)
+
+	_, err := AccrueFees(paramLog, period)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	return IssueFeeInvoices(paramLog, period)
+}
+
+func FeePeriodRange(paramLog *basic.ParamLog, period string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(FEE_PERIOD_FORMAT, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, utils.ErrorBadRequest(paramLog, utils.InvalidFeePeriod, "Invalid fee period")
+	}
+
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// AccrueFees sums the fee statements posted in the period by paying corporate, receiver, transaction
+// type and currency. Fee statements come in pairs of payer and receiver, a rollback posts the pair
+// reversed under the same reference so it is taken off the month it was posted in.
+func AccrueFees(paramLog *basic.ParamLog, period string) ([]domain.FeeAccrual, error) {
+	from, to, err := FeePeriodRange(paramLog, period)
+	if err != nil {
+		return []domain.FeeAccrual{}, err
+	}
+
+	statements, err := service.StatementsFeeBetween(paramLog, from, to)
+	if err != nil {
+		return []domain.FeeAccrual{}, err
+	}
+
+	references := []string{}
+	byReference := map[string][]domain.Statement{}
+	balanceIDs := []primitive.ObjectID{}
+	seenBalance := map[primitive.ObjectID]bool{}
+	for _, statement := range statements {
+		if _, ok := byReference[statement.Reference]; !ok {
+			references = append(references, statement.Reference)
+		}
+		byReference[statement.Reference] = append(byReference[statement.Reference], statement)
+
+		if !seenBalance[statement.BalanceID] {
+			seenBalance[statement.BalanceID] = true
+			balanceIDs = append(balanceIDs, statement.BalanceID)
+		}
+	}
+
+	owners, err := balanceOwners(paramLog, balanceIDs)
+	if err != nil {
+		return []domain.FeeAccrual{}, err
+	}
+
+	types, err := transactionTypes(paramLog, references)
+	if err != nil {
+		return []domain.FeeAccrual{}, err
+	}
+
+	keys := []string{}
+	accruals := map[string]*domain.FeeAccrual{}
+	for _, reference := range references {
+		pairs := byReference[reference]
+		for i := 0; i+1 < len(pairs); i += 2 {
+			payer, receiver := pairs[i], pairs[i+1]
+
+			amount, count := payer.Withdraw, 1
+			if payer.Withdraw == 0 {
+				amount, count = -payer.Deposit, -1
+			}
+
+			owner := owners[payer.BalanceID]
+			if amount == 0 || owner.Type != domain.ACTOR_TYPE_CORPORATE {
+				continue
+			}
+
+			accrual := domain.FeeAccrual{
+				Period:          period,
+				CorporateID:     owner.ID,
+				ReceiverID:      owners[receiver.BalanceID].ID,
+				TransactionType: types[reference],
+				Currency:        domain.NormalizeCurrency(payer.Currency),
+			}
+
+			key := fmt.Sprintf("%v:%v:%v:%v", accrual.CorporateID.Hex(), accrual.ReceiverID.Hex(),
+				accrual.TransactionType, accrual.Currency)
+			if _, ok := accruals[key]; !ok {
+				keys = append(keys, key)
+				accruals[key] = &accrual
+			}
+
+			accruals[key].Count = accruals[key].Count + count
+			accruals[key].Amount = accruals[key].Amount + amount
+		}
+	}
+
+	result := []domain.FeeAccrual{}
+	for _, key := range keys {
+		accrual := accruals[key]
+		accrual.Time = utils.TimestampNow()
+
+		err = service.FeeAccrualUpsert(paramLog, accrual)
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, *accrual)
+	}
+
+	basic.LogInformation2(paramLog, "AccrueFees", fmt.Sprintf("period %v accruals %v", period, len(result)))
+
+	return result, nil
+}
+
+// IssueFeeInvoices bills every corporate for what it accrued in the period, one invoice per receiver
+// and currency, bringing in the credit carried from the previous period. Invoices issued before for
+// the period are returned as they are.
+func IssueFeeInvoices(paramLog *basic.ParamLog, period string) ([]domain.Invoice, error) {
+	from, _, err := FeePeriodRange(paramLog, period)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	accruals, err := service.FeeAccrualsByPeriodNoSession(paramLog, period)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	previous := from.AddDate(0, -1, 0).Format(FEE_PERIOD_FORMAT)
+	carriedInvoices, err := service.InvoicesByPeriodStatusNoSession(paramLog, previous, domain.INVOICE_CARRIED_STATUS)
+	if err != nil {
+		return []domain.Invoice{}, err
+	}
+
+	numbers := []string{}
+	byNumber := map[string][]domain.FeeAccrual{}
+	for _, accrual := range accruals {
+		number := invoiceNumber(period, accrual)
+		if _, ok := byNumber[number]; !ok {
+			numbers = append(numbers, number)
+		}
+		byNumber[number] = append(byNumber[number], accrual)
+	}
+
+	carried := map[string]domain.FeeAccrual{}
+	for _, invoice := range carriedInvoices {
+		accrual := domain.FeeAccrual{
+			Period:          invoice.Period,
+			CorporateID:     invoice.CorporateID,
+			ReceiverID:      invoice.IssuerID,
+			TransactionType: domain.INVOICE_LINE_CARRIED,
+			Currency:        invoice.Currency,
+			Amount:          invoice.SubTotal,
+		}
+
+		number := invoiceNumber(period, accrual)
+		if _, ok := byNumber[number]; !ok {
+			numbers = append(numbers, number)
+		}
+		carried[number] = accrual
+	}
+
+	result := []domain.Invoice{}
+	for _, number := range numbers {
+		invoice, err := service.InvoiceByNumberNoSession(number)
+		if err == nil {
+			result = append(result, invoice)
+			continue
+		}
+
+		lines := byNumber[number]
+		if credit, ok := carried[number]; ok {
+			lines = append(lines, credit)
+		}
+
+		invoice, err = createInvoice(paramLog, number, period, lines)
+		if err != nil {
+			return result, err
+		}
+
+		if invoice.SubTotal == 0 {
+			basic.LogInformation2(paramLog, "IssueFeeInvoices", "nothing to bill on "+number)
+			continue
+		}
+
+		err = service.InvoiceSaveOne(paramLog, &invoice)
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, invoice)
+	}
+
+	return result, nil
+}
+
+func invoiceNumber(period string, accrual domain.FeeAccrual) string {
+	issuer := accrual.ReceiverID.Hex()
+	return fmt.Sprintf("INV/%v/%v/%v/%v", strings.ReplaceAll(period, "-", ""), issuer[len(issuer)-6:],
+		accrual.CorporateID.Hex(), accrual.Currency)
+}
+
+func createInvoice(paramLog *basic.ParamLog, number string, period string, accruals []domain.FeeAccrual) (domain.Invoice, error) {
+	corporate, err := service.CorporateByIDNoSession(accruals[0].CorporateID.Hex())
+	if err != nil {
+		return domain.Invoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Corporate of fee accrual not found")
+	}
+
+	issuer, err := service.CorporateByIDNoSession(accruals[0].ReceiverID.Hex())
+	if err != nil {
+		return domain.Invoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Receiver of fee accrual not found")
+	}
+
+	now := time.Now()
+	invoice := domain.Invoice{
+		Number:      number,
+		Period:      period,
+		CorporateID: corporate.ID,
+		Name:        corporate.Name,
+		Address:     corporate.Address,
+		TaxID:       corporate.TaxID,
+		IssuerID:    issuer.ID,
+		IssuerName:  issuer.Name,
+		IssuerTaxID: issuer.TaxID,
+		Currency:    accruals[0].Currency,
+		Lines:       []domain.InvoiceLine{},
+		TaxLines:    []domain.InvoiceTaxLine{},
+		Status:      domain.INVOICE_ISSUED_STATUS,
+		IssuedAt:    now.Format(os.Getenv("TIME_FORMAT")),
+		DueAt:       now.AddDate(0, 0, invoiceDueDay()).Format(os.Getenv("TIME_FORMAT")),
+		Time:        now.Format(os.Getenv("TIME_FORMAT")),
+	}
+
+	for _, accrual := range accruals {
+		if accrual.Amount == 0 {
+			continue
+		}
+
+		description := "Fee " + strings.ReplaceAll(accrual.TransactionType, "_", " ")
+		if accrual.TransactionType == domain.INVOICE_LINE_CARRIED {
+			description = "Credit carried from " + accrual.Period
+		}
+
+		invoice.Lines = append(invoice.Lines, domain.InvoiceLine{
+			TransactionType: accrual.TransactionType,
+			Description:     description,
+			Count:           accrual.Count,
+			Amount:          accrual.Amount,
+		})
+		invoice.SubTotal = invoice.SubTotal + accrual.Amount
+	}
+
+	if invoice.SubTotal < 0 {
+		invoice.Status = domain.INVOICE_CARRIED_STATUS
+		invoice.DueAt = ""
+	}
+
+	if invoice.SubTotal <= 0 {
+		invoice.Total = invoice.SubTotal
+		return invoice, nil
+	}
+
+	rate := os.Getenv("INVOICE_VAT_RATE")
+	if rate == "" {
+		rate = DEFAULT_INVOICE_VAT_RATE
+	}
+
+	tax, err := invoiceTax(paramLog, invoice.SubTotal, invoice.Currency, rate)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	if tax != 0 {
+		invoice.TaxLines = append(invoice.TaxLines, domain.InvoiceTaxLine{
+			Name:   "VAT",
+			Rate:   rate,
+			Base:   invoice.SubTotal,
+			Amount: tax,
+		})
+		invoice.TotalTax = tax
+	}
+
+	invoice.Total = invoice.SubTotal + invoice.TotalTax
+
+	return invoice, nil
+}
+
+// invoiceTax is rate of subTotal rounded once to the unit invoices are kept in
+func invoiceTax(paramLog *basic.ParamLog, subTotal int, currency string, rate string) (int, error) {
+	base, err := domain.MoneyFromLegacy(subTotal, currency)
+	if err != nil {
+		return 0, MoneyError(paramLog, err)
+	}
+
+	tax, err := base.MultiplyRate(rate)
+	if err != nil {
+		return 0, MoneyError(paramLog, err)
+	}
+
+	return tax.Legacy(), nil
+}
+
+func invoiceDueDay() int {
+	day, err := strconv.Atoi(os.Getenv("INVOICE_DUE_DAY"))
+	if err != nil || day <= 0 {
+		day = DEFAULT_INVOICE_DUE_DAY
+	}
+
+	return day
+}
+
+func ChangeInvoiceStatus(paramLog *basic.ParamLog, invoiceID string, status string) (domain.Invoice, error) {
+	invoice, err := service.InvoiceByIDNoSession(invoiceID)
+	if err != nil {
+		return domain.Invoice{}, utils.ErrorBadRequest(paramLog, utils.InvoiceNotFound, "Invoice not found")
+	}
+
+	allowed := false
+	for _, next := range invoiceStatusTransitions[invoice.Status] {
+		if next == status {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		return domain.Invoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidInvoiceStatus,
+			fmt.Sprintf("Invoice can not change from %v to %v", invoice.Status, status))
+	}
+
+	invoice.Status = status
+	if status == domain.INVOICE_PAID_STATUS {
+		invoice.PaidAt = utils.TimestampNow()
+	}
+
+	err = service.InvoiceUpdateOne(paramLog, &invoice)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return invoice, nil
+}
+
+// MarkOverdueInvoices moves issued invoices past their due time to overdue
+func MarkOverdueInvoices(paramLog *basic.ParamLog) (int, error) {
+	invoices, err := service.InvoicesByStatusNoSession(paramLog, domain.INVOICE_ISSUED_STATUS)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	now := time.Now()
+	for _, invoice := range invoices {
+		dueAt, err := utils.ParseTimestamp(invoice.DueAt)
+		if err != nil || !now.After(dueAt) {
+			continue
+		}
+
+		invoice.Status = domain.INVOICE_OVERDUE_STATUS
+		err = service.InvoiceUpdateOne(paramLog, &invoice)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func InvoicesByCorporate(paramLog *basic.ParamLog, corporate domain.Corporate, page string, limit string) ([]domain.Invoice, error) {
+	return service.InvoicesByCorporateNoSession(paramLog, corporate.ID, page, limit)
+}
+
+const invoiceTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Invoice {{.Number}}</title></head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Period {{.Period}}<br>Issued {{.IssuedAt}}<br>Due {{.DueAt}}<br>Status {{.Status}}</p>
+<table>
+<tr><td>From</td><td>{{.IssuerName}}<br>Tax ID {{.IssuerTaxID}}</td></tr>
+<tr><td>To</td><td>{{.Name}}<br>{{.Address}}<br>Tax ID {{.TaxID}}</td></tr>
+</table>
+<table>
+<tr><th>Description</th><th>Count</th><th>Amount</th></tr>
+{{range .Lines}}<tr><td>{{.Description}}</td><td>{{.Count}}</td><td>{{money .Amount}}</td></tr>
+{{end}}<tr><td colspan="2">Sub total</td><td>{{money .SubTotal}}</td></tr>
+{{range .TaxLines}}<tr><td colspan="2">{{.Name}} {{.Rate}} of {{money .Base}}</td><td>{{money .Amount}}</td></tr>
+{{end}}<tr><td colspan="2">Total</td><td>{{money .Total}}</td></tr>
+</table>
+</body>
+</html>
+`
+
+// InvoicePrintable renders the invoice as a printable HTML page
+func InvoicePrintable(paramLog *basic.ParamLog, invoiceID string) (string, error) {
+	invoice, err := service.InvoiceByIDNoSession(invoiceID)
+	if err != nil {
+		return "", utils.ErrorBadRequest(paramLog, utils.InvoiceNotFound, "Invoice not found")
+	}
+
+	page, err := template.New("invoice").Funcs(template.FuncMap{
+		"money": func(amount int) string {
+			money, err := domain.MoneyFromLegacy(amount, invoice.Currency)
+			if err != nil {
+				return fmt.Sprintf("%v %v", invoice.Currency, amount)
+			}
+			return money.String()
+		},
+	}).Parse(invoiceTemplate)
+	if err != nil {
+		return "", utils.ErrorInternalServer(paramLog, utils.QueryFailed, err.Error())
+	}
+
+	var buffer bytes.Buffer
+	err = page.Execute(&buffer, invoice)
+	if err != nil {
+		return "", utils.ErrorInternalServer(paramLog, utils.QueryFailed, err.Error())
+	}
+
+	return buffer.String(), nil
+}
+
+func balanceOwners(paramLog *basic.ParamLog, IDs []primitive.ObjectID) (map[primitive.ObjectID]domain.ActorObject, error) {
+	owners := map[primitive.ObjectID]domain.ActorObject{}
+	for start := 0; start < len(IDs); start += RECONCILIATION_BATCH_SIZE {
+		end := start + RECONCILIATION_BATCH_SIZE
+		if end > len(IDs) {
+			end = len(IDs)
+		}
+
+		balances, err := service.BalancesByIDsNoSession(paramLog, IDs[start:end])
+		if err != nil {
+			return owners, err
+		}
+
+		for _, balance := range balances {
+			owners[balance.ID] = balance.Owner
+		}
+	}
+
+	return owners, nil
+}
+
+func transactionTypes(paramLog *basic.ParamLog, codes []string) (map[string]string, error) {
+	types := map[string]string{}
+	for start := 0; start < len(codes); start += RECONCILIATION_BATCH_SIZE {
+		end := start + RECONCILIATION_BATCH_SIZE
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		transactions, err := service.TransactionsByCodes(paramLog, codes[start:end])
+		if err != nil {
+			return types, err
+		}
+
+		for _, transaction := range transactions {
+			types[transaction.TransactionCode] = transaction.Type
+		}
+	}
+
+	return types, nil
+}
@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+)
+
+func TestInvoiceTax(t *testing.T) {
+	tests := []struct {
+		subTotal int
+		currency string
+		rate     string
+		tax      int
+	}{
+		{subTotal: 100000, currency: domain.CURRENCY_IDR, rate: "0.11", tax: 11000},
+		{subTotal: 1495, currency: domain.CURRENCY_IDR, rate: "0.11", tax: 164},
+		// 1.495 rounds once to 1, rounding first to 1.50 would tax 2
+		{subTotal: 299, currency: domain.CURRENCY_IDR, rate: "0.005", tax: 1},
+		{subTotal: 1050, currency: domain.CURRENCY_USD, rate: "0.11", tax: 116},
+		{subTotal: 1000, currency: domain.CURRENCY_IDR, rate: "0", tax: 0},
+	}
+
+	for _, test := range tests {
+		tax, err := invoiceTax(nil, test.subTotal, test.currency, test.rate)
+		if err != nil {
+			t.Fatalf("invoiceTax(%v, %v, %v): %v", test.subTotal, test.currency, test.rate, err)
+		}
+		if tax != test.tax {
+			t.Errorf("invoiceTax(%v, %v, %v) = %v, want %v", test.subTotal, test.currency, test.rate, tax, test.tax)
+		}
+	}
+
+	_, err := invoiceTax(nil, 1000, domain.CURRENCY_IDR, "11%")
+	if err == nil {
+		t.Errorf("invoiceTax with invalid rate succeeded")
+	}
+}
@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const DEFAULT_FEE_QUOTE_EXPIRY_SECOND = 300
+
+func FeeQuoteExpiredAt(from time.Time) string {
+	second, err := strconv.Atoi(os.Getenv("FEE_QUOTE_EXPIRY_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_FEE_QUOTE_EXPIRY_SECOND
+	}
+
+	return from.Add(time.Duration(second) * time.Second).Format(os.Getenv("TIME_FORMAT"))
+}
+
+// QuoteFee prices a transaction of the actor without making it. The destination is the receiving
+// balance ID of wallet transfers and deducts, for other types it is only kept on the quote.
+func QuoteFee(paramLog *basic.ParamLog, corporate domain.Corporate, actor domain.ActorAble, fromBalanceID string,
+	transactionType string, destination string, subAmount int) (domain.FeeQuote, error) {
+	fromBalance, err := service.BalanceByIDNoSession(fromBalanceID)
+	if err != nil {
+		return domain.FeeQuote{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	if actor.GetActorType() == domain.ACTOR_TYPE_USER {
+		err = ValidateAccessBalance(paramLog, actor, fromBalanceID)
+		if err != nil {
+			return domain.FeeQuote{}, err
+		}
+	}
+
+	payer, payerID := FeePayer(actor.GetActorType(), actor.GetActorID(), corporate)
+	if transactionType == domain.TOPUP || transactionType == domain.ACCEPT_PAYMENT_CARD {
+		payer, payerID = FeePayer(fromBalance.Owner.Type, fromBalance.Owner.ID, corporate)
+	}
+
+	currency := corporate.Currency
+	var toBalance domain.Balance
+	if transactionType == domain.TRANSFER_WALLET || transactionType == domain.DEDUCT {
+		toBalance, err = service.BalanceByIDNoSession(destination)
+		if err != nil {
+			return domain.FeeQuote{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+		}
+
+		if !domain.IsSameCurrency(fromBalance.Currency, toBalance.Currency) {
+			currency = fromBalance.Currency
+		}
+	}
+
+	subAmountMoney, err := LegacyMoney(paramLog, subAmount, currency)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	totalFee, detailsFee, err := TransactionFee(paramLog, corporate, payer, payerID, transactionType, subAmountMoney)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	// The promotions are applied to the quote, the transaction made with it keeps the same waivers
+	feeCalculator := CalculateFee{}
+	feeCalculator.Initialize(corporate, fromBalance, domain.Transaction{
+		Type:       transactionType,
+		Currency:   subAmountMoney.Currency,
+		SubAmount:  subAmountMoney.Legacy(),
+		TotalFee:   totalFee.Legacy(),
+		Amount:     subAmountMoney.Legacy() + totalFee.Legacy(),
+		DetailsFee: detailsFee,
+	})
+	waived, err := feeCalculator.ApplyPromotions(paramLog)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	totalFee, err = feeMoney(paramLog, waived.TotalFee, subAmountMoney.Currency)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	debit, err := subAmountMoney.Add(totalFee)
+	if err != nil {
+		return domain.FeeQuote{}, MoneyError(paramLog, err)
+	}
+	credit := subAmountMoney
+
+	if transactionType == domain.TOPUP || transactionType == domain.ACCEPT_PAYMENT_CARD {
+		debit = subAmountMoney
+		credit, err = subAmountMoney.Sub(totalFee)
+		if err != nil {
+			return domain.FeeQuote{}, MoneyError(paramLog, err)
+		}
+	}
+
+	if !toBalance.ID.IsZero() {
+		_, credit, err = ConvertBalanceAmount(paramLog, corporate, fromBalance, toBalance, subAmountMoney, "")
+		if err != nil {
+			return domain.FeeQuote{}, err
+		}
+	}
+
+	now := time.Now()
+	quote := domain.FeeQuote{
+		CorporateID:     corporate.ID,
+		Payer:           payer,
+		PayerID:         payerID,
+		FromBalanceID:   fromBalance.ID,
+		Destination:     destination,
+		TransactionType: transactionType,
+		Currency:        subAmountMoney.Currency,
+		SubAmount:       subAmountMoney.Legacy(),
+		TotalFee:        totalFee.Legacy(),
+		TotalDebit:      debit.Legacy(),
+		NetCredit:       credit.Legacy(),
+		CreditCurrency:  credit.Currency,
+		Legs:            feeQuoteLegs(detailsFee),
+		DetailsFee:      detailsFee,
+		FeeWaivers:      waived.FeeWaivers,
+		Status:          domain.FEE_QUOTE_ACTIVE_STATUS,
+		Time:            now.Format(os.Getenv("TIME_FORMAT")),
+		ExpiredAt:       FeeQuoteExpiredAt(now),
+	}
+
+	err = service.FeeQuoteSaveOne(paramLog, &quote)
+	if err != nil {
+		return domain.FeeQuote{}, err
+	}
+
+	return quote, nil
+}
+
+// Details of one payer follow each other, the payer's own leg comes first and each hop up the hierarchy after
+func feeQuoteLegs(details []domain.DetailFee) []domain.FeeQuoteLeg {
+	legs := []domain.FeeQuoteLeg{}
+	for _, detail := range details {
+		last := len(legs) - 1
+		if last < 0 || legs[last].Payer != detail.Payer || legs[last].PayerID != detail.PayerID {
+			legs = append(legs, domain.FeeQuoteLeg{Payer: detail.Payer, PayerID: detail.PayerID, CorporateID: detail.CorporateID,
+				Details: []domain.DetailFee{}})
+			last++
+		}
+
+		legs[last].Amount = legs[last].Amount + detail.Amount
+		legs[last].Details = append(legs[last].Details, detail)
+	}
+
+	return legs
+}
+
+// QuotedTransactionFee charges the fee of the quote when a quote ID is given and prices the
+// transaction with TransactionFee otherwise
+func QuotedTransactionFee(paramLog *basic.ParamLog, quoteID string, corporate domain.Corporate, payer string,
+	payerID primitive.ObjectID, transactionType string, subAmount domain.Money) (domain.Money, []domain.DetailFee, error) {
+	if quoteID == "" {
+		return TransactionFee(paramLog, corporate, payer, payerID, transactionType, subAmount)
+	}
+
+	quote, err := service.FeeQuoteByIDNoSession(quoteID)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, utils.ErrorBadRequest(paramLog, utils.InvalidFeeQuote, "Fee quote not found")
+	}
+
+	if quote.Status != domain.FEE_QUOTE_ACTIVE_STATUS || quote.CorporateID != corporate.ID || quote.Payer != payer ||
+		quote.PayerID != payerID || quote.TransactionType != transactionType ||
+		!domain.IsSameCurrency(quote.Currency, subAmount.Currency) || quote.SubAmount != subAmount.Legacy() {
+		return domain.Money{}, []domain.DetailFee{}, utils.ErrorBadRequest(paramLog, utils.InvalidFeeQuote, "Fee quote does not match transaction")
+	}
+
+	expiredAt, err := utils.ParseTimestamp(quote.ExpiredAt)
+	if err != nil || time.Now().After(expiredAt) {
+		return domain.Money{}, []domain.DetailFee{}, utils.ErrorBadRequest(paramLog, utils.FeeQuoteExpired, "Fee quote expired")
+	}
+
+	totalFee, err := feeMoney(paramLog, quote.TotalFee, quote.Currency)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	return totalFee, quote.DetailsFee, nil
+}
+
+// FeeQuoteWaivers are the fee legs promotions waived when the quote was made
+func FeeQuoteWaivers(paramLog *basic.ParamLog, quoteID string) ([]domain.FeeWaiver, error) {
+	quote, err := service.FeeQuoteByIDNoSession(quoteID)
+	if err != nil {
+		return []domain.FeeWaiver{}, utils.ErrorBadRequest(paramLog, utils.InvalidFeeQuote, "Fee quote not found")
+	}
+
+	return quote.FeeWaivers, nil
+}
+
+// UseFeeQuote consumes the fee quote of a transaction within its commit so a quote is charged once
+func UseFeeQuote(paramLog *basic.ParamLog, transaction domain.Transaction, session mongo.SessionContext) error {
+	if transaction.FeeQuoteID == "" {
+		return nil
+	}
+
+	quoteID, err := primitive.ObjectIDFromHex(transaction.FeeQuoteID)
+	if err != nil {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeQuote, "Fee quote not found")
+	}
+
+	_, err = service.FeeQuoteUse(quoteID, transaction.TransactionCode, session)
+	if err == mongo.ErrNoDocuments {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeQuote, "Fee quote already used")
+	}
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	return nil
+}
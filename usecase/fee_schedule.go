@@ -0,0 +1,375 @@
+package usecase
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Transaction types whose fee is passed on up the corporate hierarchy, a deduct only when a
+// corporate pays it
+var feeCascadeTypes = map[string]bool{
+	domain.TRANSFER_BANK:       true,
+	domain.TOPUP:               true,
+	domain.TRANSFER_WALLET:     true,
+	domain.ACCEPT_PAYMENT_CARD: true,
+}
+
+// SaveFeeSchedule adds the schedule when it has no ID yet and replaces it otherwise,
+// a schedule without EffectiveAt is effective right away
+func SaveFeeSchedule(paramLog *basic.ParamLog, schedule *domain.FeeSchedule) error {
+	if schedule.Level != domain.FEE_LEVEL_PRINCIPAL && schedule.Level != domain.FEE_LEVEL_CORPORATE &&
+		schedule.Level != domain.FEE_LEVEL_USER {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee level must be PRINCIPAL, CORPORATE or USER")
+	}
+
+	if schedule.Payer != domain.ACTOR_TYPE_USER && schedule.Payer != domain.ACTOR_TYPE_CORPORATE {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee payer must be a user or a corporate")
+	}
+
+	if schedule.Level == domain.FEE_LEVEL_USER && schedule.Payer != domain.ACTOR_TYPE_USER {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee of user level is paid by the user")
+	}
+
+	if schedule.OwnerID.IsZero() || schedule.TransactionType == "" {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee schedule needs an owner and a transaction type")
+	}
+
+	if schedule.Currency != "" {
+		schedule.Currency = domain.NormalizeCurrency(schedule.Currency)
+		_, err := domain.CurrencyExponent(schedule.Currency)
+		if err != nil {
+			return MoneyError(paramLog, err)
+		}
+	}
+
+	if schedule.Flat < 0 || schedule.MinFee < 0 || schedule.MaxFee < 0 || !isFeeRate(schedule.Percentage) {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee cannot be negative")
+	}
+
+	if schedule.MaxFee > 0 && schedule.MinFee > schedule.MaxFee {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Minimum fee above maximum fee")
+	}
+
+	sort.Slice(schedule.Tiers, func(i, j int) bool {
+		return schedule.Tiers[i].FromAmount < schedule.Tiers[j].FromAmount
+	})
+	for i, tier := range schedule.Tiers {
+		if tier.FromAmount < 0 || tier.Flat < 0 || !isFeeRate(tier.Percentage) {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee tier cannot be negative")
+		}
+
+		if i > 0 && schedule.Tiers[i-1].FromAmount == tier.FromAmount {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Fee tiers start at the same amount")
+		}
+	}
+
+	now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+	if schedule.EffectiveAt == "" {
+		schedule.EffectiveAt = now
+	}
+
+	_, err := utils.ParseTimestamp(schedule.EffectiveAt)
+	if err != nil {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFeeSchedule, "Invalid fee effective time")
+	}
+
+	if schedule.ID.IsZero() {
+		schedule.Time = now
+		return service.FeeScheduleSaveOne(paramLog, schedule)
+	}
+
+	return service.FeeScheduleUpdateOne(paramLog, schedule)
+}
+
+// TransactionFee returns the fee the payer is charged for subAmount and the components of every fee
+// leg it sets off, the payer's leg first. A user pays its corporate, then every corporate up to the
+// principal pays its parent.
+func TransactionFee(paramLog *basic.ParamLog, corporate domain.Corporate, payer string, payerID primitive.ObjectID,
+	transactionType string, subAmount domain.Money) (domain.Money, []domain.DetailFee, error) {
+	fee, details, err := FeeLeg(paramLog, corporate, payer, payerID, transactionType, subAmount)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	first := 0
+	cascade := feeCascadeTypes[transactionType]
+	if payer == domain.ACTOR_TYPE_CORPORATE {
+		// the corporate's own leg is the payer's leg
+		first = 1
+		cascade = cascade || transactionType == domain.DEDUCT
+	}
+
+	if !cascade || !IsCorporateFeeLeg(corporate, transactionType, subAmount.Currency) {
+		return fee, details, nil
+	}
+
+	chain, err := CorporateChain(paramLog, corporate)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	for i := first; i < len(chain)-1; i++ {
+		_, hopDetails, err := FeeLeg(paramLog, chain[i], domain.ACTOR_TYPE_CORPORATE, chain[i].ID, transactionType, subAmount)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, err
+		}
+
+		details = append(details, hopDetails...)
+	}
+
+	return fee, details, nil
+}
+
+// IsCorporateFeeLeg tells whether the corporate pays its parent a fee, a principal has no parent to
+// pay and card payments only pay upward outside IDR
+func IsCorporateFeeLeg(corporate domain.Corporate, transactionType string, currency string) bool {
+	if !IsNotPrincipal(corporate) {
+		return false
+	}
+
+	if transactionType == domain.ACCEPT_PAYMENT_CARD {
+		return IsNotIDRCurrency(currency)
+	}
+
+	return true
+}
+
+// FeeLeg evaluates the schedule effective now for one payer. The user pays its corporate and the
+// corporate pays its parent, a principal corporate pays nothing.
+func FeeLeg(paramLog *basic.ParamLog, corporate domain.Corporate, payer string, payerID primitive.ObjectID,
+	transactionType string, subAmount domain.Money) (domain.Money, []domain.DetailFee, error) {
+	receiverID := corporate.ID
+	if payer == domain.ACTOR_TYPE_CORPORATE {
+		if !IsNotPrincipal(corporate) {
+			return domain.Money{Currency: subAmount.Currency}, []domain.DetailFee{}, nil
+		}
+		receiverID = corporate.Parent
+	}
+
+	schedule, err := EffectiveFeeSchedule(paramLog, corporate, payer, payerID, transactionType, subAmount.Currency, time.Now())
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	fee, details, err := EvaluateFeeSchedule(paramLog, schedule, subAmount)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	for i := range details {
+		details[i].CorporateID = receiverID
+		details[i].Payer = payer
+		details[i].PayerID = payerID
+	}
+
+	return fee, details, nil
+}
+
+// EffectiveFeeSchedule returns the schedule of the payer at the given time. A schedule set for the
+// user wins over the one of its corporate, which wins over the one of the principal. Without any
+// schedule the fixed fee of the corporate applies.
+func EffectiveFeeSchedule(paramLog *basic.ParamLog, corporate domain.Corporate, payer string, payerID primitive.ObjectID,
+	transactionType string, currency string, at time.Time) (domain.FeeSchedule, error) {
+	principalID := corporate.ID
+	if IsNotPrincipal(corporate) {
+		principalID = corporate.Parent
+	}
+
+	type scope struct {
+		level   string
+		ownerID primitive.ObjectID
+	}
+
+	scopes := []scope{}
+	if payer == domain.ACTOR_TYPE_USER {
+		scopes = append(scopes, scope{domain.FEE_LEVEL_USER, payerID}, scope{domain.FEE_LEVEL_CORPORATE, corporate.ID})
+	} else {
+		scopes = append(scopes, scope{domain.FEE_LEVEL_CORPORATE, corporate.ID})
+	}
+	scopes = append(scopes, scope{domain.FEE_LEVEL_PRINCIPAL, principalID})
+
+	for _, scope := range scopes {
+		if scope.ownerID.IsZero() {
+			continue
+		}
+
+		schedules, err := service.FeeSchedulesActiveNoSession(paramLog, scope.level, scope.ownerID, payer, transactionType)
+		if err != nil {
+			return domain.FeeSchedule{}, err
+		}
+
+		schedule, found := latestFeeSchedule(schedules, currency, at)
+		if found {
+			return schedule, nil
+		}
+	}
+
+	if payer == domain.ACTOR_TYPE_USER {
+		return domain.FeeFromLegacy(corporate.FeeUser, transactionType), nil
+	}
+
+	return domain.FeeFromLegacy(corporate.FeeCorporate, transactionType), nil
+}
+
+// A schedule for the currency wins over one without currency, then the latest effective wins
+func latestFeeSchedule(schedules []domain.FeeSchedule, currency string, at time.Time) (domain.FeeSchedule, bool) {
+	var result domain.FeeSchedule
+	var resultAt time.Time
+	found := false
+	for _, schedule := range schedules {
+		if schedule.Currency != "" && !domain.IsSameCurrency(schedule.Currency, currency) {
+			continue
+		}
+
+		effectiveAt, err := utils.ParseTimestamp(schedule.EffectiveAt)
+		if err != nil || effectiveAt.After(at) {
+			continue
+		}
+
+		if found && result.Currency != "" && schedule.Currency == "" {
+			continue
+		}
+
+		if !found || (result.Currency == "" && schedule.Currency != "") || effectiveAt.After(resultAt) {
+			result = schedule
+			resultAt = effectiveAt
+			found = true
+		}
+	}
+
+	return result, found
+}
+
+// EvaluateFeeSchedule prices subAmount, each component is rounded once to the unit of the bare int
+// fields so the details add up to the fee
+func EvaluateFeeSchedule(paramLog *basic.ParamLog, schedule domain.FeeSchedule, subAmount domain.Money) (domain.Money, []domain.DetailFee, error) {
+	flat := schedule.Flat
+	percentage := schedule.Percentage
+	suffix := ""
+	for _, tier := range schedule.Tiers {
+		if tier.FromAmount > subAmount.Legacy() {
+			break
+		}
+
+		flat = tier.Flat
+		percentage = tier.Percentage
+		suffix = fmt.Sprintf(" FROM %v", tier.FromAmount)
+	}
+
+	fee := domain.Money{Currency: subAmount.Currency}
+	details := []domain.DetailFee{}
+	add := func(name string, amount domain.Money) error {
+		if amount.IsZero() {
+			return nil
+		}
+
+		total, err := fee.Add(amount)
+		if err != nil {
+			return MoneyError(paramLog, err)
+		}
+
+		fee = total
+		details = append(details, domain.DetailFee{ScheduleID: schedule.ID, Name: name, Amount: amount.Legacy()})
+		return nil
+	}
+
+	flatMoney, err := feeMoney(paramLog, flat, subAmount.Currency)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	err = add(domain.FEE_COMPONENT_FLAT+suffix, flatMoney)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	if percentage != "" {
+		percentageMoney, err := subAmount.MultiplyRate(percentage)
+		if err == domain.ErrInvalidRate {
+			return domain.Money{}, []domain.DetailFee{}, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert fee percentage")
+		}
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, MoneyError(paramLog, err)
+		}
+
+		err = add(domain.FEE_COMPONENT_PERCENTAGE+" "+percentage+suffix, percentageMoney)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, err
+		}
+	}
+
+	minFee, err := feeMoney(paramLog, schedule.MinFee, subAmount.Currency)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	maxFee, err := feeMoney(paramLog, schedule.MaxFee, subAmount.Currency)
+	if err != nil {
+		return domain.Money{}, []domain.DetailFee{}, err
+	}
+
+	if fee.Amount < minFee.Amount {
+		adjustment, err := minFee.Sub(fee)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, MoneyError(paramLog, err)
+		}
+
+		err = add(domain.FEE_COMPONENT_MIN_CAP, adjustment)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, err
+		}
+	}
+
+	if schedule.MaxFee > 0 && fee.Amount > maxFee.Amount {
+		adjustment, err := maxFee.Sub(fee)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, MoneyError(paramLog, err)
+		}
+
+		err = add(domain.FEE_COMPONENT_MAX_CAP, adjustment)
+		if err != nil {
+			return domain.Money{}, []domain.DetailFee{}, err
+		}
+	}
+
+	return fee, details, nil
+}
+
+func feeMoney(paramLog *basic.ParamLog, fee int, currency string) (domain.Money, error) {
+	money, err := domain.MoneyFromLegacy(fee, currency)
+	if err != nil {
+		return domain.Money{}, MoneyError(paramLog, err)
+	}
+
+	return money, nil
+}
+
+// An empty rate is no percentage
+func isFeeRate(rate string) bool {
+	if rate == "" {
+		return true
+	}
+
+	ratio, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	return ok && ratio.Sign() >= 0
+}
+
+// FeePayer returns who pays the fee of a transaction made by or for an actor, anyone but a user
+// pays as the corporate
+func FeePayer(actorType string, actorID primitive.ObjectID, corporate domain.Corporate) (string, primitive.ObjectID) {
+	if actorType == domain.ACTOR_TYPE_USER {
+		return domain.ACTOR_TYPE_USER, actorID
+	}
+
+	return domain.ACTOR_TYPE_CORPORATE, corporate.ID
+}
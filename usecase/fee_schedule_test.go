@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+)
+
+func TestEvaluateFeeSchedule(t *testing.T) {
+	tiered := domain.FeeSchedule{
+		Flat:       2500,
+		Percentage: "",
+		Tiers: []domain.FeeTier{
+			{FromAmount: 1000000, Flat: 1000, Percentage: "0.001"},
+			{FromAmount: 10000000, Flat: 0, Percentage: "0.0005"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		schedule  domain.FeeSchedule
+		subAmount int
+		currency  string
+		fee       int
+		details   []string
+	}{
+		{
+			name:      "flat",
+			schedule:  domain.FeeSchedule{Flat: 2500},
+			subAmount: 100000,
+			fee:       2500,
+			details:   []string{"FLAT"},
+		},
+		{
+			// 0.5% of 299 is 1.495, rounded once half to even
+			name:      "percentage rounded once",
+			schedule:  domain.FeeSchedule{Percentage: "0.005"},
+			subAmount: 299,
+			fee:       1,
+			details:   []string{"PERCENTAGE 0.005"},
+		},
+		{
+			name:      "percentage on the half",
+			schedule:  domain.FeeSchedule{Percentage: "0.005"},
+			subAmount: 500,
+			fee:       2,
+			details:   []string{"PERCENTAGE 0.005"},
+		},
+		{
+			name:      "below the first tier",
+			schedule:  tiered,
+			subAmount: 999999,
+			fee:       2500,
+			details:   []string{"FLAT"},
+		},
+		{
+			name:      "first tier",
+			schedule:  tiered,
+			subAmount: 1000000,
+			fee:       2000,
+			details:   []string{"FLAT FROM 1000000", "PERCENTAGE 0.001 FROM 1000000"},
+		},
+		{
+			name:      "last tier",
+			schedule:  tiered,
+			subAmount: 20000000,
+			fee:       10000,
+			details:   []string{"PERCENTAGE 0.0005 FROM 10000000"},
+		},
+		{
+			name:      "raised to the minimum",
+			schedule:  domain.FeeSchedule{Percentage: "0.01", MinFee: 1000},
+			subAmount: 50000,
+			fee:       1000,
+			details:   []string{"PERCENTAGE 0.01", "MIN_CAP"},
+		},
+		{
+			name:      "lowered to the maximum",
+			schedule:  domain.FeeSchedule{Flat: 1000, Percentage: "0.01", MaxFee: 5000},
+			subAmount: 1000000,
+			fee:       5000,
+			details:   []string{"FLAT", "PERCENTAGE 0.01", "MAX_CAP"},
+		},
+		{
+			name:      "no maximum",
+			schedule:  domain.FeeSchedule{Percentage: "0.01"},
+			subAmount: 1000000,
+			fee:       10000,
+			details:   []string{"PERCENTAGE 0.01"},
+		},
+		{
+			name:      "minor unit currency",
+			schedule:  domain.FeeSchedule{Flat: 30, Percentage: "0.029"},
+			subAmount: 1050,
+			currency:  domain.CURRENCY_USD,
+			fee:       60,
+			details:   []string{"FLAT", "PERCENTAGE 0.029"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			currency := test.currency
+			if currency == "" {
+				currency = domain.CURRENCY_IDR
+			}
+
+			subAmount, err := domain.MoneyFromLegacy(test.subAmount, currency)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fee, details, err := EvaluateFeeSchedule(nil, test.schedule, subAmount)
+			if err != nil {
+				t.Fatalf("EvaluateFeeSchedule: %v", err)
+			}
+
+			if fee.Legacy() != test.fee {
+				t.Errorf("fee = %v, want %v", fee.Legacy(), test.fee)
+			}
+
+			sum := 0
+			names := []string{}
+			for _, detail := range details {
+				sum = sum + detail.Amount
+				names = append(names, detail.Name)
+			}
+			if sum != fee.Legacy() {
+				t.Errorf("details add up to %v, fee is %v", sum, fee.Legacy())
+			}
+			if len(names) != len(test.details) {
+				t.Fatalf("details %v, want %v", names, test.details)
+			}
+			for i := range names {
+				if names[i] != test.details[i] {
+					t.Errorf("details %v, want %v", names, test.details)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateFeeScheduleInvalidPercentage(t *testing.T) {
+	subAmount, _ := domain.MoneyFromLegacy(10000, domain.CURRENCY_IDR)
+
+	_, _, err := EvaluateFeeSchedule(nil, domain.FeeSchedule{Percentage: "1%"}, subAmount)
+	if err == nil {
+		t.Errorf("EvaluateFeeSchedule with invalid percentage succeeded")
+	}
+}
@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const DEFAULT_FX_QUOTE_EXPIRY_SECOND = 60
+
+func FXQuoteExpiredAt(from time.Time) string {
+	second, err := strconv.Atoi(os.Getenv("FX_QUOTE_EXPIRY_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_FX_QUOTE_EXPIRY_SECOND
+	}
+
+	return from.Add(time.Duration(second) * time.Second).Format(os.Getenv("TIME_FORMAT"))
+}
+
+// SaveFXRate adds a new version of a pair, a zero corporate ID sets the default rate of every corporate
+func SaveFXRate(paramLog *basic.ParamLog, corporateID primitive.ObjectID, baseCurrency string, quoteCurrency string,
+	rate string, effectiveAt time.Time) (domain.FXRate, error) {
+	baseCurrency = domain.NormalizeCurrency(baseCurrency)
+	quoteCurrency = domain.NormalizeCurrency(quoteCurrency)
+
+	_, err := domain.CurrencyExponent(baseCurrency)
+	if err != nil {
+		return domain.FXRate{}, MoneyError(paramLog, err)
+	}
+
+	_, err = domain.CurrencyExponent(quoteCurrency)
+	if err != nil {
+		return domain.FXRate{}, MoneyError(paramLog, err)
+	}
+
+	if baseCurrency == quoteCurrency {
+		return domain.FXRate{}, utils.ErrorBadRequest(paramLog, utils.CurrencyError, "Rate of a currency to itself")
+	}
+
+	_, err = domain.InverseRate(rate)
+	if err != nil {
+		return domain.FXRate{}, MoneyError(paramLog, err)
+	}
+
+	model := domain.FXRate{
+		CorporateID:   corporateID,
+		BaseCurrency:  baseCurrency,
+		QuoteCurrency: quoteCurrency,
+		Rate:          rate,
+		EffectiveAt:   effectiveAt.Format(os.Getenv("TIME_FORMAT")),
+		Time:          time.Now().Format(os.Getenv("TIME_FORMAT")),
+	}
+
+	err = service.FXRateSaveOne(paramLog, &model)
+	if err != nil {
+		return domain.FXRate{}, err
+	}
+
+	return model, nil
+}
+
+// EffectiveFXRate returns the rate converting fromCurrency into toCurrency at the given time.
+// Rates of the corporate win over those of its parent, which win over the default rates.
+// When only the opposite pair is set its inverse is used.
+func EffectiveFXRate(paramLog *basic.ParamLog, corporate domain.Corporate, fromCurrency string, toCurrency string,
+	at time.Time) (domain.FXRate, string, error) {
+	fromCurrency = domain.NormalizeCurrency(fromCurrency)
+	toCurrency = domain.NormalizeCurrency(toCurrency)
+
+	scopes := []primitive.ObjectID{corporate.ID}
+	if IsNotPrincipal(corporate) {
+		scopes = append(scopes, corporate.Parent)
+	}
+	scopes = append(scopes, primitive.NilObjectID)
+
+	for _, scope := range scopes {
+		rate, found, err := latestFXRate(paramLog, scope, fromCurrency, toCurrency, at)
+		if err != nil {
+			return domain.FXRate{}, "", err
+		}
+
+		if found {
+			return rate, rate.Rate, nil
+		}
+
+		rate, found, err = latestFXRate(paramLog, scope, toCurrency, fromCurrency, at)
+		if err != nil {
+			return domain.FXRate{}, "", err
+		}
+
+		if found {
+			inverse, err := domain.InverseRate(rate.Rate)
+			if err != nil {
+				return domain.FXRate{}, "", MoneyError(paramLog, err)
+			}
+
+			return rate, inverse, nil
+		}
+	}
+
+	return domain.FXRate{}, "", utils.ErrorBadRequest(paramLog, utils.FXRateNotFound, "No rate for "+fromCurrency+"/"+toCurrency)
+}
+
+func latestFXRate(paramLog *basic.ParamLog, corporateID primitive.ObjectID, baseCurrency string, quoteCurrency string,
+	at time.Time) (domain.FXRate, bool, error) {
+	rates, err := service.FXRatesByPairNoSession(paramLog, corporateID, baseCurrency, quoteCurrency)
+	if err != nil {
+		return domain.FXRate{}, false, err
+	}
+
+	var result domain.FXRate
+	var resultAt time.Time
+	found := false
+	for _, rate := range rates {
+		effectiveAt, err := utils.ParseTimestamp(rate.EffectiveAt)
+		if err != nil || effectiveAt.After(at) {
+			continue
+		}
+
+		if !found || effectiveAt.After(resultAt) {
+			result = rate
+			resultAt = effectiveAt
+			found = true
+		}
+	}
+
+	return result, found, nil
+}
+
+// QuoteFX locks the current rate for moving subAmount, in the currency of the source balance,
+// into a balance of another currency
+func QuoteFX(paramLog *basic.ParamLog, corporate domain.Corporate, fromBalanceID string, toBalanceID string,
+	subAmount int) (domain.FXQuote, error) {
+	fromBalance, err := service.BalanceByIDNoSession(fromBalanceID)
+	if err != nil {
+		return domain.FXQuote{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	toBalance, err := service.BalanceByIDNoSession(toBalanceID)
+	if err != nil {
+		return domain.FXQuote{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	if domain.IsSameCurrency(fromBalance.Currency, toBalance.Currency) {
+		return domain.FXQuote{}, utils.ErrorBadRequest(paramLog, utils.InvalidFXQuote, "Balances share the same currency")
+	}
+
+	from, err := LegacyMoney(paramLog, subAmount, fromBalance.Currency)
+	if err != nil {
+		return domain.FXQuote{}, err
+	}
+
+	now := time.Now()
+	rate, value, err := EffectiveFXRate(paramLog, corporate, fromBalance.Currency, toBalance.Currency, now)
+	if err != nil {
+		return domain.FXQuote{}, err
+	}
+
+	to, err := from.Convert(toBalance.Currency, value)
+	if err != nil {
+		return domain.FXQuote{}, MoneyError(paramLog, err)
+	}
+
+	quote := domain.FXQuote{
+		CorporateID:   corporate.ID,
+		RateID:        rate.ID,
+		FromBalanceID: fromBalance.ID,
+		ToBalanceID:   toBalance.ID,
+		FromCurrency:  from.Currency,
+		ToCurrency:    to.Currency,
+		Rate:          value,
+		FromAmount:    from.Legacy(),
+		ToAmount:      to.Legacy(),
+		Status:        domain.FX_QUOTE_ACTIVE_STATUS,
+		Time:          now.Format(os.Getenv("TIME_FORMAT")),
+		ExpiredAt:     FXQuoteExpiredAt(now),
+	}
+
+	err = service.FXQuoteSaveOne(paramLog, &quote)
+	if err != nil {
+		return domain.FXQuote{}, err
+	}
+
+	return quote, nil
+}
+
+// ConvertBalanceAmount returns the conversion of subAmount moving from one balance into the other
+// and the amount credited. Without quote ID the rate effective now is used. The conversion is nil
+// when both balances share a currency.
+func ConvertBalanceAmount(paramLog *basic.ParamLog, corporate domain.Corporate, fromBalance domain.Balance,
+	toBalance domain.Balance, subAmount domain.Money, quoteID string) (*domain.TransactionFX, domain.Money, error) {
+	if domain.IsSameCurrency(fromBalance.Currency, toBalance.Currency) {
+		return nil, subAmount, nil
+	}
+
+	if quoteID == "" {
+		rate, value, err := EffectiveFXRate(paramLog, corporate, fromBalance.Currency, toBalance.Currency, time.Now())
+		if err != nil {
+			return nil, domain.Money{}, err
+		}
+
+		credit, err := subAmount.Convert(toBalance.Currency, value)
+		if err != nil {
+			return nil, domain.Money{}, MoneyError(paramLog, err)
+		}
+
+		return &domain.TransactionFX{
+			RateID:       rate.ID,
+			Rate:         value,
+			FromCurrency: subAmount.Currency,
+			ToCurrency:   credit.Currency,
+			FromAmount:   subAmount.Legacy(),
+			ToAmount:     credit.Legacy(),
+		}, credit, nil
+	}
+
+	quote, err := service.FXQuoteByIDNoSession(quoteID)
+	if err != nil {
+		return nil, domain.Money{}, utils.ErrorBadRequest(paramLog, utils.InvalidFXQuote, "Quote not found")
+	}
+
+	if quote.Status != domain.FX_QUOTE_ACTIVE_STATUS || quote.CorporateID != corporate.ID ||
+		quote.FromBalanceID != fromBalance.ID || quote.ToBalanceID != toBalance.ID ||
+		!domain.IsSameCurrency(quote.FromCurrency, subAmount.Currency) || quote.FromAmount != subAmount.Legacy() {
+		return nil, domain.Money{}, utils.ErrorBadRequest(paramLog, utils.InvalidFXQuote, "Quote does not match transaction")
+	}
+
+	expiredAt, err := utils.ParseTimestamp(quote.ExpiredAt)
+	if err != nil || time.Now().After(expiredAt) {
+		return nil, domain.Money{}, utils.ErrorBadRequest(paramLog, utils.FXQuoteExpired, "Quote expired")
+	}
+
+	credit, err := domain.MoneyFromLegacy(quote.ToAmount, quote.ToCurrency)
+	if err != nil {
+		return nil, domain.Money{}, MoneyError(paramLog, err)
+	}
+
+	return &domain.TransactionFX{
+		QuoteID:      quote.ID,
+		RateID:       quote.RateID,
+		Rate:         quote.Rate,
+		FromCurrency: quote.FromCurrency,
+		ToCurrency:   quote.ToCurrency,
+		FromAmount:   quote.FromAmount,
+		ToAmount:     quote.ToAmount,
+	}, credit, nil
+}
+
+// UseFXQuote consumes the quote of a transaction within its commit so a quote pays out once
+func UseFXQuote(paramLog *basic.ParamLog, transaction domain.Transaction, session mongo.SessionContext) error {
+	if transaction.FX == nil || transaction.FX.QuoteID.IsZero() {
+		return nil
+	}
+
+	_, err := service.FXQuoteUse(transaction.FX.QuoteID, transaction.TransactionCode, session)
+	if err == mongo.ErrNoDocuments {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidFXQuote, "Quote already used")
+	}
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package usecase
+
+import (
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_GATEWAY_HEALTH_WINDOW_SECOND    = 300
+	DEFAULT_GATEWAY_BREAKER_MIN_CALLS       = 10
+	DEFAULT_GATEWAY_BREAKER_FAILURE_RATE    = "0.5"
+	DEFAULT_GATEWAY_BREAKER_COOLDOWN_SECOND = 60
+)
+
+// SetGatewayDown lets an operator take a gateway out of routing and put it back
+func SetGatewayDown(paramLog *basic.ParamLog, code string, down bool, reason string) error {
+	if !isTransferGateway(code) {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Unknown gateway "+code)
+	}
+
+	return service.GatewayHealthSet(paramLog, domain.GatewayHealth{
+		ID:     code,
+		Down:   down,
+		Reason: reason,
+		Time:   utils.TimestampNow(),
+	})
+}
+
+// GatewaysDown returns the codes of the gateways routing should avoid, those taken out by an operator
+// and those whose breaker is not closed
+func GatewaysDown(paramLog *basic.ParamLog) (map[string]bool, error) {
+	healths, err := service.GatewayHealthsNoSession(paramLog)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+
+	down := map[string]bool{}
+	for _, health := range healths {
+		if health.Down || (health.State != "" && health.State != domain.GATEWAY_BREAKER_CLOSED) {
+			down[health.ID] = true
+		}
+	}
+
+	return down, nil
+}
+
+// AcquireGateway tells whether a call may be made to the gateway now. A gateway with an open breaker
+// is skipped until its cooldown passed, then a single call is let through as the half open probe.
+func AcquireGateway(paramLog *basic.ParamLog, code string) bool {
+	health, err := service.GatewayHealthByCodeNoSession(code)
+	if err == mongo.ErrNoDocuments {
+		return true
+	}
+	if err != nil {
+		basic.LogError2(paramLog, "GatewayHealthByCodeNoSession", err)
+		return true
+	}
+
+	if health.Down {
+		return false
+	}
+
+	if health.State == "" || health.State == domain.GATEWAY_BREAKER_CLOSED {
+		return true
+	}
+
+	now := time.Now()
+	probe, err := service.GatewayBreakerProbe(paramLog, code, now.Unix(), now.Add(gatewayBreakerCooldown()).Unix(),
+		now.Format(os.Getenv("TIME_FORMAT")))
+	if err != nil {
+		basic.LogError2(paramLog, "GatewayBreakerProbe", err)
+		return false
+	}
+
+	if probe {
+		basic.LogInformation(paramLog, "Gateway half open probe "+code)
+	}
+
+	return probe
+}
+
+// RecordGatewayCall adds the outcome of a call to the rolling window of the gateway and bank and moves
+// the breaker. Only a gateway that could not be reached, timed out or answered 5xx fails the call, a
+// rejected transfer is kept by its error code. A failed probe opens the breaker again and a successful
+// one closes it, a closed breaker opens once the failure rate of the window reaches the threshold.
+func RecordGatewayCall(paramLog *basic.ParamLog, code string, bankCode string, latency time.Duration, callErr error) {
+	now := time.Now()
+	minute := now.Unix() / 60
+	metric := domain.GatewayMetric{
+		ID:        code + ":" + bankCode + ":" + strconv.FormatInt(minute, 10),
+		Gateway:   code,
+		BankCode:  bankCode,
+		Minute:    minute,
+		LatencyMs: latency.Milliseconds(),
+	}
+
+	errorCode := ""
+	if callErr != nil {
+		errorCode = gatewayErrorCode(callErr)
+	}
+
+	failed := gatewayUnavailable(callErr)
+	if failed {
+		metric.Failure = 1
+	} else {
+		metric.Success = 1
+	}
+
+	err := service.GatewayMetricRecord(paramLog, metric, errorCode)
+	if err != nil {
+		basic.LogError2(paramLog, "GatewayMetricRecord", err)
+		return
+	}
+
+	timestamp := now.Format(os.Getenv("TIME_FORMAT"))
+	if !failed {
+		_, err = service.GatewayBreakerChange(paramLog, code, []string{domain.GATEWAY_BREAKER_HALF_OPEN},
+			domain.GATEWAY_BREAKER_CLOSED, 0, timestamp)
+		if err != nil {
+			basic.LogError2(paramLog, "GatewayBreakerChange", err)
+		}
+		return
+	}
+
+	openUntil := now.Add(gatewayBreakerCooldown()).Unix()
+	reopened, err := service.GatewayBreakerChange(paramLog, code, []string{domain.GATEWAY_BREAKER_HALF_OPEN},
+		domain.GATEWAY_BREAKER_OPEN, openUntil, timestamp)
+	if err != nil || reopened {
+		if err != nil {
+			basic.LogError2(paramLog, "GatewayBreakerChange", err)
+		}
+		return
+	}
+
+	metrics, err := service.GatewayMetricsSinceNoSession(paramLog, code, gatewayHealthSince(now))
+	if err != nil {
+		basic.LogError2(paramLog, "GatewayMetricsSinceNoSession", err)
+		return
+	}
+
+	success, failure := 0, 0
+	for _, element := range metrics {
+		success = success + element.Success
+		failure = failure + element.Failure
+	}
+
+	if success+failure < gatewayBreakerMinCalls() || !gatewayFailureRateReached(success, failure) {
+		return
+	}
+
+	opened, err := service.GatewayBreakerChange(paramLog, code, []string{domain.GATEWAY_BREAKER_CLOSED},
+		domain.GATEWAY_BREAKER_OPEN, openUntil, timestamp)
+	if err != nil {
+		basic.LogError2(paramLog, "GatewayBreakerChange", err)
+		return
+	}
+
+	if opened {
+		basic.LogInformation(paramLog, "Gateway breaker opened "+code)
+	}
+}
+
+// GatewayHealthStates reports the breaker and the rolling window of every transfer gateway
+func GatewayHealthStates(paramLog *basic.ParamLog) ([]dto.GatewayHealthState, error) {
+	healths, err := service.GatewayHealthsNoSession(paramLog)
+	if err != nil {
+		return []dto.GatewayHealthState{}, err
+	}
+
+	now := time.Now()
+	metrics, err := service.GatewayMetricsSinceNoSession(paramLog, "", gatewayHealthSince(now))
+	if err != nil {
+		return []dto.GatewayHealthState{}, err
+	}
+
+	codes := transferGatewayCodes()
+
+	states := map[string]*dto.GatewayHealthState{}
+	for _, code := range codes {
+		states[code] = &dto.GatewayHealthState{Gateway: code, State: domain.GATEWAY_BREAKER_CLOSED, Banks: []dto.GatewayBankHealth{}}
+	}
+
+	for _, health := range healths {
+		state, ok := states[health.ID]
+		if !ok {
+			continue
+		}
+
+		state.Down = health.Down
+		state.Reason = health.Reason
+		if health.State != "" {
+			state.State = health.State
+		}
+		if health.OpenUntil > 0 {
+			state.OpenUntil = time.Unix(health.OpenUntil, 0).Format(os.Getenv("TIME_FORMAT"))
+		}
+	}
+
+	latency := map[string]int64{}
+	banks := map[string]map[string]*dto.GatewayBankHealth{}
+	for _, metric := range metrics {
+		state, ok := states[metric.Gateway]
+		if !ok {
+			continue
+		}
+
+		if banks[metric.Gateway] == nil {
+			banks[metric.Gateway] = map[string]*dto.GatewayBankHealth{}
+		}
+
+		bank, ok := banks[metric.Gateway][metric.BankCode]
+		if !ok {
+			bank = &dto.GatewayBankHealth{BankCode: metric.BankCode, Errors: map[string]int{}}
+			banks[metric.Gateway][metric.BankCode] = bank
+		}
+
+		bank.Success = bank.Success + metric.Success
+		bank.Failure = bank.Failure + metric.Failure
+		latency[metric.Gateway+":"+metric.BankCode] = latency[metric.Gateway+":"+metric.BankCode] + metric.LatencyMs
+		for code, count := range metric.Errors {
+			bank.Errors[code] = bank.Errors[code] + count
+		}
+
+		state.Success = state.Success + metric.Success
+		state.Failure = state.Failure + metric.Failure
+		latency[metric.Gateway] = latency[metric.Gateway] + metric.LatencyMs
+	}
+
+	result := []dto.GatewayHealthState{}
+	for _, code := range codes {
+		state := states[code]
+		state.AverageLatencyMs = averageLatency(latency[code], state.Success+state.Failure)
+
+		bankCodes := []string{}
+		for bankCode := range banks[code] {
+			bankCodes = append(bankCodes, bankCode)
+		}
+		sort.Strings(bankCodes)
+
+		for _, bankCode := range bankCodes {
+			bank := banks[code][bankCode]
+			bank.AverageLatencyMs = averageLatency(latency[code+":"+bankCode], bank.Success+bank.Failure)
+			state.Banks = append(state.Banks, *bank)
+		}
+
+		result = append(result, *state)
+	}
+
+	return result, nil
+}
+
+func averageLatency(total int64, calls int) int64 {
+	if calls == 0 {
+		return 0
+	}
+
+	return total / int64(calls)
+}
+
+func gatewayErrorCode(err error) string {
+	customError, ok := err.(utils.CustomError)
+	if !ok {
+		return "UNKNOWN"
+	}
+
+	return strconv.Itoa(customError.Code)
+}
+
+// gatewayUnavailable tells whether the call failed on the gateway itself rather than on the transfer
+func gatewayUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	customError, ok := err.(utils.CustomError)
+	if !ok {
+		return true
+	}
+
+	return customError.Unavailable
+}
+
+func gatewayHealthSince(now time.Time) int64 {
+	second, err := strconv.Atoi(os.Getenv("GATEWAY_HEALTH_WINDOW_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_GATEWAY_HEALTH_WINDOW_SECOND
+	}
+
+	return now.Add(-time.Duration(second)*time.Second).Unix() / 60
+}
+
+func gatewayBreakerMinCalls() int {
+	calls, err := strconv.Atoi(os.Getenv("GATEWAY_BREAKER_MIN_CALLS"))
+	if err != nil || calls <= 0 {
+		calls = DEFAULT_GATEWAY_BREAKER_MIN_CALLS
+	}
+
+	return calls
+}
+
+func gatewayBreakerCooldown() time.Duration {
+	second, err := strconv.Atoi(os.Getenv("GATEWAY_BREAKER_COOLDOWN_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_GATEWAY_BREAKER_COOLDOWN_SECOND
+	}
+
+	return time.Duration(second) * time.Second
+}
+
+func gatewayFailureRateReached(success int, failure int) bool {
+	threshold, ok := new(big.Rat).SetString(os.Getenv("GATEWAY_BREAKER_FAILURE_RATE"))
+	if !ok {
+		threshold, _ = new(big.Rat).SetString(DEFAULT_GATEWAY_BREAKER_FAILURE_RATE)
+	}
+
+	rate := big.NewRat(int64(failure), int64(success+failure))
+	return rate.Cmp(threshold) >= 0
+}
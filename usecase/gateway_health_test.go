@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/utils"
+)
+
+func TestGatewayUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{name: "success", err: nil, unavailable: false},
+		{name: "transport", err: utils.ErrorUnavailable(nil, utils.OYApiCallFailed, "dial tcp: i/o timeout"), unavailable: true},
+		{name: "unknown error", err: errors.New("context deadline exceeded"), unavailable: true},
+		{name: "rejected transfer", err: utils.ErrorInternalServer(nil, utils.XenditApiCallFailed, "Xendit API failed"), unavailable: false},
+		{name: "invalid account", err: utils.ErrorBadRequest(nil, utils.InquiryAccountHolderNameNotFound, "Unknown response"), unavailable: false},
+	}
+
+	for _, test := range tests {
+		if gatewayUnavailable(test.err) != test.unavailable {
+			t.Errorf("%v: gatewayUnavailable = %v, want %v", test.name, !test.unavailable, test.unavailable)
+		}
+	}
+}
+
+func TestGatewayFailureRateReached(t *testing.T) {
+	t.Setenv("GATEWAY_BREAKER_FAILURE_RATE", "")
+
+	tests := []struct {
+		success int
+		failure int
+		reached bool
+	}{
+		{success: 10, failure: 0, reached: false},
+		{success: 6, failure: 4, reached: false},
+		{success: 5, failure: 5, reached: true},
+		{success: 0, failure: 10, reached: true},
+	}
+
+	for _, test := range tests {
+		if gatewayFailureRateReached(test.success, test.failure) != test.reached {
+			t.Errorf("gatewayFailureRateReached(%v, %v) = %v, want %v", test.success, test.failure, !test.reached, test.reached)
+		}
+	}
+
+	t.Setenv("GATEWAY_BREAKER_FAILURE_RATE", "0.3")
+	if !gatewayFailureRateReached(7, 3) {
+		t.Errorf("gatewayFailureRateReached(7, 3) at 0.3 = false, want true")
+	}
+}
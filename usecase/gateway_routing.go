@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const GATEWAY_ROUTING_TIME_FORMAT = "15:04"
+
+// Transfers go through Permata until a routing is published
+var defaultGatewayRoute = []string{gateway.Permata}
+
+// PublishGatewayRouting saves the rules as the next version and activates it
+func PublishGatewayRouting(paramLog *basic.ParamLog, routing *domain.GatewayRouting) error {
+	err := validateGatewayRouting(paramLog, *routing)
+	if err != nil {
+		return err
+	}
+
+	latest, err := service.GatewayRoutingLatestNoSession()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	now := time.Now()
+	routing.ID = primitive.NilObjectID
+	routing.Version = latest.Version + 1
+	routing.Activation = now.UnixNano()
+	routing.ActivatedAt = now.Format(os.Getenv("TIME_FORMAT"))
+	routing.Time = now.Format(os.Getenv("TIME_FORMAT"))
+
+	return service.GatewayRoutingSaveOne(paramLog, routing)
+}
+
+// ActivateGatewayRouting puts a published version back in use
+func ActivateGatewayRouting(paramLog *basic.ParamLog, version int) (domain.GatewayRouting, error) {
+	routing, err := service.GatewayRoutingByVersionNoSession(version)
+	if err != nil {
+		return domain.GatewayRouting{}, utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting,
+			fmt.Sprintf("Gateway routing version %v not found", version))
+	}
+
+	now := time.Now()
+	routing.Activation = now.UnixNano()
+	routing.ActivatedAt = now.Format(os.Getenv("TIME_FORMAT"))
+
+	err = service.GatewayRoutingActivate(paramLog, routing)
+	if err != nil {
+		return domain.GatewayRouting{}, err
+	}
+
+	return routing, nil
+}
+
+func GatewayRoutings(paramLog *basic.ParamLog) ([]domain.GatewayRouting, error) {
+	return service.GatewayRoutingsNoSession(paramLog)
+}
+
+func validateGatewayRouting(paramLog *basic.ParamLog, routing domain.GatewayRouting) error {
+	err := validateGateways(paramLog, routing.Default)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range routing.Rules {
+		if len(rule.Gateways) == 0 {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Gateway rule "+rule.Name+" has no gateway")
+		}
+
+		err = validateGateways(paramLog, append(rule.Gateways, rule.WhenDown...))
+		if err != nil {
+			return err
+		}
+
+		if rule.MinAmount < 0 || rule.MaxAmount < 0 || (rule.MaxAmount > 0 && rule.MinAmount > rule.MaxAmount) {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Gateway rule "+rule.Name+" amount range invalid")
+		}
+
+		for _, clock := range []string{rule.FromTime, rule.ToTime} {
+			_, err = time.Parse(GATEWAY_ROUTING_TIME_FORMAT, clock)
+			if clock != "" && err != nil {
+				return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Gateway rule "+rule.Name+" time must be 15:04")
+			}
+		}
+
+		if (rule.FromTime == "") != (rule.ToTime == "") {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Gateway rule "+rule.Name+" needs both from and to time")
+		}
+	}
+
+	return nil
+}
+
+func isTransferGateway(code string) bool {
+	transferGateway, ok := gateway.Get(code)
+	return ok && transferGateway.Capabilities().Transfer
+}
+
+// transferGatewayCodes lists the registered gateways able to make transfers
+func transferGatewayCodes() []string {
+	codes := []string{}
+	for _, transferGateway := range gateway.Registered() {
+		if transferGateway.Capabilities().Transfer {
+			codes = append(codes, transferGateway.Name())
+		}
+	}
+
+	return codes
+}
+
+func validateGateways(paramLog *basic.ParamLog, codes []string) error {
+	for _, code := range codes {
+		if !isTransferGateway(code) {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting, "Unknown gateway "+code)
+		}
+	}
+
+	return nil
+}
+
+// TransferGatewayStrategies routes the transfer with the routing in use
+func TransferGatewayStrategies(paramLog *basic.ParamLog, transaction domain.Transaction) ([]domain.GatewayStrategy, int, error) {
+	at, err := utils.ParseTimestamp(transaction.Time)
+	if err != nil {
+		at = time.Now()
+	}
+
+	route, err := DryRunGatewayRoute(paramLog, 0, transaction.CorporateID, transaction.To.InstitutionCode, transaction.SubAmount, at)
+	if err != nil {
+		return []domain.GatewayStrategy{}, 0, err
+	}
+
+	strategies := []domain.GatewayStrategy{}
+	for _, code := range route.Gateways {
+		strategies = append(strategies, domain.GatewayStrategy{Code: code, IsExecuted: false})
+	}
+
+	return strategies, route.Version, nil
+}
+
+// DryRunGatewayRoute answers which gateways a transfer would use without making it, version zero
+// is the routing in use. Gateways that cannot pay out to a wallet are left out for wallet transfers.
+func DryRunGatewayRoute(paramLog *basic.ParamLog, version int, corporateID primitive.ObjectID, bankCode string,
+	amount int, at time.Time) (dto.GatewayRoute, error) {
+	var routing domain.GatewayRouting
+	var err error
+	if version == 0 {
+		routing, err = service.GatewayRoutingActiveNoSession()
+		if err == mongo.ErrNoDocuments {
+			routing, err = domain.GatewayRouting{Default: defaultGatewayRoute}, nil
+		}
+	} else {
+		routing, err = service.GatewayRoutingByVersionNoSession(version)
+		if err == mongo.ErrNoDocuments {
+			return dto.GatewayRoute{}, utils.ErrorBadRequest(paramLog, utils.InvalidGatewayRouting,
+				fmt.Sprintf("Gateway routing version %v not found", version))
+		}
+	}
+	if err != nil {
+		return dto.GatewayRoute{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	down, err := GatewaysDown(paramLog)
+	if err != nil {
+		return dto.GatewayRoute{}, err
+	}
+
+	route := dto.GatewayRoute{Version: routing.Version, Gateways: routing.Default, Down: []string{}}
+	for _, rule := range routing.Rules {
+		if gatewayRuleMatches(rule, corporateID, bankCode, amount, at.Format(GATEWAY_ROUTING_TIME_FORMAT), down) {
+			route.Rule = rule.Name
+			route.Gateways = rule.Gateways
+			break
+		}
+	}
+
+	wallet := gateway.IsWallet(bankCode)
+	up := []string{}
+	for _, code := range route.Gateways {
+		routeGateway, ok := gateway.Get(code)
+		if !ok || (wallet && !routeGateway.Capabilities().WalletPayout) {
+			continue
+		}
+
+		if down[code] {
+			route.Down = append(route.Down, code)
+		} else {
+			up = append(up, code)
+		}
+	}
+	route.Gateways = append(up, route.Down...)
+
+	return route, nil
+}
+
+func gatewayRuleMatches(rule domain.GatewayRule, corporateID primitive.ObjectID, bankCode string, amount int,
+	clock string, down map[string]bool) bool {
+	if len(rule.BankCodes) > 0 && !containsString(rule.BankCodes, bankCode) {
+		return false
+	}
+
+	if len(rule.CorporateIDs) > 0 {
+		found := false
+		for _, ID := range rule.CorporateIDs {
+			if ID == corporateID {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if amount < rule.MinAmount || (rule.MaxAmount > 0 && amount > rule.MaxAmount) {
+		return false
+	}
+
+	if rule.FromTime != "" {
+		inside := clock >= rule.FromTime && clock < rule.ToTime
+		if rule.FromTime > rule.ToTime {
+			inside = clock >= rule.FromTime || clock < rule.ToTime
+		}
+
+		if !inside {
+			return false
+		}
+	}
+
+	if len(rule.WhenDown) > 0 {
+		found := false
+		for _, code := range rule.WhenDown {
+			if down[code] {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGatewayRuleMatches(t *testing.T) {
+	corporateID := primitive.NewObjectID()
+
+	tests := []struct {
+		name        string
+		rule        domain.GatewayRule
+		corporateID primitive.ObjectID
+		bankCode    string
+		amount      int
+		clock       string
+		down        map[string]bool
+		matches     bool
+	}{
+		{name: "catch all", rule: domain.GatewayRule{}, bankCode: "014", amount: 10000, clock: "10:00", matches: true},
+		{name: "bank listed", rule: domain.GatewayRule{BankCodes: []string{"014", "008"}}, bankCode: "008", matches: true},
+		{name: "bank not listed", rule: domain.GatewayRule{BankCodes: []string{"014"}}, bankCode: "008", matches: false},
+		{name: "corporate listed", rule: domain.GatewayRule{CorporateIDs: []primitive.ObjectID{corporateID}},
+			corporateID: corporateID, matches: true},
+		{name: "corporate not listed", rule: domain.GatewayRule{CorporateIDs: []primitive.ObjectID{corporateID}},
+			corporateID: primitive.NewObjectID(), matches: false},
+		{name: "under the minimum", rule: domain.GatewayRule{MinAmount: 10000}, amount: 9999, matches: false},
+		{name: "on the minimum", rule: domain.GatewayRule{MinAmount: 10000}, amount: 10000, matches: true},
+		{name: "on the maximum", rule: domain.GatewayRule{MaxAmount: 50000}, amount: 50000, matches: true},
+		{name: "over the maximum", rule: domain.GatewayRule{MaxAmount: 50000}, amount: 50001, matches: false},
+		{name: "inside the window", rule: domain.GatewayRule{FromTime: "08:00", ToTime: "17:00"}, clock: "08:00", matches: true},
+		{name: "window end excluded", rule: domain.GatewayRule{FromTime: "08:00", ToTime: "17:00"}, clock: "17:00", matches: false},
+		{name: "overnight window before midnight", rule: domain.GatewayRule{FromTime: "22:00", ToTime: "06:00"}, clock: "23:30",
+			matches: true},
+		{name: "overnight window after midnight", rule: domain.GatewayRule{FromTime: "22:00", ToTime: "06:00"}, clock: "05:59",
+			matches: true},
+		{name: "outside the overnight window", rule: domain.GatewayRule{FromTime: "22:00", ToTime: "06:00"}, clock: "12:00",
+			matches: false},
+		{name: "fallback while down", rule: domain.GatewayRule{WhenDown: []string{"D"}}, down: map[string]bool{"D": true},
+			matches: true},
+		{name: "fallback while up", rule: domain.GatewayRule{WhenDown: []string{"D"}}, down: map[string]bool{"A": true},
+			matches: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches := gatewayRuleMatches(test.rule, test.corporateID, test.bankCode, test.amount, test.clock, test.down)
+			if matches != test.matches {
+				t.Errorf("gatewayRuleMatches = %v, want %v", matches, test.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const DEFAULT_HOLD_EXPIRY_MINUTE = 4320
+
+func HoldExpiredAt(from time.Time) string {
+	minute, err := strconv.Atoi(os.Getenv("HOLD_EXPIRY_MINUTE"))
+	if err != nil || minute <= 0 {
+		minute = DEFAULT_HOLD_EXPIRY_MINUTE
+	}
+
+	return from.Add(time.Duration(minute) * time.Minute).Format(os.Getenv("TIME_FORMAT"))
+}
+
+func PlaceHold(paramLog *basic.ParamLog, hold *domain.Hold, session mongo.SessionContext) error {
+	for _, reserve := range hold.Reserves {
+		balance, err := service.BalanceReserve(paramLog, reserve.BalanceID, reserve.Amount, session)
+		if err == mongo.ErrNoDocuments {
+			return balanceGuardError(paramLog, reserve.BalanceID, true, session)
+		}
+		if err != nil {
+			return err
+		}
+		basic.LogInformation2(paramLog, "BalanceReserve", balance)
+	}
+
+	err := service.HoldSaveOne(hold, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func CaptureHoldBalance(paramLog *basic.ParamLog, statement domain.Statement, session mongo.SessionContext) error {
+	balance, err := service.BalanceCaptureReserve(paramLog, statement.BalanceID, statement.Withdraw, session)
+	if err != nil {
+		return err
+	}
+
+	statement.Balance = balance.Amount
+
+	err = service.StatementSaveOne(statement, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseHold gives reserved funds back to available, a hold that is no longer active is left as is
+func ReleaseHold(paramLog *basic.ParamLog, holdID string, status string) error {
+	function := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			session.AbortTransaction(session)
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Release hold start transaction failed")
+		}
+
+		hold, err := service.HoldByID(holdID, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if hold.Status != domain.HOLD_ACTIVE_STATUS {
+			session.AbortTransaction(session)
+			return nil
+		}
+
+		for _, reserve := range hold.Reserves {
+			_, err = service.BalanceReleaseReserve(paramLog, reserve.BalanceID, reserve.Amount, session)
+			if err != nil {
+				session.AbortTransaction(session)
+				return err
+			}
+		}
+
+		err = ReleaseLimits(paramLog, hold.TransactionCode, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = ReleasePromotions(paramLog, hold.TransactionCode, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		hold.Status = status
+		hold.SettledTime = time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+		err = service.HoldUpdateOne(paramLog, &hold, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		return database.CommitWithRetry(session)
+	}
+
+	err := database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, function)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExpireHolds is meant to be scheduled periodically by the host service. The gateway may still pay
+// out a transfer pending there, its hold is escalated for review instead of released.
+func ExpireHolds(paramLog *basic.ParamLog) error {
+	holds, err := service.HoldsActiveNoSession(paramLog)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hold := range holds {
+		expiredAt, err := utils.ParseTimestamp(hold.ExpiredAt)
+		if err != nil || expiredAt.After(now) || hold.EscalatedTime != "" {
+			continue
+		}
+
+		transaction, err := service.TransactionByCodeNoSession(paramLog, hold.TransactionCode)
+		if err == nil && transaction.Status == domain.PENDING_STATUS && transaction.Gateway != "" {
+			escalateHold(paramLog, hold, transaction, now)
+			continue
+		}
+
+		err = ReleaseHold(paramLog, hold.ID.Hex(), domain.HOLD_EXPIRED_STATUS)
+		if err != nil {
+			basic.LogError(paramLog, fmt.Sprintf("Failed expire hold %v because %v", hold.ID.Hex(), err.Error()))
+		}
+	}
+
+	return nil
+}
+
+func escalateHold(paramLog *basic.ParamLog, hold domain.Hold, transaction domain.Transaction, now time.Time) {
+	escalated, err := service.HoldEscalate(paramLog, hold.ID, now.Format(os.Getenv("TIME_FORMAT")))
+	if err != nil || !escalated {
+		return
+	}
+
+	err = service.TransferRequeryEscalate(paramLog, domain.TransferRequery{
+		ID:              transaction.TransactionCode,
+		Gateway:         transaction.Gateway,
+		Reference:       transaction.GatewayReference,
+		EscalatedReason: "Hold expired while the transfer is pending at gateway " + transaction.Gateway,
+		Time:            now.Format(os.Getenv("TIME_FORMAT")),
+	})
+	if err != nil {
+		basic.LogError(paramLog, fmt.Sprintf("Failed escalate hold %v because %v", hold.ID.Hex(), err.Error()))
+	}
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const DEFAULT_INBOUND_CALLBACK_LOCK_SECOND = 300
+
+// ProcessCallbackOnce runs process for the first delivery of a gateway callback and keeps what it
+// put in result, a pointer. A replay of a processed callback gets that result back without running
+// process again, a replay arriving while the callback is still being processed gets a conflict so
+// the provider retries later. A failed processing is run again by the next delivery.
+func ProcessCallbackOnce(paramLog *basic.ParamLog, gatewayCode string, reference string, event string,
+	result interface{}, process func() error) error {
+	if reference == "" {
+		basic.LogInformation(paramLog, "Callback without reference processed without deduplication")
+		return process()
+	}
+
+	now := time.Now()
+	callback := domain.InboundCallback{
+		ID:        domain.InboundCallbackID(gatewayCode, reference, event),
+		Gateway:   gatewayCode,
+		Reference: reference,
+		Event:     event,
+		Time:      now.Format(os.Getenv("TIME_FORMAT")),
+	}
+
+	claimed, err := service.InboundCallbackClaim(paramLog, callback, now.Unix(), now.Add(inboundCallbackLock()).Unix())
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		return replayCallback(paramLog, callback.ID, result)
+	}
+
+	err = process()
+	if err != nil {
+		failedErr := service.InboundCallbackFailed(paramLog, callback.ID, err.Error())
+		if failedErr != nil {
+			basic.LogError2(paramLog, "InboundCallbackFailed", failedErr)
+		}
+		return err
+	}
+
+	raw, err := bson.Marshal(result)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.BsonUnmarshalFailed, err.Error())
+	}
+
+	err = service.InboundCallbackProcessed(paramLog, callback.ID, raw, time.Now().Format(os.Getenv("TIME_FORMAT")))
+	if err != nil {
+		basic.LogError2(paramLog, "InboundCallbackProcessed", err)
+	}
+
+	return nil
+}
+
+func replayCallback(paramLog *basic.ParamLog, ID string, result interface{}) error {
+	callback, err := service.InboundCallbackByIDNoSession(ID)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	if callback.Status != domain.INBOUND_CALLBACK_PROCESSED {
+		return utils.ErrorConflict(paramLog, utils.CallbackInProgress, "Callback is being processed "+ID)
+	}
+
+	err = service.InboundCallbackReplayed(paramLog, ID)
+	if err != nil {
+		basic.LogError2(paramLog, "InboundCallbackReplayed", err)
+	}
+
+	basic.LogInformation(paramLog, "Callback replayed "+ID)
+
+	if len(callback.Result) == 0 {
+		return nil
+	}
+
+	err = bson.Unmarshal(callback.Result, result)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.BsonUnmarshalFailed, err.Error())
+	}
+
+	return nil
+}
+
+func inboundCallbackLock() time.Duration {
+	second, err := strconv.Atoi(os.Getenv("INBOUND_CALLBACK_LOCK_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_INBOUND_CALLBACK_LOCK_SECOND
+	}
+
+	return time.Duration(second) * time.Second
+}
@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+)
+
+func ValidateJournal(paramLog *basic.ParamLog, journal domain.Journal) error {
+	sums := map[string]int{}
+	for _, leg := range journal.Legs {
+		if leg.Withdraw < 0 || leg.Deposit < 0 {
+			return utils.ErrorInternalServer(paramLog, utils.UnbalancedJournal,
+				fmt.Sprintf("Journal %v has negative leg on %v", journal.TransactionCode, leg.Reference))
+		}
+		sums[leg.Currency] = sums[leg.Currency] + leg.Deposit - leg.Withdraw
+	}
+
+	for currency, sum := range sums {
+		if sum != 0 {
+			return utils.ErrorInternalServer(paramLog, utils.UnbalancedJournal,
+				fmt.Sprintf("Journal %v unbalanced by %v %v", journal.TransactionCode, sum, currency))
+		}
+	}
+
+	return nil
+}
+
+func JournalByTransactionCode(paramLog *basic.ParamLog, transactionCode string) ([]domain.Journal, error) {
+	journals, err := service.JournalsByTransactionCode(paramLog, transactionCode)
+	if err != nil {
+		return []domain.Journal{}, err
+	}
+
+	if len(journals) == 0 {
+		return []domain.Journal{}, utils.ErrorBadRequest(paramLog, utils.TransactionNotFound, "Journal not found")
+	}
+
+	return journals, nil
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func transactionStatement(balanceID primitive.ObjectID, currency string, withdraw int, deposit int) domain.Statement {
+	return domain.Statement{
+		BalanceID: balanceID,
+		Reference: "TRX1",
+		Withdraw:  withdraw,
+		Deposit:   deposit,
+		Currency:  currency,
+		Type:      domain.STATEMENT_TYPE_TRANSACTION,
+	}
+}
+
+func feeStatement(balanceID primitive.ObjectID, withdraw int, deposit int) domain.Statement {
+	return domain.Statement{
+		BalanceID: balanceID,
+		Reference: "TRX1",
+		Withdraw:  withdraw,
+		Deposit:   deposit,
+		Currency:  domain.CURRENCY_IDR,
+		Type:      domain.STATEMENT_TYPE_FEE,
+	}
+}
+
+func TestValidateJournal(t *testing.T) {
+	balance := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	feeBalance := primitive.NewObjectID()
+
+	topup := domain.Transaction{TransactionCode: "TRX1", Type: domain.TOPUP, SubAmount: 10000, Currency: domain.CURRENCY_IDR}
+	transfer := domain.Transaction{TransactionCode: "TRX1", Type: domain.TRANSFER_BANK, SubAmount: 10000, Currency: domain.CURRENCY_IDR}
+	conversion := domain.Transaction{TransactionCode: "TRX1", Type: domain.DEDUCT, SubAmount: 10000, Currency: domain.CURRENCY_IDR,
+		FX: &domain.TransactionFX{FromCurrency: domain.CURRENCY_IDR, ToCurrency: domain.CURRENCY_USD, FromAmount: 10000, ToAmount: 65}}
+
+	tests := []struct {
+		name        string
+		transaction domain.Transaction
+		journalType string
+		statements  []domain.Statement
+		external    string
+		inbound     bool
+		balanced    bool
+	}{
+		{
+			name:        "topup with fee",
+			transaction: topup,
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements: []domain.Statement{
+				transactionStatement(balance, domain.CURRENCY_IDR, 0, 10000),
+				feeStatement(balance, 500, 0),
+				feeStatement(feeBalance, 0, 500),
+			},
+			external: "BANK_ACCOUNT:014",
+			inbound:  true,
+			balanced: true,
+		},
+		{
+			name:        "topup deposit not matching the sub amount",
+			transaction: topup,
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements:  []domain.Statement{transactionStatement(balance, domain.CURRENCY_IDR, 0, 9999)},
+			external:    "BANK_ACCOUNT:014",
+			inbound:     true,
+			balanced:    false,
+		},
+		{
+			name:        "transfer withdraw in the wrong direction",
+			transaction: transfer,
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements:  []domain.Statement{transactionStatement(balance, domain.CURRENCY_IDR, 0, 10000)},
+			external:    "BANK_ACCOUNT:014",
+			inbound:     false,
+			balanced:    false,
+		},
+		{
+			name:        "transfer rollback",
+			transaction: transfer,
+			journalType: domain.JOURNAL_TYPE_ROLLBACK,
+			statements:  []domain.Statement{transactionStatement(balance, domain.CURRENCY_IDR, 0, 10000)},
+			external:    "BANK_ACCOUNT:014",
+			inbound:     false,
+			balanced:    true,
+		},
+		{
+			name:        "transfer between balances",
+			transaction: domain.Transaction{TransactionCode: "TRX1", SubAmount: 10000, Currency: domain.CURRENCY_IDR},
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements: []domain.Statement{
+				transactionStatement(balance, domain.CURRENCY_IDR, 10000, 0),
+				transactionStatement(other, domain.CURRENCY_IDR, 0, 10000),
+			},
+			balanced: true,
+		},
+		{
+			name:        "conversion",
+			transaction: conversion,
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements: []domain.Statement{
+				transactionStatement(balance, domain.CURRENCY_IDR, 10000, 0),
+				transactionStatement(other, domain.CURRENCY_USD, 0, 65),
+			},
+			balanced: true,
+		},
+		{
+			name:        "conversion crediting more than quoted",
+			transaction: conversion,
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements: []domain.Statement{
+				transactionStatement(balance, domain.CURRENCY_IDR, 10000, 0),
+				transactionStatement(other, domain.CURRENCY_USD, 0, 66),
+			},
+			balanced: false,
+		},
+		{
+			name:        "negative leg",
+			transaction: domain.Transaction{TransactionCode: "TRX1", Currency: domain.CURRENCY_IDR},
+			journalType: domain.JOURNAL_TYPE_COMMIT,
+			statements: []domain.Statement{
+				transactionStatement(balance, domain.CURRENCY_IDR, -100, 0),
+				transactionStatement(other, domain.CURRENCY_IDR, 0, -100),
+			},
+			balanced: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			journal := service.CreateJournal(test.transaction, test.journalType, "", test.statements, test.external, test.inbound)
+			err := ValidateJournal(nil, journal)
+			if test.balanced && err != nil {
+				t.Fatalf("expected a balanced journal, got %v", err)
+			}
+			if !test.balanced && err == nil {
+				t.Fatalf("expected an unbalanced journal, legs %+v", journal.Legs)
+			}
+		})
+	}
+}
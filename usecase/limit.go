@@ -0,0 +1,248 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var limitTransactionTypes = map[string]bool{
+	domain.TOPUP:           true,
+	domain.DEDUCT:          true,
+	domain.TRANSFER_WALLET: true,
+	domain.TRANSFER_BANK:   true,
+	domain.BILLER:          true,
+}
+
+// SaveLimit adds the limit when it has no ID yet and replaces it otherwise
+func SaveLimit(paramLog *basic.ParamLog, limit *domain.Limit) error {
+	if limit.TransactionType != "" && !limitTransactionTypes[limit.TransactionType] {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidLimit, "Limit transaction type not supported")
+	}
+
+	if limit.Verification != "" && limit.Verification != domain.LIMIT_VERIFIED && limit.Verification != domain.LIMIT_UNVERIFIED {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidLimit, "Limit verification must be VERIFIED or UNVERIFIED")
+	}
+
+	caps := []int{limit.MinAmount, limit.MaxAmount, limit.DailyAmount, limit.DailyCount, limit.MonthlyAmount, limit.MonthlyCount}
+	for _, value := range caps {
+		if value < 0 {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidLimit, "Limit cap cannot be negative")
+		}
+	}
+
+	if limit.MaxAmount > 0 && limit.MinAmount > limit.MaxAmount {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidLimit, "Limit minimum above maximum")
+	}
+
+	if limit.ID.IsZero() {
+		limit.Time = time.Now().Format(os.Getenv("TIME_FORMAT"))
+		return service.LimitSaveOne(paramLog, limit)
+	}
+
+	return service.LimitUpdateOne(paramLog, limit)
+}
+
+// CheckLimits rejects a transaction that breaches a limit given the usage so far, it writes nothing.
+// The usage is only taken by ConsumeLimits when the transaction is committed. Without a limit capping
+// the amount the MINIMUM_TRANSFER_AMOUNT and MAXIMUM_TRANSFER_AMOUNT of the environment apply.
+func CheckLimits(paramLog *basic.ParamLog, transaction domain.Transaction) error {
+	limits, err := matchingLimits(paramLog, transaction)
+	if err != nil {
+		return err
+	}
+
+	err = checkDefaultAmountLimit(paramLog, limits, transaction.Amount)
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range limits {
+		err = checkAmountLimit(paramLog, limit, transaction.Amount)
+		if err != nil {
+			return err
+		}
+
+		for _, usage := range limitUsages(limit, transaction, time.Now()) {
+			used, err := service.LimitUsageByIDNoSession(usage.ID)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+			}
+
+			amountCap, countCap := limitCaps(limit, usage.Period)
+			if (amountCap > 0 && used.Amount+usage.Amount > amountCap) || (countCap > 0 && used.Count+1 > countCap) {
+				return limitExceededError(paramLog, limit, usage.Period)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ConsumeLimits takes the daily and monthly usage of the transaction within the commit session and
+// records the usages on the transaction so a rollback can give them back
+func ConsumeLimits(paramLog *basic.ParamLog, transaction *domain.Transaction, session mongo.SessionContext) error {
+	limits, err := matchingLimits(paramLog, *transaction)
+	if err != nil {
+		return err
+	}
+
+	usageIDs := []string{}
+	for _, limit := range limits {
+		err = checkAmountLimit(paramLog, limit, transaction.Amount)
+		if err != nil {
+			return err
+		}
+
+		for _, usage := range limitUsages(limit, *transaction, time.Now()) {
+			amountCap, countCap := limitCaps(limit, usage.Period)
+			if amountCap > 0 && usage.Amount > amountCap {
+				return limitExceededError(paramLog, limit, usage.Period)
+			}
+
+			used, err := service.LimitUsageConsume(usage, amountCap, countCap, session)
+			if mongo.IsDuplicateKeyError(err) {
+				return limitExceededError(paramLog, limit, usage.Period)
+			}
+			if database.IsWriteConflict(err) {
+				return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Limit usage changed concurrently "+usage.ID)
+			}
+			if err != nil {
+				return err
+			}
+			basic.LogInformation2(paramLog, "LimitUsageConsume", used)
+
+			usageIDs = append(usageIDs, usage.ID)
+		}
+	}
+
+	transaction.LimitUsages = usageIDs
+
+	return nil
+}
+
+// ReleaseLimits gives back the usage taken by a transaction that failed, usages are released once
+func ReleaseLimits(paramLog *basic.ParamLog, transactionCode string, session mongo.SessionContext) error {
+	transaction, err := service.TransactionTakeLimitUsages(transactionCode, session)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, usageID := range transaction.LimitUsages {
+		err = service.LimitUsageRelease(usageID, transaction.Amount, session)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func matchingLimits(paramLog *basic.ParamLog, transaction domain.Transaction) ([]domain.Limit, error) {
+	balanceID := domain.LimitBalanceID(transaction)
+
+	verification := domain.LIMIT_UNVERIFIED
+	balance, err := service.BalanceByIDNoSession(balanceID.Hex())
+	if err != nil {
+		return []domain.Limit{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	owner, err := ActorObjectToActor(paramLog, balance.Owner.ToActorObject())
+	if err != nil {
+		return []domain.Limit{}, err
+	}
+
+	if owner.IsVerify() {
+		verification = domain.LIMIT_VERIFIED
+	}
+
+	return service.LimitsActiveMatchingNoSession(paramLog, transaction.CorporateID, balanceID, transaction.Type, verification)
+}
+
+func checkAmountLimit(paramLog *basic.ParamLog, limit domain.Limit, amount int) error {
+	if limit.MinAmount > 0 && amount < limit.MinAmount {
+		return utils.ErrorBadRequest(paramLog, utils.MinimumAmountTransaction, "Transaction under minimum")
+	}
+
+	if limit.MaxAmount > 0 && amount > limit.MaxAmount {
+		return utils.ErrorBadRequest(paramLog, utils.LimitExceeded,
+			fmt.Sprintf("Transaction reach maximum of limit %v", limit.ID.Hex()))
+	}
+
+	return nil
+}
+
+func checkDefaultAmountLimit(paramLog *basic.ParamLog, limits []domain.Limit, amount int) error {
+	hasMinimum, hasMaximum := false, false
+	for _, limit := range limits {
+		hasMinimum = hasMinimum || limit.MinAmount > 0
+		hasMaximum = hasMaximum || limit.MaxAmount > 0
+	}
+
+	minimum, _ := strconv.Atoi(os.Getenv("MINIMUM_TRANSFER_AMOUNT"))
+	if !hasMinimum && amount < minimum {
+		return utils.ErrorBadRequest(paramLog, utils.MinimumAmountTransaction, "Transaction under minimum")
+	}
+
+	maximum, _ := strconv.Atoi(os.Getenv("MAXIMUM_TRANSFER_AMOUNT"))
+	if !hasMaximum && maximum > 0 && amount > maximum {
+		return utils.ErrorBadRequest(paramLog, utils.MaximumAmountTransaction, "Transaction reach maximum")
+	}
+
+	return nil
+}
+
+// The usages a transaction counts against, one per period the limit caps
+func limitUsages(limit domain.Limit, transaction domain.Transaction, now time.Time) []domain.LimitUsage {
+	balanceID := domain.LimitBalanceID(transaction)
+
+	periods := []string{}
+	if limit.DailyAmount > 0 || limit.DailyCount > 0 {
+		periods = append(periods, "D"+now.Format("20060102"))
+	}
+	if limit.MonthlyAmount > 0 || limit.MonthlyCount > 0 {
+		periods = append(periods, "M"+now.Format("200601"))
+	}
+
+	usages := []domain.LimitUsage{}
+	for _, period := range periods {
+		usages = append(usages, domain.LimitUsage{
+			ID:        limit.ID.Hex() + ":" + balanceID.Hex() + ":" + period,
+			LimitID:   limit.ID,
+			BalanceID: balanceID,
+			Period:    period,
+			Amount:    transaction.Amount,
+		})
+	}
+
+	return usages
+}
+
+func limitCaps(limit domain.Limit, period string) (int, int) {
+	if period[0] == 'D' {
+		return limit.DailyAmount, limit.DailyCount
+	}
+
+	return limit.MonthlyAmount, limit.MonthlyCount
+}
+
+func limitExceededError(paramLog *basic.ParamLog, limit domain.Limit, period string) error {
+	name := "monthly"
+	if period[0] == 'D' {
+		name = "daily"
+	}
+
+	return utils.ErrorBadRequest(paramLog, utils.LimitExceeded,
+		fmt.Sprintf("Transaction reach %v limit %v", name, limit.ID.Hex()))
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func errorCode(err error) int {
+	customError, ok := err.(utils.CustomError)
+	if !ok {
+		return 0
+	}
+
+	return customError.Code
+}
+
+func TestCheckDefaultAmountLimit(t *testing.T) {
+	t.Setenv("MINIMUM_TRANSFER_AMOUNT", "10000")
+	t.Setenv("MAXIMUM_TRANSFER_AMOUNT", "50000000")
+
+	tests := []struct {
+		name   string
+		limits []domain.Limit
+		amount int
+		code   int
+	}{
+		{name: "within the environment", amount: 10000},
+		{name: "under the environment minimum", amount: 9999, code: utils.MinimumAmountTransaction},
+		{name: "over the environment maximum", amount: 50000001, code: utils.MaximumAmountTransaction},
+		{name: "limit with its own minimum", limits: []domain.Limit{{MinAmount: 1000}}, amount: 5000},
+		{name: "limit with its own maximum", limits: []domain.Limit{{MaxAmount: 100000000}}, amount: 60000000},
+		{name: "limit capping only the day", limits: []domain.Limit{{DailyAmount: 1000000}}, amount: 9999,
+			code: utils.MinimumAmountTransaction},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkDefaultAmountLimit(nil, test.limits, test.amount)
+			if errorCode(err) != test.code {
+				t.Errorf("checkDefaultAmountLimit(%v) = %v, want code %v", test.amount, err, test.code)
+			}
+		})
+	}
+}
+
+func TestCheckDefaultAmountLimitWithoutEnvironment(t *testing.T) {
+	t.Setenv("MINIMUM_TRANSFER_AMOUNT", "")
+	t.Setenv("MAXIMUM_TRANSFER_AMOUNT", "")
+
+	err := checkDefaultAmountLimit(nil, []domain.Limit{}, 1)
+	if err != nil {
+		t.Errorf("checkDefaultAmountLimit without environment = %v, want nil", err)
+	}
+}
+
+func TestCheckAmountLimit(t *testing.T) {
+	limit := domain.Limit{ID: primitive.NewObjectID(), MinAmount: 10000, MaxAmount: 100000}
+
+	tests := []struct {
+		amount int
+		code   int
+	}{
+		{amount: 10000},
+		{amount: 100000},
+		{amount: 9999, code: utils.MinimumAmountTransaction},
+		{amount: 100001, code: utils.LimitExceeded},
+	}
+
+	for _, test := range tests {
+		err := checkAmountLimit(nil, limit, test.amount)
+		if errorCode(err) != test.code {
+			t.Errorf("checkAmountLimit(%v) = %v, want code %v", test.amount, err, test.code)
+		}
+	}
+}
+
+func TestLimitUsages(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	balanceID := primitive.NewObjectID()
+	transaction := domain.Transaction{Type: domain.TRANSFER_BANK, FromBalanceID: balanceID, Amount: 25000}
+
+	tests := []struct {
+		name    string
+		limit   domain.Limit
+		periods []string
+	}{
+		{name: "amount only", limit: domain.Limit{MaxAmount: 100000}},
+		{name: "daily", limit: domain.Limit{DailyCount: 5}, periods: []string{"D20261018"}},
+		{name: "daily and monthly", limit: domain.Limit{DailyAmount: 100000, MonthlyAmount: 1000000},
+			periods: []string{"D20261018", "M202610"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			usages := limitUsages(test.limit, transaction, now)
+			if len(usages) != len(test.periods) {
+				t.Fatalf("limitUsages = %v usages, want %v", len(usages), len(test.periods))
+			}
+
+			for i, usage := range usages {
+				if usage.Period != test.periods[i] || usage.BalanceID != balanceID || usage.Amount != transaction.Amount {
+					t.Errorf("usage %v = %+v", i, usage)
+				}
+				if usage.ID != test.limit.ID.Hex()+":"+balanceID.Hex()+":"+test.periods[i] {
+					t.Errorf("usage ID %v", usage.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LegacyMoney reads a requested amount given in the unit of the bare int fields
+func LegacyMoney(paramLog *basic.ParamLog, amount int, currency string) (domain.Money, error) {
+	if amount < 0 {
+		return domain.Money{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Negative amount")
+	}
+
+	money, err := domain.MoneyFromLegacy(amount, currency)
+	if err != nil {
+		return domain.Money{}, MoneyError(paramLog, err)
+	}
+
+	return money, nil
+}
+
+func MoneyError(paramLog *basic.ParamLog, err error) error {
+	switch err {
+	case domain.ErrUnknownCurrency, domain.ErrCurrencyMismatch:
+		return utils.ErrorBadRequest(paramLog, utils.CurrencyError, err.Error())
+	case domain.ErrMoneyOverflow:
+		return utils.ErrorBadRequest(paramLog, utils.AmountOverflow, err.Error())
+	case domain.ErrInvalidRate:
+		return utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, err.Error())
+	}
+
+	return err
+}
+
+// TransactionMoney returns sub amount, total fee with its details and the amount debited from the source
+func TransactionMoney(paramLog *basic.ParamLog, feeQuoteID string, corporate domain.Corporate, payer string, payerID primitive.ObjectID,
+	transactionType string, subAmount int, currency string) (domain.Money, domain.Money, []domain.DetailFee, domain.Money, error) {
+	subAmountMoney, err := LegacyMoney(paramLog, subAmount, currency)
+	if err != nil {
+		return domain.Money{}, domain.Money{}, []domain.DetailFee{}, domain.Money{}, err
+	}
+
+	totalFee, detailsFee, err := QuotedTransactionFee(paramLog, feeQuoteID, corporate, payer, payerID, transactionType, subAmountMoney)
+	if err != nil {
+		return domain.Money{}, domain.Money{}, []domain.DetailFee{}, domain.Money{}, err
+	}
+
+	amount, err := subAmountMoney.Add(totalFee)
+	if err != nil {
+		return domain.Money{}, domain.Money{}, []domain.DetailFee{}, domain.Money{}, MoneyError(paramLog, err)
+	}
+
+	return subAmountMoney, totalFee, detailsFee, amount, nil
+}
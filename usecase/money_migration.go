@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateMoneyCurrency is the first step of moving stored amounts to Money. It rewrites stored
+// currency codes such as "idr" to ISO-4217, backfills the currency of statements from their balance
+// and records on every document the exponent its bare int amounts are kept in as amount_exponent.
+// The amounts themselves are not converted yet, that is left to the step reading them by their
+// recorded exponent. It is safe to run twice.
+func MigrateMoneyCurrency(paramLog *basic.ParamLog) error {
+	collections := []string{domain.BALANCE_COLLECTION, domain.CORPORATE_COLLECTION, domain.TRANSACTION_COLLECTION}
+
+	for _, collection := range collections {
+		_, err := database.Update(paramLog, collection, bson.M{"currency": bson.M{"$exists": false}},
+			bson.D{{Key: "$set", Value: bson.M{"currency": domain.CURRENCY_IDR}}})
+		if err != nil {
+			return err
+		}
+
+		for _, currency := range domain.Currencies() {
+			filter := bson.M{"currency": bson.M{"$regex": "^" + currency + "$", "$options": "i", "$ne": currency}}
+			result, err := database.Update(paramLog, collection, filter,
+				bson.D{{Key: "$set", Value: bson.M{"currency": currency}}})
+			if err != nil {
+				return err
+			}
+
+			if result.ModifiedCount > 0 {
+				basic.LogInformation2(paramLog, "MigrateMoneyCurrency", fmt.Sprintf("%v %v %v", collection, currency, result.ModifiedCount))
+			}
+		}
+	}
+
+	balances, err := service.BalancesNoSession(paramLog)
+	if err != nil {
+		return err
+	}
+
+	for _, balance := range balances {
+		filter := bson.M{"balance_id": balance.ID, "currency": bson.M{"$exists": false}}
+		_, err := database.Update(paramLog, domain.STATEMENT_COLLECTION_NAME, filter,
+			bson.D{{Key: "$set", Value: bson.M{"currency": domain.NormalizeCurrency(balance.Currency)}}})
+		if err != nil {
+			return err
+		}
+	}
+
+	collections = append(collections, domain.STATEMENT_COLLECTION_NAME)
+	for _, collection := range collections {
+		for _, currency := range domain.Currencies() {
+			filter := bson.M{"currency": currency, "amount_exponent": bson.M{"$exists": false}}
+			result, err := database.Update(paramLog, collection, filter,
+				bson.D{{Key: "$set", Value: bson.M{"amount_exponent": domain.LegacyExponent(currency)}}})
+			if err != nil {
+				return err
+			}
+
+			if result.ModifiedCount > 0 {
+				basic.LogInformation2(paramLog, "MigrateMoneyCurrency", fmt.Sprintf("%v %v exponent %v", collection, currency, result.ModifiedCount))
+			}
+		}
+	}
+
+	return nil
+}
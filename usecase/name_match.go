@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kangdjoker/takeme-core/domain"
+)
+
+const (
+	DEFAULT_NAME_MATCH_FLAG_SCORE  = 80
+	DEFAULT_NAME_MATCH_BLOCK_SCORE = 50
+)
+
+var nameMatchTitles = map[string]bool{
+	"BPK": true, "BAPAK": true, "IBU": true, "SDR": true, "SDRI": true, "TN": true, "NY": true, "NN": true,
+	"MR": true, "MRS": true, "MS": true, "DR": true, "IR": true, "H": true, "HJ": true,
+}
+
+// MatchName scores the holder name against the expected one and decides whether a transfer to it
+// passes, is flagged for review or is blocked
+func MatchName(expected string, accountName string) domain.NameMatch {
+	score := NameMatchScore(expected, accountName)
+
+	return domain.NameMatch{
+		Expected:    expected,
+		AccountName: accountName,
+		Score:       score,
+		Decision:    NameMatchDecision(score),
+	}
+}
+
+// NameMatchScore tells from 0 to 100 how alike two names are. Case, punctuation, titles and the
+// order of the words do not count and an initial matches the word it stands for, though initials
+// alone stay under the flag score until a whole word matches too.
+func NameMatchScore(a string, b string) int {
+	tokensA := nameTokens(a)
+	tokensB := nameTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	compact := stringSimilarity(strings.Join(tokensA, ""), strings.Join(tokensB, ""))
+	tokens, initialsOnly := tokenSimilarity(tokensA, tokensB)
+	if compact >= tokens {
+		return int(math.Round(compact * 100))
+	}
+
+	score := int(math.Round(tokens * 100))
+	limit := nameMatchEnvScore("NAME_MATCH_FLAG_SCORE", DEFAULT_NAME_MATCH_FLAG_SCORE) - 1
+	if initialsOnly && score > limit {
+		score = limit
+	}
+
+	return score
+}
+
+func NameMatchDecision(score int) string {
+	if score >= nameMatchEnvScore("NAME_MATCH_FLAG_SCORE", DEFAULT_NAME_MATCH_FLAG_SCORE) {
+		return domain.NAME_MATCH_PASS
+	}
+
+	if score >= nameMatchEnvScore("NAME_MATCH_BLOCK_SCORE", DEFAULT_NAME_MATCH_BLOCK_SCORE) {
+		return domain.NAME_MATCH_FLAG
+	}
+
+	return domain.NAME_MATCH_BLOCK
+}
+
+func nameTokens(name string) []string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return ' '
+	}, name)
+
+	tokens := []string{}
+	for _, token := range strings.Fields(cleaned) {
+		if !nameMatchTitles[token] {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+// tokenSimilarity pairs every word of the shorter name with its best unused word of the longer one,
+// words missing from the shorter name cost less than words that differ. It also tells whether the
+// pairs lean on an initial without any whole word matching.
+func tokenSimilarity(a []string, b []string) (float64, bool) {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	used := make([]bool, len(b))
+	total := 0.0
+	initial, fullWord := false, false
+	for _, token := range a {
+		best, bestIndex := 0.0, -1
+		for index, other := range b {
+			if used[index] {
+				continue
+			}
+
+			similarity := wordSimilarity(token, other)
+			if similarity > best {
+				best, bestIndex = similarity, index
+			}
+		}
+
+		if bestIndex >= 0 {
+			used[bestIndex] = true
+
+			other := b[bestIndex]
+			if len([]rune(token)) == 1 || len([]rune(other)) == 1 {
+				initial = true
+			} else if token == other {
+				fullWord = true
+			}
+		}
+		total = total + best
+	}
+
+	return 0.8*(total/float64(len(a))) + 0.2*(float64(len(a))/float64(len(b))), initial && !fullWord
+}
+
+func wordSimilarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	if (len(ra) == 1 || len(rb) == 1) && ra[0] == rb[0] {
+		return 0.9
+	}
+
+	return stringSimilarity(a, b)
+}
+
+func stringSimilarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func nameMatchEnvScore(name string, fallback int) int {
+	score, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || score < 0 || score > 100 {
+		score = fallback
+	}
+
+	return score
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+)
+
+func TestNameMatchScore(t *testing.T) {
+	t.Setenv("NAME_MATCH_FLAG_SCORE", "")
+	t.Setenv("NAME_MATCH_BLOCK_SCORE", "")
+
+	tests := []struct {
+		expected    string
+		accountName string
+		score       int
+		decision    string
+	}{
+		{expected: "Andi Wijaya", accountName: "ANDI WIJAYA", score: 100, decision: domain.NAME_MATCH_PASS},
+		{expected: "Bpk. Andi Wijaya", accountName: "WIJAYA, ANDI", score: 100, decision: domain.NAME_MATCH_PASS},
+		{expected: "Andi W", accountName: "ANDI WIJAYA", score: 96, decision: domain.NAME_MATCH_PASS},
+		{expected: "Andi", accountName: "ANDI WIJAYA", score: 90, decision: domain.NAME_MATCH_PASS},
+		{expected: "Andy Wijaya", accountName: "ANDI WIJAYA", score: 90, decision: domain.NAME_MATCH_PASS},
+		// initials alone do not pass
+		{expected: "A", accountName: "ANDI WIJAYA", score: 79, decision: domain.NAME_MATCH_FLAG},
+		{expected: "A W", accountName: "ANDI WIJAYA", score: 79, decision: domain.NAME_MATCH_FLAG},
+		{expected: "Andi Wijaya", accountName: "BUDI SANTOSO", decision: domain.NAME_MATCH_BLOCK},
+		{expected: "", accountName: "ANDI WIJAYA", score: 0, decision: domain.NAME_MATCH_BLOCK},
+	}
+
+	for _, test := range tests {
+		match := MatchName(test.expected, test.accountName)
+		if test.score > 0 && match.Score != test.score {
+			t.Errorf("NameMatchScore(%q, %q) = %v, want %v", test.expected, test.accountName, match.Score, test.score)
+		}
+		if match.Decision != test.decision {
+			t.Errorf("MatchName(%q, %q) = %v (%v), want %v", test.expected, test.accountName, match.Decision, match.Score,
+				test.decision)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_PARTNER_DELIVERY_BACKOFF_SECOND     = 60
+	DEFAULT_PARTNER_DELIVERY_MAX_BACKOFF_SECOND = 3600
+	DEFAULT_PARTNER_DELIVERY_MAX_ATTEMPTS       = 10
+	PARTNER_DELIVERY_LEASE_SECOND               = 120
+	PARTNER_DELIVERY_TIMEOUT_SECOND             = 30
+	PARTNER_DELIVERY_RESPONSE_LENGTH            = 1000
+)
+
+// SavePartnerCallback adds the partner when it has no ID yet and replaces it otherwise, a partner is
+// only forwarded to over https and an update without secret keeps the one it has
+func SavePartnerCallback(paramLog *basic.ParamLog, partner *domain.PartnerCallback) error {
+	err := validatePartnerCallback(paramLog, *partner)
+	if err != nil {
+		return err
+	}
+
+	partner.Time = time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+	if partner.ID.IsZero() {
+		if partner.Secret == "" {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner secret is required")
+		}
+
+		partner.CreatedTime = partner.Time
+		return service.PartnerCallbackSaveOne(paramLog, partner)
+	}
+
+	existing, err := service.PartnerCallbackByIDNoSession(partner.ID.Hex())
+	if err != nil {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner not found")
+	}
+
+	partner.CreatedTime = existing.CreatedTime
+
+	return service.PartnerCallbackUpdateOne(paramLog, partner)
+}
+
+func PartnerCallbacks(paramLog *basic.ParamLog, page string, limit string) ([]domain.PartnerCallback, error) {
+	return service.PartnerCallbacksNoSession(paramLog, page, limit)
+}
+
+// PartnerDeliveries is the delivery log of the partner, of every partner when partnerID is empty
+func PartnerDeliveries(paramLog *basic.ParamLog, partnerID string, status string, page string, limit string) ([]domain.PartnerDelivery, error) {
+	ID := primitive.NilObjectID
+	if partnerID != "" {
+		var err error
+		ID, err = primitive.ObjectIDFromHex(partnerID)
+		if err != nil {
+			return []domain.PartnerDelivery{}, utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Invalid partner id")
+		}
+	}
+
+	return service.PartnerDeliveriesNoSession(paramLog, ID, status, page, limit)
+}
+
+// ForwardPartnerCallback hands a gateway callback whose routing key matches the rules of a partner to
+// that partner, the first active partner matching wins. It tells whether the callback was handed over,
+// such a callback belongs to the partner and is not processed here. The delivery is made in the
+// background and retried by RunPartnerDeliveries.
+func ForwardPartnerCallback(paramLog *basic.ParamLog, gatewayCode string, event string, key string, reference string,
+	payload []byte) (bool, error) {
+	if key == "" {
+		return false, nil
+	}
+
+	partners, err := service.PartnerCallbacksActiveNoSession(paramLog)
+	if err != nil {
+		return false, err
+	}
+
+	for _, partner := range partners {
+		if !matchPartnerCallback(paramLog, partner, gatewayCode, event, key) {
+			continue
+		}
+
+		if reference == "" {
+			reference = primitive.NewObjectID().Hex()
+		}
+
+		delivery := domain.PartnerDelivery{
+			ID:        domain.PartnerDeliveryID(partner.ID, gatewayCode, event, reference),
+			PartnerID: partner.ID,
+			Gateway:   gatewayCode,
+			Event:     event,
+			Key:       key,
+			Reference: reference,
+			Payload:   string(payload),
+			Time:      time.Now().Format(os.Getenv("TIME_FORMAT")),
+		}
+
+		err = service.PartnerDeliveryQueue(paramLog, delivery)
+		if err != nil {
+			return false, err
+		}
+
+		basic.LogInformation(paramLog, "Callback forwarded to partner "+partner.Name+" "+delivery.ID)
+
+		go deliverPartnerCallbacks(paramLog, []domain.PartnerDelivery{delivery})
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// RunPartnerDeliveries posts the pending partner deliveries that are due, a partner that keeps
+// failing is retried with backoff and the delivery fails for good after too many attempts
+func RunPartnerDeliveries(paramLog *basic.ParamLog) (dto.PartnerDeliveryReport, error) {
+	deliveries, err := service.PartnerDeliveriesDueNoSession(paramLog, time.Now().Unix())
+	if err != nil {
+		return dto.PartnerDeliveryReport{}, err
+	}
+
+	report := deliverPartnerCallbacks(paramLog, deliveries)
+	basic.LogInformation2(paramLog, "RunPartnerDeliveries", report)
+
+	return report, nil
+}
+
+// RedeliverPartnerCallback posts a delivered or failed callback again from its first attempt
+func RedeliverPartnerCallback(paramLog *basic.ParamLog, deliveryID string) (domain.PartnerDelivery, error) {
+	requeued, err := service.PartnerDeliveryRequeue(paramLog, deliveryID, time.Now().Format(os.Getenv("TIME_FORMAT")))
+	if err != nil {
+		return domain.PartnerDelivery{}, err
+	}
+	if !requeued {
+		return domain.PartnerDelivery{}, utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback,
+			"Partner delivery not found or still pending "+deliveryID)
+	}
+
+	deliverPartnerCallbacks(paramLog, []domain.PartnerDelivery{{ID: deliveryID}})
+
+	return service.PartnerDeliveryByIDNoSession(deliveryID)
+}
+
+func deliverPartnerCallbacks(paramLog *basic.ParamLog, deliveries []domain.PartnerDelivery) dto.PartnerDeliveryReport {
+	report := dto.PartnerDeliveryReport{}
+
+	for _, delivery := range deliveries {
+		now := time.Now()
+		claimed, err := service.PartnerDeliveryClaim(paramLog, delivery.ID, now.Unix(), now.Unix()+PARTNER_DELIVERY_LEASE_SECOND)
+		if err != nil {
+			basic.LogError2(paramLog, "PartnerDeliveryClaim", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		delivery, err = service.PartnerDeliveryByIDNoSession(delivery.ID)
+		if err != nil {
+			basic.LogError2(paramLog, "PartnerDeliveryByIDNoSession", err)
+			continue
+		}
+
+		report.Checked = report.Checked + 1
+		delivery = deliverPartnerCallback(paramLog, delivery)
+
+		switch delivery.Status {
+		case domain.PARTNER_DELIVERY_DELIVERED:
+			report.Delivered = report.Delivered + 1
+		case domain.PARTNER_DELIVERY_FAILED:
+			report.Failed = report.Failed + 1
+		default:
+			report.Pending = report.Pending + 1
+		}
+	}
+
+	return report
+}
+
+func deliverPartnerCallback(paramLog *basic.ParamLog, delivery domain.PartnerDelivery) domain.PartnerDelivery {
+	now := time.Now()
+	attempt := domain.PartnerDeliveryAttempt{Time: now.Format(os.Getenv("TIME_FORMAT"))}
+
+	partner, err := service.PartnerCallbackByIDNoSession(delivery.PartnerID.Hex())
+	if err == nil {
+		attempt.StatusCode, attempt.Response, err = postPartnerCallback(paramLog, partner, delivery, now)
+	} else if err == mongo.ErrNoDocuments {
+		err = utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner not found")
+	}
+	attempt.DurationMs = time.Since(now).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	delivery = recordPartnerAttempt(delivery, attempt, now)
+
+	err = service.PartnerDeliveryAttempted(paramLog, delivery, attempt)
+	if err != nil {
+		basic.LogError2(paramLog, "PartnerDeliveryAttempted", err)
+	}
+
+	return delivery
+}
+
+// recordPartnerAttempt adds the attempt to the delivery log, the delivery is done once an attempt
+// succeeds and is retried with backoff otherwise
+func recordPartnerAttempt(delivery domain.PartnerDelivery, attempt domain.PartnerDeliveryAttempt, now time.Time) domain.PartnerDelivery {
+	delivery.Log = append(delivery.Log, attempt)
+	delivery.Time = attempt.Time
+	delivery.LastStatusCode = attempt.StatusCode
+
+	if attempt.Error != "" {
+		delivery.LastError = attempt.Error
+		return backoffPartnerDelivery(delivery, now)
+	}
+
+	delivery.Status = domain.PARTNER_DELIVERY_DELIVERED
+	delivery.Attempts = delivery.Attempts + 1
+	delivery.NextAt = 0
+	delivery.LastError = ""
+	delivery.DeliveredAt = attempt.Time
+
+	return delivery
+}
+
+// postPartnerCallback posts the payload as the gateway sent it, signed with the HMAC-SHA256 of the
+// timestamp and the payload joined by a dot. Any 2xx answer is a delivery.
+func postPartnerCallback(paramLog *basic.ParamLog, partner domain.PartnerCallback, delivery domain.PartnerDelivery,
+	now time.Time) (int, string, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	client := resty.New().SetTimeout(PARTNER_DELIVERY_TIMEOUT_SECOND * time.Second)
+	resp, err := client.R().
+		SetHeaders(map[string]string{
+			"Content-Type":       "application/json",
+			"callback-delivery":  delivery.ID,
+			"callback-gateway":   delivery.Gateway,
+			"callback-event":     delivery.Event,
+			"callback-timestamp": timestamp,
+			"callback-signature": partnerSignature(partner.Secret, timestamp, delivery.Payload),
+		}).
+		SetBody(delivery.Payload).Post(partner.URL)
+
+	if err != nil {
+		return 0, "", utils.ErrorInternalServer(paramLog, utils.CallbackError, "Partner callback "+partner.Name+" failed "+err.Error())
+	}
+
+	response := string(resp.Body())
+	if len(response) > PARTNER_DELIVERY_RESPONSE_LENGTH {
+		response = response[:PARTNER_DELIVERY_RESPONSE_LENGTH]
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return resp.StatusCode(), response, utils.ErrorInternalServer(paramLog, utils.CallbackError,
+			"Partner callback "+partner.Name+" answered "+strconv.Itoa(resp.StatusCode()))
+	}
+
+	return resp.StatusCode(), response, nil
+}
+
+func partnerSignature(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoffPartnerDelivery(delivery domain.PartnerDelivery, now time.Time) domain.PartnerDelivery {
+	delivery.Attempts = delivery.Attempts + 1
+	if delivery.Attempts >= utils.EnvInt("PARTNER_DELIVERY_MAX_ATTEMPTS", DEFAULT_PARTNER_DELIVERY_MAX_ATTEMPTS) {
+		delivery.Status = domain.PARTNER_DELIVERY_FAILED
+		delivery.NextAt = 0
+		return delivery
+	}
+
+	backoff := utils.ExponentialBackoff(delivery.Attempts,
+		utils.EnvSecond("PARTNER_DELIVERY_BACKOFF_SECOND", DEFAULT_PARTNER_DELIVERY_BACKOFF_SECOND),
+		utils.EnvSecond("PARTNER_DELIVERY_MAX_BACKOFF_SECOND", DEFAULT_PARTNER_DELIVERY_MAX_BACKOFF_SECOND))
+
+	delivery.Status = domain.PARTNER_DELIVERY_PENDING
+	delivery.NextAt = now.Add(backoff).Unix()
+
+	return delivery
+}
+
+func matchPartnerCallback(paramLog *basic.ParamLog, partner domain.PartnerCallback, gatewayCode string, event string, key string) bool {
+	for _, rule := range partner.Rules {
+		if rule.Gateway != "" && rule.Gateway != gatewayCode {
+			continue
+		}
+		if rule.Event != "" && !strings.HasPrefix(event, rule.Event) {
+			continue
+		}
+
+		if rule.Prefix != "" && strings.HasPrefix(key, rule.Prefix) {
+			return true
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				basic.LogError2(paramLog, "Partner "+partner.Name+" pattern", err)
+				continue
+			}
+			if pattern.MatchString(key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func validatePartnerCallback(paramLog *basic.ParamLog, partner domain.PartnerCallback) error {
+	if strings.TrimSpace(partner.Name) == "" {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner name is required")
+	}
+
+	target, err := url.Parse(partner.URL)
+	if err != nil || target.Scheme != "https" || target.Host == "" {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner url must be https")
+	}
+
+	if len(partner.Rules) == 0 {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Partner needs at least one rule")
+	}
+
+	for _, rule := range partner.Rules {
+		if (rule.Prefix == "") == (rule.Pattern == "") {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Rule needs either a prefix or a pattern")
+		}
+
+		if rule.Pattern != "" {
+			_, err = regexp.Compile(rule.Pattern)
+			if err != nil {
+				return utils.ErrorBadRequest(paramLog, utils.InvalidPartnerCallback, "Invalid rule pattern "+rule.Pattern)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+)
+
+func TestMatchPartnerCallback(t *testing.T) {
+	partner := domain.PartnerCallback{
+		Name: "Partner",
+		Rules: []domain.PartnerCallbackRule{
+			{Gateway: "A", Event: "VA", Prefix: "PTN-"},
+			{Event: "TRANSFER", Pattern: `^TRX[0-9]{4}$`},
+			{Pattern: `[`},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		gateway string
+		event   string
+		key     string
+		matches bool
+	}{
+		{name: "prefix", gateway: "A", event: "VA_PAID", key: "PTN-001", matches: true},
+		{name: "prefix on another gateway", gateway: "B", event: "VA_PAID", key: "PTN-001", matches: false},
+		{name: "prefix on another event", gateway: "A", event: "TRANSFER_SUCCESS", key: "PTN-001", matches: false},
+		{name: "prefix not at the start", gateway: "A", event: "VA_PAID", key: "X-PTN-001", matches: false},
+		{name: "pattern on any gateway", gateway: "D", event: "TRANSFER_FAILED", key: "TRX1234", matches: true},
+		{name: "pattern not matching", gateway: "D", event: "TRANSFER_FAILED", key: "TRX12345", matches: false},
+		{name: "invalid pattern skipped", gateway: "A", event: "VA_PAID", key: "[", matches: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches := matchPartnerCallback(nil, partner, test.gateway, test.event, test.key)
+			if matches != test.matches {
+				t.Errorf("matchPartnerCallback = %v, want %v", matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestPostPartnerCallbackSigned(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := `{"external_id":"PTN-001","amount":10000}`
+
+	var header http.Header
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		read, _ := io.ReadAll(r.Body)
+		body = string(read)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	partner := domain.PartnerCallback{Name: "Partner", URL: server.URL, Secret: "secret"}
+	delivery := domain.PartnerDelivery{ID: "delivery", Gateway: "A", Event: "VA_PAID", Payload: payload}
+
+	statusCode, response, err := postPartnerCallback(nil, partner, delivery, now)
+	if err != nil || statusCode != http.StatusOK || response != "ok" {
+		t.Fatalf("got %v %q %v, want 200 ok", statusCode, response, err)
+	}
+
+	if body != payload {
+		t.Errorf("body = %v, want the payload as the gateway sent it", body)
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "." + payload))
+	if header.Get("callback-timestamp") != timestamp || header.Get("callback-signature") != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signed %v at %v, want the HMAC of the timestamp and the payload", header.Get("callback-signature"),
+			header.Get("callback-timestamp"))
+	}
+	if header.Get("callback-delivery") != "delivery" || header.Get("callback-gateway") != "A" || header.Get("callback-event") != "VA_PAID" {
+		t.Errorf("delivery headers = %v", header)
+	}
+}
+
+func TestPostPartnerCallbackRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("down"))
+	}))
+	defer server.Close()
+
+	partner := domain.PartnerCallback{Name: "Partner", URL: server.URL, Secret: "secret"}
+	statusCode, response, err := postPartnerCallback(nil, partner, domain.PartnerDelivery{Payload: "{}"}, time.Now())
+	if err == nil || statusCode != http.StatusBadGateway || response != "down" {
+		t.Errorf("got %v %q %v, want 502 down with an error", statusCode, response, err)
+	}
+}
+
+func TestRecordPartnerAttempt(t *testing.T) {
+	t.Setenv("PARTNER_DELIVERY_MAX_ATTEMPTS", "3")
+
+	now := time.Unix(1700000000, 0)
+	delivery := domain.PartnerDelivery{Status: domain.PARTNER_DELIVERY_PENDING}
+
+	delivery = recordPartnerAttempt(delivery, domain.PartnerDeliveryAttempt{StatusCode: 502, Response: "down",
+		Error: "answered 502", Time: "t1"}, now)
+	if delivery.Status != domain.PARTNER_DELIVERY_PENDING || delivery.NextAt <= now.Unix() ||
+		delivery.LastStatusCode != 502 || delivery.LastError != "answered 502" {
+		t.Fatalf("after a failed attempt got %+v", delivery)
+	}
+
+	delivery = recordPartnerAttempt(delivery, domain.PartnerDeliveryAttempt{StatusCode: 200, Response: "ok", Time: "t2"}, now)
+	if delivery.Status != domain.PARTNER_DELIVERY_DELIVERED || delivery.Attempts != 2 || delivery.NextAt != 0 ||
+		delivery.LastError != "" || delivery.DeliveredAt != "t2" {
+		t.Fatalf("after a delivered attempt got %+v", delivery)
+	}
+
+	if len(delivery.Log) != 2 || delivery.Log[0].Error != "answered 502" || delivery.Log[1].Response != "ok" {
+		t.Errorf("log = %+v, want both attempts in order", delivery.Log)
+	}
+
+	delivery = domain.PartnerDelivery{Status: domain.PARTNER_DELIVERY_PENDING}
+	for i := 0; i < 3; i++ {
+		delivery = recordPartnerAttempt(delivery, domain.PartnerDeliveryAttempt{Error: "refused"}, now)
+	}
+	if delivery.Status != domain.PARTNER_DELIVERY_FAILED || delivery.NextAt != 0 || len(delivery.Log) != 3 {
+		t.Errorf("after 3 failed attempts got %v next at %v with %v logged", delivery.Status, delivery.NextAt, len(delivery.Log))
+	}
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SavePromotion adds the promotion when it has no ID yet and replaces it otherwise, what the
+// promotion spent so far is kept
+func SavePromotion(paramLog *basic.ParamLog, promotion *domain.Promotion) error {
+	if promotion.Payer != domain.ACTOR_TYPE_USER && promotion.Payer != domain.ACTOR_TYPE_CORPORATE {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion payer must be user or corporate")
+	}
+
+	if promotion.QuotaPeriod == "" {
+		promotion.QuotaPeriod = domain.PROMOTION_QUOTA_MONTHLY
+	}
+	if promotion.QuotaPeriod != domain.PROMOTION_QUOTA_MONTHLY && promotion.QuotaPeriod != domain.PROMOTION_QUOTA_CAMPAIGN {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion quota period must be MONTHLY or CAMPAIGN")
+	}
+
+	if promotion.Quota < 0 || promotion.Budget < 0 {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion quota and budget cannot be negative")
+	}
+
+	promotion.Currency = domain.NormalizeCurrency(promotion.Currency)
+	_, err := domain.CurrencyExponent(promotion.Currency)
+	if err != nil {
+		return MoneyError(paramLog, err)
+	}
+
+	startAt, err := utils.ParseTimestamp(promotion.StartAt)
+	if err != nil {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion start time invalid")
+	}
+
+	endAt, err := utils.ParseTimestamp(promotion.EndAt)
+	if err != nil || !endAt.After(startAt) {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion end time invalid")
+	}
+
+	if promotion.ID.IsZero() {
+		promotion.Spent = 0
+		promotion.Time = time.Now().Format(os.Getenv("TIME_FORMAT"))
+		return service.PromotionSaveOne(paramLog, promotion)
+	}
+
+	stored, err := service.PromotionByIDNoSession(promotion.ID.Hex())
+	if err != nil {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion not found")
+	}
+	promotion.Spent = stored.Spent
+
+	return service.PromotionUpdateOne(paramLog, promotion)
+}
+
+// FeeWaivers picks for every fee leg of the transaction the oldest promotion of the receiving
+// corporate that still has quota for the payer and budget left, it writes nothing. The quota and
+// budget are only taken by ConsumePromotions when the transaction is committed.
+func FeeWaivers(paramLog *basic.ParamLog, transaction domain.Transaction) ([]domain.FeeWaiver, error) {
+	now := time.Now()
+	waivers := []domain.FeeWaiver{}
+	for _, leg := range feeLegs(transaction.DetailsFee) {
+		if leg.Amount <= 0 {
+			continue
+		}
+
+		promotions, err := service.PromotionsActiveNoSession(paramLog, leg.CorporateID, leg.Payer, transaction.Type)
+		if err != nil {
+			return []domain.FeeWaiver{}, err
+		}
+
+		for _, promotion := range promotions {
+			usageID, ok, err := promotionAvailable(paramLog, promotion, leg, transaction.Currency, now)
+			if err != nil {
+				return []domain.FeeWaiver{}, err
+			}
+
+			if ok {
+				leg.PromotionID = promotion.ID
+				leg.UsageID = usageID
+				waivers = append(waivers, leg)
+				break
+			}
+		}
+	}
+
+	return waivers, nil
+}
+
+// feeLegs sums the fee details by payer in the order they were priced, the payer's leg first
+func feeLegs(details []domain.DetailFee) []domain.FeeWaiver {
+	legs := []domain.FeeWaiver{}
+	for _, detail := range details {
+		found := false
+		for i := range legs {
+			if legs[i].Payer == detail.Payer && legs[i].PayerID == detail.PayerID && legs[i].CorporateID == detail.CorporateID {
+				legs[i].Amount = legs[i].Amount + detail.Amount
+				found = true
+			}
+		}
+
+		if !found {
+			legs = append(legs, domain.FeeWaiver{
+				Payer:       detail.Payer,
+				PayerID:     detail.PayerID,
+				CorporateID: detail.CorporateID,
+				Amount:      detail.Amount,
+			})
+		}
+	}
+
+	return legs
+}
+
+func promotionAvailable(paramLog *basic.ParamLog, promotion domain.Promotion, leg domain.FeeWaiver, currency string,
+	now time.Time) (string, bool, error) {
+	if !domain.IsSameCurrency(promotion.Currency, currency) {
+		return "", false, nil
+	}
+
+	startAt, err := utils.ParseTimestamp(promotion.StartAt)
+	if err != nil || now.Before(startAt) {
+		return "", false, nil
+	}
+
+	endAt, err := utils.ParseTimestamp(promotion.EndAt)
+	if err != nil || !now.Before(endAt) {
+		return "", false, nil
+	}
+
+	if promotion.Budget > 0 && promotion.Spent+leg.Amount > promotion.Budget {
+		return "", false, nil
+	}
+
+	usageID := promotionUsageID(promotion, leg.PayerID, now)
+	if promotion.Quota > 0 {
+		usage, err := service.PromotionUsageByIDNoSession(usageID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return "", false, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+
+		if usage.Count >= promotion.Quota {
+			return "", false, nil
+		}
+	}
+
+	return usageID, true, nil
+}
+
+func promotionUsageID(promotion domain.Promotion, payerID primitive.ObjectID, now time.Time) string {
+	period := "ALL"
+	if promotion.QuotaPeriod != domain.PROMOTION_QUOTA_CAMPAIGN {
+		period = "M" + now.Format("200601")
+	}
+
+	return promotion.ID.Hex() + ":" + payerID.Hex() + ":" + period
+}
+
+// ConsumePromotions takes the quota and budget of the waivers within the commit session and records
+// the usages on the transaction so a rollback can give them back
+func ConsumePromotions(paramLog *basic.ParamLog, transaction *domain.Transaction, session mongo.SessionContext) error {
+	usageIDs := []string{}
+	for _, waiver := range transaction.FeeWaivers {
+		promotion, err := service.PromotionByIDNoSession(waiver.PromotionID.Hex())
+		if err != nil {
+			return utils.ErrorBadRequest(paramLog, utils.InvalidPromotion, "Promotion not found")
+		}
+
+		usage := domain.PromotionUsage{
+			ID:          waiver.UsageID,
+			PromotionID: promotion.ID,
+			PayerID:     waiver.PayerID,
+			Period:      waiver.UsageID[strings.LastIndex(waiver.UsageID, ":")+1:],
+		}
+
+		used, err := service.PromotionUsageConsume(usage, promotion.Quota, session)
+		if mongo.IsDuplicateKeyError(err) {
+			return promotionExhaustedError(paramLog, promotion)
+		}
+		if database.IsWriteConflict(err) {
+			return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Promotion usage changed concurrently "+usage.ID)
+		}
+		if err != nil {
+			return err
+		}
+		basic.LogInformation2(paramLog, "PromotionUsageConsume", used)
+
+		err = service.PromotionSpend(promotion, waiver.Amount, session)
+		if err == mongo.ErrNoDocuments {
+			return promotionExhaustedError(paramLog, promotion)
+		}
+		if database.IsWriteConflict(err) {
+			return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Promotion budget changed concurrently "+promotion.ID.Hex())
+		}
+		if err != nil {
+			return err
+		}
+
+		usageIDs = append(usageIDs, usage.ID)
+	}
+
+	transaction.PromotionUsages = usageIDs
+
+	return nil
+}
+
+// ReleasePromotions gives back the quota and budget taken by a transaction that failed, they are
+// released once
+func ReleasePromotions(paramLog *basic.ParamLog, transactionCode string, session mongo.SessionContext) error {
+	transaction, err := service.TransactionTakePromotionUsages(transactionCode, session)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, waiver := range transaction.FeeWaivers {
+		err = service.PromotionUsageRelease(waiver.UsageID, session)
+		if err != nil {
+			return err
+		}
+
+		err = service.PromotionRefund(waiver.PromotionID, waiver.Amount, session)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func promotionExhaustedError(paramLog *basic.ParamLog, promotion domain.Promotion) error {
+	return utils.ErrorBadRequest(paramLog, utils.PromotionExhausted,
+		fmt.Sprintf("Promotion %v ran out, please retry the transaction", promotion.ID.Hex()))
+}
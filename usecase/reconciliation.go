@@ -0,0 +1,287 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const RECONCILIATION_BATCH_SIZE = 500
+
+// RunNightlyReconciliation checks transactions and rollbacks of the previous day, balances are always checked in full
+func RunNightlyReconciliation(paramLog *basic.ParamLog) (dto.ReconciliationReport, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := to.AddDate(0, 0, -1)
+
+	return RunReconciliation(paramLog, from, to)
+}
+
+func RunReconciliation(paramLog *basic.ParamLog, from time.Time, to time.Time) (dto.ReconciliationReport, error) {
+	report := dto.ReconciliationReport{
+		RunID:  primitive.NewObjectID().Hex(),
+		From:   from.Format(os.Getenv("TIME_FORMAT")),
+		To:     to.Format(os.Getenv("TIME_FORMAT")),
+		Issues: []domain.ReconciliationIssue{},
+	}
+
+	err := reconcileBalances(paramLog, &report)
+	if err != nil {
+		return report, err
+	}
+
+	err = reconcileCompletedTransactions(paramLog, &report, from, to)
+	if err != nil {
+		return report, err
+	}
+
+	err = reconcileRollbacks(paramLog, &report, from, to)
+	if err != nil {
+		return report, err
+	}
+
+	err = reconcileFailedTransactions(paramLog, &report, from, to)
+	if err != nil {
+		return report, err
+	}
+
+	basic.LogInformation2(paramLog, "RunReconciliation", fmt.Sprintf("run %v critical %v warning %v",
+		report.RunID, report.Critical, report.Warning))
+
+	return report, nil
+}
+
+func reconcileBalances(paramLog *basic.ParamLog, report *dto.ReconciliationReport) error {
+	sums, err := service.StatementSumByBalance(paramLog)
+	if err != nil {
+		return err
+	}
+
+	balances, err := service.BalancesNoSession(paramLog)
+	if err != nil {
+		return err
+	}
+
+	for _, balance := range balances {
+		report.BalancesChecked++
+
+		expected := sums[balance.ID]
+		if balance.Amount != expected {
+			issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_BALANCE_DRIFT,
+				domain.RECONCILIATION_SEVERITY_CRITICAL, "Balance amount differs from sum of statements")
+			issue.BalanceID = balance.ID
+			issue.Expected = expected
+			issue.Actual = balance.Amount
+			recordIssue(paramLog, report, issue)
+		}
+	}
+
+	return nil
+}
+
+func reconcileCompletedTransactions(paramLog *basic.ParamLog, report *dto.ReconciliationReport, from time.Time, to time.Time) error {
+	transactions, err := service.TransactionsByStatusBetween(paramLog, domain.COMPLETED_STATUS, from, to)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(transactions); start += RECONCILIATION_BATCH_SIZE {
+		end := start + RECONCILIATION_BATCH_SIZE
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+
+		batch := transactions[start:end]
+		codes := []string{}
+		for _, transaction := range batch {
+			codes = append(codes, transaction.TransactionCode)
+		}
+
+		statements, err := service.StatementsByReferences(paramLog, codes)
+		if err != nil {
+			return err
+		}
+
+		byReference := map[string][]domain.Statement{}
+		for _, statement := range statements {
+			byReference[statement.Reference] = append(byReference[statement.Reference], statement)
+		}
+
+		for _, transaction := range batch {
+			report.TransactionsChecked++
+			reconcileTransactionStatements(paramLog, report, transaction, byReference[transaction.TransactionCode])
+		}
+	}
+
+	return nil
+}
+
+func reconcileTransactionStatements(paramLog *basic.ParamLog, report *dto.ReconciliationReport, transaction domain.Transaction,
+	statements []domain.Statement) {
+	hasTransaction := false
+	hasFee := false
+	feeNet := 0
+	for _, statement := range statements {
+		if statement.Type == domain.STATEMENT_TYPE_TRANSACTION {
+			hasTransaction = true
+		} else if statement.Type == domain.STATEMENT_TYPE_FEE {
+			hasFee = true
+			feeNet = feeNet + statement.Deposit - statement.Withdraw
+		}
+	}
+
+	if !hasTransaction {
+		issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_MISSING_TRANSACTION_STATEMENT,
+			domain.RECONCILIATION_SEVERITY_CRITICAL, "Completed transaction has no transaction statement")
+		issue.TransactionCode = transaction.TransactionCode
+		issue.Expected = transaction.SubAmount
+		recordIssue(paramLog, report, issue)
+	}
+
+	// A principal corporate pays no fee upward, so a missing fee statement is only a warning
+	if transaction.TotalFee > 0 && !hasFee {
+		issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_MISSING_FEE_STATEMENT,
+			domain.RECONCILIATION_SEVERITY_WARNING, "Completed transaction with fee has no fee statement")
+		issue.TransactionCode = transaction.TransactionCode
+		issue.Expected = transaction.TotalFee
+		recordIssue(paramLog, report, issue)
+	}
+
+	if feeNet != 0 {
+		issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_UNBALANCED_FEE_STATEMENT,
+			domain.RECONCILIATION_SEVERITY_CRITICAL, "Fee statements do not net to zero")
+		issue.TransactionCode = transaction.TransactionCode
+		issue.Actual = feeNet
+		recordIssue(paramLog, report, issue)
+	}
+}
+
+func reconcileRollbacks(paramLog *basic.ParamLog, report *dto.ReconciliationReport, from time.Time, to time.Time) error {
+	rollbacks, err := service.StatementsRollbackBetween(paramLog, from, to)
+	if err != nil {
+		return err
+	}
+
+	rollbackCount := map[string]int{}
+	for _, statement := range rollbacks {
+		report.RollbacksChecked++
+		code := strings.TrimSuffix(statement.Reference, domain.STATEMENT_ROLLBACK_SUFFIX)
+		rollbackCount[code]++
+
+		if rollbackCount[code] == 2 {
+			issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_DUPLICATE_ROLLBACK,
+				domain.RECONCILIATION_SEVERITY_CRITICAL, "Transaction rolled back more than once")
+			issue.TransactionCode = code
+			issue.BalanceID = statement.BalanceID
+			issue.Reference = statement.Reference
+			issue.Actual = statement.Deposit
+			recordIssue(paramLog, report, issue)
+		}
+	}
+
+	codes := []string{}
+	for code := range rollbackCount {
+		codes = append(codes, code)
+	}
+
+	statusByCode := map[string]string{}
+	for start := 0; start < len(codes); start += RECONCILIATION_BATCH_SIZE {
+		end := start + RECONCILIATION_BATCH_SIZE
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		transactions, err := service.TransactionsByCodes(paramLog, codes[start:end])
+		if err != nil {
+			return err
+		}
+
+		for _, transaction := range transactions {
+			statusByCode[transaction.TransactionCode] = transaction.Status
+		}
+	}
+
+	for _, statement := range rollbacks {
+		code := strings.TrimSuffix(statement.Reference, domain.STATEMENT_ROLLBACK_SUFFIX)
+		if statusByCode[code] != domain.FAILED_STATUS {
+			issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_ORPHAN_ROLLBACK,
+				domain.RECONCILIATION_SEVERITY_CRITICAL, "Rollback statement without failed transaction, status "+statusByCode[code])
+			issue.TransactionCode = code
+			issue.BalanceID = statement.BalanceID
+			issue.Reference = statement.Reference
+			issue.Actual = statement.Deposit
+			recordIssue(paramLog, report, issue)
+		}
+	}
+
+	return nil
+}
+
+// Failed transactions that were posted must have been rolled back
+func reconcileFailedTransactions(paramLog *basic.ParamLog, report *dto.ReconciliationReport, from time.Time, to time.Time) error {
+	transactions, err := service.TransactionsByStatusBetween(paramLog, domain.FAILED_STATUS, from, to)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(transactions); start += RECONCILIATION_BATCH_SIZE {
+		end := start + RECONCILIATION_BATCH_SIZE
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+
+		references := []string{}
+		for _, transaction := range transactions[start:end] {
+			references = append(references, transaction.TransactionCode, transaction.TransactionCode+domain.STATEMENT_ROLLBACK_SUFFIX)
+		}
+
+		statements, err := service.StatementsByReferences(paramLog, references)
+		if err != nil {
+			return err
+		}
+
+		posted := map[string]int{}
+		rolledBack := map[string]bool{}
+		for _, statement := range statements {
+			if strings.HasSuffix(statement.Reference, domain.STATEMENT_ROLLBACK_SUFFIX) {
+				rolledBack[strings.TrimSuffix(statement.Reference, domain.STATEMENT_ROLLBACK_SUFFIX)] = true
+			} else if statement.Type == domain.STATEMENT_TYPE_TRANSACTION {
+				posted[statement.Reference] = posted[statement.Reference] + statement.Withdraw
+			}
+		}
+
+		for _, transaction := range transactions[start:end] {
+			if posted[transaction.TransactionCode] > 0 && !rolledBack[transaction.TransactionCode] {
+				issue := domain.CreateReconciliationIssue(report.RunID, domain.RECONCILIATION_MISSING_ROLLBACK,
+					domain.RECONCILIATION_SEVERITY_CRITICAL, "Failed transaction was posted but never rolled back")
+				issue.TransactionCode = transaction.TransactionCode
+				issue.Expected = posted[transaction.TransactionCode]
+				recordIssue(paramLog, report, issue)
+			}
+		}
+	}
+
+	return nil
+}
+
+func recordIssue(paramLog *basic.ParamLog, report *dto.ReconciliationReport, issue domain.ReconciliationIssue) {
+	err := service.ReconciliationIssueSaveOne(paramLog, &issue)
+	if err != nil {
+		basic.LogError2(paramLog, "ReconciliationIssueSaveOne", err)
+	}
+
+	if issue.Severity == domain.RECONCILIATION_SEVERITY_CRITICAL {
+		report.Critical++
+	} else {
+		report.Warning++
+	}
+
+	report.Issues = append(report.Issues, issue)
+}
@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const SUSPENSE_BALANCE_NAME = "Suspense"
+
+// SuspenseCorporateID is the corporate, set by SUSPENSE_CORPORATE_ID, that receives the payments
+// nobody could be identified for
+func SuspenseCorporateID() string {
+	return os.Getenv("SUSPENSE_CORPORATE_ID")
+}
+
+// SuspenseBalance returns the suspense balance of the corporate and creates it on first use. It is
+// kept out of the balances the corporate lists and gets no virtual account.
+func SuspenseBalance(paramLog *basic.ParamLog, corporateID string) (domain.Balance, domain.Corporate, error) {
+	corporate, err := service.CorporateByIDNoSession(corporateID)
+	if err != nil {
+		return domain.Balance{}, domain.Corporate{}, utils.ErrorInternalServer(paramLog, utils.CorporateNotFound, "Corporate id not found")
+	}
+
+	if !corporate.SuspenseBalance.IsZero() {
+		balance, err := service.BalanceByIDNoSession(corporate.SuspenseBalance.Hex())
+		if err != nil {
+			return domain.Balance{}, domain.Corporate{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+
+		return balance, corporate, nil
+	}
+
+	var balance domain.Balance
+	createSuspenseBalance := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Initialize balance start transaction failed")
+		}
+
+		corp, err := service.CorporateByID(corporateID, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if !corp.SuspenseBalance.IsZero() {
+			balance, err = service.BalanceByID(corp.SuspenseBalance.Hex(), session)
+			if err != nil {
+				session.AbortTransaction(session)
+				return err
+			}
+
+			corporate = corp
+			return database.CommitWithRetry(session)
+		}
+
+		balance, err = service.BalanceCreate(corp.ID, corp.ToActorObject(), SUSPENSE_BALANCE_NAME, corp.Currency, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		corp.SuspenseBalance = balance.ID
+		err = service.CorporateUpdateOne(paramLog, &corp, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		corporate = corp
+		return database.CommitWithRetry(session)
+	}
+
+	err = database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, createSuspenseBalance)
+		},
+	)
+
+	if err != nil {
+		return domain.Balance{}, domain.Corporate{}, utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed,
+			"Failed initialize suspense balance for corporate "+corporateID)
+	}
+
+	return balance, corporate, nil
+}
+
+// SuspenseItems lists the suspense items of the corporate, of every corporate when corporateID is empty
+func SuspenseItems(paramLog *basic.ParamLog, corporateID string, status string, page string, limit string) ([]domain.SuspenseItem, error) {
+	ID := primitive.NilObjectID
+	if corporateID != "" {
+		var err error
+		ID, err = primitive.ObjectIDFromHex(corporateID)
+		if err != nil {
+			return []domain.SuspenseItem{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Invalid corporate id")
+		}
+	}
+
+	return service.SuspenseItemsNoSession(paramLog, ID, status, page, limit)
+}
+
+func SuspenseItemByID(paramLog *basic.ParamLog, itemID string) (domain.SuspenseItem, error) {
+	item, err := service.SuspenseItemByIDNoSession(itemID)
+	if err == mongo.ErrNoDocuments {
+		return domain.SuspenseItem{}, utils.ErrorBadRequest(paramLog, utils.InvalidSuspenseItem, "Suspense item not found")
+	}
+	if err != nil {
+		return domain.SuspenseItem{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return item, nil
+}
+
+// ClaimSuspenseItem moves an open item to status on behalf of the operator before its money is moved,
+// the caller releases the claim when moving the money failed
+func ClaimSuspenseItem(paramLog *basic.ParamLog, item *domain.SuspenseItem, status string, operator domain.ActorObject,
+	note string) error {
+	now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+	set := bson.M{"status": status, "resolved_by": operator, "resolved_at": now, "note": note}
+
+	moved, err := service.SuspenseItemTransition(paramLog, item.ID, domain.SUSPENSE_OPEN, set)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidSuspenseItem, "Suspense item is not open "+item.ID.Hex())
+	}
+
+	item.Status = status
+	item.ResolvedBy = operator
+	item.ResolvedAt = now
+	item.Note = note
+
+	return nil
+}
+
+// ReleaseSuspenseItem reopens a claimed item whose money could not be moved
+func ReleaseSuspenseItem(paramLog *basic.ParamLog, item *domain.SuspenseItem) {
+	_, err := service.SuspenseItemTransition(paramLog, item.ID, item.Status,
+		bson.M{"status": domain.SUSPENSE_OPEN, "resolved_by": domain.ActorObject{}, "resolved_at": "", "note": ""})
+	if err != nil {
+		basic.LogError2(paramLog, "SuspenseItemTransition", err)
+		return
+	}
+
+	item.Status = domain.SUSPENSE_OPEN
+}
+
+// ResolveSuspenseItem links the claimed item to the transaction that moved its money
+func ResolveSuspenseItem(paramLog *basic.ParamLog, item *domain.SuspenseItem, transaction domain.Transaction) {
+	set := bson.M{"resolution_transaction_code": transaction.TransactionCode}
+	if item.Status == domain.SUSPENSE_ASSIGNED {
+		set["assigned_balance_id"] = transaction.ToBalanceID
+	}
+
+	_, err := service.SuspenseItemTransition(paramLog, item.ID, item.Status, set)
+	if err != nil {
+		basic.LogError2(paramLog, "SuspenseItemTransition", err)
+		return
+	}
+
+	item.ResolutionTransactionCode = transaction.TransactionCode
+	if item.Status == domain.SUSPENSE_ASSIGNED {
+		item.AssignedBalanceID = transaction.ToBalanceID
+	}
+}
+
+// ReopenSuspenseRefund opens again the item a failed refund transfer was made for, its money is back
+// on the suspense balance
+func ReopenSuspenseRefund(paramLog *basic.ParamLog, transaction domain.Transaction) {
+	if transaction.Type != domain.TRANSFER_BANK {
+		return
+	}
+
+	reopened, err := service.SuspenseItemReopen(paramLog, transaction.TransactionCode, time.Now().Format(os.Getenv("TIME_FORMAT")))
+	if err != nil {
+		basic.LogError2(paramLog, "SuspenseItemReopen", err)
+		return
+	}
+
+	if reopened {
+		basic.LogInformation(paramLog, "Suspense refund failed, item reopened "+transaction.TransactionCode)
+	}
+}
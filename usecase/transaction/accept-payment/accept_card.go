@@ -2,16 +2,17 @@ package acceptpayment
 
 import (
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
 	"github.com/kangdjoker/takeme-core/service"
 	"github.com/kangdjoker/takeme-core/usecase"
 	"github.com/kangdjoker/takeme-core/usecase/transaction"
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AcceptCard struct {
@@ -59,6 +60,17 @@ func (self AcceptCard) Execute(paramLog *basic.ParamLog, from domain.Card, balan
 		return domain.Transaction{}, domain.Balance{}, err
 	}
 
+	if reference != "" {
+		existing, err := service.TransactionByGatewayPaymentNoSession(gateway.Stripe, reference, domain.ACCEPT_PAYMENT_CARD)
+		if err == nil {
+			basic.LogInformation(paramLog, "Card payment already accepted for reference "+reference)
+			return existing, balance, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return domain.Transaction{}, domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+	}
+
 	gateway := gateway.StripeGateway{}
 	self.corporate = corporate
 	self.from = from
@@ -77,7 +89,7 @@ func (self AcceptCard) Execute(paramLog *basic.ParamLog, from domain.Card, balan
 		return domain.Transaction{}, domain.Balance{}, err
 	}
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, balance, transaction)
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, balance, &transaction)
 	if err != nil {
 		return domain.Transaction{}, domain.Balance{}, err
 	}
@@ -90,16 +102,32 @@ func (self AcceptCard) Execute(paramLog *basic.ParamLog, from domain.Card, balan
 		return domain.Transaction{}, domain.Balance{}, err
 	}
 
-	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	err = self.transactionUsecase.WithWebhooks(usecase.AcceptPaymentWebhook(corporate, balance, transaction)).
+		Commit(paramLog, statements, &transaction)
 	if err != nil {
 		return domain.Transaction{}, domain.Balance{}, err
 	}
 
-	go usecase.PublishAcceptPaymentCallback(paramLog, corporate, balance, transaction)
-
 	return transaction, balance, nil
 }
 
+// ExecuteCallback accepts the card payment of a Stripe callback once, a replay of the callback returns
+// the transaction made by the first delivery
+func (self AcceptCard) ExecuteCallback(paramLog *basic.ParamLog, from domain.Card, balanceID string, amount int,
+	reference string, currency string, externalID string, requestId string) (domain.Transaction, domain.Balance, error) {
+	result := dto.CallbackPaymentResult{}
+	err := usecase.ProcessCallbackOnce(paramLog, gateway.Stripe, reference, domain.CALLBACK_EVENT_CARD_PAID, &result, func() error {
+		transaction, balance, err := self.Execute(paramLog, from, balanceID, amount, reference, currency, externalID, requestId)
+		result = dto.CallbackPaymentResult{Transaction: transaction, Balance: balance}
+		return err
+	})
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	return result.Transaction, result.Balance, nil
+}
+
 func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance, domain.TransactionObject, domain.Corporate, error) {
 	balance, err := service.BalanceByIDNoSession(balanceID)
 	if err != nil {
@@ -142,22 +170,20 @@ func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance
 func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, from domain.Card,
 	to domain.TransactionObject, subAmount int, reference string, gateway gateway.Gateway, externalID string, requestId string) (domain.Transaction, domain.Statement, error) {
 
-	var totalFee = 0
-	if balance.Owner.Type == domain.ACTOR_TYPE_USER {
-
-		s, err := strconv.ParseFloat(corporate.FeeUser.AcceptPaymentCard, 64)
-		if err != nil {
-			return domain.Transaction{}, domain.Statement{}, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert accept payment card fee")
-		}
+	subAmountMoney, err := usecase.LegacyMoney(paramLog, subAmount, corporate.Currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
 
-		totalFee = int(float64(subAmount) * s)
-	} else {
-		s, err := strconv.ParseFloat(corporate.FeeCorporate.AcceptPaymentCard, 64)
-		if err != nil {
-			return domain.Transaction{}, domain.Statement{}, utils.ErrorBadRequest(paramLog, utils.WrongAcceptCardFee, "Cannot convert accept payment card fee")
-		}
+	payer, payerID := usecase.FeePayer(balance.Owner.Type, balance.Owner.ID, corporate)
+	totalFee, detailsFee, err := usecase.TransactionFee(paramLog, corporate, payer, payerID, domain.ACCEPT_PAYMENT_CARD, subAmountMoney)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
 
-		totalFee = int(float64(subAmount) * s)
+	amount, err := subAmountMoney.Sub(totalFee)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, usecase.MoneyError(paramLog, err)
 	}
 
 	transcation := domain.Transaction{
@@ -169,9 +195,10 @@ func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, bal
 		FromBalanceID:    balance.ID,
 		From:             from.ToTransactionObject(),
 		To:               to,
-		TotalFee:         totalFee,
-		SubAmount:        subAmount,
-		Amount:           subAmount - totalFee,
+		DetailsFee:       detailsFee,
+		TotalFee:         totalFee.Legacy(),
+		SubAmount:        subAmountMoney.Legacy(),
+		Amount:           amount.Legacy(),
 		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:            "",
 		Status:           domain.COMPLETED_STATUS,
@@ -184,7 +211,7 @@ func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, bal
 	}
 
 	statement := service.DepositTransactionStatement(
-		balance.ID, transcation.Time, transcation.TransactionCode, subAmount)
+		balance.ID, transcation.Time, transcation.TransactionCode, subAmountMoney)
 
 	return transcation, statement, nil
 }
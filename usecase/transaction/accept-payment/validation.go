@@ -7,7 +7,7 @@ import (
 )
 
 func validateCurrency(paramLog *basic.ParamLog, incomeCurrency string, balance domain.Balance) error {
-	if incomeCurrency != balance.Currency {
+	if !domain.IsSameCurrency(incomeCurrency, balance.Currency) {
 		return utils.ErrorBadRequest(paramLog, utils.CurrencyError, "Transaction cross currency")
 	}
 
@@ -21,12 +21,46 @@ import (
 )
 
 type Base struct {
+	webhooks      []domain.Webhook
+	suspenseItems []domain.SuspenseItem
 }
 
+// WithWebhooks adds the webhooks to the outbox in the transaction of Commit or CommitHold and makes
+// their first attempt once it is committed
+func (self Base) WithWebhooks(webhooks ...domain.Webhook) Base {
+	self.webhooks = append(self.webhooks, webhooks...)
+	return self
+}
+
+// WithSuspenseItems opens the suspense items in the transaction of Commit
+func (self Base) WithSuspenseItems(items ...domain.SuspenseItem) Base {
+	self.suspenseItems = append(self.suspenseItems, items...)
+	return self
+}
+
+// CreateFeeStatement records on the transaction the fee legs waived by promotions before the
+// statements of the legs charged are made. A quoted fee already has its waivers taken off, the
+// transaction gets the waivers of the quote.
 func (self Base) CreateFeeStatement(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance,
-	transaction domain.Transaction) ([]domain.Statement, error) {
+	transaction *domain.Transaction) ([]domain.Statement, error) {
+	if transaction.FeeQuoteID != "" {
+		waivers, err := usecase.FeeQuoteWaivers(paramLog, transaction.FeeQuoteID)
+		if err != nil {
+			return []domain.Statement{}, err
+		}
+		transaction.FeeWaivers = waivers
+	}
+
 	feeCalculator := usecase.CalculateFee{}
-	feeCalculator.Initialize(corporate, balance, transaction)
+	feeCalculator.Initialize(corporate, balance, *transaction)
+
+	if transaction.FeeQuoteID == "" {
+		waived, err := feeCalculator.ApplyPromotions(paramLog)
+		if err != nil {
+			return []domain.Statement{}, err
+		}
+		*transaction = waived
+	}
 
 	statements, err := feeCalculator.CalculateByOwnerAndTransaction(paramLog)
 	if err != nil {
@@ -42,8 +76,11 @@ func (self Base) RollbackFeeStatement(paramLog *basic.ParamLog, corporate domain
 	feeCalculator.Initialize(corporate, balance, transaction)
 
 	feeStatements, err := feeCalculator.CalculateByOwnerAndTransaction(paramLog)
-	statements := feeCalculator.RollbackFeeStatement(feeStatements)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
 
+	statements, err := feeCalculator.RollbackFeeStatement(paramLog, feeStatements)
 	if err != nil {
 		return []domain.Statement{}, err
 	}
@@ -64,22 +101,64 @@ func (self Base) Commit(paramLog *basic.ParamLog, statements []domain.Statement,
 			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Initialize balance start transaction failed")
 		}
 
-		err = service.TransactionSaveOne(transaction, session)
+		err = usecase.ConsumeLimits(paramLog, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.ConsumeLimits", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.ConsumePromotions(paramLog, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.ConsumePromotions", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = saveTransaction(paramLog, transaction, session)
 		if err != nil {
 			basic.LogError2(paramLog, "Commit.TransactionSaveOne", err)
 			session.AbortTransaction(session)
-			if strings.Contains(err.Error(), "E11000") {
-				return utils.CustomError{
-					HttpStatus:  http.StatusBadRequest,
-					Code:        11000,
-					Description: "Duplicate Request ID",
-					Time:        time.Now().Format(os.Getenv("TIME_FORMAT")),
-				}
-			} else {
-				return err
+			return err
+		}
+
+		err = usecase.SaveWebhooks(paramLog, self.webhooks, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.SaveWebhooks", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		for i := range self.suspenseItems {
+			err = service.SuspenseItemSaveOne(&self.suspenseItems[i], session)
+			if err != nil {
+				basic.LogError2(paramLog, "Commit.SuspenseItemSaveOne", err)
+				session.AbortTransaction(session)
+				return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Save suspense item failed")
 			}
 		}
 
+		err = usecase.UseFXQuote(paramLog, *transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.UseFXQuote", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.UseFeeQuote(paramLog, *transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.UseFeeQuote", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		statements, err := postJournal(paramLog, domain.JOURNAL_TYPE_COMMIT, statements, *transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "Commit.postJournal", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
 		err = adjustBalanceWithStatement(paramLog, statements, session)
 		if err != nil {
 			basic.LogError2(paramLog, "Commit.adjustBalanceWithStatement", err)
@@ -102,6 +181,261 @@ func (self Base) Commit(paramLog *basic.ParamLog, statements []domain.Statement,
 		return err
 	}
 
+	go usecase.DeliverWebhooks(paramLog, self.webhooks)
+
+	return nil
+}
+
+// CommitHold saves a pending transaction and only reserves the funds its statements withdraw,
+// the statements are posted by CaptureHold once the transaction is settled.
+func (self Base) CommitHold(paramLog *basic.ParamLog, statements []domain.Statement, transaction *domain.Transaction) error {
+	function := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.Error", err)
+			session.AbortTransaction(session)
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Initialize hold start transaction failed")
+		}
+
+		err = usecase.ConsumeLimits(paramLog, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.ConsumeLimits", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.ConsumePromotions(paramLog, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.ConsumePromotions", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = saveTransaction(paramLog, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.TransactionSaveOne", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.SaveWebhooks(paramLog, self.webhooks, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.SaveWebhooks", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.UseFeeQuote(paramLog, *transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.UseFeeQuote", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		externalAccount, inbound := journalExternalAccount(*transaction)
+		journal := service.CreateJournal(*transaction, domain.JOURNAL_TYPE_COMMIT, transaction.Time,
+			statements, externalAccount, inbound)
+		err = usecase.ValidateJournal(paramLog, journal)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.ValidateJournal", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		hold := service.CreateHold(transaction.TransactionCode, transaction.Time, usecase.HoldExpiredAt(time.Now()), statements)
+		err = usecase.PlaceHold(paramLog, &hold, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CommitHold.PlaceHold", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		return database.CommitWithRetry(session)
+	}
+
+	err := database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, function)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	go usecase.DeliverWebhooks(paramLog, self.webhooks)
+
+	return nil
+}
+
+// CaptureHold posts the held statements. A hold that was already released or expired is posted
+// against the available amount, a captured hold is not posted twice.
+func (self Base) CaptureHold(paramLog *basic.ParamLog, holdID string, transaction domain.Transaction) error {
+	function := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			session.AbortTransaction(session)
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Capture hold start transaction failed")
+		}
+
+		hold, err := service.HoldByID(holdID, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if hold.Status == domain.HOLD_CAPTURED_STATUS {
+			session.AbortTransaction(session)
+			return nil
+		}
+
+		now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+		statements := []domain.Statement{}
+		for _, statement := range hold.Statements {
+			statement.Time = now
+			statements = append(statements, statement)
+		}
+
+		statements, err = postJournal(paramLog, domain.JOURNAL_TYPE_COMMIT, statements, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "CaptureHold.postJournal", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if hold.Status == domain.HOLD_ACTIVE_STATUS {
+			err = captureBalanceWithStatement(paramLog, statements, session)
+		} else {
+			err = adjustBalanceWithStatement(paramLog, statements, session)
+		}
+		if err != nil {
+			basic.LogError2(paramLog, "CaptureHold.adjustBalance", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		hold.Status = domain.HOLD_CAPTURED_STATUS
+		hold.SettledTime = now
+		err = service.HoldUpdateOne(paramLog, &hold, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		return database.CommitWithRetry(session)
+	}
+
+	err := database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, function)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CommitClose posts the sweep of a balance into its owner's main balance and closes it in the same
+// transaction. A dormant balance is reactivated for the sweep, transaction is nil when nothing is left.
+func (self Base) CommitClose(paramLog *basic.ParamLog, statements []domain.Statement, transaction *domain.Transaction,
+	balanceID string, actor domain.ActorObject, reason string) error {
+	function := func(session mongo.SessionContext) error {
+		err := session.StartTransaction(options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())),
+		)
+
+		if err != nil {
+			basic.LogError2(paramLog, "CommitClose.Error", err)
+			session.AbortTransaction(session)
+			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Close balance start transaction failed")
+		}
+
+		balance, err := service.BalanceByID(balanceID, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		if balance.CurrentStatus() == domain.BALANCE_STATUS_DORMANT {
+			balance, err = usecase.SetBalanceStatus(paramLog, balance, domain.BALANCE_STATUS_ACTIVE, actor,
+				"Reactivated to close: "+reason, "", session)
+			if err != nil {
+				session.AbortTransaction(session)
+				return err
+			}
+		}
+
+		transactionCode := ""
+		if transaction != nil {
+			transactionCode = transaction.TransactionCode
+
+			err = saveTransaction(paramLog, transaction, session)
+			if err != nil {
+				basic.LogError2(paramLog, "CommitClose.TransactionSaveOne", err)
+				session.AbortTransaction(session)
+				return err
+			}
+
+			statements, err := postJournal(paramLog, domain.JOURNAL_TYPE_COMMIT, statements, *transaction, session)
+			if err != nil {
+				basic.LogError2(paramLog, "CommitClose.postJournal", err)
+				session.AbortTransaction(session)
+				return err
+			}
+
+			err = adjustBalanceWithStatement(paramLog, statements, session)
+			if err != nil {
+				basic.LogError2(paramLog, "CommitClose.adjustBalanceWithStatement", err)
+				session.AbortTransaction(session)
+				return err
+			}
+
+			balance, err = service.BalanceByID(balanceID, session)
+			if err != nil {
+				session.AbortTransaction(session)
+				return err
+			}
+		}
+
+		if balance.Amount != 0 || balance.Held != 0 {
+			session.AbortTransaction(session)
+			return utils.ErrorConflict(paramLog, utils.BalanceConflict, "Balance changed while closing "+balanceID)
+		}
+
+		_, err = usecase.SetBalanceStatus(paramLog, balance, domain.BALANCE_STATUS_CLOSED, actor, reason, transactionCode, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
+		return database.CommitWithRetry(session)
+	}
+
+	err := database.DBClient.UseSessionWithOptions(
+		context.TODO(), options.Session().SetDefaultReadPreference(readpref.Primary()),
+		func(sctx mongo.SessionContext) error {
+			return database.RunTransactionWithRetry(sctx, function)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -142,7 +476,7 @@ func (self Base) UpdatingTransactionDetail(paramLog *basic.ParamLog, transaction
 	return nil
 }
 
-func (self Base) CommitRollback(paramLog *basic.ParamLog, statements []domain.Statement) error {
+func (self Base) CommitRollback(paramLog *basic.ParamLog, statements []domain.Statement, transaction domain.Transaction) error {
 	function := func(session mongo.SessionContext) error {
 		err := session.StartTransaction(options.Transaction().
 			SetReadConcern(readconcern.Snapshot()).
@@ -154,6 +488,26 @@ func (self Base) CommitRollback(paramLog *basic.ParamLog, statements []domain.St
 			session.AbortTransaction(session)
 			return utils.ErrorInternalServer(paramLog, utils.DBStartTransactionFailed, "Initialize balance start transaction failed")
 		}
+		statements, err := postJournal(paramLog, domain.JOURNAL_TYPE_ROLLBACK, statements, transaction, session)
+		if err != nil {
+			basic.LogError2(paramLog, "postJournal", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.ReleaseLimits(paramLog, transaction.TransactionCode, session)
+		if err != nil {
+			basic.LogError2(paramLog, "ReleaseLimits", err)
+			session.AbortTransaction(session)
+			return err
+		}
+
+		err = usecase.ReleasePromotions(paramLog, transaction.TransactionCode, session)
+		if err != nil {
+			basic.LogError2(paramLog, "ReleasePromotions", err)
+			session.AbortTransaction(session)
+			return err
+		}
 		basic.LogInformation(paramLog, "adjustBalanceWithStatement")
 
 		err = adjustBalanceWithStatement(paramLog, statements, session)
@@ -181,6 +535,69 @@ func (self Base) CommitRollback(paramLog *basic.ParamLog, statements []domain.St
 	return nil
 }
 
+func saveTransaction(paramLog *basic.ParamLog, transaction *domain.Transaction, session mongo.SessionContext) error {
+	err := service.TransactionSaveOne(transaction, session)
+	if err != nil {
+		if strings.Contains(err.Error(), "E11000") {
+			return utils.CustomError{
+				HttpStatus:  http.StatusBadRequest,
+				Code:        11000,
+				Description: "Duplicate Request ID",
+				Time:        time.Now().Format(os.Getenv("TIME_FORMAT")),
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func postJournal(paramLog *basic.ParamLog, journalType string, statements []domain.Statement,
+	transaction domain.Transaction, session mongo.SessionContext) ([]domain.Statement, error) {
+	externalAccount, inbound := journalExternalAccount(transaction)
+	journal := service.CreateJournal(transaction, journalType, time.Now().Format(os.Getenv("TIME_FORMAT")),
+		statements, externalAccount, inbound)
+
+	err := usecase.ValidateJournal(paramLog, journal)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	err = service.JournalSaveOne(&journal, session)
+	if err != nil {
+		return []domain.Statement{}, err
+	}
+
+	result := []domain.Statement{}
+	for _, statement := range statements {
+		statement.JournalID = journal.ID
+		result = append(result, statement)
+	}
+
+	return result, nil
+}
+
+// Money only enters or leaves the ledger through a counterparty that is not a balance holder,
+// or through the dashboard for manual topup and deduct. It tells whether the money comes in from it.
+func journalExternalAccount(transaction domain.Transaction) (string, bool) {
+	if transaction.Method == domain.METHOD_DASHBOARD {
+		return domain.METHOD_DASHBOARD, transaction.Type == domain.TOPUP
+	}
+
+	if isExternalObject(transaction.From) {
+		return transaction.From.Type + ":" + transaction.From.InstitutionCode, true
+	}
+	if isExternalObject(transaction.To) {
+		return transaction.To.Type + ":" + transaction.To.InstitutionCode, false
+	}
+
+	return "", false
+}
+
+func isExternalObject(object domain.TransactionObject) bool {
+	return object.Type != "" && object.Type != domain.WALLET_OBJECT && object.Type != domain.CORPORATE_OBJECT
+}
+
 func adjustBalanceWithStatement(paramLog *basic.ParamLog, statements []domain.Statement, session mongo.SessionContext) error {
 
 	for _, statement := range statements {
@@ -201,3 +618,25 @@ func adjustBalanceWithStatement(paramLog *basic.ParamLog, statements []domain.St
 
 	return nil
 }
+
+// Withdrawals of a held transaction were reserved already, deposits are posted as usual
+func captureBalanceWithStatement(paramLog *basic.ParamLog, statements []domain.Statement, session mongo.SessionContext) error {
+
+	for _, statement := range statements {
+		if statement.Deposit != 0 {
+			basic.LogInformation2(paramLog, "captureBalanceWithStatement.Deposit", statement)
+			err := usecase.DepositBalance(paramLog, statement, session)
+			if err != nil {
+				return err
+			}
+		} else if statement.Withdraw != 0 {
+			basic.LogInformation2(paramLog, "captureBalanceWithStatement.Capture", statement)
+			err := usecase.CaptureHoldBalance(paramLog, statement, session)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -29,6 +29,13 @@ type BPJSTKBiller struct {
 	billerBase         BillerBase
 	paymentCode        string
 	currency           string
+	feeQuoteID         string
+}
+
+// WithFeeQuote charges the fee shown by the quote, quoted on the amount of the inquiry
+func (self BPJSTKBiller) WithFeeQuote(quoteID string) BPJSTKBiller {
+	self.feeQuoteID = quoteID
+	return self
 }
 
 func (biller BPJSTKBiller) Inquiry(paramLog *basic.ParamLog, paymentCode string, currency string, requestId string) (FusBPJSInqResponse, error) {
@@ -75,9 +82,13 @@ func (self BPJSTKBiller) Execute(paramLog *basic.ParamLog, corporate domain.Corp
 		return domain.Transaction{}, nil, errors.New("tidak mendapatkan data inquiry")
 	}
 	basic.LogInformation(paramLog, "weAreCreatingtransaction")
-	transaction, transactionStatement := createTransaction(paramLog, self.corporate, self.fromBalance, self.actor, to, totalBayar, externalID, requestId)
+	transaction, transactionStatement, err := createTransaction(paramLog, self.corporate, self.fromBalance, self.actor, to, totalBayar, self.feeQuoteID, externalID, requestId)
+	if err != nil {
+		basic.LogInformation(paramLog, "Error Create Transaction: "+err.Error())
+		return domain.Transaction{}, nil, err
+	}
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, transaction)
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, &transaction)
 	if err != nil {
 		basic.LogInformation(paramLog, "Error Fee Statement: "+err.Error())
 		return domain.Transaction{}, nil, err
@@ -144,13 +155,13 @@ func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance
 }
 
 func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, from domain.ActorAble,
-	to domain.TransactionObject, subAmount int, externalID string, requestId string) (domain.Transaction, domain.Statement) {
+	to domain.TransactionObject, subAmount int, feeQuoteID string, externalID string, requestId string) (domain.Transaction, domain.Statement, error) {
 
-	totalFee := 0
-	if from.GetActorType() == domain.ACTOR_TYPE_USER {
-		totalFee = corporate.FeeUser.TransferBank
-	} else {
-		totalFee = corporate.FeeCorporate.TransferBank
+	payer, payerID := usecase.FeePayer(from.GetActorType(), from.GetActorID(), corporate)
+	subAmountMoney, totalFee, detailsFee, amount, err := usecase.TransactionMoney(paramLog, feeQuoteID, corporate, payer, payerID,
+		domain.BILLER, subAmount, domain.CURRENCY_IDR)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
 	}
 
 	transcation := domain.Transaction{
@@ -162,23 +173,25 @@ func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, bal
 		FromBalanceID:    balance.ID,
 		From:             from.ToTransactionObject(),
 		To:               to,
-		TotalFee:         totalFee,
-		SubAmount:        subAmount,
-		Amount:           subAmount + totalFee,
+		DetailsFee:       detailsFee,
+		FeeQuoteID:       feeQuoteID,
+		TotalFee:         totalFee.Legacy(),
+		SubAmount:        subAmountMoney.Legacy(),
+		Amount:           amount.Legacy(),
 		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:            "",
 		Status:           domain.COMPLETED_STATUS,
 		Unpaid:           false,
 		ExternalID:       externalID,
-		Currency:         "idr",
+		Currency:         domain.CURRENCY_IDR,
 		RequestId:        requestId,
 		GatewayReference: requestId,
 	}
 
 	statement := service.WithdrawTransactionStatement(
-		balance.ID, transcation.Time, transcation.TransactionCode, subAmount)
+		balance.ID, transcation.Time, transcation.TransactionCode, subAmountMoney)
 
-	return transcation, statement
+	return transcation, statement, nil
 }
 
 func validationActor(paramLog *basic.ParamLog, actor domain.ActorAble, balanceID string, pin string) error {
@@ -0,0 +1,159 @@
+package close_balance
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/usecase/transaction"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+)
+
+type CloseBalance struct {
+	balance            domain.Balance
+	mainBalance        domain.Balance
+	owner              domain.ActorAble
+	transactionUsecase transaction.Base
+}
+
+// Execute sweeps what is left on the balance to the owner's main balance and closes it.
+// The returned transaction is empty when there was nothing to sweep.
+func (self CloseBalance) Execute(paramLog *basic.ParamLog, actor domain.ActorAble, balanceID string,
+	reason string) (domain.Transaction, error) {
+	if strings.TrimSpace(reason) == "" {
+		return domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Reason is required")
+	}
+
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil {
+		return domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	err = validationActor(paramLog, actor, balance)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	err = validationBalance(paramLog, balance)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	owner, err := usecase.ActorObjectToActor(paramLog, balance.Owner)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	if owner.GetActorBalance() == balance.ID {
+		return domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceStatus, "Main balance can not be closed")
+	}
+
+	mainBalance, err := service.BalanceByIDNoSession(owner.GetActorBalance().Hex())
+	if err != nil {
+		return domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Main balance not found")
+	}
+
+	if !domain.IsSameCurrency(balance.Currency, mainBalance.Currency) {
+		return domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.CurrencyError, "Main balance has another currency")
+	}
+
+	self.balance = balance
+	self.mainBalance = mainBalance
+	self.owner = owner
+	self.transactionUsecase = transaction.Base{}
+
+	if balance.Amount == 0 {
+		err = self.transactionUsecase.CommitClose(paramLog, []domain.Statement{}, nil, balanceID, actor.ToActorObject(), reason)
+		if err != nil {
+			return domain.Transaction{}, err
+		}
+
+		return domain.Transaction{}, nil
+	}
+
+	transaction, statements, err := createTransaction(paramLog, actor, self.owner, self.balance, self.mainBalance, reason)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	err = self.transactionUsecase.CommitClose(paramLog, statements, &transaction, balanceID, actor.ToActorObject(), reason)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+func createTransaction(paramLog *basic.ParamLog, actor domain.ActorAble, owner domain.ActorAble, balance domain.Balance,
+	mainBalance domain.Balance, reason string) (domain.Transaction, []domain.Statement, error) {
+	subAmount, err := usecase.LegacyMoney(paramLog, balance.Amount, balance.Currency)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, err
+	}
+
+	transaction := domain.Transaction{
+		TransactionCode: utils.GenerateTransactionCode("1"),
+		UserID:          actor.GetActorID(),
+		CorporateID:     balance.CorporateID,
+		Type:            domain.SWEEP_BALANCE,
+		Method:          domain.METHOD_BALANCE,
+		FromBalanceID:   balance.ID,
+		ToBalanceID:     mainBalance.ID,
+		Actor:           actor.ToTransactionObject(),
+		From:            owner.ToTransactionObject(),
+		To:              owner.ToTransactionObject(),
+		TotalFee:        0,
+		SubAmount:       subAmount.Legacy(),
+		Amount:          subAmount.Legacy(),
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+		Notes:           reason,
+		Status:          domain.COMPLETED_STATUS,
+		Unpaid:          false,
+		Currency:        subAmount.Currency,
+		RequestId:       uuid.New().String(),
+	}
+
+	var statements []domain.Statement
+
+	fromStatement := service.WithdrawTransactionStatement(
+		balance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+
+	toStatement := service.DepositTransactionStatement(
+		mainBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+
+	statements = append(statements, fromStatement)
+	statements = append(statements, toStatement)
+
+	return transaction, statements, nil
+}
+
+func validationActor(paramLog *basic.ParamLog, actor domain.ActorAble, balance domain.Balance) error {
+	if actor.GetActorType() == domain.ACTOR_TYPE_CORPORATE && balance.CorporateID == actor.GetActorID() {
+		return nil
+	}
+
+	if usecase.IsBalanceOwner(actor, balance.ID.Hex()) {
+		return nil
+	}
+
+	return utils.ErrorBadRequest(paramLog, utils.InvalidBalanceAccess, "Invalid balance access")
+}
+
+// Frozen balances keep their funds until compliance releases them
+func validationBalance(paramLog *basic.ParamLog, balance domain.Balance) error {
+	status := balance.CurrentStatus()
+	if status != domain.BALANCE_STATUS_ACTIVE && status != domain.BALANCE_STATUS_DORMANT {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidBalanceStatus, "Balance can not be closed from "+status)
+	}
+
+	if balance.Held != 0 {
+		return utils.ErrorBadRequest(paramLog, utils.InvalidBalanceStatus, "Balance has pending transactions")
+	}
+
+	return nil
+}
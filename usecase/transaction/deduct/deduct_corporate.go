@@ -23,6 +23,20 @@ type DeductCorporate struct {
 	subAmount          int
 	externalID         string
 	transactionUsecase transaction.Base
+	fxQuoteID          string
+	feeQuoteID         string
+}
+
+// WithFXQuote executes a cross currency deduct at the rate locked by the quote
+func (self DeductCorporate) WithFXQuote(quoteID string) DeductCorporate {
+	self.fxQuoteID = quoteID
+	return self
+}
+
+// WithFeeQuote charges the fee shown by the quote
+func (self DeductCorporate) WithFeeQuote(quoteID string) DeductCorporate {
+	self.feeQuoteID = quoteID
+	return self
 }
 
 func (self DeductCorporate) Execute(paramLog *basic.ParamLog, corporate domain.Corporate, actor domain.ActorAble,
@@ -62,50 +76,72 @@ func (self DeductCorporate) Execute(paramLog *basic.ParamLog, corporate domain.C
 
 	var statements []domain.Statement
 
-	transaction, transactionStatement := createTransaction(self.corporate, self.fromBalance, self.actor, self.from, self.to,
-		self.toBalance, self.subAmount, self.externalID, requestId)
+	currency := corporate.Currency
+	if !domain.IsSameCurrency(fromBalance.Currency, toBalance.Currency) {
+		currency = fromBalance.Currency
+	}
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, transaction)
+	subAmountMoney, err := usecase.LegacyMoney(paramLog, self.subAmount, currency)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	statements = append(statements, transactionStatement...)
-	statements = append(statements, feeStatement...)
+	fx, credit, err := usecase.ConvertBalanceAmount(paramLog, corporate, fromBalance, toBalance, subAmountMoney, self.fxQuoteID)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
 
-	err = validationActor(paramLog, self.actor, self.fromBalance, toBalance, self.pin)
+	transaction, transactionStatement, err := createTransaction(paramLog, self.corporate, self.fromBalance, self.actor, self.from, self.to,
+		self.toBalance, subAmountMoney, credit, fx, self.feeQuoteID, self.externalID, requestId)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	err = validateCurrency(paramLog, fromBalance, toBalance)
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, &transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	err = validationTransaction(paramLog, transaction)
+	statements = append(statements, transactionStatement...)
+	statements = append(statements, feeStatement...)
+
+	err = validationActor(paramLog, self.actor, self.fromBalance, toBalance, self.pin)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	err = usecase.CheckLimits(paramLog, transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	go usecase.PublishDeductCallback(paramLog, corporate, fromBalance, transaction)
+	err = self.transactionUsecase.WithWebhooks(usecase.DeductWebhook(corporate, fromBalance, transaction)).
+		Commit(paramLog, statements, &transaction)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
 
 	return transaction, nil
 }
 
-func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
-	to domain.TransactionObject, toBalance domain.Balance, subAmount int, externalID string, requestId string) (domain.Transaction, []domain.Statement) {
+func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, fromBalance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
+	to domain.TransactionObject, toBalance domain.Balance, subAmount domain.Money, credit domain.Money, fx *domain.TransactionFX,
+	feeQuoteID string, externalID string, requestId string) (domain.Transaction, []domain.Statement, error) {
 
-	totalFee := 0
-	if actor.GetActorType() == domain.ACTOR_TYPE_USER {
-		totalFee = corporate.FeeUser.Deduct
-	} else {
-		totalFee = corporate.FeeCorporate.Deduct
+	payer, payerID := usecase.FeePayer(actor.GetActorType(), actor.GetActorID(), corporate)
+	totalFee, detailsFee, err := usecase.QuotedTransactionFee(paramLog, feeQuoteID, corporate, payer, payerID, domain.DEDUCT, subAmount)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, err
+	}
+
+	amount, err := subAmount.Add(totalFee)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, usecase.MoneyError(paramLog, err)
+	}
+
+	currency := corporate.Currency
+	if fx != nil {
+		currency = fx.FromCurrency
 	}
 
 	transaction := domain.Transaction{
@@ -119,22 +155,29 @@ func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, a
 		Actor:           actor.ToTransactionObject(),
 		From:            from,
 		To:              to,
-		TotalFee:        totalFee,
-		SubAmount:       subAmount,
-		Amount:          subAmount + totalFee,
+		DetailsFee:      detailsFee,
+		FeeQuoteID:      feeQuoteID,
+		TotalFee:        totalFee.Legacy(),
+		SubAmount:       subAmount.Legacy(),
+		Amount:          amount.Legacy(),
 		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:           "",
 		Status:          domain.COMPLETED_STATUS,
 		Unpaid:          false,
 		ExternalID:      externalID,
-		Currency:        corporate.Currency,
+		Currency:        currency,
+		FX:              fx,
 		RequestId:       requestId,
 	}
 
 	var statements []domain.Statement
 
 	fromStatement := service.DepositTransactionStatement(
-		toBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+		toBalance.ID, transaction.Time, transaction.TransactionCode, credit)
+	if fx != nil {
+		fromStatement = service.DepositConversionStatement(
+			toBalance.ID, transaction.Time, transaction.TransactionCode, credit, *fx)
+	}
 
 	toStatement := service.WithdrawTransactionStatement(
 		fromBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
@@ -142,7 +185,7 @@ func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, a
 	statements = append(statements, fromStatement)
 	statements = append(statements, toStatement)
 
-	return transaction, statements
+	return transaction, statements, nil
 }
 
 func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance, domain.TransactionObject, domain.Corporate, error) {
@@ -216,17 +259,3 @@ func validateDeductScope(paramLog *basic.ParamLog, actor domain.ActorAble, balan
 
 	return nil
 }
-
-func validationTransaction(paramLog *basic.ParamLog, transaction domain.Transaction) error {
-	err := validateMaximum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	err = validateMinimum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
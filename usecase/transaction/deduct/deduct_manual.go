@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
 	"github.com/kangdjoker/takeme-core/usecase/transaction"
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
@@ -40,8 +41,13 @@ func (tm DeductManual) Execute(paramLog *basic.ParamLog, balanceID string, amoun
 
 	var statements []domain.Statement
 
+	subAmount, err := usecase.LegacyMoney(paramLog, tm.amount, tm.currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
 	transaction, transactionStatement := createTransactionDeductManual(tm.corporate, tm.balance,
-		tm.to, tm.amount, tm.remark)
+		tm.to, subAmount, tm.remark)
 
 	statements = append(statements, transactionStatement)
 
@@ -59,7 +65,7 @@ func (tm DeductManual) Execute(paramLog *basic.ParamLog, balanceID string, amoun
 }
 
 func createTransactionDeductManual(corporate domain.Corporate, balance domain.Balance,
-	to domain.TransactionObject, subAmount int, remark string) (domain.Transaction, domain.Statement) {
+	to domain.TransactionObject, subAmount domain.Money, remark string) (domain.Transaction, domain.Statement) {
 
 	var totalFee = 0
 	newUuid := uuid.New().String()
@@ -73,8 +79,8 @@ func createTransactionDeductManual(corporate domain.Corporate, balance domain.Ba
 		From:             domain.TransactionObject{},
 		To:               to,
 		TotalFee:         totalFee,
-		SubAmount:        subAmount,
-		Amount:           subAmount - totalFee,
+		SubAmount:        subAmount.Legacy(),
+		Amount:           subAmount.Legacy() - totalFee,
 		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:            remark,
 		Status:           domain.COMPLETED_STATUS,
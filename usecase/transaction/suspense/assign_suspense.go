@@ -0,0 +1,163 @@
+package suspense
+
+import (
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/usecase/transaction"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+)
+
+type AssignSuspense struct {
+	item               domain.SuspenseItem
+	suspenseBalance    domain.Balance
+	balance            domain.Balance
+	transactionUsecase transaction.Base
+}
+
+// Execute transfers an open suspense item from the suspense balance to the balance it was meant for.
+// Items of the corporate of SUSPENSE_CORPORATE_ID may go to any corporate, the others stay in theirs.
+func (self AssignSuspense) Execute(paramLog *basic.ParamLog, operator domain.ActorAble, itemID string, balanceID string,
+	note string) (domain.SuspenseItem, domain.Transaction, error) {
+	item, suspenseBalance, err := openItem(paramLog, itemID)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance id not found")
+	}
+
+	if balance.ID == suspenseBalance.ID {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidSuspenseItem,
+			"Suspense item can not be assigned to the suspense balance")
+	}
+
+	if balance.CorporateID != item.CorporateID && item.CorporateID.Hex() != usecase.SuspenseCorporateID() {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceAccess,
+			"Balance belongs to another corporate")
+	}
+
+	if !domain.IsSameCurrency(balance.Currency, suspenseBalance.Currency) {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.CurrencyError, "Balance has another currency")
+	}
+
+	if !balance.CanCredit() {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.BalanceFrozen,
+			"Balance "+balance.CurrentStatus()+" "+balanceID)
+	}
+
+	owner, err := usecase.ActorObjectToActor(paramLog, balance.Owner)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	self.item = item
+	self.suspenseBalance = suspenseBalance
+	self.balance = balance
+	self.transactionUsecase = transaction.Base{}
+
+	transaction, statements, err := createAssignTransaction(paramLog, operator, owner, self.item, self.suspenseBalance,
+		self.balance, note)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	err = usecase.ClaimSuspenseItem(paramLog, &self.item, domain.SUSPENSE_ASSIGNED, operator.ToActorObject(), note)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	if err != nil {
+		usecase.ReleaseSuspenseItem(paramLog, &self.item)
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	usecase.ResolveSuspenseItem(paramLog, &self.item, transaction)
+
+	return self.item, transaction, nil
+}
+
+func createAssignTransaction(paramLog *basic.ParamLog, operator domain.ActorAble, owner domain.ActorAble, item domain.SuspenseItem,
+	suspenseBalance domain.Balance, balance domain.Balance, note string) (domain.Transaction, []domain.Statement, error) {
+	subAmount, err := usecase.LegacyMoney(paramLog, item.Amount, suspenseBalance.Currency)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, err
+	}
+
+	suspenseOwner, err := usecase.ActorObjectToActor(paramLog, suspenseBalance.Owner)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, err
+	}
+
+	transaction := domain.Transaction{
+		TransactionCode: utils.GenerateTransactionCode("1"),
+		UserID:          operator.GetActorID(),
+		CorporateID:     balance.CorporateID,
+		Type:            domain.SUSPENSE_ASSIGN,
+		Method:          domain.METHOD_BALANCE,
+		FromBalanceID:   suspenseBalance.ID,
+		ToBalanceID:     balance.ID,
+		Actor:           operator.ToTransactionObject(),
+		From:            suspenseOwner.ToTransactionObject(),
+		To:              owner.ToTransactionObject(),
+		TotalFee:        0,
+		SubAmount:       subAmount.Legacy(),
+		Amount:          subAmount.Legacy(),
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+		Notes:           suspenseNotes(item, note),
+		Status:          domain.COMPLETED_STATUS,
+		Unpaid:          false,
+		ExternalID:      item.ExternalID,
+		Currency:        subAmount.Currency,
+		RequestId:       uuid.New().String(),
+	}
+
+	var statements []domain.Statement
+
+	fromStatement := service.WithdrawTransactionStatement(
+		suspenseBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+
+	toStatement := service.DepositTransactionStatement(
+		balance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+
+	statements = append(statements, fromStatement)
+	statements = append(statements, toStatement)
+
+	return transaction, statements, nil
+}
+
+// openItem returns the open item with the suspense balance holding its money
+func openItem(paramLog *basic.ParamLog, itemID string) (domain.SuspenseItem, domain.Balance, error) {
+	item, err := usecase.SuspenseItemByID(paramLog, itemID)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Balance{}, err
+	}
+
+	if item.Status != domain.SUSPENSE_OPEN {
+		return domain.SuspenseItem{}, domain.Balance{}, utils.ErrorBadRequest(paramLog, utils.InvalidSuspenseItem,
+			"Suspense item is "+item.Status)
+	}
+
+	suspenseBalance, err := service.BalanceByIDNoSession(item.BalanceID.Hex())
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	return item, suspenseBalance, nil
+}
+
+func suspenseNotes(item domain.SuspenseItem, note string) string {
+	if note == "" {
+		return "Suspense " + item.ID.Hex()
+	}
+
+	return "Suspense " + item.ID.Hex() + " " + note
+}
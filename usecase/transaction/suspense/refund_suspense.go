@@ -0,0 +1,114 @@
+package suspense
+
+import (
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/usecase/transaction"
+	"github.com/kangdjoker/takeme-core/usecase/transaction/transfer/transfer_bank"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+)
+
+type RefundSuspense struct {
+	item               domain.SuspenseItem
+	suspenseBalance    domain.Balance
+	transactionUsecase transaction.Base
+	transferBankBase   transfer_bank.TransferBank
+}
+
+// Execute sends an open suspense item back by bank transfer to the bank account the operator gave, the
+// VA it was paid into is not an account to refund to. A refund the bank fails returns to the suspense
+// balance and reopens the item.
+func (self RefundSuspense) Execute(paramLog *basic.ParamLog, operator domain.ActorAble, itemID string, to domain.TransactionObject,
+	note string, requestId string) (domain.SuspenseItem, domain.Transaction, error) {
+	item, suspenseBalance, err := openItem(paramLog, itemID)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	if to.Type != domain.BANK_OBJECT || to.AccountNumber == "" || to.InstitutionCode == "" {
+		return domain.SuspenseItem{}, domain.Transaction{}, utils.ErrorBadRequest(paramLog, utils.InvalidSuspenseItem,
+			"Bank account to refund to is required")
+	}
+
+	self.item = item
+	self.suspenseBalance = suspenseBalance
+	self.transactionUsecase = transaction.Base{}
+	self.transferBankBase = transfer_bank.TransferBank{}
+
+	transaction, statement, err := createRefundTransaction(paramLog, operator, self.item, self.suspenseBalance, to, note, requestId)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	err = self.transferBankBase.SetupGateway(paramLog, &transaction)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	err = usecase.ClaimSuspenseItem(paramLog, &self.item, domain.SUSPENSE_REFUNDED, operator.ToActorObject(), note)
+	if err != nil {
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	err = self.transactionUsecase.CommitHold(paramLog, []domain.Statement{statement}, &transaction)
+	if err != nil {
+		usecase.ReleaseSuspenseItem(paramLog, &self.item)
+		return domain.SuspenseItem{}, domain.Transaction{}, err
+	}
+
+	usecase.ResolveSuspenseItem(paramLog, &self.item, transaction)
+
+	err = self.transferBankBase.CreateTransferGateway(paramLog, &transaction, requestId)
+	if transaction.Status == domain.FAILED_STATUS {
+		self.item.Status = domain.SUSPENSE_OPEN
+		self.item.ResolutionTransactionCode = ""
+	}
+
+	return self.item, transaction, err
+}
+
+func createRefundTransaction(paramLog *basic.ParamLog, operator domain.ActorAble, item domain.SuspenseItem,
+	suspenseBalance domain.Balance, to domain.TransactionObject, note string, requestId string) (domain.Transaction, domain.Statement, error) {
+	subAmount, err := usecase.LegacyMoney(paramLog, item.Amount, suspenseBalance.Currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
+
+	suspenseOwner, err := usecase.ActorObjectToActor(paramLog, suspenseBalance.Owner)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
+
+	transaction := domain.Transaction{
+		TransactionCode:  utils.GenerateTransactionCode("1"),
+		UserID:           operator.GetActorID(),
+		CorporateID:      item.CorporateID,
+		Type:             domain.TRANSFER_BANK,
+		Method:           domain.METHOD_BALANCE,
+		FromBalanceID:    suspenseBalance.ID,
+		Actor:            operator.ToTransactionObject(),
+		From:             suspenseOwner.ToTransactionObject(),
+		To:               to,
+		TotalFee:         0,
+		SubAmount:        subAmount.Legacy(),
+		Amount:           subAmount.Legacy(),
+		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
+		Notes:            suspenseNotes(item, note),
+		Status:           domain.PENDING_STATUS,
+		Unpaid:           false,
+		ExternalID:       item.ExternalID,
+		Currency:         subAmount.Currency,
+		RequestId:        requestId,
+		GatewayReference: requestId,
+	}
+
+	statement := service.WithdrawTransactionStatement(
+		suspenseBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+
+	return transaction, statement, nil
+}
@@ -5,12 +5,23 @@ import (
 	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
 	"github.com/kangdjoker/takeme-core/service"
 	"github.com/kangdjoker/takeme-core/usecase"
 	"github.com/kangdjoker/takeme-core/usecase/transaction"
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Steps of ExecuteCallback that reach the store, replaced in tests
+var (
+	forwardPartnerCallback = usecase.ForwardPartnerCallback
+	vaInvoiceByID          = service.VAInvoiceByIDNoSession
+	executeTopup           = TopupBank.Execute
+	suspendTopup           = TopupBank.suspendPayment
 )
 
 type TopupBank struct {
@@ -21,6 +32,8 @@ type TopupBank struct {
 	amount             int
 	currency           string
 	reference          string
+	gatewayCode        string
+	invoice            domain.VAInvoice
 	transactionUsecase transaction.Base
 }
 
@@ -36,7 +49,27 @@ func (self TopupBank) Execute(paramLog *basic.ParamLog, from domain.Bank, balanc
 	basic.LogInformation2(paramLog, "owner", owner)
 	basic.LogInformation2(paramLog, "corporate", corporate)
 
-	gateway := gateway.XenditGateway{}
+	if self.gatewayCode == "" {
+		self.gatewayCode = gateway.Xendit
+	}
+
+	if reference != "" {
+		existing, err := service.TransactionByGatewayPaymentNoSession(self.gatewayCode, reference, domain.TOPUP)
+		if err == nil {
+			basic.LogInformation(paramLog, "Topup already made for reference "+reference)
+			return existing, balance, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return domain.Transaction{}, domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+	}
+
+	topupGateway, ok := gateway.Get(self.gatewayCode)
+	if !ok {
+		return domain.Transaction{}, domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.GatewayNotSupported,
+			"Gateway "+self.gatewayCode+" not found")
+	}
+
 	self.corporate = corporate
 	self.from = from
 	self.to = owner
@@ -48,12 +81,17 @@ func (self TopupBank) Execute(paramLog *basic.ParamLog, from domain.Bank, balanc
 
 	var statements []domain.Statement
 
-	transaction, transactionStatement := createTransaction(self.corporate, self.balance, self.from,
-		self.to, self.amount, self.reference, gateway, requestId)
+	transaction, transactionStatement, err := createTransaction(paramLog, self.corporate, self.balance, self.from,
+		self.to, self.amount, self.reference, topupGateway, requestId)
+	if err != nil {
+		basic.LogError2(paramLog, "createTransaction", err)
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+	transaction.ExternalID = self.invoice.ExternalID
 	basic.LogInformation2(paramLog, "transaction", transaction)
 	basic.LogInformation2(paramLog, "transactionStatement", transactionStatement)
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, balance, transaction)
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, balance, &transaction)
 	if err != nil {
 		basic.LogError2(paramLog, "CreateFeeStatement", err)
 		return domain.Transaction{}, domain.Balance{}, err
@@ -70,18 +108,123 @@ func (self TopupBank) Execute(paramLog *basic.ParamLog, from domain.Bank, balanc
 	}
 	basic.LogInformation(paramLog, "validateCurrency.Success")
 
-	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	// The invoice tells the corporate about its own payment
+	webhook := usecase.TopupWebhook(corporate, balance, transaction)
+	if !self.invoice.ID.IsZero() {
+		webhook = usecase.VAInvoiceWebhook(corporate, self.invoice, transaction)
+	}
+
+	err = self.transactionUsecase.WithWebhooks(webhook).Commit(paramLog, statements, &transaction)
 	if err != nil {
 		basic.LogError2(paramLog, "transactionUsecase.Commit", err)
 		return domain.Transaction{}, domain.Balance{}, err
 	}
 	basic.LogInformation(paramLog, "transactionUsecase.Commit.Success")
 
-	go usecase.PublishTopupCallback(paramLog, corporate, balance, transaction)
+	return transaction, balance, nil
+}
+
+// ExecuteCallback makes the topup of a VA payment callback once, a replay of the callback returns the
+// topup made by the first delivery. A callback without external ID is credited to the balance the paid
+// account number was provisioned for. A payment to an invoice VA pays the invoice, one that does not
+// match it is refused or suspended. A suspended payment, or one whose balance cannot be identified or
+// credited, is credited to the suspense balance of the corporate instead. A payment routed to a partner
+// is only forwarded to it.
+func (self TopupBank) ExecuteCallback(paramLog *basic.ParamLog, gatewayCode string, callback gateway.VACallback,
+	currency string, requestId string) (domain.Transaction, domain.Balance, error) {
+	self.gatewayCode = gatewayCode
+
+	key := callback.ExternalID
+	if key == "" {
+		key = callback.AccountNumber
+	}
+	forwarded, err := forwardPartnerCallback(paramLog, gatewayCode, domain.CALLBACK_EVENT_VA_PAID, key,
+		callback.Reference, callback.Payload)
+	if err != nil || forwarded {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	result := dto.CallbackPaymentResult{}
+	err = usecase.ProcessCallbackOnce(paramLog, gatewayCode, callback.Reference, domain.CALLBACK_EVENT_VA_PAID, &result, func() error {
+		invoice, err := vaInvoiceByID(callback.ExternalID)
+		if err == nil {
+			transaction, balance, err := self.payVAInvoice(paramLog, invoice, callback, currency, requestId)
+			result = dto.CallbackPaymentResult{Transaction: transaction, Balance: balance}
+			return err
+		}
+		if err != mongo.ErrNoDocuments {
+			return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+
+		balanceID, err := callbackBalanceID(paramLog, gatewayCode, callback)
+		if err == nil {
+			var transaction domain.Transaction
+			var balance domain.Balance
+			transaction, balance, err = executeTopup(self, paramLog, callback.From, balanceID, callback.Amount,
+				callback.Reference, currency, requestId)
+			result = dto.CallbackPaymentResult{Transaction: transaction, Balance: balance}
+		}
+		if err == nil || !isSuspenseError(err) {
+			return err
+		}
+
+		corporateID := suspenseCorporateID(balanceID)
+		if corporateID == "" {
+			return err
+		}
+
+		transaction, balance, err := suspendTopup(self, paramLog, corporateID, callback, primitive.NilObjectID,
+			err.Error(), requestId)
+		result = dto.CallbackPaymentResult{Transaction: transaction, Balance: balance}
+		return err
+	})
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	return result.Transaction, result.Balance, nil
+}
+
+func (self TopupBank) payVAInvoice(paramLog *basic.ParamLog, invoice domain.VAInvoice, callback gateway.VACallback,
+	currency string, requestId string) (domain.Transaction, domain.Balance, error) {
+	claimed, err := usecase.ClaimVAInvoicePayment(paramLog, &invoice, callback.Reference, callback.Amount)
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+	if !claimed {
+		reason := "Invoice payment suspended"
+		if len(invoice.Payments) > 0 {
+			reason = invoice.Payments[len(invoice.Payments)-1].Reason
+		}
+		return self.suspendPayment(paramLog, invoice.CorporateID.Hex(), callback, invoice.ID, reason, requestId)
+	}
+
+	self.invoice = invoice
+	transaction, balance, err := self.Execute(paramLog, callback.From, invoice.BalanceID.Hex(), callback.Amount,
+		callback.Reference, currency, requestId)
+	if err != nil {
+		usecase.ReleaseVAInvoicePayment(paramLog, &invoice)
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	usecase.SettleVAInvoicePayment(paramLog, invoice, transaction)
 
 	return transaction, balance, nil
 }
 
+func callbackBalanceID(paramLog *basic.ParamLog, gatewayCode string, callback gateway.VACallback) (string, error) {
+	if callback.ExternalID != "" {
+		return callback.ExternalID, nil
+	}
+
+	provision, err := service.VAProvisionByAccountNumberNoSession(gatewayCode, callback.AccountNumber)
+	if err != nil {
+		return "", utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount, "Virtual account not found "+callback.AccountNumber)
+	}
+
+	return provision.BalanceID.Hex(), nil
+}
+
 func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance, domain.TransactionObject, domain.Corporate, error) {
 	balance, err := service.BalanceByIDNoSession(balanceID)
 	if err != nil {
@@ -121,14 +264,23 @@ func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance
 	return balance, balanceOwner, corporate, nil
 }
 
-func createTransaction(corporate domain.Corporate, balance domain.Balance, from domain.Bank,
-	to domain.TransactionObject, subAmount int, reference string, gateway gateway.Gateway, requestId string) (domain.Transaction, domain.Statement) {
+func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, from domain.Bank,
+	to domain.TransactionObject, subAmount int, reference string, gateway gateway.Gateway, requestId string) (domain.Transaction, domain.Statement, error) {
 
-	var totalFee = 0
-	if balance.Owner.Type == domain.ACTOR_TYPE_USER {
-		totalFee = corporate.FeeUser.Topup
-	} else {
-		totalFee = corporate.FeeCorporate.Topup
+	subAmountMoney, err := usecase.LegacyMoney(paramLog, subAmount, corporate.Currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
+
+	payer, payerID := usecase.FeePayer(balance.Owner.Type, balance.Owner.ID, corporate)
+	totalFee, detailsFee, err := usecase.TransactionFee(paramLog, corporate, payer, payerID, domain.TOPUP, subAmountMoney)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
+	}
+
+	amount, err := subAmountMoney.Sub(totalFee)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, usecase.MoneyError(paramLog, err)
 	}
 
 	transcation := domain.Transaction{
@@ -140,9 +292,10 @@ func createTransaction(corporate domain.Corporate, balance domain.Balance, from
 		FromBalanceID:    balance.ID,
 		From:             from.ToTransactionObject(),
 		To:               to,
-		TotalFee:         totalFee,
-		SubAmount:        subAmount,
-		Amount:           subAmount - totalFee,
+		DetailsFee:       detailsFee,
+		TotalFee:         totalFee.Legacy(),
+		SubAmount:        subAmountMoney.Legacy(),
+		Amount:           amount.Legacy(),
 		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:            "",
 		Status:           domain.COMPLETED_STATUS,
@@ -155,7 +308,7 @@ func createTransaction(corporate domain.Corporate, balance domain.Balance, from
 	}
 
 	statement := service.DepositTransactionStatement(
-		balance.ID, transcation.Time, transcation.TransactionCode, subAmount)
+		balance.ID, transcation.Time, transcation.TransactionCode, subAmountMoney)
 
-	return transcation, statement
+	return transcation, statement, nil
 }
@@ -0,0 +1,82 @@
+package topup
+
+import (
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stubCallbackSteps makes the topup fail with err and records the payments sent to suspense
+func stubCallbackSteps(t *testing.T, err error) *[]string {
+	forward, invoice, execute, suspend, corporate := forwardPartnerCallback, vaInvoiceByID, executeTopup, suspendTopup,
+		suspenseCorporateID
+	t.Cleanup(func() {
+		forwardPartnerCallback, vaInvoiceByID, executeTopup, suspendTopup, suspenseCorporateID = forward, invoice, execute,
+			suspend, corporate
+	})
+
+	forwardPartnerCallback = func(paramLog *basic.ParamLog, gatewayCode string, event string, key string, reference string,
+		payload []byte) (bool, error) {
+		return false, nil
+	}
+	vaInvoiceByID = func(ID string) (domain.VAInvoice, error) {
+		return domain.VAInvoice{}, mongo.ErrNoDocuments
+	}
+	executeTopup = func(self TopupBank, paramLog *basic.ParamLog, from domain.Bank, balanceID string, amount int,
+		reference string, currency string, requestId string) (domain.Transaction, domain.Balance, error) {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+	suspenseCorporateID = func(balanceID string) string {
+		return "corporate"
+	}
+
+	suspended := []string{}
+	suspendTopup = func(self TopupBank, paramLog *basic.ParamLog, corporateID string, callback gateway.VACallback,
+		invoiceID primitive.ObjectID, reason string, requestId string) (domain.Transaction, domain.Balance, error) {
+		suspended = append(suspended, reason)
+		return domain.Transaction{Type: domain.SUSPENSE_IN, Notes: reason}, domain.Balance{}, nil
+	}
+
+	return &suspended
+}
+
+func TestExecuteCallbackSuspendsUncreditablePayment(t *testing.T) {
+	codes := []int{
+		utils.InvalidVirtualAccount,
+		utils.InvalidBalanceID,
+		utils.CorporateNotFound,
+		utils.UserNotFound,
+		utils.BalanceFrozen,
+		utils.BalanceClosed,
+		utils.LimitExceeded,
+	}
+
+	for _, code := range codes {
+		suspended := stubCallbackSteps(t, utils.ErrorBadRequest(nil, code, "Cannot credit"))
+
+		callback := gateway.VACallback{ExternalID: primitive.NewObjectID().Hex(), Amount: 10000}
+		transaction, _, err := TopupBank{}.ExecuteCallback(nil, gateway.Xendit, callback, "IDR", "request")
+		if err != nil {
+			t.Errorf("code %v: ExecuteCallback failed %v, want the payment suspended", code, err)
+			continue
+		}
+		if len(*suspended) != 1 || transaction.Type != domain.SUSPENSE_IN {
+			t.Errorf("code %v: suspended %v times as %v, want once", code, len(*suspended), transaction.Type)
+		}
+	}
+}
+
+func TestExecuteCallbackKeepsOtherErrors(t *testing.T) {
+	suspended := stubCallbackSteps(t, utils.ErrorInternalServer(nil, utils.QueryFailed, "Query failed"))
+
+	callback := gateway.VACallback{ExternalID: primitive.NewObjectID().Hex(), Amount: 10000}
+	_, _, err := TopupBank{}.ExecuteCallback(nil, gateway.Xendit, callback, "IDR", "request")
+	if err == nil || len(*suspended) != 0 {
+		t.Errorf("got %v with %v suspended, want the error and nothing suspended", err, len(*suspended))
+	}
+}
@@ -0,0 +1,147 @@
+package topup
+
+import (
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors of a payment whose balance cannot be identified or credited, or that breaches a limit of
+// the balance, the gateway already took the money so the payment goes to suspense
+var suspenseErrorCodes = map[int]bool{
+	utils.InvalidVirtualAccount: true,
+	utils.InvalidBalanceID:      true,
+	utils.CorporateNotFound:     true,
+	utils.UserNotFound:          true,
+	utils.BalanceFrozen:         true,
+	utils.BalanceClosed:         true,
+	utils.LimitExceeded:         true,
+}
+
+func isSuspenseError(err error) bool {
+	customError, ok := err.(utils.CustomError)
+
+	return ok && suspenseErrorCodes[customError.Code]
+}
+
+// suspenseCorporateID is the corporate of the balance the payment was meant for, or the one of
+// SUSPENSE_CORPORATE_ID when that balance is unknown
+var suspenseCorporateID = func(balanceID string) string {
+	if balanceID != "" {
+		balance, err := service.BalanceByIDNoSession(balanceID)
+		if err == nil {
+			return balance.CorporateID.Hex()
+		}
+	}
+
+	return usecase.SuspenseCorporateID()
+}
+
+// suspendPayment credits the payment to the suspense balance of the corporate and opens a suspense
+// item for it in the same transaction, an operator later assigns it to a balance or refunds it. A
+// replay opens the item of a payment suspended without one.
+func (self TopupBank) suspendPayment(paramLog *basic.ParamLog, corporateID string, callback gateway.VACallback,
+	invoiceID primitive.ObjectID, reason string, requestId string) (domain.Transaction, domain.Balance, error) {
+	balance, corporate, err := usecase.SuspenseBalance(paramLog, corporateID)
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	if callback.Reference != "" {
+		existing, err := service.TransactionByGatewayPaymentNoSession(self.gatewayCode, callback.Reference, domain.SUSPENSE_IN)
+		if err == nil {
+			basic.LogInformation(paramLog, "Payment already suspended for reference "+callback.Reference)
+			err = ensureSuspenseItem(paramLog, suspenseItem(existing, callback, invoiceID))
+			if err != nil {
+				return domain.Transaction{}, domain.Balance{}, err
+			}
+			return existing, balance, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return domain.Transaction{}, domain.Balance{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+		}
+	}
+
+	amount, err := usecase.LegacyMoney(paramLog, callback.Amount, balance.Currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	transaction := domain.Transaction{
+		TransactionCode:  utils.GenerateTransactionCode("2"),
+		CorporateID:      corporate.ID,
+		Type:             domain.SUSPENSE_IN,
+		Method:           domain.METHOD_VA,
+		ToBalanceID:      balance.ID,
+		FromBalanceID:    balance.ID,
+		From:             callback.From.ToTransactionObject(),
+		To:               corporate.ToTransactionObject(),
+		TotalFee:         0,
+		SubAmount:        amount.Legacy(),
+		Amount:           amount.Legacy(),
+		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
+		Notes:            reason,
+		Status:           domain.COMPLETED_STATUS,
+		Unpaid:           false,
+		ExternalID:       callback.ExternalID,
+		Gateway:          self.gatewayCode,
+		GatewayReference: callback.Reference,
+		Currency:         amount.Currency,
+		RequestId:        requestId,
+	}
+
+	statement := service.DepositTransactionStatement(
+		balance.ID, transaction.Time, transaction.TransactionCode, amount)
+
+	item := suspenseItem(transaction, callback, invoiceID)
+	err = self.transactionUsecase.WithSuspenseItems(item).Commit(paramLog, []domain.Statement{statement}, &transaction)
+	if err != nil {
+		basic.LogError2(paramLog, "transactionUsecase.Commit", err)
+		return domain.Transaction{}, domain.Balance{}, err
+	}
+
+	basic.LogInformation(paramLog, "Payment suspended "+transaction.TransactionCode+" "+reason)
+
+	return transaction, balance, nil
+}
+
+func suspenseItem(transaction domain.Transaction, callback gateway.VACallback, invoiceID primitive.ObjectID) domain.SuspenseItem {
+	return domain.SuspenseItem{
+		CorporateID:     transaction.CorporateID,
+		BalanceID:       transaction.ToBalanceID,
+		Gateway:         transaction.Gateway,
+		Reference:       transaction.GatewayReference,
+		ExternalID:      transaction.ExternalID,
+		AccountNumber:   callback.AccountNumber,
+		InvoiceID:       invoiceID,
+		From:            transaction.From,
+		Amount:          transaction.Amount,
+		Currency:        transaction.Currency,
+		Reason:          transaction.Notes,
+		Status:          domain.SUSPENSE_OPEN,
+		TransactionCode: transaction.TransactionCode,
+		Time:            transaction.Time,
+	}
+}
+
+func ensureSuspenseItem(paramLog *basic.ParamLog, item domain.SuspenseItem) error {
+	_, err := service.SuspenseItemByTransactionCodeNoSession(item.TransactionCode)
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	basic.LogInformation(paramLog, "Opening missing suspense item of "+item.TransactionCode)
+
+	return service.SuspenseItemSaveOneNoSession(paramLog, &item)
+}
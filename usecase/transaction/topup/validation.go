@@ -7,7 +7,7 @@ import (
 )
 
 func validateCurrency(paramLog *basic.ParamLog, from domain.Balance, to domain.Balance) error {
-	if from.Currency != to.Currency {
+	if !domain.IsSameCurrency(from.Currency, to.Currency) {
 		return utils.ErrorBadRequest(paramLog, utils.CurrencyError, "Transaction cross currency")
 	}
 
@@ -24,6 +24,20 @@ type ActorTransferBalance struct {
 	externalID         string
 	transactionUsecase transaction.Base
 	isTopuoType        bool
+	fxQuoteID          string
+	feeQuoteID         string
+}
+
+// WithFXQuote executes a cross currency transfer at the rate locked by the quote
+func (self ActorTransferBalance) WithFXQuote(quoteID string) ActorTransferBalance {
+	self.fxQuoteID = quoteID
+	return self
+}
+
+// WithFeeQuote charges the fee shown by the quote
+func (self ActorTransferBalance) WithFeeQuote(quoteID string) ActorTransferBalance {
+	self.feeQuoteID = quoteID
+	return self
 }
 
 func (self ActorTransferBalance) Execute(paramLog *basic.ParamLog, corporate domain.Corporate, actor domain.ActorAble,
@@ -64,15 +78,28 @@ func (self ActorTransferBalance) Execute(paramLog *basic.ParamLog, corporate dom
 
 	var statements []domain.Statement
 
-	err = validateCurrency(paramLog, fromBalance, toBalance)
+	currency := corporate.Currency
+	if !domain.IsSameCurrency(fromBalance.Currency, toBalance.Currency) {
+		currency = fromBalance.Currency
+	}
+
+	subAmountMoney, err := usecase.LegacyMoney(paramLog, self.subAmount, currency)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	transaction, transactionStatement := createTransaction(self.corporate, self.fromBalance, self.actor, self.from, self.to,
-		self.toBalance, self.subAmount, self.externalID, isTopupType, requestId)
+	fx, credit, err := usecase.ConvertBalanceAmount(paramLog, corporate, fromBalance, toBalance, subAmountMoney, self.fxQuoteID)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, transaction)
+	transaction, transactionStatement, err := createTransaction(paramLog, self.corporate, self.fromBalance, self.actor, self.from, self.to,
+		self.toBalance, subAmountMoney, credit, fx, self.feeQuoteID, self.externalID, isTopupType, requestId)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, &transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
@@ -92,29 +119,38 @@ func (self ActorTransferBalance) Execute(paramLog *basic.ParamLog, corporate dom
 		}
 	}
 
-	err = validationTransaction(paramLog, transaction)
+	err = usecase.CheckLimits(paramLog, transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	err = self.transactionUsecase.WithWebhooks(usecase.TopupWebhook(corporate, toBalance, transaction)).
+		Commit(paramLog, statements, &transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	go usecase.PublishTopupCallback(paramLog, corporate, toBalance, transaction)
-
 	return transaction, nil
 }
 
-func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
-	to domain.TransactionObject, toBalance domain.Balance, subAmount int, externalID string, isTopupType bool, requestId string) (domain.Transaction, []domain.Statement) {
+func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, fromBalance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
+	to domain.TransactionObject, toBalance domain.Balance, subAmount domain.Money, credit domain.Money, fx *domain.TransactionFX,
+	feeQuoteID string, externalID string, isTopupType bool, requestId string) (domain.Transaction, []domain.Statement, error) {
 
-	totalFee := 0
-	if actor.GetActorType() == domain.ACTOR_TYPE_USER {
-		totalFee = corporate.FeeUser.TransferBalance
-	} else {
-		totalFee = corporate.FeeCorporate.TransferBalance
+	payer, payerID := usecase.FeePayer(actor.GetActorType(), actor.GetActorID(), corporate)
+	totalFee, detailsFee, err := usecase.QuotedTransactionFee(paramLog, feeQuoteID, corporate, payer, payerID, domain.TRANSFER_WALLET, subAmount)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, err
+	}
+
+	amount, err := subAmount.Add(totalFee)
+	if err != nil {
+		return domain.Transaction{}, []domain.Statement{}, usecase.MoneyError(paramLog, err)
+	}
+
+	currency := corporate.Currency
+	if fx != nil {
+		currency = fx.FromCurrency
 	}
 
 	transactionType := domain.TRANSFER_WALLET
@@ -133,15 +169,18 @@ func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, a
 		Actor:           actor.ToTransactionObject(),
 		From:            from,
 		To:              to,
-		TotalFee:        totalFee,
-		SubAmount:       subAmount,
-		Amount:          subAmount + totalFee,
+		DetailsFee:      detailsFee,
+		FeeQuoteID:      feeQuoteID,
+		TotalFee:        totalFee.Legacy(),
+		SubAmount:       subAmount.Legacy(),
+		Amount:          amount.Legacy(),
 		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:           "",
 		Status:          domain.COMPLETED_STATUS,
 		Unpaid:          false,
 		ExternalID:      externalID,
-		Currency:        corporate.Currency,
+		Currency:        currency,
+		FX:              fx,
 		RequestId:       requestId,
 	}
 
@@ -151,12 +190,16 @@ func createTransaction(corporate domain.Corporate, fromBalance domain.Balance, a
 		fromBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
 
 	toStatement := service.DepositTransactionStatement(
-		toBalance.ID, transaction.Time, transaction.TransactionCode, subAmount)
+		toBalance.ID, transaction.Time, transaction.TransactionCode, credit)
+	if fx != nil {
+		toStatement = service.DepositConversionStatement(
+			toBalance.ID, transaction.Time, transaction.TransactionCode, credit, *fx)
+	}
 
 	statements = append(statements, fromStatement)
 	statements = append(statements, toStatement)
 
-	return transaction, statements
+	return transaction, statements, nil
 }
 
 func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance, error) {
@@ -206,17 +249,3 @@ func validationActorCorporate(paramLog *basic.ParamLog, actor domain.ActorAble,
 
 	return nil
 }
-
-func validationTransaction(paramLog *basic.ParamLog, transaction domain.Transaction) error {
-	err := validateMaximum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	err = validateMinimum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
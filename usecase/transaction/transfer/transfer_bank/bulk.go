@@ -136,6 +136,11 @@ func executeBulkInquiry(paramLog *basic.ParamLog, corporate domain.Corporate, ac
 			a.Number = inq.Number
 			a.Valid = true
 			a.Reason = ""
+			if inq.AccountName != "" {
+				match := usecase.MatchName(inq.AccountName, bank.Name)
+				a.NameScore = match.Score
+				a.NameDecision = match.Decision
+			}
 			result = append(result, a)
 		}
 	}
@@ -0,0 +1,55 @@
+package transfer_bank
+
+import (
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/usecase/transaction"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transfers created before holds existed were posted on commit, they have nothing to capture
+func captureTransferBank(paramLog *basic.ParamLog, trx domain.Transaction) error {
+	hold, err := service.HoldByTransactionCodeNoSession(paramLog, trx.TransactionCode)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return transaction.Base{}.CaptureHold(paramLog, hold.ID.Hex(), trx)
+}
+
+// A failed suspense refund puts its money back on the suspense balance, its item is open again
+func releaseTransferBank(paramLog *basic.ParamLog, trx domain.Transaction) error {
+	err := releaseTransferBankFunds(paramLog, trx)
+	if err != nil {
+		return err
+	}
+
+	usecase.ReopenSuspenseRefund(paramLog, trx)
+
+	return nil
+}
+
+// An uncaptured hold is simply released, only posted transfers need the rollback statements
+func releaseTransferBankFunds(paramLog *basic.ParamLog, trx domain.Transaction) error {
+	hold, err := service.HoldByTransactionCodeNoSession(paramLog, trx.TransactionCode)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err == nil && hold.Status != domain.HOLD_CAPTURED_STATUS {
+		return usecase.ReleaseHold(paramLog, hold.ID.Hex(), domain.HOLD_RELEASED_STATUS)
+	}
+
+	rollbackUsecase := RollbackTransferBank{}
+	err = rollbackUsecase.Initialize(trx)
+	if err != nil {
+		return err
+	}
+
+	return rollbackUsecase.ExecuteRollback(paramLog)
+}
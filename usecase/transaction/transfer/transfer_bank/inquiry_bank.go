@@ -1,21 +1,157 @@
 package transfer_bank
 
 import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
+	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_BANK_INQUIRY_TTL_SECOND         = 604800
+	DEFAULT_BANK_INQUIRY_INVALID_TTL_SECOND = 3600
 )
 
+// Whether transfers check the beneficiary name, set by NAME_MATCH_MODE
+const (
+	NAME_MATCH_MODE_OFF   = "OFF"
+	NAME_MATCH_MODE_FLAG  = "FLAG"
+	NAME_MATCH_MODE_BLOCK = "BLOCK"
+)
+
+// InquiryBankAccount answers the holder of the account from the cache when it can, an account the
+// gateway found invalid is answered with the same error until its shorter cache expires
 func InquiryBankAccount(paramLog *basic.ParamLog, accountNumber string, bankCode string, requestId string) (domain.Bank, error) {
-	// gateway := gateway.OYGateway{}
-	gateway := gateway.PermataGateway{}
+	now := time.Now()
+	cached, err := service.BankInquiryCachedNoSession(bankCode, accountNumber, now.Unix())
+	if err == nil {
+		if !cached.Valid {
+			return domain.Bank{}, utils.ErrorBadRequest(paramLog, cached.ErrorCode, "Cached invalid bank account "+cached.ID)
+		}
+
+		return domain.CreateBank(bankCode, cached.AccountName, accountNumber), nil
+	}
+	if err != mongo.ErrNoDocuments {
+		basic.LogError2(paramLog, "BankInquiryCachedNoSession", err)
+	}
+
+	inquiryGateway, _ := gateway.Get(gateway.Permata)
+
+	result, err := inquiryGateway.Inquiry(context.Background(), paramLog, gateway.InquiryRequest{
+		BankCode:      bankCode,
+		AccountNumber: accountNumber,
+	}, gateway.WithRequestID(requestId))
+
+	inquiry := domain.BankInquiry{
+		ID:            domain.BankInquiryID(bankCode, accountNumber),
+		BankCode:      bankCode,
+		AccountNumber: accountNumber,
+		Time:          now.Format(os.Getenv("TIME_FORMAT")),
+	}
 
-	accountName, err := gateway.Inquiry(paramLog, bankCode, accountNumber, requestId)
 	if err != nil {
+		customError, ok := err.(utils.CustomError)
+		if ok && (customError.Code == utils.InquiryAccountHolderNameNotFound || customError.Code == utils.BankCodeNotFound) {
+			inquiry.ErrorCode = customError.Code
+			inquiry.ExpiresAt = now.Add(inquiryTTL("BANK_INQUIRY_INVALID_TTL_SECOND", DEFAULT_BANK_INQUIRY_INVALID_TTL_SECOND)).Unix()
+			cacheBankInquiry(paramLog, inquiry)
+		}
+
 		return domain.Bank{}, err
 	}
 
-	bank := domain.CreateBank(bankCode, accountName, accountNumber)
+	inquiry.AccountName = result.AccountName
+	inquiry.Valid = true
+	inquiry.ExpiresAt = now.Add(inquiryTTL("BANK_INQUIRY_TTL_SECOND", DEFAULT_BANK_INQUIRY_TTL_SECOND)).Unix()
+	cacheBankInquiry(paramLog, inquiry)
+
+	bank := domain.CreateBank(bankCode, result.AccountName, accountNumber)
 
 	return bank, nil
 }
+
+// InquiryBankAccountMatch inquires the account and scores its holder against the name typed by the sender
+func InquiryBankAccountMatch(paramLog *basic.ParamLog, accountNumber string, bankCode string, expectedName string,
+	requestId string) (domain.Bank, domain.NameMatch, error) {
+	bank, err := InquiryBankAccount(paramLog, accountNumber, bankCode, requestId)
+	if err != nil {
+		return domain.Bank{}, domain.NameMatch{}, err
+	}
+
+	return bank, usecase.MatchName(expectedName, bank.Name), nil
+}
+
+// checkBeneficiaryName compares the holder of the destination account with the name the sender typed,
+// or the name the user saved the account under. Depending on NAME_MATCH_MODE a mismatch blocks the
+// transfer or only flags it, an inquiry that could not be made never blocks.
+func checkBeneficiaryName(paramLog *basic.ParamLog, actor domain.ActorAble, to domain.TransactionObject,
+	requestId string) (*domain.NameMatch, error) {
+	mode := os.Getenv("NAME_MATCH_MODE")
+	if mode != NAME_MATCH_MODE_FLAG && mode != NAME_MATCH_MODE_BLOCK {
+		return nil, nil
+	}
+
+	expected := to.Name
+	if expected == "" && actor.GetActorType() == domain.ACTOR_TYPE_USER {
+		user, err := service.UserByIDNoSession(paramLog, actor.GetActorID().Hex())
+		if err == nil {
+			expected = savedBankAccountName(user, to)
+		}
+	}
+	if expected == "" {
+		return nil, nil
+	}
+
+	bank, err := InquiryBankAccount(paramLog, to.AccountNumber, to.InstitutionCode, requestId)
+	if err != nil {
+		customError, ok := err.(utils.CustomError)
+		invalid := ok && (customError.Code == utils.InquiryAccountHolderNameNotFound || customError.Code == utils.BankCodeNotFound)
+		if invalid && mode == NAME_MATCH_MODE_BLOCK {
+			return nil, err
+		}
+
+		return &domain.NameMatch{Expected: expected, Decision: domain.NAME_MATCH_FLAG, Reason: "Inquiry failed"}, nil
+	}
+
+	match := usecase.MatchName(expected, bank.Name)
+	if match.Decision == domain.NAME_MATCH_BLOCK && mode == NAME_MATCH_MODE_BLOCK {
+		return nil, utils.ErrorBadRequest(paramLog, utils.BeneficiaryNameMismatch,
+			"Beneficiary name "+bank.Name+" does not match "+expected+" score "+strconv.Itoa(match.Score))
+	}
+
+	return &match, nil
+}
+
+func savedBankAccountName(user domain.User, to domain.TransactionObject) string {
+	for _, saved := range user.SavedBankAccount {
+		if saved.BankCode == to.InstitutionCode && saved.AccountNumber == to.AccountNumber {
+			return saved.Name
+		}
+	}
+
+	return ""
+}
+
+func cacheBankInquiry(paramLog *basic.ParamLog, inquiry domain.BankInquiry) {
+	err := service.BankInquirySet(paramLog, inquiry)
+	if err != nil {
+		basic.LogError2(paramLog, "BankInquirySet", err)
+	}
+}
+
+func inquiryTTL(name string, fallback int) time.Duration {
+	second, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || second <= 0 {
+		second = fallback
+	}
+
+	return time.Duration(second) * time.Second
+}
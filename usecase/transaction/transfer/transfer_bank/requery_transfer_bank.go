@@ -0,0 +1,249 @@
+package transfer_bank
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_TRANSFER_REQUERY_AFTER_SECOND       = 900
+	DEFAULT_TRANSFER_REQUERY_BACKOFF_SECOND     = 300
+	DEFAULT_TRANSFER_REQUERY_MAX_BACKOFF_SECOND = 21600
+	DEFAULT_TRANSFER_REQUERY_MAX_ATTEMPTS       = 8
+	TRANSFER_REQUERY_LEASE_SECOND               = 120
+	TRANSFER_REQUERY_CALL_TIMEOUT_SECOND        = 30
+)
+
+// RunTransferRequery asks the gateways again for the bank transfers still pending past the threshold
+// and settles the answer under the same claim as the callback would. A transfer the gateway still
+// reports pending, or could not be asked about, is retried with backoff and escalated for manual
+// review after too many attempts.
+func RunTransferRequery(paramLog *basic.ParamLog) (dto.TransferRequeryReport, error) {
+	report := dto.TransferRequeryReport{}
+
+	now := time.Now()
+	transactions, err := service.TransactionsPendingTransferBefore(paramLog, now.Add(-requeryAfter()))
+	if err != nil {
+		return report, err
+	}
+
+	for _, transaction := range transactions {
+		requery := domain.TransferRequery{
+			ID:        transaction.TransactionCode,
+			Gateway:   transaction.Gateway,
+			Reference: transaction.GatewayReference,
+			Time:      now.Format(os.Getenv("TIME_FORMAT")),
+		}
+
+		claimed, err := service.TransferRequeryClaim(paramLog, requery, now.Unix(), now.Unix()+TRANSFER_REQUERY_LEASE_SECOND)
+		if err != nil {
+			basic.LogError2(paramLog, "TransferRequeryClaim", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		requery, err = service.TransferRequeryByCodeNoSession(transaction.TransactionCode)
+		if err != nil {
+			basic.LogError2(paramLog, "TransferRequeryByCodeNoSession", err)
+			continue
+		}
+
+		report.Checked = report.Checked + 1
+		requery = requeryTransfer(paramLog, requery, transaction)
+
+		err = service.TransferRequerySet(paramLog, requery)
+		if err != nil {
+			basic.LogError2(paramLog, "TransferRequerySet", err)
+		}
+
+		switch requery.Status {
+		case domain.REQUERY_RESOLVED:
+			report.Resolved = report.Resolved + 1
+		case domain.REQUERY_ESCALATED:
+			report.Escalated = report.Escalated + 1
+		default:
+			report.Pending = report.Pending + 1
+		}
+	}
+
+	basic.LogInformation2(paramLog, "RunTransferRequery", report)
+
+	return report, nil
+}
+
+func requeryTransfer(paramLog *basic.ParamLog, requery domain.TransferRequery, transaction domain.Transaction) domain.TransferRequery {
+	now := time.Now()
+	requery.Time = now.Format(os.Getenv("TIME_FORMAT"))
+
+	// The transfer moved to another gateway since it was last asked about, follow it from the start
+	if requery.Reference != transaction.GatewayReference || requery.Gateway != transaction.Gateway {
+		requery.Gateway = transaction.Gateway
+		requery.Reference = transaction.GatewayReference
+		requery.Attempts = 0
+	}
+
+	statusGateway, ok := gateway.Get(transaction.Gateway)
+	if !ok || !statusGateway.Capabilities().TransferStatus {
+		requery.Status = domain.REQUERY_ESCALATED
+		requery.EscalatedReason = "Gateway " + transaction.Gateway + " cannot be asked for the transfer status"
+		return requery
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRANSFER_REQUERY_CALL_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
+	result, err := statusGateway.TransferStatus(ctx, paramLog, transaction, gateway.WithRequestID(transaction.RequestId))
+	if err == nil {
+		requery.GatewayStatus = result.Status
+		requery.LastError = ""
+	}
+	if err == nil && result.Status != domain.PENDING_STATUS {
+		_, err = TransferBank{}.processTransferStatusOnce(paramLog, transaction.Gateway, transaction.TransactionCode,
+			transaction.GatewayReference, result.Status, transaction.RequestId)
+	}
+	if err != nil {
+		requery.LastError = err.Error()
+		return backoffRequery(requery, now)
+	}
+	if result.Status == domain.PENDING_STATUS {
+		return backoffRequery(requery, now)
+	}
+
+	return settledRequery(paramLog, requery, transaction.TransactionCode, now)
+}
+
+func settledRequery(paramLog *basic.ParamLog, requery domain.TransferRequery, transactionCode string, now time.Time) domain.TransferRequery {
+	updated, err := service.TransactionByCodeNoSession(paramLog, transactionCode)
+	if err != nil {
+		requery.LastError = err.Error()
+		return backoffRequery(requery, now)
+	}
+
+	// A failed transfer handed to the next gateway is pending again there
+	if updated.Status == domain.PENDING_STATUS {
+		requery.Gateway = updated.Gateway
+		requery.Reference = updated.GatewayReference
+		requery.Attempts = 0
+		requery.Status = domain.REQUERY_ACTIVE
+		requery.NextAt = now.Add(requeryAfter()).Unix()
+		requery.EscalatedReason = ""
+		return requery
+	}
+
+	requery.Status = domain.REQUERY_RESOLVED
+	return requery
+}
+
+func backoffRequery(requery domain.TransferRequery, now time.Time) domain.TransferRequery {
+	requery.Attempts = requery.Attempts + 1
+	if requery.Attempts >= utils.EnvInt("TRANSFER_REQUERY_MAX_ATTEMPTS", DEFAULT_TRANSFER_REQUERY_MAX_ATTEMPTS) {
+		requery.Status = domain.REQUERY_ESCALATED
+		requery.EscalatedReason = fmt.Sprintf("Still unresolved after %v attempts", requery.Attempts)
+		return requery
+	}
+
+	backoff := utils.ExponentialBackoff(requery.Attempts,
+		utils.EnvSecond("TRANSFER_REQUERY_BACKOFF_SECOND", DEFAULT_TRANSFER_REQUERY_BACKOFF_SECOND),
+		utils.EnvSecond("TRANSFER_REQUERY_MAX_BACKOFF_SECOND", DEFAULT_TRANSFER_REQUERY_MAX_BACKOFF_SECOND))
+
+	requery.Status = domain.REQUERY_ACTIVE
+	requery.NextAt = now.Add(backoff).Unix()
+
+	return requery
+}
+
+// TransferRequeriesEscalated lists the transfers waiting for manual review
+func TransferRequeriesEscalated(paramLog *basic.ParamLog, page string, limit string) ([]domain.TransferRequery, error) {
+	return service.TransferRequeriesByStatusNoSession(paramLog, domain.REQUERY_ESCALATED, page, limit)
+}
+
+// RetryTransferRequery puts an escalated transfer back in the requery from its first attempt
+func RetryTransferRequery(paramLog *basic.ParamLog, transactionCode string) (domain.TransferRequery, error) {
+	requery, err := escalatedRequery(paramLog, transactionCode)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	requery.Status = domain.REQUERY_ACTIVE
+	requery.Attempts = 0
+	requery.NextAt = 0
+	requery.EscalatedReason = ""
+	requery.Time = time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+	err = service.TransferRequerySet(paramLog, requery)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	return requery, nil
+}
+
+// ResolveTransferRequery settles an escalated transfer with the status an operator confirmed with the
+// gateway, under the same claim as a callback of that status
+func ResolveTransferRequery(paramLog *basic.ParamLog, transactionCode string, status string, requestId string) (domain.TransferRequery, error) {
+	if status != domain.COMPLETED_STATUS && status != domain.FAILED_STATUS {
+		return domain.TransferRequery{}, utils.ErrorBadRequest(paramLog, utils.InvalidTransferRequery,
+			"Transfer requery can only be resolved as Completed or Failed")
+	}
+
+	requery, err := escalatedRequery(paramLog, transactionCode)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	transaction, err := service.TransactionPendingByCodeNoSession(paramLog, transactionCode)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	_, err = TransferBank{}.processTransferStatusOnce(paramLog, transaction.Gateway, transaction.TransactionCode,
+		transaction.GatewayReference, status, requestId)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	now := time.Now()
+	requery.GatewayStatus = status
+	requery.Time = now.Format(os.Getenv("TIME_FORMAT"))
+	requery = settledRequery(paramLog, requery, transactionCode, now)
+
+	err = service.TransferRequerySet(paramLog, requery)
+	if err != nil {
+		return domain.TransferRequery{}, err
+	}
+
+	return requery, nil
+}
+
+func escalatedRequery(paramLog *basic.ParamLog, transactionCode string) (domain.TransferRequery, error) {
+	requery, err := service.TransferRequeryByCodeNoSession(transactionCode)
+	if err == mongo.ErrNoDocuments {
+		return domain.TransferRequery{}, utils.ErrorBadRequest(paramLog, utils.InvalidTransferRequery, "Transfer requery not found")
+	}
+	if err != nil {
+		return domain.TransferRequery{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	if requery.Status != domain.REQUERY_ESCALATED {
+		return domain.TransferRequery{}, utils.ErrorBadRequest(paramLog, utils.InvalidTransferRequery,
+			"Transfer requery is not escalated")
+	}
+
+	return requery, nil
+}
+
+func requeryAfter() time.Duration {
+	return utils.EnvSecond("TRANSFER_REQUERY_AFTER_SECOND", DEFAULT_TRANSFER_REQUERY_AFTER_SECOND)
+}
@@ -0,0 +1,115 @@
+package transfer_bank
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+)
+
+const testStatusGateway = "STATUS-TEST"
+
+// testGateway still reports every transfer pending, or fails to answer while unreachable is set
+type testGateway struct {
+	unreachable *bool
+}
+
+func init() {
+	gateway.Register(testGateway{unreachable: new(bool)})
+}
+
+func (g testGateway) Name() string { return testStatusGateway }
+
+func (g testGateway) Capabilities() gateway.Capabilities {
+	return gateway.Capabilities{Transfer: true, TransferStatus: true}
+}
+
+func (g testGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request gateway.VARequest, opts ...gateway.Option) (gateway.VAResult, error) {
+	return gateway.VAResult{}, nil
+}
+
+func (g testGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (gateway.VACallback, error) {
+	return gateway.VACallback{}, nil
+}
+
+func (g testGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va gateway.VAResult, opts ...gateway.Option) error {
+	return nil
+}
+
+func (g testGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...gateway.Option) (gateway.TransferResult, error) {
+	return gateway.TransferResult{}, nil
+}
+
+func (g testGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (gateway.TransferCallback, error) {
+	return gateway.TransferCallback{}, nil
+}
+
+func (g testGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...gateway.Option) (gateway.TransferCallback, error) {
+	if *g.unreachable {
+		return gateway.TransferCallback{}, errors.New("gateway unreachable")
+	}
+
+	return gateway.TransferCallback{Status: domain.PENDING_STATUS}, nil
+}
+
+func (g testGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request gateway.InquiryRequest, opts ...gateway.Option) (gateway.InquiryResult, error) {
+	return gateway.InquiryResult{}, nil
+}
+
+func TestRequeryTransferStillPending(t *testing.T) {
+	t.Setenv("TRANSFER_REQUERY_MAX_ATTEMPTS", "3")
+
+	transaction := domain.Transaction{TransactionCode: "TRX0001", Gateway: testStatusGateway, GatewayReference: "REF1"}
+	requery := domain.TransferRequery{ID: transaction.TransactionCode, Gateway: testStatusGateway, Reference: "REF1"}
+
+	for attempt := 1; attempt < 3; attempt++ {
+		requery = requeryTransfer(nil, requery, transaction)
+		if requery.Status != domain.REQUERY_ACTIVE || requery.Attempts != attempt || requery.NextAt == 0 ||
+			requery.GatewayStatus != domain.PENDING_STATUS {
+			t.Fatalf("attempt %v: got %v after %v attempts, want active with backoff", attempt, requery.Status, requery.Attempts)
+		}
+	}
+
+	requery = requeryTransfer(nil, requery, transaction)
+	if requery.Status != domain.REQUERY_ESCALATED || requery.EscalatedReason == "" {
+		t.Errorf("attempt 3: got %v %q, want escalated with a reason", requery.Status, requery.EscalatedReason)
+	}
+}
+
+func TestRequeryTransferUnreachable(t *testing.T) {
+	test, _ := gateway.Get(testStatusGateway)
+	*test.(testGateway).unreachable = true
+	defer func() { *test.(testGateway).unreachable = false }()
+
+	transaction := domain.Transaction{TransactionCode: "TRX0002", Gateway: testStatusGateway, GatewayReference: "REF2"}
+	requery := domain.TransferRequery{ID: transaction.TransactionCode, Gateway: testStatusGateway, Reference: "REF2"}
+
+	requery = requeryTransfer(nil, requery, transaction)
+	if requery.Status != domain.REQUERY_ACTIVE || requery.Attempts != 1 || requery.LastError == "" {
+		t.Errorf("got %v after %v attempts with error %q, want a retry", requery.Status, requery.Attempts, requery.LastError)
+	}
+}
+
+func TestRequeryTransferMovedGateway(t *testing.T) {
+	transaction := domain.Transaction{TransactionCode: "TRX0003", Gateway: testStatusGateway, GatewayReference: "REF3"}
+	requery := domain.TransferRequery{ID: transaction.TransactionCode, Gateway: gateway.OY, Reference: "OLD", Attempts: 5}
+
+	requery = requeryTransfer(nil, requery, transaction)
+	if requery.Gateway != testStatusGateway || requery.Reference != "REF3" || requery.Attempts != 1 {
+		t.Errorf("got %v %v after %v attempts, want the new gateway asked from its first attempt", requery.Gateway,
+			requery.Reference, requery.Attempts)
+	}
+}
+
+func TestRequeryTransferWithoutStatusCheck(t *testing.T) {
+	transaction := domain.Transaction{TransactionCode: "TRX0004", Gateway: gateway.Stripe}
+
+	requery := requeryTransfer(nil, domain.TransferRequery{ID: transaction.TransactionCode}, transaction)
+	if requery.Status != domain.REQUERY_ESCALATED || requery.EscalatedReason == "" {
+		t.Errorf("got %v %q, want escalated for manual review", requery.Status, requery.EscalatedReason)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/usecase"
 	"github.com/kangdjoker/takeme-core/usecase/transaction"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 )
@@ -39,11 +40,16 @@ func (self *RollbackTransferBank) Initialize(rollbackTransaction domain.Transact
 }
 
 func (self *RollbackTransferBank) ExecuteRollback(paramLog *basic.ParamLog) error {
+	subAmount, err := usecase.LegacyMoney(paramLog, self.transaction.SubAmount, self.transaction.Currency)
+	if err != nil {
+		return err
+	}
+
 	transactionStatement := service.DepositTransactionStatement(
 		self.balance.ID, time.Now().Format(os.Getenv("TIME_FORMAT")),
 		self.transaction.TransactionCode,
-		self.transaction.SubAmount)
-	transactionStatement.Reference = transactionStatement.Reference + ":rollback"
+		subAmount)
+	transactionStatement.Reference = transactionStatement.Reference + domain.STATEMENT_ROLLBACK_SUFFIX
 	basic.LogInformation2(paramLog, "transactionStatement", transactionStatement)
 
 	basic.LogInformation(paramLog, "RollbackFeeStatement")
@@ -59,7 +65,7 @@ func (self *RollbackTransferBank) ExecuteRollback(paramLog *basic.ParamLog) erro
 	statements = append(statements, feeStatements...)
 
 	basic.LogInformation(paramLog, "CommitRollback")
-	err = self.transactionUsecase.CommitRollback(paramLog, statements)
+	err = self.transactionUsecase.CommitRollback(paramLog, statements, self.transaction)
 	if err != nil {
 		basic.LogError2(paramLog, "CommitRollback.Error", err)
 		return err
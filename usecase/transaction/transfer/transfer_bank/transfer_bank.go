@@ -22,95 +22,48 @@ import (
 )
 
 type TransferBank struct {
+	webhookCorporate *domain.Corporate
 }
 
-func (self TransferBank) SetupGateway(transaction *domain.Transaction) {
-	if true {
-		transaction.GatewayStrategies = []domain.GatewayStrategy{
-			{
-				Code:       gateway.Permata,
-				IsExecuted: false,
-			},
-		}
-	} else if transaction.To.AccountNumber == "8691577392" && transaction.To.InstitutionCode == utils.BCA {
-		transaction.GatewayStrategies = []domain.GatewayStrategy{
-			{
-				Code:       gateway.Xendit,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.MMBC,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.OY,
-				IsExecuted: false,
-			},
-		}
-	} else if transaction.To.InstitutionCode == utils.ALADIN {
-		transaction.GatewayStrategies = []domain.GatewayStrategy{
-			{
-				Code:       gateway.Xendit,
-				IsExecuted: false,
-			},
-		}
-	} else if transaction.To.InstitutionCode == utils.OCBC || transaction.To.InstitutionCode == utils.DKI ||
-		transaction.To.InstitutionCode == utils.JAWA_BARAT || transaction.To.InstitutionCode == utils.BTN {
-
-		transaction.GatewayStrategies = []domain.GatewayStrategy{
-			{
-				Code:       gateway.MMBC,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.OY,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.Xendit,
-				IsExecuted: false,
-			},
-		}
-	} else {
+// WithTransferWebhook tells the corporate the status CreateTransferGateway leaves the transfer in,
+// the webhook is saved with that status
+func (self TransferBank) WithTransferWebhook(corporate domain.Corporate) TransferBank {
+	self.webhookCorporate = &corporate
+	return self
+}
 
-		transaction.GatewayStrategies = []domain.GatewayStrategy{
-			{
-				Code:       gateway.OY,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.MMBC,
-				IsExecuted: false,
-			},
-			{
-				Code:       gateway.Xendit,
-				IsExecuted: false,
-			},
-		}
+// SetupGateway orders the gateways the transfer is tried on with the routing rules in use
+func (self TransferBank) SetupGateway(paramLog *basic.ParamLog, transaction *domain.Transaction) error {
+	strategies, version, err := usecase.TransferGatewayStrategies(paramLog, *transaction)
+	if err != nil {
+		return err
 	}
+
+	transaction.GatewayStrategies = strategies
+	transaction.GatewayRouting = version
+
+	return nil
 }
 
 func (self TransferBank) CreateTransferGateway(paramLog *basic.ParamLog, transaction *domain.Transaction, requestID string) error {
-	oy := gateway.OYGateway{}
-	mmbc := gateway.MMBCGateway{}
-	xendit := gateway.XenditGateway{}
-	permata := gateway.PermataGateway{}
-
 	reference := ""
 	var err error
-	gatewayCode := changeGatewayStrategy(transaction)
+	gatewayCode := changeGatewayStrategy(paramLog, transaction)
 	basic.LogInformation(paramLog, "gatewayCode:"+gatewayCode)
 
-	switch gatewayCode {
-	case gateway.OY:
-		reference, err = oy.CreateTransfer(paramLog, *transaction)
-	case gateway.Permata:
-		reference, err = permata.CreateTransfer(paramLog, transaction, requestID)
-	case gateway.MMBC:
-		reference, err = mmbc.CreateTransfer(paramLog, *transaction)
-	case gateway.Xendit:
-		reference, err = xendit.CreateTransfer(paramLog, *transaction)
+	transferGateway, ok := gateway.Get(gatewayCode)
+	if !ok {
+		gatewayCode = ""
 	}
+
+	if gatewayCode != "" {
+		start := time.Now()
+		var result gateway.TransferResult
+		result, err = transferGateway.CreateTransfer(context.Background(), paramLog, *transaction, gateway.WithRequestID(requestID))
+		reference = result.Reference
+		usecase.RecordGatewayCall(paramLog, gatewayCode, transaction.To.InstitutionCode, time.Since(start), err)
+	}
+
 	rollback := false
 	basic.LogInformation(paramLog, "reference:"+reference)
 	if err != nil {
@@ -134,13 +87,28 @@ func (self TransferBank) CreateTransferGateway(paramLog *basic.ParamLog, transac
 	if gatewayCode == "" || rollback {
 		basic.LogInformation(paramLog, "doing rollback")
 		transaction.Status = domain.FAILED_STATUS
-		rollbackUsecase := RollbackTransferBank{}
-		rollbackUsecase.Initialize(*transaction)
-		rollbackUsecase.ExecuteRollback(paramLog)
+		releaseErr := releaseTransferBank(paramLog, *transaction)
+		if releaseErr != nil {
+			basic.LogError2(paramLog, "releaseTransferBank", releaseErr)
+		}
+	}
 
+	// A transfer paid out but not booked stays pending, the requery captures it again
+	if transaction.Status == domain.COMPLETED_STATUS {
+		captureErr := captureTransferBank(paramLog, *transaction)
+		if captureErr != nil {
+			basic.LogError2(paramLog, "captureTransferBank", captureErr)
+			transaction.Status = domain.PENDING_STATUS
+		}
 	}
 
-	commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies)
+	webhooks := []domain.Webhook{}
+	if self.webhookCorporate != nil {
+		webhooks = append(webhooks, usecase.TransferWebhook(*self.webhookCorporate, *transaction))
+	}
+
+	commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies,
+		webhooks)
 
 	// if err != nil {
 	// 	self.CreateTransferGateway(paramLog, transaction, requestID)
@@ -177,45 +145,94 @@ func (self TransferBank) ProcessCallbackGatewayTransfer(paramLog *basic.ParamLog
 	}
 
 	if nextGateway != "" && (status == domain.FAILED_STATUS || status == domain.REFUND_STATUS) {
-		err = self.CreateTransferGateway(paramLog, &transaction, requestId)
+		err = self.WithTransferWebhook(corporate).CreateTransferGateway(paramLog, &transaction, requestId)
 		return domain.Transaction{}, err
 	}
 
 	if nextGateway == "" && (status == domain.FAILED_STATUS || status == domain.REFUND_STATUS) {
 		transaction.Status = domain.FAILED_STATUS
-		commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies)
-
-		rollbackUsecase := RollbackTransferBank{}
-		rollbackUsecase.Initialize(transaction)
-		rollbackUsecase.ExecuteRollback(paramLog)
+		commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies,
+			[]domain.Webhook{usecase.TransferWebhook(corporate, transaction)})
 
-		go usecase.PublishTransferCallback(paramLog, corporate, transaction)
+		err = releaseTransferBank(paramLog, transaction)
+		if err != nil {
+			basic.LogError2(paramLog, "releaseTransferBank", err)
+		}
 
 		return domain.Transaction{}, nil
 	}
 
-	transaction.Status = domain.COMPLETED_STATUS
-	commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies)
+	err = captureTransferBank(paramLog, transaction)
+	if err != nil {
+		basic.LogError2(paramLog, "captureTransferBank", err)
+		return domain.Transaction{}, err
+	}
 
-	go usecase.PublishTransferCallback(paramLog, corporate, transaction)
+	transaction.Status = domain.COMPLETED_STATUS
+	commitTransactionGateway(paramLog, transaction.ID.Hex(), transaction.Status, gatewayCode, reference, transaction.GatewayStrategies,
+		[]domain.Webhook{usecase.TransferWebhook(corporate, transaction)})
 
 	return transaction, nil
 }
 
-func changeGatewayStrategy(transaction *domain.Transaction) string {
-	gatewayCode := ""
+// ProcessCallbackGatewayTransferOnce processes a transfer callback once per gateway, reference and
+// status, a replay of the callback returns the transaction of the first delivery. A callback routed to
+// a partner is only forwarded to it.
+func (self TransferBank) ProcessCallbackGatewayTransferOnce(paramLog *basic.ParamLog, gatewayCode string,
+	callback gateway.TransferCallback, requestId string) (domain.Transaction, error) {
+	forwarded, err := usecase.ForwardPartnerCallback(paramLog, gatewayCode, domain.CALLBACK_EVENT_TRANSFER+callback.Status,
+		callback.TransactionCode, callback.Reference, callback.Payload)
+	if err != nil || forwarded {
+		return domain.Transaction{}, err
+	}
 
+	return self.processTransferStatusOnce(paramLog, gatewayCode, callback.TransactionCode, callback.Reference, callback.Status, requestId)
+}
+
+// processTransferStatusOnce settles the transfer with status under the claim of its callback, so the
+// callback, the requery and an operator can not settle the same status twice
+func (self TransferBank) processTransferStatusOnce(paramLog *basic.ParamLog, gatewayCode string, transactionCode string,
+	reference string, status string, requestId string) (domain.Transaction, error) {
+	result := domain.Transaction{}
+	err := usecase.ProcessCallbackOnce(paramLog, gatewayCode, reference, domain.CALLBACK_EVENT_TRANSFER+status, &result,
+		func() error {
+			transaction, err := self.ProcessCallbackGatewayTransfer(paramLog, gatewayCode, transactionCode, reference, status, requestId)
+			result = transaction
+			return err
+		})
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	return result, nil
+}
+
+// changeGatewayStrategy takes the next gateway not tried yet, skipping those the breaker keeps shut
+// unless no other is left
+func changeGatewayStrategy(paramLog *basic.ParamLog, transaction *domain.Transaction) string {
+	next := -1
 	for index, element := range transaction.GatewayStrategies {
+		if element.IsExecuted {
+			continue
+		}
 
-		if element.IsExecuted == false {
-			gatewayCode = element.Code
-			transaction.GatewayStrategies[index].IsExecuted = true
+		if next == -1 {
+			next = index
+		}
+
+		if usecase.AcquireGateway(paramLog, element.Code) {
+			next = index
 			break
 		}
+	}
 
+	if next == -1 {
+		return ""
 	}
 
-	return gatewayCode
+	transaction.GatewayStrategies[next].IsExecuted = true
+
+	return transaction.GatewayStrategies[next].Code
 }
 
 func checkUnexecutedGateway(transaction domain.Transaction) string {
@@ -233,7 +250,10 @@ func checkUnexecutedGateway(transaction domain.Transaction) string {
 	return gatewayCode
 }
 
-func commitTransactionGateway(paramLog *basic.ParamLog, transactionID string, status string, gatewayCode string, reference string, gatewayStrategy []domain.GatewayStrategy) {
+// commitTransactionGateway saves the status and gateway of the transfer with the webhooks telling
+// about it, and makes their first attempt once committed
+func commitTransactionGateway(paramLog *basic.ParamLog, transactionID string, status string, gatewayCode string, reference string,
+	gatewayStrategy []domain.GatewayStrategy, webhooks []domain.Webhook) {
 	function := func(session mongo.SessionContext) error {
 		err := session.StartTransaction(options.Transaction().
 			SetReadConcern(readconcern.Snapshot()).
@@ -271,6 +291,12 @@ func commitTransactionGateway(paramLog *basic.ParamLog, transactionID string, st
 			return err
 		}
 
+		err = usecase.SaveWebhooks(paramLog, webhooks, session)
+		if err != nil {
+			session.AbortTransaction(session)
+			return err
+		}
+
 		return database.CommitWithRetry(session)
 	}
 
@@ -283,5 +309,8 @@ func commitTransactionGateway(paramLog *basic.ParamLog, transactionID string, st
 
 	if err != nil {
 		basic.LogError(paramLog, fmt.Sprintf("Failed commit gateway transaction with id  %v because %v ", transactionID, err.Error()))
+		return
 	}
+
+	go usecase.DeliverWebhooks(paramLog, webhooks)
 }
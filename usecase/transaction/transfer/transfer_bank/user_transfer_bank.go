@@ -24,6 +24,13 @@ type UserTransferBank struct {
 	externalID         string
 	transactionUsecase transaction.Base
 	transferBankBase   TransferBank
+	feeQuoteID         string
+}
+
+// WithFeeQuote charges the fee shown by the quote
+func (self UserTransferBank) WithFeeQuote(quoteID string) UserTransferBank {
+	self.feeQuoteID = quoteID
+	return self
 }
 
 func (self UserTransferBank) Execute(paramLog *basic.ParamLog, corporate domain.Corporate, actor domain.ActorAble,
@@ -52,9 +59,13 @@ func (self UserTransferBank) Execute(paramLog *basic.ParamLog, corporate domain.
 
 	var statements []domain.Statement
 
-	transaction, transactionStatement := createTransaction(self.corporate, self.fromBalance, self.actor, self.from, to, subAmount, notes, externalID, requestId)
+	transaction, transactionStatement, err := createTransaction(paramLog, self.corporate, self.fromBalance, self.actor, self.from, to, subAmount,
+		self.feeQuoteID, notes, externalID, requestId)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
 
-	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, transaction)
+	feeStatement, err := self.transactionUsecase.CreateFeeStatement(paramLog, corporate, self.fromBalance, &transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
@@ -72,20 +83,27 @@ func (self UserTransferBank) Execute(paramLog *basic.ParamLog, corporate domain.
 		return domain.Transaction{}, err
 	}
 
-	err = validationTransaction(paramLog, transaction)
+	err = usecase.CheckLimits(paramLog, transaction)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
+
+	transaction.NameMatch, err = checkBeneficiaryName(paramLog, self.actor, to, requestId)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	self.transferBankBase.SetupGateway(&transaction)
+	err = self.transferBankBase.SetupGateway(paramLog, &transaction)
+	if err != nil {
+		return domain.Transaction{}, err
+	}
 
-	err = self.transactionUsecase.Commit(paramLog, statements, &transaction)
+	err = self.transactionUsecase.CommitHold(paramLog, statements, &transaction)
 	if err != nil {
 		return domain.Transaction{}, err
 	}
 
-	err = self.transferBankBase.CreateTransferGateway(paramLog, &transaction, requestId)
-	go usecase.PublishTransferCallback(paramLog, corporate, transaction)
+	err = self.transferBankBase.WithTransferWebhook(corporate).CreateTransferGateway(paramLog, &transaction, requestId)
 	return transaction, err
 }
 
@@ -98,14 +116,14 @@ func identifyBalance(paramLog *basic.ParamLog, balanceID string) (domain.Balance
 	return balance, nil
 }
 
-func createTransaction(corporate domain.Corporate, balance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
-	to domain.TransactionObject, subAmount int, notes string, externalID string, requestId string) (domain.Transaction, domain.Statement) {
+func createTransaction(paramLog *basic.ParamLog, corporate domain.Corporate, balance domain.Balance, actor domain.ActorAble, from domain.TransactionObject,
+	to domain.TransactionObject, subAmount int, feeQuoteID string, notes string, externalID string, requestId string) (domain.Transaction, domain.Statement, error) {
 
-	totalFee := 0
-	if actor.GetActorType() == domain.ACTOR_TYPE_USER {
-		totalFee = corporate.FeeUser.TransferBank
-	} else {
-		totalFee = corporate.FeeCorporate.TransferBank
+	payer, payerID := usecase.FeePayer(actor.GetActorType(), actor.GetActorID(), corporate)
+	subAmountMoney, totalFee, detailsFee, amount, err := usecase.TransactionMoney(paramLog, feeQuoteID, corporate, payer, payerID,
+		domain.TRANSFER_BANK, subAmount, corporate.Currency)
+	if err != nil {
+		return domain.Transaction{}, domain.Statement{}, err
 	}
 
 	transcation := domain.Transaction{
@@ -118,9 +136,11 @@ func createTransaction(corporate domain.Corporate, balance domain.Balance, actor
 		Actor:            actor.ToTransactionObject(),
 		From:             from,
 		To:               to,
-		TotalFee:         totalFee,
-		SubAmount:        subAmount,
-		Amount:           subAmount + totalFee,
+		DetailsFee:       detailsFee,
+		FeeQuoteID:       feeQuoteID,
+		TotalFee:         totalFee.Legacy(),
+		SubAmount:        subAmountMoney.Legacy(),
+		Amount:           amount.Legacy(),
 		Time:             time.Now().Format(os.Getenv("TIME_FORMAT")),
 		Notes:            notes,
 		Status:           domain.PENDING_STATUS,
@@ -132,9 +152,9 @@ func createTransaction(corporate domain.Corporate, balance domain.Balance, actor
 	}
 
 	statement := service.WithdrawTransactionStatement(
-		balance.ID, transcation.Time, transcation.TransactionCode, subAmount)
+		balance.ID, transcation.Time, transcation.TransactionCode, subAmountMoney)
 
-	return transcation, statement
+	return transcation, statement, nil
 }
 
 func validationActor(paramLog *basic.ParamLog, actor domain.ActorAble, balanceID string, pin string) error {
@@ -156,17 +176,3 @@ func validationActor(paramLog *basic.ParamLog, actor domain.ActorAble, balanceID
 
 	return nil
 }
-
-func validationTransaction(paramLog *basic.ParamLog, transaction domain.Transaction) error {
-	err := validateMaximum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	err = validateMinimum(paramLog, transaction)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
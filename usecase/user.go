@@ -389,7 +389,7 @@ func UserMainBalanceVA(paramLog *basic.ParamLog, user domain.User) ([]domain.Vir
 			return err
 		}
 
-		va = balance.VA
+		va = balance.ActiveVA()
 
 		return nil
 	}
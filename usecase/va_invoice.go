@@ -0,0 +1,330 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const DEFAULT_VA_INVOICE_EXPIRY_SECOND = 86400
+
+// CreateVAInvoice opens a VA closed to amount that credits the balance of the corporate once, it
+// expires at expiresAt, a timestamp in TIME_FORMAT, or after VA_INVOICE_EXPIRY_SECOND when empty.
+// A payment that does not match is rejected or suspended as onMismatch says, suspended by default.
+func CreateVAInvoice(paramLog *basic.ParamLog, corporate domain.Corporate, balanceID string, externalID string,
+	bankCode string, amount int, expiresAt string, onMismatch string) (domain.VAInvoice, error) {
+	if externalID == "" || bankCode == "" || amount <= 0 {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice,
+			"External id, bank code and a positive amount are required")
+	}
+
+	if onMismatch == "" {
+		onMismatch = domain.VA_INVOICE_MISMATCH_SUSPEND
+	}
+	if onMismatch != domain.VA_INVOICE_MISMATCH_REJECT && onMismatch != domain.VA_INVOICE_MISMATCH_SUSPEND {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice, "Unknown mismatch action "+onMismatch)
+	}
+
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil || balance.CorporateID != corporate.ID {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	if !balance.CanCredit() {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.BalanceFrozen, "Balance "+balance.CurrentStatus()+" "+balanceID)
+	}
+
+	now := time.Now()
+	expiry := now.Add(vaInvoiceExpiry())
+	if expiresAt != "" {
+		expiry, err = utils.ParseTimestamp(expiresAt)
+		if err != nil || !expiry.After(now) {
+			return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice, "Expiry must be a future "+os.Getenv("TIME_FORMAT"))
+		}
+	}
+
+	_, err = service.VAInvoiceByExternalIDNoSession(corporate.ID, externalID)
+	if err == nil {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice, "External id already used "+externalID)
+	}
+	if err != mongo.ErrNoDocuments {
+		return domain.VAInvoice{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	_, providers := vaBankProviders()
+	provider := providers[bankCode]
+	if provider == "" {
+		provider = gateway.Xendit
+	}
+
+	providerGateway, ok := gateway.Get(provider)
+	if !ok || !providerGateway.Capabilities().VA {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount,
+			"Provider "+provider+" cannot create virtual accounts")
+	}
+
+	invoice := domain.VAInvoice{
+		ID:            primitive.NewObjectID(),
+		CorporateID:   corporate.ID,
+		BalanceID:     balance.ID,
+		ExternalID:    externalID,
+		Name:          corporate.Name,
+		BankCode:      bankCode,
+		Provider:      provider,
+		Amount:        amount,
+		Currency:      balance.Currency,
+		OnMismatch:    onMismatch,
+		Status:        domain.VA_INVOICE_PENDING,
+		ExpiresAt:     expiry.Format(os.Getenv("TIME_FORMAT")),
+		ExpiresAtUnix: expiry.Unix(),
+		Time:          now.Format(os.Getenv("TIME_FORMAT")),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), VA_PROVISION_CALL_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
+	result, err := providerGateway.CreateVA(ctx, paramLog, gateway.VARequest{
+		ExternalID: invoice.ID.Hex(),
+		Name:       invoice.Name,
+		BankCode:   bankCode,
+		Amount:     amount,
+		ExpiresAt:  expiry,
+	})
+	if err != nil {
+		return domain.VAInvoice{}, err
+	}
+	if result.AccountNumber == "" {
+		return domain.VAInvoice{}, utils.ErrorInternalServer(paramLog, utils.InvalidVirtualAccount,
+			"Provider "+provider+" answered without account number")
+	}
+
+	invoice.AccountNumber = result.AccountNumber
+	invoice.Reference = result.Reference
+
+	err = service.VAInvoiceSaveOne(paramLog, &invoice)
+	if err != nil {
+		closeInvoiceVA(paramLog, invoice)
+		return domain.VAInvoice{}, err
+	}
+
+	return invoice, nil
+}
+
+// CancelVAInvoice stops a pending invoice from being paid and closes its VA
+func CancelVAInvoice(paramLog *basic.ParamLog, corporate domain.Corporate, invoiceID string) (domain.VAInvoice, error) {
+	invoice, err := corporateVAInvoice(paramLog, corporate, invoiceID)
+	if err != nil {
+		return domain.VAInvoice{}, err
+	}
+
+	err = transitionVAInvoice(paramLog, &invoice, domain.VA_INVOICE_CANCELLED, bson.M{})
+	if err != nil {
+		return domain.VAInvoice{}, err
+	}
+
+	closeInvoiceVA(paramLog, invoice)
+
+	return invoice, nil
+}
+
+func VAInvoiceByID(paramLog *basic.ParamLog, corporate domain.Corporate, invoiceID string) (domain.VAInvoice, error) {
+	return corporateVAInvoice(paramLog, corporate, invoiceID)
+}
+
+func VAInvoicesByCorporate(paramLog *basic.ParamLog, corporate domain.Corporate, status string, page string,
+	limit string) ([]domain.VAInvoice, error) {
+	return service.VAInvoicesByCorporateNoSession(paramLog, corporate.ID, status, page, limit)
+}
+
+// RunVAInvoiceExpiry expires the pending invoices past their expiry and closes their VA, it tells how
+// many expired
+func RunVAInvoiceExpiry(paramLog *basic.ParamLog) (int, error) {
+	invoices, err := service.VAInvoicesExpiredNoSession(paramLog, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, invoice := range invoices {
+		err = transitionVAInvoice(paramLog, &invoice, domain.VA_INVOICE_EXPIRED, bson.M{})
+		if err != nil {
+			basic.LogError2(paramLog, "transitionVAInvoice", err)
+			continue
+		}
+
+		closeInvoiceVA(paramLog, invoice)
+		expired = expired + 1
+	}
+
+	basic.LogInformation(paramLog, "RunVAInvoiceExpiry expired "+strconv.Itoa(expired))
+
+	return expired, nil
+}
+
+// ClaimVAInvoicePayment marks the invoice paid by the payment when it is pending, unexpired and the
+// amount matches, the caller credits the balance afterwards and releases the claim when that fails.
+// A payment that does not match is recorded, and refused with an error when the invoice rejects
+// mismatches, otherwise the caller credits it to suspense. It tells whether the payment may be credited.
+func ClaimVAInvoicePayment(paramLog *basic.ParamLog, invoice *domain.VAInvoice, reference string, amount int) (bool, error) {
+	now := time.Now()
+	reason := ""
+	switch {
+	case invoice.Status != domain.VA_INVOICE_PENDING:
+		reason = "Invoice is " + invoice.Status
+	case invoice.ExpiresAtUnix > 0 && now.Unix() > invoice.ExpiresAtUnix:
+		reason = "Invoice expired at " + invoice.ExpiresAt
+	case amount != invoice.Amount:
+		reason = "Paid " + strconv.Itoa(amount) + " expected " + strconv.Itoa(invoice.Amount)
+	}
+
+	if reason == "" {
+		paidAt := now.Format(os.Getenv("TIME_FORMAT"))
+		err := transitionVAInvoice(paramLog, invoice, domain.VA_INVOICE_PAID, bson.M{"paid_at": paidAt})
+		if err == nil {
+			invoice.PaidAt = paidAt
+			return true, nil
+		}
+		reason = "Invoice is " + invoice.Status
+	}
+
+	payment := domain.VAInvoicePayment{
+		Reference: reference,
+		Amount:    amount,
+		Status:    domain.VA_INVOICE_PAYMENT_SUSPENDED,
+		Reason:    reason,
+		Time:      now.Format(os.Getenv("TIME_FORMAT")),
+	}
+	if invoice.OnMismatch == domain.VA_INVOICE_MISMATCH_REJECT {
+		payment.Status = domain.VA_INVOICE_PAYMENT_REJECTED
+	}
+
+	err := service.VAInvoiceAddPayment(paramLog, invoice.ID, payment)
+	if err != nil {
+		return false, err
+	}
+	invoice.Payments = append(invoice.Payments, payment)
+
+	if payment.Status == domain.VA_INVOICE_PAYMENT_SUSPENDED && invoice.Status == domain.VA_INVOICE_PENDING {
+		err = transitionVAInvoice(paramLog, invoice, domain.VA_INVOICE_SUSPENDED, bson.M{})
+		if err != nil {
+			basic.LogError2(paramLog, "transitionVAInvoice", err)
+		}
+	}
+
+	if payment.Status == domain.VA_INVOICE_PAYMENT_REJECTED {
+		return false, utils.ErrorBadRequest(paramLog, utils.VAInvoicePaymentMismatch, reason+" "+invoice.ID.Hex())
+	}
+
+	basic.LogInformation(paramLog, "Invoice payment suspended "+invoice.ID.Hex()+" "+reason)
+
+	return false, nil
+}
+
+// ReleaseVAInvoicePayment puts a claimed invoice back to pending when crediting its payment failed
+func ReleaseVAInvoicePayment(paramLog *basic.ParamLog, invoice *domain.VAInvoice) {
+	_, err := service.VAInvoiceTransition(paramLog, invoice.ID, domain.VA_INVOICE_PAID,
+		bson.M{"status": domain.VA_INVOICE_PENDING, "paid_at": ""})
+	if err != nil {
+		basic.LogError2(paramLog, "VAInvoiceTransition", err)
+		return
+	}
+
+	invoice.Status = domain.VA_INVOICE_PENDING
+	invoice.PaidAt = ""
+}
+
+// SettleVAInvoicePayment records the topup of the paid invoice and closes its VA, the topup told the corporate
+func SettleVAInvoicePayment(paramLog *basic.ParamLog, invoice domain.VAInvoice, transaction domain.Transaction) {
+	invoice.TransactionCode = transaction.TransactionCode
+
+	_, err := service.VAInvoiceTransition(paramLog, invoice.ID, domain.VA_INVOICE_PAID,
+		bson.M{"transaction_code": transaction.TransactionCode})
+	if err != nil {
+		basic.LogError2(paramLog, "VAInvoiceTransition", err)
+	}
+
+	err = service.VAInvoiceAddPayment(paramLog, invoice.ID, domain.VAInvoicePayment{
+		Reference:       transaction.GatewayReference,
+		Amount:          transaction.SubAmount,
+		Status:          domain.VA_INVOICE_PAYMENT_ACCEPTED,
+		TransactionCode: transaction.TransactionCode,
+		Time:            transaction.Time,
+	})
+	if err != nil {
+		basic.LogError2(paramLog, "VAInvoiceAddPayment", err)
+	}
+
+	closeInvoiceVA(paramLog, invoice)
+}
+
+func corporateVAInvoice(paramLog *basic.ParamLog, corporate domain.Corporate, invoiceID string) (domain.VAInvoice, error) {
+	invoice, err := service.VAInvoiceByIDNoSession(invoiceID)
+	if err != nil || invoice.CorporateID != corporate.ID {
+		return domain.VAInvoice{}, utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice, "Invoice not found")
+	}
+
+	return invoice, nil
+}
+
+// transitionVAInvoice moves a pending invoice to status
+func transitionVAInvoice(paramLog *basic.ParamLog, invoice *domain.VAInvoice, status string, set bson.M) error {
+	now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+	set["status"] = status
+	set["time"] = now
+
+	moved, err := service.VAInvoiceTransition(paramLog, invoice.ID, domain.VA_INVOICE_PENDING, set)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		current, err := service.VAInvoiceByIDNoSession(invoice.ID.Hex())
+		if err == nil {
+			invoice.Status = current.Status
+		}
+		return utils.ErrorBadRequest(paramLog, utils.InvalidVAInvoice, "Invoice is not pending "+invoice.ID.Hex())
+	}
+
+	invoice.Status = status
+	invoice.Time = now
+
+	return nil
+}
+
+// closeInvoiceVA closes the VA at its provider, a provider that expires it by itself may refuse
+func closeInvoiceVA(paramLog *basic.ParamLog, invoice domain.VAInvoice) {
+	providerGateway, ok := gateway.Get(invoice.Provider)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), VA_PROVISION_CALL_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
+	err := providerGateway.CloseVA(ctx, paramLog, gateway.VAResult{
+		BankCode:      invoice.BankCode,
+		AccountNumber: invoice.AccountNumber,
+		Reference:     invoice.Reference,
+	})
+	if err != nil {
+		basic.LogError2(paramLog, "CloseVA", err)
+	}
+}
+
+func vaInvoiceExpiry() time.Duration {
+	second, err := strconv.Atoi(os.Getenv("VA_INVOICE_EXPIRY_SECOND"))
+	if err != nil || second <= 0 {
+		second = DEFAULT_VA_INVOICE_EXPIRY_SECOND
+	}
+
+	return time.Duration(second) * time.Second
+}
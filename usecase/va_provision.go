@@ -0,0 +1,480 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_VA_BANK_PROVIDERS               = "MANDIRI:A,BNI:A,BRI:A,PERMATA:A"
+	DEFAULT_VA_PROVISION_BACKOFF_SECOND     = 60
+	DEFAULT_VA_PROVISION_MAX_BACKOFF_SECOND = 3600
+	DEFAULT_VA_PROVISION_MAX_ATTEMPTS       = 6
+	VA_PROVISION_LEASE_SECOND               = 120
+	VA_PROVISION_CALL_TIMEOUT_SECOND        = 60
+)
+
+// queueBalanceVA asks for the virtual account of every bank in VA_BANK_PROVIDERS and creates them in
+// the background, a balance shows an account only once its provider created it
+func queueBalanceVA(paramLog *basic.ParamLog, balance domain.Balance, ownerName string) {
+	now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+	for _, provision := range balanceVAProvisions(balance, ownerName, now) {
+		err := service.VAProvisionQueue(paramLog, provision)
+		if err != nil {
+			basic.LogError2(paramLog, "VAProvisionQueue", err)
+		}
+	}
+
+	go provisionBalanceVA(paramLog, balance.ID)
+}
+
+// RunVAProvisioning creates the pending virtual accounts that are due, an account whose provider
+// keeps failing is retried with backoff and marked failed after too many attempts
+func RunVAProvisioning(paramLog *basic.ParamLog) (dto.VAProvisionReport, error) {
+	provisions, err := service.VAProvisionsDueNoSession(paramLog, time.Now().Unix())
+	if err != nil {
+		return dto.VAProvisionReport{}, err
+	}
+
+	report := provisionDue(paramLog, provisions)
+	basic.LogInformation2(paramLog, "RunVAProvisioning", report)
+
+	return report, nil
+}
+
+// ProvisionVA (re)creates the virtual account of one bank of the balance with provider, or with the
+// provider configured for the bank when empty. An active account is closed at its provider first.
+// The account is created right away and left pending for RunVAProvisioning when that fails.
+func ProvisionVA(paramLog *basic.ParamLog, balanceID string, bankCode string, provider string) (domain.VAProvision, error) {
+	balance, err := service.BalanceByIDNoSession(balanceID)
+	if err != nil || balance.Owner.Type == "" {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	if balance.CurrentStatus() == domain.BALANCE_STATUS_CLOSED {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.BalanceClosed, "Balance closed "+balanceID)
+	}
+
+	if bankCode == "" {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount, "Bank code is required")
+	}
+
+	provider, err = vaProvider(paramLog, bankCode, provider)
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+
+	ID := domain.VAProvisionID(balance.ID, bankCode)
+	provision, err := service.VAProvisionByIDNoSession(ID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return domain.VAProvision{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	if err == nil && provision.Status == domain.VA_ACTIVE {
+		err = closeProviderVA(paramLog, provision)
+		if err != nil {
+			return domain.VAProvision{}, err
+		}
+
+		err = service.BalanceRemoveVA(paramLog, balance.ID, bankCode)
+		if err != nil {
+			return domain.VAProvision{}, err
+		}
+	}
+
+	name := provision.Name
+	if name == "" {
+		ownerName, err := balanceOwnerName(paramLog, balance)
+		if err != nil {
+			return domain.VAProvision{}, err
+		}
+		name = vaName(ownerName, balance)
+	}
+
+	err = service.VAProvisionQueue(paramLog, domain.VAProvision{
+		ID:        ID,
+		BalanceID: balance.ID,
+		BankCode:  bankCode,
+		Provider:  provider,
+		Name:      name,
+		Time:      time.Now().Format(os.Getenv("TIME_FORMAT")),
+	})
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+
+	provisionDue(paramLog, []domain.VAProvision{{ID: ID}})
+
+	return service.VAProvisionByIDNoSession(ID)
+}
+
+// CloseVA closes the virtual account of one bank of the balance at its provider and stops showing it
+func CloseVA(paramLog *basic.ParamLog, balanceID string, bankCode string) (domain.VAProvision, error) {
+	ID, err := primitive.ObjectIDFromHex(balanceID)
+	if err != nil {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	provision, err := service.VAProvisionByIDNoSession(domain.VAProvisionID(ID, bankCode))
+	if err == mongo.ErrNoDocuments {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount, "Virtual account not found")
+	}
+	if err != nil {
+		return domain.VAProvision{}, utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Query failed")
+	}
+
+	if provision.Status == domain.VA_CLOSED {
+		return domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount, "Virtual account already closed")
+	}
+
+	if provision.Status == domain.VA_ACTIVE {
+		err = closeProviderVA(paramLog, provision)
+		if err != nil {
+			return domain.VAProvision{}, err
+		}
+	}
+
+	status := provision.Status
+	provision.Status = domain.VA_CLOSED
+	provision.NextAt = 0
+	provision.Time = time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+	updated, err := service.VAProvisionUpdate(paramLog, provision, status)
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+	if !updated {
+		return domain.VAProvision{}, utils.ErrorConflict(paramLog, utils.InvalidVirtualAccount,
+			"Virtual account changed while closing "+provision.ID)
+	}
+
+	err = service.BalanceRemoveVA(paramLog, provision.BalanceID, bankCode)
+	if err != nil {
+		return domain.VAProvision{}, err
+	}
+
+	return provision, nil
+}
+
+// BalanceVAProvisions lists the virtual accounts of the balance in every state
+func BalanceVAProvisions(paramLog *basic.ParamLog, balanceID string) ([]domain.VAProvision, error) {
+	ID, err := primitive.ObjectIDFromHex(balanceID)
+	if err != nil {
+		return []domain.VAProvision{}, utils.ErrorBadRequest(paramLog, utils.InvalidBalanceID, "Balance not found")
+	}
+
+	return service.VAProvisionsByBalanceNoSession(paramLog, ID)
+}
+
+// VAProvisionsFailed lists the virtual accounts that gave up retrying, they wait for ProvisionVA
+func VAProvisionsFailed(paramLog *basic.ParamLog, page string, limit string) ([]domain.VAProvision, error) {
+	return service.VAProvisionsByStatusNoSession(paramLog, domain.VA_FAILED, page, limit)
+}
+
+// RequeueLegacyVA removes the placeholder account number older balances show and queues a real
+// account for those banks, it tells how many balances were fixed
+func RequeueLegacyVA(paramLog *basic.ParamLog) (int, error) {
+	balances, err := service.BalancesWithVANumberNoSession(paramLog, domain.VA_LEGACY_PLACEHOLDER)
+	if err != nil {
+		return 0, err
+	}
+
+	_, providers := vaBankProviders()
+	now := time.Now().Format(os.Getenv("TIME_FORMAT"))
+
+	fixed := 0
+	for _, balance := range balances {
+		ownerName, err := balanceOwnerName(paramLog, balance)
+		if err != nil {
+			basic.LogError2(paramLog, "balanceOwnerName", err)
+			continue
+		}
+
+		for _, va := range balance.VA {
+			if va.AccountNumber != domain.VA_LEGACY_PLACEHOLDER {
+				continue
+			}
+
+			err = service.BalanceRemoveVA(paramLog, balance.ID, va.BankCode)
+			if err != nil {
+				basic.LogError2(paramLog, "BalanceRemoveVA", err)
+				continue
+			}
+
+			provider := providers[va.BankCode]
+			if provider == "" {
+				provider = gateway.Xendit
+			}
+
+			err = service.VAProvisionQueue(paramLog, domain.VAProvision{
+				ID:        domain.VAProvisionID(balance.ID, va.BankCode),
+				BalanceID: balance.ID,
+				BankCode:  va.BankCode,
+				Provider:  provider,
+				Name:      vaName(ownerName, balance),
+				Time:      now,
+			})
+			if err != nil {
+				basic.LogError2(paramLog, "VAProvisionQueue", err)
+			}
+		}
+
+		fixed = fixed + 1
+	}
+
+	return fixed, nil
+}
+
+func provisionBalanceVA(paramLog *basic.ParamLog, balanceID primitive.ObjectID) {
+	provisions, err := service.VAProvisionsByBalanceNoSession(paramLog, balanceID)
+	if err != nil {
+		basic.LogError2(paramLog, "VAProvisionsByBalanceNoSession", err)
+		return
+	}
+
+	provisionDue(paramLog, provisions)
+}
+
+func provisionDue(paramLog *basic.ParamLog, provisions []domain.VAProvision) dto.VAProvisionReport {
+	report := dto.VAProvisionReport{}
+
+	for _, provision := range provisions {
+		now := time.Now()
+		claimed, err := service.VAProvisionClaim(paramLog, provision.ID, now.Unix(), now.Unix()+VA_PROVISION_LEASE_SECOND)
+		if err != nil {
+			basic.LogError2(paramLog, "VAProvisionClaim", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		provision, err = service.VAProvisionByIDNoSession(provision.ID)
+		if err != nil {
+			basic.LogError2(paramLog, "VAProvisionByIDNoSession", err)
+			continue
+		}
+
+		report.Checked = report.Checked + 1
+		provision = provisionVA(paramLog, provision)
+
+		switch provision.Status {
+		case domain.VA_ACTIVE:
+			report.Active = report.Active + 1
+		case domain.VA_FAILED:
+			report.Failed = report.Failed + 1
+		default:
+			report.Pending = report.Pending + 1
+		}
+	}
+
+	return report
+}
+
+func provisionVA(paramLog *basic.ParamLog, provision domain.VAProvision) domain.VAProvision {
+	provision = createProviderVA(paramLog, provision, time.Now())
+	if provision.Status != domain.VA_ACTIVE {
+		writeVAProvision(paramLog, provision)
+		return provision
+	}
+
+	// Closed or queued again by someone else while the provider was creating it
+	if !writeVAProvision(paramLog, provision) {
+		err := closeProviderVA(paramLog, provision)
+		if err != nil {
+			basic.LogError2(paramLog, "closeProviderVA", err)
+		}
+		return provision
+	}
+
+	err := service.BalanceSetVA(paramLog, provision.BalanceID, provision.ToVirtualAccount())
+	if err != nil {
+		basic.LogError2(paramLog, "BalanceSetVA", err)
+	}
+
+	return provision
+}
+
+// createProviderVA asks the provider for the account, a failed call is left pending with backoff
+func createProviderVA(paramLog *basic.ParamLog, provision domain.VAProvision, now time.Time) domain.VAProvision {
+	provision.Time = now.Format(os.Getenv("TIME_FORMAT"))
+
+	providerGateway, ok := gateway.Get(provision.Provider)
+	if !ok || !providerGateway.Capabilities().VA {
+		provision.Status = domain.VA_FAILED
+		provision.LastError = "Provider " + provision.Provider + " cannot create virtual accounts"
+		return provision
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), VA_PROVISION_CALL_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
+	result, err := providerGateway.CreateVA(ctx, paramLog, gateway.VARequest{
+		ExternalID: provision.BalanceID.Hex(),
+		Name:       provision.Name,
+		BankCode:   provision.BankCode,
+	})
+	if err == nil && result.AccountNumber == "" {
+		err = fmt.Errorf("provider %v answered without account number", provision.Provider)
+	}
+	if err != nil {
+		provision.LastError = err.Error()
+		return backoffVAProvision(provision, now)
+	}
+
+	provision.Status = domain.VA_ACTIVE
+	provision.AccountNumber = result.AccountNumber
+	provision.Reference = result.Reference
+	provision.NextAt = 0
+	provision.LastError = ""
+
+	return provision
+}
+
+func writeVAProvision(paramLog *basic.ParamLog, provision domain.VAProvision) bool {
+	updated, err := service.VAProvisionUpdate(paramLog, provision, domain.VA_PENDING)
+	if err != nil {
+		basic.LogError2(paramLog, "VAProvisionUpdate", err)
+		return false
+	}
+
+	return updated
+}
+
+func backoffVAProvision(provision domain.VAProvision, now time.Time) domain.VAProvision {
+	provision.Attempts = provision.Attempts + 1
+	if provision.Attempts >= utils.EnvInt("VA_PROVISION_MAX_ATTEMPTS", DEFAULT_VA_PROVISION_MAX_ATTEMPTS) {
+		provision.Status = domain.VA_FAILED
+		provision.NextAt = 0
+		return provision
+	}
+
+	backoff := utils.ExponentialBackoff(provision.Attempts,
+		utils.EnvSecond("VA_PROVISION_BACKOFF_SECOND", DEFAULT_VA_PROVISION_BACKOFF_SECOND),
+		utils.EnvSecond("VA_PROVISION_MAX_BACKOFF_SECOND", DEFAULT_VA_PROVISION_MAX_BACKOFF_SECOND))
+
+	provision.Status = domain.VA_PENDING
+	provision.NextAt = now.Add(backoff).Unix()
+
+	return provision
+}
+
+func closeProviderVA(paramLog *basic.ParamLog, provision domain.VAProvision) error {
+	providerGateway, ok := gateway.Get(provision.Provider)
+	if !ok {
+		return utils.ErrorInternalServer(paramLog, utils.GatewayNotSupported, "Gateway "+provision.Provider+" not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), VA_PROVISION_CALL_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
+	return providerGateway.CloseVA(ctx, paramLog, gateway.VAResult{
+		BankCode:      provision.BankCode,
+		AccountNumber: provision.AccountNumber,
+		Reference:     provision.Reference,
+	})
+}
+
+// vaBankProviders reads VA_BANK_PROVIDERS, a list of bank:gateway code in the order the accounts
+// are shown. A bank without a gateway code is created with Xendit.
+func vaBankProviders() ([]string, map[string]string) {
+	config := os.Getenv("VA_BANK_PROVIDERS")
+	if config == "" {
+		config = DEFAULT_VA_BANK_PROVIDERS
+	}
+
+	banks := []string{}
+	providers := map[string]string{}
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		bankCode := parts[0]
+		if bankCode == "" {
+			continue
+		}
+
+		provider := gateway.Xendit
+		if len(parts) == 2 && parts[1] != "" {
+			provider = parts[1]
+		}
+
+		if _, ok := providers[bankCode]; !ok {
+			banks = append(banks, bankCode)
+		}
+		providers[bankCode] = provider
+	}
+
+	return banks, providers
+}
+
+// balanceVAProvisions are the pending virtual accounts of every bank in VA_BANK_PROVIDERS for the balance
+func balanceVAProvisions(balance domain.Balance, ownerName string, now string) []domain.VAProvision {
+	banks, providers := vaBankProviders()
+
+	provisions := []domain.VAProvision{}
+	for _, bankCode := range banks {
+		provisions = append(provisions, domain.VAProvision{
+			ID:        domain.VAProvisionID(balance.ID, bankCode),
+			BalanceID: balance.ID,
+			BankCode:  bankCode,
+			Provider:  providers[bankCode],
+			Name:      vaName(ownerName, balance),
+			Time:      now,
+		})
+	}
+
+	return provisions
+}
+
+// vaProvider is the provider asked for, or the one configured for the bank when empty, once it is
+// known to create virtual accounts
+func vaProvider(paramLog *basic.ParamLog, bankCode string, provider string) (string, error) {
+	if provider == "" {
+		_, providers := vaBankProviders()
+		provider = providers[bankCode]
+	}
+	if provider == "" {
+		provider = gateway.Xendit
+	}
+
+	providerGateway, ok := gateway.Get(provider)
+	if !ok || !providerGateway.Capabilities().VA {
+		return "", utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount,
+			"Provider "+provider+" cannot create virtual accounts")
+	}
+
+	return provider, nil
+}
+
+func balanceOwnerName(paramLog *basic.ParamLog, balance domain.Balance) (string, error) {
+	if balance.Owner.Type == domain.ACTOR_TYPE_CORPORATE {
+		corporate, err := service.CorporateByIDNoSession(balance.Owner.ID.Hex())
+		if err != nil {
+			return "", utils.ErrorBadRequest(paramLog, utils.CorporateNotFound, "Corporate id not found")
+		}
+		return corporate.Name, nil
+	}
+
+	user, err := service.UserByIDNoSession(paramLog, balance.Owner.ID.Hex())
+	if err != nil {
+		return "", utils.ErrorBadRequest(paramLog, utils.UserNotFound, "User id not found")
+	}
+
+	return user.FullName, nil
+}
+
+func vaName(ownerName string, balance domain.Balance) string {
+	return ownerName + " " + balance.Name
+}
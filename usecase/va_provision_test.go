@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"github.com/kangdjoker/takeme-core/utils/gateway"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testVAGateway = "VA-TEST"
+
+// testGateway creates a virtual account once it failed createFailures times
+type testGateway struct {
+	createFailures *int
+}
+
+func init() {
+	gateway.Register(testGateway{createFailures: new(int)})
+}
+
+func (g testGateway) Name() string { return testVAGateway }
+
+func (g testGateway) Capabilities() gateway.Capabilities { return gateway.Capabilities{VA: true} }
+
+func (g testGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request gateway.VARequest, opts ...gateway.Option) (gateway.VAResult, error) {
+	if *g.createFailures > 0 {
+		*g.createFailures = *g.createFailures - 1
+		return gateway.VAResult{}, errors.New("provider unreachable")
+	}
+
+	return gateway.VAResult{BankCode: request.BankCode, AccountNumber: "8808" + request.BankCode, Reference: request.ExternalID}, nil
+}
+
+func (g testGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (gateway.VACallback, error) {
+	return gateway.VACallback{}, nil
+}
+
+func (g testGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va gateway.VAResult, opts ...gateway.Option) error {
+	return nil
+}
+
+func (g testGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...gateway.Option) (gateway.TransferResult, error) {
+	return gateway.TransferResult{}, nil
+}
+
+func (g testGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (gateway.TransferCallback, error) {
+	return gateway.TransferCallback{}, nil
+}
+
+func (g testGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...gateway.Option) (gateway.TransferCallback, error) {
+	return gateway.TransferCallback{}, nil
+}
+
+func (g testGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request gateway.InquiryRequest, opts ...gateway.Option) (gateway.InquiryResult, error) {
+	return gateway.InquiryResult{}, nil
+}
+
+func TestBalanceVAProvisions(t *testing.T) {
+	t.Setenv("VA_BANK_PROVIDERS", "BNI:"+testVAGateway+", MANDIRI ,BRI:"+gateway.OY+",BNI:A")
+
+	balance := domain.Balance{ID: primitive.NewObjectID(), Name: "Main"}
+	provisions := balanceVAProvisions(balance, "Andy", "now")
+
+	expected := []struct {
+		bankCode string
+		provider string
+	}{
+		{bankCode: "BNI", provider: gateway.Xendit},
+		{bankCode: "MANDIRI", provider: gateway.Xendit},
+		{bankCode: "BRI", provider: gateway.OY},
+	}
+
+	if len(provisions) != len(expected) {
+		t.Fatalf("got %v accounts, want %v", len(provisions), len(expected))
+	}
+	for i, provision := range provisions {
+		if provision.BankCode != expected[i].bankCode || provision.Provider != expected[i].provider {
+			t.Errorf("account %v: got %v by %v, want %v by %v", i, provision.BankCode, provision.Provider,
+				expected[i].bankCode, expected[i].provider)
+		}
+		if provision.ID != domain.VAProvisionID(balance.ID, provision.BankCode) || provision.Name != "Andy Main" {
+			t.Errorf("account %v: got id %v name %v", i, provision.ID, provision.Name)
+		}
+		if provision.Status != "" || provision.AccountNumber != "" {
+			t.Errorf("account %v: shown before its provider created it", i)
+		}
+	}
+}
+
+func TestVAProvider(t *testing.T) {
+	t.Setenv("VA_BANK_PROVIDERS", "BNI:"+testVAGateway+",BRI:"+gateway.Stripe)
+
+	tests := []struct {
+		name     string
+		bankCode string
+		provider string
+		expected string
+		code     int
+	}{
+		{name: "configured for the bank", bankCode: "BNI", expected: testVAGateway},
+		{name: "asked for", bankCode: "BNI", provider: gateway.OY, expected: gateway.OY},
+		{name: "bank not configured", bankCode: "CIMB", expected: gateway.Xendit},
+		{name: "configured without virtual accounts", bankCode: "BRI", code: utils.InvalidVirtualAccount},
+		{name: "unknown provider", bankCode: "BNI", provider: "ZZ", code: utils.InvalidVirtualAccount},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := vaProvider(nil, test.bankCode, test.provider)
+			if errorCode(err) != test.code {
+				t.Fatalf("error code = %v, want %v", errorCode(err), test.code)
+			}
+			if provider != test.expected {
+				t.Errorf("provider = %v, want %v", provider, test.expected)
+			}
+		})
+	}
+}
+
+func TestCreateProviderVARetriesThenFails(t *testing.T) {
+	t.Setenv("VA_PROVISION_BACKOFF_SECOND", "60")
+	t.Setenv("VA_PROVISION_MAX_BACKOFF_SECOND", "3600")
+	t.Setenv("VA_PROVISION_MAX_ATTEMPTS", "3")
+
+	test, _ := gateway.Get(testVAGateway)
+	*test.(testGateway).createFailures = 5
+
+	now := time.Unix(1700000000, 0)
+	provision := domain.VAProvision{BalanceID: primitive.NewObjectID(), BankCode: "BNI", Provider: testVAGateway,
+		Status: domain.VA_PENDING}
+
+	for attempt := 1; attempt < 3; attempt++ {
+		provision = createProviderVA(nil, provision, now)
+		if provision.Status != domain.VA_PENDING || provision.NextAt <= now.Unix() || provision.LastError == "" {
+			t.Fatalf("attempt %v: got %v next at %v, want pending with backoff", attempt, provision.Status, provision.NextAt)
+		}
+	}
+
+	provision = createProviderVA(nil, provision, now)
+	if provision.Status != domain.VA_FAILED || provision.NextAt != 0 || provision.AccountNumber != "" {
+		t.Errorf("attempt 3: got %v next at %v, want failed", provision.Status, provision.NextAt)
+	}
+}
+
+func TestCreateProviderVA(t *testing.T) {
+	test, _ := gateway.Get(testVAGateway)
+	*test.(testGateway).createFailures = 1
+
+	now := time.Unix(1700000000, 0)
+	provision := domain.VAProvision{BalanceID: primitive.NewObjectID(), BankCode: "BNI", Provider: testVAGateway,
+		Status: domain.VA_PENDING}
+
+	provision = createProviderVA(nil, provision, now)
+	if provision.Status != domain.VA_PENDING || provision.Attempts != 1 {
+		t.Fatalf("got %v after %v attempts, want pending after 1", provision.Status, provision.Attempts)
+	}
+
+	provision = createProviderVA(nil, provision, now)
+	if provision.Status != domain.VA_ACTIVE || provision.AccountNumber != "8808BNI" || provision.LastError != "" {
+		t.Errorf("got %v %v %q, want active 8808BNI", provision.Status, provision.AccountNumber, provision.LastError)
+	}
+
+	provision = createProviderVA(nil, domain.VAProvision{BankCode: "BRI", Provider: gateway.Stripe, Status: domain.VA_PENDING}, now)
+	if provision.Status != domain.VA_FAILED || provision.LastError == "" {
+		t.Errorf("provider without virtual accounts: got %v, want failed", provision.Status)
+	}
+}
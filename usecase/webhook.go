@@ -0,0 +1,338 @@
+package usecase
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/domain/dto"
+	"github.com/kangdjoker/takeme-core/service"
+	"github.com/kangdjoker/takeme-core/utils"
+	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_WEBHOOK_BACKOFF_SECOND     = 30
+	DEFAULT_WEBHOOK_MAX_BACKOFF_SECOND = 3600
+	DEFAULT_WEBHOOK_MAX_ATTEMPTS       = 10
+	DEFAULT_WEBHOOK_WORKERS            = 4
+	WEBHOOK_LEASE_SECOND               = 120
+	WEBHOOK_TIMEOUT_SECOND             = 30
+	WEBHOOK_RESPONSE_LENGTH            = 1000
+)
+
+func TopupWebhook(corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_TOPUP, transaction.TransactionCode, corporate.VACallbackURL,
+		createTopupPayload(corporate, balance, transaction))
+}
+
+func VAInvoiceWebhook(corporate domain.Corporate, invoice domain.VAInvoice, transaction domain.Transaction) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_VA_INVOICE, transaction.TransactionCode, corporate.VACallbackURL,
+		createVAInvoicePayload(invoice, transaction))
+}
+
+func DeductWebhook(corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_DEDUCT, transaction.TransactionCode, corporate.DeductCallbackURL,
+		createDeductPayload(corporate, balance, transaction))
+}
+
+func TransferWebhook(corporate domain.Corporate, transaction domain.Transaction) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_TRANSFER, transaction.TransactionCode, corporate.TransferCallbackURL,
+		createTransferPayload(corporate, transaction))
+}
+
+func AcceptPaymentWebhook(corporate domain.Corporate, balance domain.Balance, transaction domain.Transaction) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_ACCEPT_PAYMENT, transaction.TransactionCode,
+		corporate.AccecptPaymentCallbackURL, createAcceptPaymentPayload(corporate, balance, transaction))
+}
+
+func BulkWebhook(corporate domain.Corporate, actor domain.ActorObject, bulkID string, bulkStatus string, url string) domain.Webhook {
+	return createWebhook(corporate, domain.WEBHOOK_EVENT_BULK, bulkID, url, createBulkPayload(corporate, actor, bulkID, bulkStatus))
+}
+
+// SaveWebhooks adds the webhooks to the outbox in the session of the transaction they tell about, a
+// corporate without callback url gets none
+func SaveWebhooks(paramLog *basic.ParamLog, webhooks []domain.Webhook, session mongo.SessionContext) error {
+	for i := range webhooks {
+		if webhooks[i].URL == "" {
+			continue
+		}
+
+		err := service.WebhookSaveOne(&webhooks[i], session)
+		if err != nil {
+			basic.LogError2(paramLog, "WebhookSaveOne", err)
+			return utils.ErrorInternalServer(paramLog, utils.QueryFailed, "Save webhook failed")
+		}
+	}
+
+	return nil
+}
+
+// PublishWebhooks adds the webhooks to the outbox and makes their first attempt, the ones not delivered
+// are posted again by RunWebhookDelivery
+func PublishWebhooks(paramLog *basic.ParamLog, webhooks ...domain.Webhook) {
+	var saved []domain.Webhook
+	for _, webhook := range webhooks {
+		if webhook.URL == "" {
+			continue
+		}
+
+		err := service.WebhookSaveOneNoSession(paramLog, &webhook)
+		if err != nil {
+			basic.LogError2(paramLog, "WebhookSaveOneNoSession", err)
+			continue
+		}
+
+		saved = append(saved, webhook)
+	}
+
+	DeliverWebhooks(paramLog, saved)
+}
+
+// DeliverWebhooks makes the first attempt of webhooks already in the outbox
+func DeliverWebhooks(paramLog *basic.ParamLog, webhooks []domain.Webhook) {
+	var due []domain.Webhook
+	for _, webhook := range webhooks {
+		if webhook.URL != "" {
+			due = append(due, webhook)
+		}
+	}
+
+	deliverWebhooks(paramLog, due)
+}
+
+func RunWebhookDelivery(paramLog *basic.ParamLog) (dto.WebhookReport, error) {
+	webhooks, err := service.WebhooksDueNoSession(paramLog, time.Now().Unix())
+	if err != nil {
+		return dto.WebhookReport{}, err
+	}
+
+	report := deliverWebhooks(paramLog, webhooks)
+	basic.LogInformation2(paramLog, "RunWebhookDelivery", report)
+
+	return report, nil
+}
+
+// RedeliverWebhook posts a delivered or dead webhook again from its first attempt
+func RedeliverWebhook(paramLog *basic.ParamLog, webhookID string) (domain.Webhook, error) {
+	ID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return domain.Webhook{}, utils.ErrorBadRequest(paramLog, utils.InvalidWebhook, "Webhook not found "+webhookID)
+	}
+
+	requeued, err := service.WebhookRequeue(paramLog, ID, time.Now().Format(os.Getenv("TIME_FORMAT")))
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+	if !requeued {
+		return domain.Webhook{}, utils.ErrorBadRequest(paramLog, utils.InvalidWebhook,
+			"Webhook not found or still pending "+webhookID)
+	}
+
+	deliverWebhooks(paramLog, []domain.Webhook{{ID: ID}})
+
+	return service.WebhookByIDNoSession(webhookID)
+}
+
+func Webhooks(paramLog *basic.ParamLog, corporateID primitive.ObjectID, status string, page string,
+	limit string) ([]domain.Webhook, error) {
+	return service.WebhooksNoSession(paramLog, corporateID, status, page, limit)
+}
+
+// WebhookAttempts lists the callback history of every attempt of the webhook
+func WebhookAttempts(paramLog *basic.ParamLog, webhookID string) ([]domain.CallbackHistory, error) {
+	ID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return []domain.CallbackHistory{}, utils.ErrorBadRequest(paramLog, utils.InvalidWebhook, "Webhook not found "+webhookID)
+	}
+
+	return service.CallbackHistoriesByWebhookNoSession(paramLog, ID)
+}
+
+// deliverWebhooks shares the webhooks between WEBHOOK_WORKERS workers, a webhook is only posted by
+// the worker that claims it
+func deliverWebhooks(paramLog *basic.ParamLog, webhooks []domain.Webhook) dto.WebhookReport {
+	report := dto.WebhookReport{}
+	if len(webhooks) == 0 {
+		return report
+	}
+
+	queue := make(chan domain.Webhook)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	workers := utils.EnvInt("WEBHOOK_WORKERS", DEFAULT_WEBHOOK_WORKERS)
+	if workers > len(webhooks) {
+		workers = len(webhooks)
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for queued := range queue {
+				webhook, claimed := claimWebhook(paramLog, queued.ID)
+				if !claimed {
+					continue
+				}
+
+				webhook = deliverWebhook(paramLog, webhook)
+
+				mutex.Lock()
+				report.Checked = report.Checked + 1
+				switch webhook.Status {
+				case domain.WEBHOOK_DELIVERED:
+					report.Delivered = report.Delivered + 1
+				case domain.WEBHOOK_DEAD:
+					report.Dead = report.Dead + 1
+				default:
+					report.Pending = report.Pending + 1
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, webhook := range webhooks {
+		queue <- webhook
+	}
+	close(queue)
+	wg.Wait()
+
+	return report
+}
+
+func claimWebhook(paramLog *basic.ParamLog, ID primitive.ObjectID) (domain.Webhook, bool) {
+	now := time.Now()
+	claimed, err := service.WebhookClaim(paramLog, ID, now.Unix(), now.Unix()+WEBHOOK_LEASE_SECOND)
+	if err != nil {
+		basic.LogError2(paramLog, "WebhookClaim", err)
+		return domain.Webhook{}, false
+	}
+	if !claimed {
+		return domain.Webhook{}, false
+	}
+
+	webhook, err := service.WebhookByIDNoSession(ID.Hex())
+	if err != nil {
+		basic.LogError2(paramLog, "WebhookByIDNoSession", err)
+		return domain.Webhook{}, false
+	}
+
+	return webhook, true
+}
+
+// deliverWebhook posts the webhook once and records the attempt in the callback history
+func deliverWebhook(paramLog *basic.ParamLog, webhook domain.Webhook) domain.Webhook {
+	now := time.Now()
+	webhook.Time = now.Format(os.Getenv("TIME_FORMAT"))
+	attempt := webhook.Attempts + 1
+
+	corporate, err := service.CorporateByIDNoSession(webhook.CorporateID.Hex())
+	if err == nil {
+		var response string
+		webhook.LastStatusCode, response, err = postWebhook(paramLog, corporate, webhook)
+		if webhook.LastStatusCode == 0 {
+			go service.CreateWebhookCallbackHistory(paramLog, webhook, attempt, "", "CONNECTION REFUSED")
+		} else {
+			go service.CreateWebhookCallbackHistory(paramLog, webhook, attempt, response, strconv.Itoa(webhook.LastStatusCode))
+		}
+	}
+
+	if err == nil {
+		webhook.Status = domain.WEBHOOK_DELIVERED
+		webhook.Attempts = attempt
+		webhook.NextAt = 0
+		webhook.LastError = ""
+		webhook.DeliveredAt = webhook.Time
+	} else {
+		webhook.LastError = err.Error()
+		webhook = backoffWebhook(webhook, now)
+	}
+
+	err = service.WebhookAttempted(paramLog, webhook)
+	if err != nil {
+		basic.LogError2(paramLog, "WebhookAttempted", err)
+	}
+
+	return webhook
+}
+
+// postWebhook posts the payload with the current callback token of the corporate, any 2xx answer is
+// a delivery
+func postWebhook(paramLog *basic.ParamLog, corporate domain.Corporate, webhook domain.Webhook) (int, string, error) {
+	client := resty.New().SetTimeout(WEBHOOK_TIMEOUT_SECOND * time.Second)
+	resp, err := client.R().
+		SetHeaders(map[string]string{
+			"Content-Type":     "application/json",
+			"callback-token":   corporate.CallbackToken,
+			"callback-webhook": webhook.ID.Hex(),
+		}).
+		SetBody(webhook.Payload).Post(webhook.URL)
+
+	if err != nil {
+		return 0, "", utils.ErrorInternalServer(paramLog, utils.CallbackError,
+			"Callback "+webhook.Event+" corporate connection refused or Timeout")
+	}
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), webhook.Payload, string(resp.Body()), "Callback "+webhook.Event+" corporate")
+
+	response := string(resp.Body())
+	if len(response) > WEBHOOK_RESPONSE_LENGTH {
+		response = response[:WEBHOOK_RESPONSE_LENGTH]
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return resp.StatusCode(), response, utils.ErrorInternalServer(paramLog, utils.CallbackError,
+			"Callback "+webhook.Event+" corporate answered "+strconv.Itoa(resp.StatusCode()))
+	}
+
+	return resp.StatusCode(), response, nil
+}
+
+// backoffWebhook waits twice as long after each failed attempt up to the max backoff, taking a random
+// half of the wait off so retries of many webhooks spread out
+func backoffWebhook(webhook domain.Webhook, now time.Time) domain.Webhook {
+	webhook.Attempts = webhook.Attempts + 1
+	if webhook.Attempts >= utils.EnvInt("WEBHOOK_MAX_ATTEMPTS", DEFAULT_WEBHOOK_MAX_ATTEMPTS) {
+		webhook.Status = domain.WEBHOOK_DEAD
+		webhook.NextAt = 0
+		return webhook
+	}
+
+	backoff := int64(utils.ExponentialBackoff(webhook.Attempts,
+		utils.EnvSecond("WEBHOOK_BACKOFF_SECOND", DEFAULT_WEBHOOK_BACKOFF_SECOND),
+		utils.EnvSecond("WEBHOOK_MAX_BACKOFF_SECOND", DEFAULT_WEBHOOK_MAX_BACKOFF_SECOND)) / time.Second)
+
+	jitter := rand.Int63n(backoff/2 + 1)
+
+	webhook.Status = domain.WEBHOOK_PENDING
+	webhook.NextAt = now.Unix() + backoff - jitter
+
+	return webhook
+}
+
+func createWebhook(corporate domain.Corporate, event string, transactionCode string, url string, payload interface{}) domain.Webhook {
+	body, _ := json.Marshal(payload)
+
+	return domain.Webhook{
+		ID:              primitive.NewObjectID(),
+		CorporateID:     corporate.ID,
+		Event:           event,
+		TransactionCode: transactionCode,
+		URL:             url,
+		Payload:         string(body),
+		Status:          domain.WEBHOOK_PENDING,
+		Attempts:        0,
+		NextAt:          0,
+		Time:            time.Now().Format(os.Getenv("TIME_FORMAT")),
+	}
+}
@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kangdjoker/takeme-core/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookOutboxEntry(t *testing.T) {
+	corporate := domain.Corporate{
+		ID:                  primitive.NewObjectID(),
+		TransferCallbackURL: "https://corporate/transfer",
+		DeductCallbackURL:   "https://corporate/deduct",
+	}
+	transaction := domain.Transaction{TransactionCode: "TRX0001"}
+
+	tests := []struct {
+		name    string
+		webhook domain.Webhook
+		event   string
+		url     string
+	}{
+		{name: "transfer", webhook: TransferWebhook(corporate, transaction), event: domain.WEBHOOK_EVENT_TRANSFER,
+			url: corporate.TransferCallbackURL},
+		{name: "deduct", webhook: DeductWebhook(corporate, domain.Balance{}, transaction), event: domain.WEBHOOK_EVENT_DEDUCT,
+			url: corporate.DeductCallbackURL},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			webhook := test.webhook
+			if webhook.Event != test.event || webhook.URL != test.url || webhook.TransactionCode != transaction.TransactionCode {
+				t.Errorf("got %v to %v for %v", webhook.Event, webhook.URL, webhook.TransactionCode)
+			}
+			if webhook.ID.IsZero() || webhook.CorporateID != corporate.ID || webhook.Payload == "" {
+				t.Errorf("got id %v corporate %v payload %q", webhook.ID, webhook.CorporateID, webhook.Payload)
+			}
+			if webhook.Status != domain.WEBHOOK_PENDING || webhook.Attempts != 0 || webhook.NextAt != 0 {
+				t.Errorf("got %v after %v attempts due at %v, want pending and due now", webhook.Status, webhook.Attempts,
+					webhook.NextAt)
+			}
+		})
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	statusCode := http.StatusOK
+
+	var header http.Header
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		read, _ := io.ReadAll(r.Body)
+		body = string(read)
+		w.WriteHeader(statusCode)
+		w.Write([]byte("answer"))
+	}))
+	defer server.Close()
+
+	corporate := domain.Corporate{CallbackToken: "token"}
+	webhook := domain.Webhook{ID: primitive.NewObjectID(), URL: server.URL, Payload: `{"transaction_code":"TRX0001"}`}
+
+	code, response, err := postWebhook(nil, corporate, webhook)
+	if err != nil || code != http.StatusOK || response != "answer" {
+		t.Fatalf("got %v %q %v, want 200 answer", code, response, err)
+	}
+	if body != webhook.Payload || header.Get("callback-token") != "token" || header.Get("callback-webhook") != webhook.ID.Hex() {
+		t.Errorf("posted %v with token %v webhook %v", body, header.Get("callback-token"), header.Get("callback-webhook"))
+	}
+
+	statusCode = http.StatusInternalServerError
+	code, _, err = postWebhook(nil, corporate, webhook)
+	if err == nil || code != http.StatusInternalServerError {
+		t.Errorf("got %v %v, want 500 with an error", code, err)
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// ExponentialBackoff is the wait after the given number of failed attempts, base doubled after every
+// attempt past the first and never more than max
+func ExponentialBackoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
+// EnvInt reads a positive number from the environment, fallback when it is not set or not positive
+func EnvInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		value = fallback
+	}
+
+	return value
+}
+
+// EnvSecond reads a number of seconds from the environment like EnvInt
+func EnvSecond(name string, fallback int) time.Duration {
+	return time.Duration(EnvInt(name, fallback)) * time.Second
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: 60 * time.Second},
+		{attempts: 1, expected: 60 * time.Second},
+		{attempts: 2, expected: 120 * time.Second},
+		{attempts: 4, expected: 480 * time.Second},
+		{attempts: 6, expected: 1000 * time.Second},
+		{attempts: 60, expected: 1000 * time.Second},
+	}
+
+	for _, test := range tests {
+		backoff := ExponentialBackoff(test.attempts, 60*time.Second, 1000*time.Second)
+		if backoff != test.expected {
+			t.Errorf("attempts %v: expected %v, got %v", test.attempts, test.expected, backoff)
+		}
+	}
+}
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+	}{
+		{value: "", expected: 7},
+		{value: "abc", expected: 7},
+		{value: "0", expected: 7},
+		{value: "-3", expected: 7},
+		{value: "12", expected: 12},
+	}
+
+	for _, test := range tests {
+		t.Setenv("BACKOFF_TEST_VALUE", test.value)
+		value := EnvInt("BACKOFF_TEST_VALUE", 7)
+		if value != test.expected {
+			t.Errorf("value %q: expected %v, got %v", test.value, test.expected, value)
+		}
+	}
+
+	t.Setenv("BACKOFF_TEST_VALUE", "3")
+	if second := EnvSecond("BACKOFF_TEST_VALUE", 7); second != 3*time.Second {
+		t.Errorf("expected 3s, got %v", second)
+	}
+}
@@ -70,6 +70,13 @@ func FindOne(colName string, query bson.M) *mongo.SingleResult {
 	return result
 }
 
+func FindOneSorted(colName string, query bson.M, sort bson.D) *mongo.SingleResult {
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	result := collection.FindOne(context.TODO(), query, options.FindOne().SetSort(sort))
+
+	return result
+}
+
 func Find(paramLog *basic.ParamLog, colName string, query bson.M, page string, limit string) (*mongo.Cursor, error) {
 
 	opts := options.Find()
@@ -145,6 +152,23 @@ func FindAllOrderByID(paramLog *basic.ParamLog, colName string, query bson.M, pa
 	return cursor, nil
 }
 
+func FindAscendingByID(paramLog *basic.ParamLog, colName string, query bson.M) (*mongo.Cursor, error) {
+	opts := options.Find()
+	opts.SetSort(bson.M{"_id": 1})
+
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	cursor, err := collection.Find(
+		context.TODO(),
+		query,
+		opts,
+	)
+	if err != nil {
+		return nil, utils.ErrorInternalServer(paramLog, utils.QueryFailed, err.Error())
+	}
+
+	return cursor, nil
+}
+
 func Aggregate(paramLog *basic.ParamLog, colName string, query []bson.M) (*mongo.Cursor, error) {
 	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
 	cursor, err := collection.Aggregate(
@@ -213,6 +237,44 @@ func UpdateOne(paramLog *basic.ParamLog, colName string, domain domain.BaseModel
 	return nil
 }
 
+// UpsertOne replaces the fields of the document matching the filter, inserting it when there is none
+func UpsertOne(paramLog *basic.ParamLog, colName string, filter bson.M, domain domain.BaseModel) error {
+
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	document, err := toDoc(domain)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		filter,
+		bson.M{"$set": document},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	return nil
+}
+
+func UpsertQuery(paramLog *basic.ParamLog, colName string, filter bson.M, update bson.M) error {
+
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	_, err := collection.UpdateOne(
+		context.TODO(),
+		filter,
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	return nil
+}
+
 func UpdateQuery(paramLog *basic.ParamLog, colName string, id primitive.ObjectID, update bson.M) error {
 
 	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
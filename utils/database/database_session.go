@@ -1,7 +1,9 @@
 package database
 
 import (
+	"math/rand"
 	"os"
+	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/utils"
@@ -9,8 +11,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const MAX_RETRYABLE_ATTEMPT = 5
+
 func CommitWithRetry(sctx mongo.SessionContext) error {
 	for {
 		err := sctx.CommitTransaction(sctx)
@@ -29,6 +34,7 @@ func CommitWithRetry(sctx mongo.SessionContext) error {
 }
 
 func RunTransactionWithRetry(sessionCtx mongo.SessionContext, function func(mongo.SessionContext) error) error {
+	attempt := 0
 	for {
 		err := function(sessionCtx)
 		if err == nil {
@@ -39,10 +45,26 @@ func RunTransactionWithRetry(sessionCtx mongo.SessionContext, function func(mong
 			continue
 		}
 
+		// Conflicts on hot documents back off with jitter so concurrent writers spread out
+		if utils.IsRetryable(err) && attempt < MAX_RETRYABLE_ATTEMPT {
+			attempt++
+			time.Sleep(time.Duration(attempt*attempt*10+rand.Intn(20)) * time.Millisecond)
+			continue
+		}
+
 		return err
 	}
 }
 
+func IsWriteConflict(err error) bool {
+	serverErr, ok := err.(mongo.ServerError)
+	if !ok {
+		return false
+	}
+
+	return serverErr.HasErrorCode(112)
+}
+
 func SessionFindOneByID(colName string, ID string, session mongo.SessionContext) *mongo.SingleResult {
 	objectID, _ := primitive.ObjectIDFromHex(ID)
 
@@ -82,6 +104,34 @@ func SessionUpdateOne(paramLog *basic.ParamLog, domain domain.BaseModel, session
 	return nil
 }
 
+func SessionUpdateOneWithFilter(paramLog *basic.ParamLog, domain domain.BaseModel, filter bson.M,
+	session mongo.SessionContext) (*mongo.UpdateResult, error) {
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(domain.CollectionName())
+	document, err := toDoc(domain)
+	if err != nil {
+		return nil, utils.ErrorInternalServer(paramLog, utils.UpdateFailed, err.Error())
+	}
+
+	filter["_id"] = domain.GetDocumentID()
+	update := bson.M{"$set": document}
+
+	return collection.UpdateOne(session, filter, update)
+}
+
+func SessionFindOneAndUpdate(colName string, filter bson.M, update bson.M, session mongo.SessionContext) *mongo.SingleResult {
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	return collection.FindOneAndUpdate(session, filter, update, opts)
+}
+
+func SessionFindOneAndUpsert(colName string, filter bson.M, update bson.M, session mongo.SessionContext) *mongo.SingleResult {
+	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(colName)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
+
+	return collection.FindOneAndUpdate(session, filter, update, opts)
+}
+
 func SessionSaveOne(domain domain.BaseModel, session mongo.SessionContext) error {
 
 	collection := DBClient.Database(os.Getenv("MONGO_DB_NAME")).Collection(domain.CollectionName())
@@ -49,6 +49,32 @@ const (
 	InvalidReceiverType                = 833
 	ExternalIDNotFound                 = 834
 	InvalidLevelAccessRevoke           = 835
+	AmountOverflow                     = 836
+	FXRateNotFound                     = 837
+	FXQuoteExpired                     = 838
+	InvalidFXQuote                     = 839
+	BalanceFrozen                      = 840
+	BalanceClosed                      = 841
+	InvalidBalanceStatus               = 842
+	LimitExceeded                      = 843
+	InvalidLimit                       = 844
+	InvalidFeeSchedule                 = 845
+	InvalidFeeQuote                    = 846
+	FeeQuoteExpired                    = 847
+	InvalidFeePeriod                   = 848
+	InvoiceNotFound                    = 849
+	InvalidInvoiceStatus               = 850
+	InvalidPromotion                   = 851
+	PromotionExhausted                 = 852
+	InvalidGatewayRouting              = 853
+	InvalidTransferRequery             = 854
+	BeneficiaryNameMismatch            = 855
+	InvalidVirtualAccount              = 856
+	InvalidVAInvoice                   = 857
+	VAInvoicePaymentMismatch           = 858
+	InvalidSuspenseItem                = 859
+	InvalidPartnerCallback             = 860
+	InvalidWebhook                     = 861
 	SprintParamError                   = 880
 	SprintDeletedVA                    = 881
 	InvalidNameFormat                  = 882
@@ -109,6 +135,11 @@ const (
 	StripeAPICallFail         = 936
 	SaveFileFailed            = 937
 	PermataApiCallFailed      = 938
+	UnbalancedJournal         = 939
+	BalanceConflict           = 940
+	CorporateHierarchyInvalid = 941
+	GatewayNotSupported       = 942
+	CallbackInProgress        = 943
 )
 
 type CustomError struct {
@@ -116,6 +147,8 @@ type CustomError struct {
 	Code        int    `json:"code"`
 	Description string `json:"description"`
 	Time        string `json:"time"`
+	Retryable   bool   `json:"-"`
+	Unavailable bool   `json:"-"`
 }
 
 func (error CustomError) Error() string {
@@ -145,6 +178,43 @@ func ErrorUnprocessableEntity(paramLog *basic.ParamLog, errorCode int, logMessag
 	}
 }
 
+// Conflict error is raised when a concurrent write won, the whole database transaction can be retried
+func ErrorConflict(paramLog *basic.ParamLog, errorCode int, logMessage string) error {
+	_, fn, line, _ := runtime.Caller(1)
+	basic.LogError(paramLog, fmt.Sprintf("Conflict on %v at line %v (%v)", fn, line, logMessage))
+
+	return CustomError{
+		HttpStatus:  http.StatusConflict,
+		Code:        errorCode,
+		Description: "Conflict, please retry",
+		Time:        TimestampNow(),
+		Retryable:   true,
+	}
+}
+
+func IsRetryable(err error) bool {
+	customError, ok := err.(CustomError)
+	if !ok {
+		return false
+	}
+
+	return customError.Retryable
+}
+
+// Unavailable error is raised when a provider could not be reached, timed out or answered 5xx
+func ErrorUnavailable(paramLog *basic.ParamLog, errorCode int, logMessage string) error {
+	_, fn, line, _ := runtime.Caller(1)
+	basic.LogError(paramLog, fmt.Sprintf("Provider unavailable on %v at line %v (%v)", fn, line, logMessage))
+
+	return CustomError{
+		HttpStatus:  http.StatusInternalServerError,
+		Code:        errorCode,
+		Description: "Internal Server Error",
+		Time:        TimestampNow(),
+		Unavailable: true,
+	}
+}
+
 func ErrorInternalServer(paramLog *basic.ParamLog, errorCode int, logMessage string) error {
 	_, fn, line, _ := runtime.Caller(1)
 	basic.LogError(paramLog, fmt.Sprintf("Internal server error on %v at line %v (%v)", fn, line, logMessage))
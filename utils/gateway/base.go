@@ -1,9 +1,13 @@
 package gateway
 
 import (
+	"context"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/kangdjoker/takeme-core/domain"
+	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
 )
 
@@ -19,9 +23,153 @@ const (
 
 type Gateway interface {
 	Name() string
-	CreateVA(paramLog *basic.ParamLog, balanceID string, nameVA string, bankCode string) (string, error)
-	CallbackVA(w http.ResponseWriter, r *http.Request) (string, int, domain.Bank, string, error)
-	CreateTransfer(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error)
-	CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error)
-	Inquiry(paramLog *basic.ParamLog, bankCode string, accountNumber string) (string, error)
+	Capabilities() Capabilities
+	CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error)
+	CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error)
+	CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error
+	CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error)
+	CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error)
+	TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error)
+	Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error)
+}
+
+type Capabilities struct {
+	VA             bool
+	Inquiry        bool
+	Transfer       bool
+	TransferStatus bool
+	WalletPayout   bool
+}
+
+type Options struct {
+	RequestID string
+}
+
+type Option func(*Options)
+
+// WithRequestID passes the request id of the caller to gateways that need one per call
+func WithRequestID(requestID string) Option {
+	return func(options *Options) {
+		options.RequestID = requestID
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// VARequest asks for an open amount permanent VA unless Amount is set, a VA with an amount is closed
+// to that amount and paid once. A zero ExpiresAt never expires.
+type VARequest struct {
+	ExternalID string
+	Name       string
+	BankCode   string
+	Amount     int
+	ExpiresAt  time.Time
+}
+
+type VAResult struct {
+	BankCode      string
+	AccountNumber string
+	Reference     string
+}
+
+// VACallback is a payment into a virtual account. Providers that do not echo the external ID only
+// tell the paid AccountNumber. Payload is the body as the provider sent it.
+type VACallback struct {
+	ExternalID    string
+	AccountNumber string
+	Amount        int
+	From          domain.Bank
+	Reference     string
+	Payload       []byte
+}
+
+type TransferResult struct {
+	Reference string
+}
+
+// TransferCallback is the status of a transfer, Payload is the body of a callback as the provider
+// sent it and empty when the status was asked for
+type TransferCallback struct {
+	TransactionCode string
+	Reference       string
+	Status          string
+	Payload         []byte
+}
+
+type InquiryRequest struct {
+	BankCode      string
+	AccountNumber string
+}
+
+type InquiryResult struct {
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+}
+
+var registry = map[string]Gateway{}
+
+// Register makes the gateway available by its code, adapters register themselves in init
+func Register(gateway Gateway) {
+	if _, ok := registry[gateway.Name()]; ok {
+		panic("gateway: Register called twice for gateway " + gateway.Name())
+	}
+
+	registry[gateway.Name()] = gateway
+}
+
+func Get(code string) (Gateway, bool) {
+	gateway, ok := registry[code]
+	return gateway, ok
+}
+
+// Registered lists the registered gateways ordered by code
+func Registered() []Gateway {
+	gateways := []Gateway{}
+	for _, gateway := range registry {
+		gateways = append(gateways, gateway)
+	}
+
+	sort.Slice(gateways, func(i, j int) bool {
+		return gateways[i].Name() < gateways[j].Name()
+	})
+
+	return gateways
+}
+
+// IsWallet tells whether the institution is an e-wallet rather than a bank
+func IsWallet(institutionCode string) bool {
+	if institutionCode == utils.DANA ||
+		institutionCode == utils.GOPAY ||
+		institutionCode == utils.SHOPEEPAY ||
+		institutionCode == utils.OVO ||
+		institutionCode == utils.LINK_AJA {
+
+		return true
+	}
+
+	return false
+}
+
+func notSupported(paramLog *basic.ParamLog, gateway Gateway, operation string) error {
+	return utils.ErrorInternalServer(paramLog, utils.GatewayNotSupported,
+		"Gateway "+gateway.Name()+" does not support "+operation)
+}
+
+// callbackPayload is the raw body the security middleware kept in the request context
+func callbackPayload(r *http.Request) []byte {
+	payload, _ := r.Context().Value("payload").([]byte)
+	return payload
+}
+
+func requestTracing(r *http.Request) *basic.ParamLog {
+	ioCloser, span, tag := basic.RequestToTracing(r)
+	return &basic.ParamLog{Span: span, TrCloser: ioCloser, Tag: tag}
 }
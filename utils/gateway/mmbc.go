@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"os"
@@ -17,52 +18,104 @@ import (
 type MMBCGateway struct {
 }
 
+func init() {
+	Register(MMBCGateway{})
+}
+
 func (gateway MMBCGateway) Name() string {
 	return MMBC
 }
 
-func (gateway MMBCGateway) CreateVA(balanceID string, nameVA string, bankCode string) (string, error) {
-	return "", nil
+func (gateway MMBCGateway) Capabilities() Capabilities {
+	return Capabilities{Transfer: true, TransferStatus: true, WalletPayout: true}
+}
+
+func (gateway MMBCGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error) {
+	return VAResult{}, notSupported(paramLog, gateway, "virtual account")
+}
+
+func (gateway MMBCGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error) {
+	return VACallback{}, notSupported(requestTracing(r), gateway, "virtual account")
 }
 
-func (gateway MMBCGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (string, int, domain.Bank, string, error) {
-	return "", 0, domain.Bank{}, "", nil
+func (gateway MMBCGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error {
+	return notSupported(paramLog, gateway, "virtual account")
 }
 
-func (gateway MMBCGateway) CreateTransfer(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
-	if checkIsTransferToWallet(transaction.To.InstitutionCode) {
-		referece, err := createTransferToWallet(paramLog, transaction)
-		return referece, err
+func (gateway MMBCGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error) {
+	if IsWallet(transaction.To.InstitutionCode) {
+		referece, err := createTransferToWallet(ctx, paramLog, transaction)
+		return TransferResult{Reference: referece}, err
 	} else {
-		referece, err := createTransferToBank(paramLog, transaction)
-		return referece, err
+		referece, err := createTransferToBank(ctx, paramLog, transaction)
+		return TransferResult{Reference: referece}, err
 	}
 }
 
-func (gateway MMBCGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error) {
-	ioCloser, span, tag := basic.RequestToTracing(r)
-	paramLog := &basic.ParamLog{Span: span, TrCloser: ioCloser, Tag: tag}
+func (gateway MMBCGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error) {
+	paramLog := requestTracing(r)
 	basic.LogInformation(paramLog, "------------------------ MMBC hit callback transfer ------------------------")
 	var payload MMBCTransferResponse
 
 	err := utils.LoadPayload(r, &payload)
 	if err != nil {
 		basic.LogInformation(paramLog, "Failed process mmbc callback ")
-		return "", "", "", err
+		return TransferCallback{}, err
 	}
 
-	transactionCode := payload.Invoice
-	reference := payload.Invoice
-	status := convertStatusMMBC(payload.Status)
+	return TransferCallback{
+		TransactionCode: payload.Invoice,
+		Reference:       payload.Invoice,
+		Status:          convertStatusMMBC(payload.Status),
+		Payload:         callbackPayload(r),
+	}, nil
+}
 
-	return transactionCode, reference, status, nil
+// TransferStatus asks MMBC for the state of the invoice, a transfer MMBC only confirmed is pending
+func (gateway MMBCGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error) {
+	client := resty.New()
+	client.SetTimeout(20 * time.Second)
+	url := os.Getenv("MMBC_TRANSFER_STATUS_API_URL")
+
+	var result MMBCTransferResponse
+	_, err := client.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{
+			"username": os.Getenv("MMBC_USERNAME"),
+			"password": os.Getenv("MMBC_PASSWORD"),
+			"invoice":  mmbcInvoice(transaction),
+		}).
+		SetResult(&result).Post(url)
+
+	if err != nil {
+		return TransferCallback{}, utils.ErrorInternalServer(paramLog, utils.MMBCApiCallFailed, err.Error())
+	}
+
+	b, _ := json.Marshal(result)
+	basic.LogInformation(paramLog, "Response mmbc transfer status "+string(b))
+
+	if result.Result != "ok" {
+		basic.LogInformation(paramLog, "Failed reason mmbc transfer status "+result.Reason)
+		return TransferCallback{}, utils.ErrorInternalServer(paramLog, utils.MMBCApiCallFailed, "MMBC API Call failed")
+	}
+
+	status := convertStatusMMBC(result.Status)
+	if result.Status == "" || result.Status == "CONFIRM" || result.Status == "PENDING" {
+		status = domain.PENDING_STATUS
+	}
+
+	return TransferCallback{
+		TransactionCode: transaction.TransactionCode,
+		Reference:       transaction.GatewayReference,
+		Status:          status,
+	}, nil
 }
 
-func (gateway MMBCGateway) Inquiry(bankCode string, accountNumber string) (string, error) {
-	return "", nil
+func (gateway MMBCGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error) {
+	return InquiryResult{}, notSupported(paramLog, gateway, "inquiry")
 }
 
-func createTransferToBank(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
+func createTransferToBank(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
 	client := resty.New()
 	client.SetTimeout(10 * time.Minute)
 	url := os.Getenv("MMBC_TRANSFER_API_URL")
@@ -75,10 +128,11 @@ func createTransferToBank(paramLog *basic.ParamLog, transaction domain.Transacti
 	// need convert
 	bankAccount := transaction.To.AccountNumber
 	amount := strconv.Itoa(transaction.SubAmount)
-	invoice := strings.Replace(transaction.TransactionCode, ":", "", -1)[9:]
+	invoice := mmbcInvoice(transaction)
 
 	var result MMBCTransferResponse
-	_, err := client.R().
+	resp, err := client.R().
+		SetContext(ctx).
 		SetFormData(map[string]string{
 			"username":           os.Getenv("MMBC_USERNAME"),
 			"password":           os.Getenv("MMBC_PASSWORD"),
@@ -91,7 +145,11 @@ func createTransferToBank(paramLog *basic.ParamLog, transaction domain.Transacti
 		SetResult(&result).Post(url)
 
 	if err != nil {
-		return "", utils.ErrorInternalServer(paramLog, utils.MMBCApiCallFailed, err.Error())
+		return "", utils.ErrorUnavailable(paramLog, utils.MMBCApiCallFailed, err.Error())
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return "", utils.ErrorUnavailable(paramLog, utils.MMBCApiCallFailed, "MMBC API Call status "+strconv.Itoa(resp.StatusCode()))
 	}
 
 	b, _ := json.Marshal(result)
@@ -107,7 +165,7 @@ func createTransferToBank(paramLog *basic.ParamLog, transaction domain.Transacti
 	return result.Invoice, nil
 }
 
-func createTransferToWallet(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
+func createTransferToWallet(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
 	client := resty.New()
 	client.SetTimeout(10 * time.Minute)
 	url := os.Getenv("MMBC_TRANSFER_WALLET_API_URL")
@@ -119,10 +177,11 @@ func createTransferToWallet(paramLog *basic.ParamLog, transaction domain.Transac
 
 	bankAccount := transaction.To.AccountNumber
 	amount := strconv.Itoa(transaction.SubAmount)
-	invoice := strings.Replace(transaction.TransactionCode, ":", "", -1)[9:]
+	invoice := mmbcInvoice(transaction)
 
 	var result MMBCTransferWalletResponse
-	_, err := client.R().
+	resp, err := client.R().
+		SetContext(ctx).
 		SetFormData(map[string]string{
 			"username":               os.Getenv("MMBC_USERNAME"),
 			"password":               os.Getenv("MMBC_PASSWORD"),
@@ -134,7 +193,11 @@ func createTransferToWallet(paramLog *basic.ParamLog, transaction domain.Transac
 		SetResult(&result).Post(url)
 
 	if err != nil {
-		return "", utils.ErrorInternalServer(paramLog, utils.MMBCApiCallFailed, err.Error())
+		return "", utils.ErrorUnavailable(paramLog, utils.MMBCApiCallFailed, err.Error())
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return "", utils.ErrorUnavailable(paramLog, utils.MMBCApiCallFailed, "MMBC API Call status "+strconv.Itoa(resp.StatusCode()))
 	}
 
 	b, _ := json.Marshal(result)
@@ -181,6 +244,10 @@ type MMBCTransferResponse struct {
 	Status                string `json:"status"`
 }
 
+func mmbcInvoice(transaction domain.Transaction) string {
+	return strings.Replace(transaction.TransactionCode, ":", "", -1)[9:]
+}
+
 func convertStatusMMBC(status string) string {
 	if status == "REFUND" {
 		return domain.REFUND_STATUS
@@ -209,16 +276,3 @@ func convertStatusMMBC(status string) string {
 // 		log.Info("Failed fake callback mmbc")
 // 	}
 // }
-
-func checkIsTransferToWallet(institutionCode string) bool {
-	if institutionCode == utils.DANA ||
-		institutionCode == utils.GOPAY ||
-		institutionCode == utils.SHOPEEPAY ||
-		institutionCode == utils.OVO ||
-		institutionCode == utils.LINK_AJA {
-
-		return true
-	}
-
-	return false
-}
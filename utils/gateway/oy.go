@@ -1,7 +1,9 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
+	"math"
 	"net/http"
 	"os"
 	"time"
@@ -15,18 +17,125 @@ import (
 type OYGateway struct {
 }
 
+func init() {
+	Register(OYGateway{})
+}
+
 func (gateway OYGateway) Name() string {
 	return OY
 }
 
-func (gateway OYGateway) CreateVA(balanceID string, nameVA string, bankCode string) (string, error) {
-	return "", nil
+func (gateway OYGateway) Capabilities() Capabilities {
+	return Capabilities{VA: true, Inquiry: true, Transfer: true, TransferStatus: true}
+}
+
+// CreateVA opens a static VA, partner_user_id carries the external ID so the payment callback names
+// the balance. OY counts the expiration in minutes.
+func (gateway OYGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error) {
+	client := resty.New()
+	client.SetTimeout(60 * time.Second)
+	url := os.Getenv("OY_VA_API_URL")
+
+	bankCode := utils.ConvertBankCodeOY(request.BankCode)
+	if bankCode == "" {
+		return VAResult{}, utils.ErrorBadRequest(paramLog, utils.BankCodeNotFound, "VA bank code OY not found")
+	}
+
+	var result OYVAResponse
+	payload := OYVAPayload{
+		PartnerUserID:   request.ExternalID,
+		BankCode:        bankCode,
+		Amount:          request.Amount,
+		IsOpen:          request.Amount == 0,
+		IsSingleUse:     request.Amount > 0,
+		IsLifetime:      request.ExpiresAt.IsZero(),
+		UsernameDisplay: request.Name,
+		TransactionID:   NewOptions(opts...).RequestID,
+	}
+	if !request.ExpiresAt.IsZero() {
+		payload.ExpirationTime = int(math.Ceil(time.Until(request.ExpiresAt).Minutes()))
+	}
+
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(map[string]string{
+			"Content-Type":  "application/json",
+			"x-oy-username": os.Getenv("OY_PUBLIC_KEY"),
+			"x-api-key":     os.Getenv("OY_API_KEY"),
+		}).
+		SetBody(payload).
+		SetResult(&result).Post(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "OY Create VA API Call ")
+
+	if err != nil {
+		return VAResult{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+	}
+
+	if result.Status.Code != "000" || result.VANumber == "" {
+		return VAResult{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, "OY Create VA API Call "+result.Status.Message)
+	}
+
+	return VAResult{BankCode: request.BankCode, AccountNumber: result.VANumber, Reference: result.ID}, nil
 }
-func (gateway OYGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (string, int, domain.Bank, string, error) {
-	return "", 0, domain.Bank{}, "", nil
+
+func (gateway OYGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error) {
+	paramLog := requestTracing(r)
+	basic.LogInformation(paramLog, "------------------------ OY hit callback topup ------------------------")
+
+	var payload OYVACallbackPayload
+	err := utils.LoadPayload(r, &payload)
+	if err != nil {
+		return VACallback{}, err
+	}
+
+	if !payload.Success {
+		return VACallback{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "OY VA callback is not a success payment")
+	}
+
+	return VACallback{
+		ExternalID:    payload.PartnerUserID,
+		AccountNumber: payload.VANumber,
+		Amount:        payload.Amount,
+		From: domain.Bank{
+			BankCode:      payload.BankCode,
+			AccountNumber: payload.VANumber,
+			Name:          payload.PayerName,
+		},
+		Reference: payload.Reference,
+		Payload:   callbackPayload(r),
+	}, nil
 }
 
-func (gateway OYGateway) CreateTransfer(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
+func (gateway OYGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error {
+	client := resty.New()
+	client.SetTimeout(60 * time.Second)
+	url := os.Getenv("OY_VA_DEACTIVATE_API_URL") + "/" + va.Reference
+
+	var result OYVAResponse
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(map[string]string{
+			"Content-Type":  "application/json",
+			"x-oy-username": os.Getenv("OY_PUBLIC_KEY"),
+			"x-api-key":     os.Getenv("OY_API_KEY"),
+		}).
+		SetResult(&result).Put(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), url, result, "OY Deactivate VA API Call ")
+
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+	}
+
+	if result.Status.Code != "000" {
+		return utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, "OY Deactivate VA API Call "+result.Status.Message)
+	}
+
+	return nil
+}
+
+func (gateway OYGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error) {
 	client := resty.New()
 	client.SetTimeout(10 * time.Minute)
 	url := os.Getenv("OY_TRANSFER_API_URL")
@@ -46,6 +155,7 @@ func (gateway OYGateway) CreateTransfer(paramLog *basic.ParamLog, transaction do
 	}
 
 	resp, err := client.R().
+		SetContext(ctx).
 		SetHeaders(map[string]string{
 			"Content-Type":  "application/json",
 			"x-oy-username": os.Getenv("OY_PUBLIC_KEY"),
@@ -57,7 +167,7 @@ func (gateway OYGateway) CreateTransfer(paramLog *basic.ParamLog, transaction do
 	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "OY Transfer API Call ")
 
 	if err != nil {
-		return "TIMEOUT", utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+		return TransferResult{Reference: "TIMEOUT"}, utils.ErrorUnavailable(paramLog, utils.OYApiCallFailed, err.Error())
 	}
 
 	reference := result.Reference
@@ -66,28 +176,67 @@ func (gateway OYGateway) CreateTransfer(paramLog *basic.ParamLog, transaction do
 		reference = "CUT OFF"
 	}
 
-	return reference, nil
+	return TransferResult{Reference: reference}, nil
 }
 
-func (gateway OYGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error) {
-	ioCloser, span, tag := basic.RequestToTracing(r)
-	paramLog := &basic.ParamLog{Span: span, TrCloser: ioCloser, Tag: tag}
+func (gateway OYGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error) {
+	paramLog := requestTracing(r)
 	basic.LogInformation(paramLog, "------------------------ OY hit callback transfer ------------------------")
 
 	var payload OYTransferCallbackPayload
 	err := utils.LoadPayload(r, &payload)
 	if err != nil {
-		return "", "", "", err
+		return TransferCallback{}, err
 	}
 
-	transactionCode := payload.TransactionID
-	reference := payload.Reference
-	status := convertStatusOY(payload.Status)
+	return TransferCallback{
+		TransactionCode: payload.TransactionID,
+		Reference:       payload.Reference,
+		Status:          convertStatusOY(payload.Status),
+		Payload:         callbackPayload(r),
+	}, nil
+}
+
+// TransferStatus asks OY for the state of a transfer whose callback never came
+func (gateway OYGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error) {
+	client := resty.New()
+	client.SetTimeout(20 * time.Second)
+	url := os.Getenv("OY_TRANSFER_STATUS_API_URL")
+
+	var result OYTransferResponse
+	payload := OYTransferStatusPayload{
+		TransactionID: transaction.TransactionCode,
+		SendCallback:  false,
+	}
 
-	return transactionCode, reference, status, nil
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(map[string]string{
+			"Content-Type":  "application/json",
+			"x-oy-username": os.Getenv("OY_PUBLIC_KEY"),
+			"x-api-key":     os.Getenv("OY_API_KEY"),
+		}).
+		SetBody(payload).
+		SetResult(&result).Post(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "OY Transfer Status API Call ")
+
+	if err != nil {
+		return TransferCallback{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+	}
+
+	if result.Status.Code == "" {
+		return TransferCallback{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, "OY Transfer Status API Call ")
+	}
+
+	return TransferCallback{
+		TransactionCode: transaction.TransactionCode,
+		Reference:       result.Reference,
+		Status:          convertStatusOY(result.Status),
+	}, nil
 }
 
-func (gateway OYGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, accountNumber string) (string, error) {
+func (gateway OYGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error) {
 
 	client := resty.New()
 	client.SetTimeout(20 * time.Second)
@@ -95,14 +244,14 @@ func (gateway OYGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, acco
 
 	url := os.Getenv("OY_INQUIRY_API_URL")
 
-	bankCode = utils.ConvertBankCodeOY(bankCode)
+	bankCode := utils.ConvertBankCodeOY(request.BankCode)
 	if bankCode == "" {
-		return "", utils.ErrorBadRequest(paramLog, utils.BankCodeNotFound, "Inquiry bank code OY not found")
+		return InquiryResult{}, utils.ErrorBadRequest(paramLog, utils.BankCodeNotFound, "Inquiry bank code OY not found")
 	}
 
 	var result OYInquiryResponse
 	payload := OYInquiryPayload{
-		AccountNumber: accountNumber,
+		AccountNumber: request.AccountNumber,
 		BankCode:      bankCode,
 	}
 
@@ -112,6 +261,7 @@ func (gateway OYGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, acco
 		"x-api-key":     os.Getenv("OY_API_KEY"),
 	}
 	resp, err := client.R().
+		SetContext(ctx).
 		SetHeaders(header).
 		SetBody(payload).
 		SetResult(&result).Post(url)
@@ -122,18 +272,22 @@ func (gateway OYGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, acco
 	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "OY Inquiry API Call ")
 
 	if err != nil {
-		return "", utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+		return InquiryResult{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
 	}
 
 	if result.Status.Code == "209" {
-		return "", utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Account holder name is empty string")
+		return InquiryResult{}, utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Account holder name is empty string")
 	}
 
 	if result.Status.Code != "000" {
-		return "", utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, "OY Inquiry API Call ")
+		return InquiryResult{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, "OY Inquiry API Call ")
 	}
 
-	return result.AccountName, nil
+	return InquiryResult{
+		BankCode:      request.BankCode,
+		AccountNumber: request.AccountNumber,
+		AccountName:   result.AccountName,
+	}, nil
 }
 
 type OYTransferPayload struct {
@@ -154,6 +308,11 @@ type OYTransferResponse struct {
 	Time             string   `json:"timestamp"`
 }
 
+type OYTransferStatusPayload struct {
+	TransactionID string `json:"partner_trx_id"`
+	SendCallback  bool   `json:"send_callback"`
+}
+
 type OYTransferCallbackPayload struct {
 	Status                 OYStatus `json:"status"`
 	TransactionID          string   `json:"partner_trx_id"`
@@ -161,6 +320,38 @@ type OYTransferCallbackPayload struct {
 	Reference              string   `json:"trx_id"`
 }
 
+type OYVAPayload struct {
+	PartnerUserID   string `json:"partner_user_id"`
+	BankCode        string `json:"bank_code"`
+	Amount          int    `json:"amount"`
+	IsOpen          bool   `json:"is_open"`
+	IsSingleUse     bool   `json:"is_single_use"`
+	IsLifetime      bool   `json:"is_lifetime"`
+	UsernameDisplay string `json:"username_display"`
+	TransactionID   string `json:"partner_trx_id,omitempty"`
+	ExpirationTime  int    `json:"expiration_time,omitempty"`
+}
+
+type OYVAResponse struct {
+	ID            string   `json:"id"`
+	Status        OYStatus `json:"status"`
+	VANumber      string   `json:"va_number"`
+	BankCode      string   `json:"bank_code"`
+	VAStatus      string   `json:"va_status"`
+	PartnerUserID string   `json:"partner_user_id"`
+}
+
+type OYVACallbackPayload struct {
+	VANumber      string `json:"va_number"`
+	BankCode      string `json:"bank_code"`
+	Amount        int    `json:"amount"`
+	PartnerUserID string `json:"partner_user_id"`
+	Success       bool   `json:"success"`
+	PayerName     string `json:"payer_name"`
+	Reference     string `json:"trx_id"`
+	Time          string `json:"tx_date"`
+}
+
 type OYStatus struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
@@ -1,32 +1,161 @@
 package gateway
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/kangdjoker/takeme-core/domain"
 	"github.com/kangdjoker/takeme-core/utils"
 	"github.com/kangdjoker/takeme-core/utils/basic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type PermataGateway struct {
-	Gateway
+}
+
+func init() {
+	Register(PermataGateway{})
 }
 
 func (gw PermataGateway) Name() string {
 	return Permata
 }
-func (gw PermataGateway) CreateVA(balanceID string, nameVA string, bankCode string) (string, error) {
-	return "", nil
+func (gw PermataGateway) Capabilities() Capabilities {
+	return Capabilities{VA: true, Inquiry: true, Transfer: true}
+}
+
+// CreateVA registers a VA under the partner service id, open amount unless the request has one. The customer number comes from
+// the external ID, an ObjectID, and the external ID is sent as trxId so the payment notification
+// names the balance.
+func (gw PermataGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error) {
+	customerNo, err := permataCustomerNo(request.ExternalID)
+	if err != nil {
+		return VAResult{}, utils.ErrorBadRequest(paramLog, utils.InvalidVirtualAccount, "Permata VA external id must be an object id")
+	}
+
+	client := resty.New()
+	client.SetTimeout(60 * time.Second)
+	url := os.Getenv("PERMATA_VA_CREATE_API_URL")
+
+	partnerServiceID := os.Getenv("PERMATA_VA_PARTNER_SERVICE_ID")
+	var result PermataVAResponse
+	payload := PermataVAPayload{
+		PartnerServiceID:      partnerServiceID,
+		CustomerNo:            customerNo,
+		VirtualAccountNo:      partnerServiceID + customerNo,
+		VirtualAccountName:    request.Name,
+		TrxID:                 request.ExternalID,
+		VirtualAccountTrxType: "O",
+	}
+	if request.Amount > 0 {
+		payload.VirtualAccountTrxType = "C"
+		payload.TotalAmount = &PermataAmount{Value: fmt.Sprintf("%d.00", request.Amount), Currency: "IDR"}
+	}
+	if !request.ExpiresAt.IsZero() {
+		payload.ExpiredDate = request.ExpiresAt.Format(time.RFC3339)
+	}
+
+	header := map[string]string{
+		"Content-Type": "application/json",
+		"X-APP":        os.Getenv("PERMATA_API_KEY"),
+	}
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(header).
+		SetBody(payload).
+		SetResult(&result).Post(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "Permata Create VA API Call ")
+
+	if err != nil {
+		return VAResult{}, utils.ErrorInternalServer(paramLog, utils.PermataApiCallFailed, err.Error())
+	}
+
+	if len(result.ResponseCode) < 3 || result.ResponseCode[:3] != "200" {
+		return VAResult{}, utils.ErrorInternalServer(paramLog, utils.PermataApiCallFailed, "Permata Create VA API Call "+result.ResponseMessage)
+	}
+
+	return VAResult{
+		BankCode:      request.BankCode,
+		AccountNumber: strings.TrimSpace(payload.VirtualAccountNo),
+		Reference:     customerNo,
+	}, nil
+}
+func (gw PermataGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error) {
+	paramLog := requestTracing(r)
+	basic.LogInformation(paramLog, "------------------------ Permata hit callback topup ------------------------")
+
+	var payload PermataVACallbackPayload
+	err := utils.LoadPayload(r, &payload)
+	if err != nil {
+		return VACallback{}, err
+	}
+
+	amount, err := strconv.ParseFloat(payload.PaidAmount.Value, 64)
+	if err != nil {
+		return VACallback{}, utils.ErrorBadRequest(paramLog, utils.InvalidRequestPayload, "Permata VA callback invalid paid amount")
+	}
+
+	accountNumber := strings.TrimSpace(payload.VirtualAccountNo)
+
+	return VACallback{
+		ExternalID:    payload.TrxID,
+		AccountNumber: accountNumber,
+		Amount:        int(amount),
+		From: domain.Bank{
+			BankCode:      utils.PERMATA,
+			AccountNumber: accountNumber,
+			Name:          payload.VirtualAccountName,
+		},
+		Reference: payload.PaymentRequestID,
+		Payload:   callbackPayload(r),
+	}, nil
 }
-func (gw PermataGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (string, int, domain.Bank, string, error) {
-	return "", 0, domain.Bank{}, "", nil
+func (gw PermataGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error {
+	client := resty.New()
+	client.SetTimeout(60 * time.Second)
+	url := os.Getenv("PERMATA_VA_DELETE_API_URL")
+
+	partnerServiceID := os.Getenv("PERMATA_VA_PARTNER_SERVICE_ID")
+	var result PermataVAResponse
+	payload := PermataVAPayload{
+		PartnerServiceID: partnerServiceID,
+		CustomerNo:       va.Reference,
+		VirtualAccountNo: partnerServiceID + va.Reference,
+	}
+
+	header := map[string]string{
+		"Content-Type": "application/json",
+		"X-APP":        os.Getenv("PERMATA_API_KEY"),
+	}
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(header).
+		SetBody(payload).
+		SetResult(&result).Post(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "Permata Delete VA API Call ")
+
+	if err != nil {
+		return utils.ErrorInternalServer(paramLog, utils.PermataApiCallFailed, err.Error())
+	}
+
+	if len(result.ResponseCode) < 3 || result.ResponseCode[:3] != "200" {
+		return utils.ErrorInternalServer(paramLog, utils.PermataApiCallFailed, "Permata Delete VA API Call "+result.ResponseMessage)
+	}
+
+	return nil
 }
-func (gw PermataGateway) CreateTransfer(paramLog *basic.ParamLog, transaction *domain.Transaction, requestId string) (string, error) {
+func (gw PermataGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error) {
+	requestId := NewOptions(opts...).RequestID
 	client := resty.New()
 	client.SetTimeout(20 * time.Second)
 	client.SetRetryCount(1)
@@ -74,6 +203,7 @@ func (gw PermataGateway) CreateTransfer(paramLog *basic.ParamLog, transaction *d
 		"X-APP":        os.Getenv("PERMATA_API_KEY"),
 	}
 	resp, err := client.R().
+		SetContext(ctx).
 		SetHeaders(header).
 		SetBody(payload).
 		SetResult(&result).Post(url)
@@ -84,15 +214,20 @@ func (gw PermataGateway) CreateTransfer(paramLog *basic.ParamLog, transaction *d
 	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "Permata Payment API Call ")
 
 	if err != nil {
-		return requestId, utils.ErrorInternalServer(paramLog, utils.PermataApiCallFailed, err.Error())
+		return TransferResult{Reference: requestId}, utils.ErrorUnavailable(paramLog, utils.PermataApiCallFailed, err.Error())
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return TransferResult{Reference: requestId}, utils.ErrorUnavailable(paramLog, utils.PermataApiCallFailed,
+			"Permata Payment API Call status "+strconv.Itoa(resp.StatusCode()))
 	}
 
 	if len(result.ResponseCode) >= 3 {
 		if result.ResponseCode[:3] == "200" {
-			return requestId, nil
+			return TransferResult{Reference: requestId}, nil
 		} else {
 			i, _ := strconv.Atoi(result.ResponseCode)
-			return requestId, utils.CustomError{
+			return TransferResult{Reference: requestId}, utils.CustomError{
 				HttpStatus:  http.StatusBadRequest,
 				Code:        i,
 				Description: result.ResponseMessage,
@@ -100,11 +235,14 @@ func (gw PermataGateway) CreateTransfer(paramLog *basic.ParamLog, transaction *d
 			}
 		}
 	} else {
-		return requestId, utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Unknown response")
+		return TransferResult{Reference: requestId}, utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Unknown response")
 	}
 }
-func (gw PermataGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error) {
-	return "", "", "", nil
+func (gw PermataGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error) {
+	return TransferCallback{}, notSupported(requestTracing(r), gw, "transfer callback")
+}
+func (gw PermataGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error) {
+	return TransferCallback{}, notSupported(paramLog, gw, "transfer status")
 }
 
 type PermataInquiryInterbankPayload struct {
@@ -153,6 +291,37 @@ type PermataPaymentInterbankPayload struct {
 	BeneficiaryCustomerTownName       string `json:"beneficiaryCustomerTownName" bson:"beneficiaryCustomerTownName"`
 }
 
+type PermataVAPayload struct {
+	PartnerServiceID      string         `json:"partnerServiceId" bson:"partnerServiceId"`
+	CustomerNo            string         `json:"customerNo" bson:"customerNo"`
+	VirtualAccountNo      string         `json:"virtualAccountNo" bson:"virtualAccountNo"`
+	VirtualAccountName    string         `json:"virtualAccountName,omitempty" bson:"virtualAccountName"`
+	TrxID                 string         `json:"trxId,omitempty" bson:"trxId"`
+	VirtualAccountTrxType string         `json:"virtualAccountTrxType,omitempty" bson:"virtualAccountTrxType"`
+	TotalAmount           *PermataAmount `json:"totalAmount,omitempty" bson:"totalAmount"`
+	ExpiredDate           string         `json:"expiredDate,omitempty" bson:"expiredDate"`
+}
+
+type PermataVAResponse struct {
+	ResponseCode    string `json:"responseCode" bson:"responseCode"`
+	ResponseMessage string `json:"responseMessage" bson:"responseMessage"`
+}
+
+type PermataAmount struct {
+	Value    string `json:"value" bson:"value"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+type PermataVACallbackPayload struct {
+	PartnerServiceID   string        `json:"partnerServiceId" bson:"partnerServiceId"`
+	CustomerNo         string        `json:"customerNo" bson:"customerNo"`
+	VirtualAccountNo   string        `json:"virtualAccountNo" bson:"virtualAccountNo"`
+	VirtualAccountName string        `json:"virtualAccountName" bson:"virtualAccountName"`
+	PaymentRequestID   string        `json:"paymentRequestId" bson:"paymentRequestId"`
+	TrxID              string        `json:"trxId" bson:"trxId"`
+	PaidAmount         PermataAmount `json:"paidAmount" bson:"paidAmount"`
+}
+
 type PermataResponse struct {
 	ResponseCode       string `json:"responseCode" bson:"responseCode"`
 	ResponseMessage    string `json:"responseMessage" bson:"responseMessage"`
@@ -174,7 +343,11 @@ type PermataPaymentResponse struct {
 	ReferenceNo          string `json:"referenceNo" bson:"referenceNo"`
 }
 
-func (gw PermataGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, accountNumber string, requestId string) (string, error) {
+func (gw PermataGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error) {
+	bankCode := request.BankCode
+	accountNumber := request.AccountNumber
+	requestId := NewOptions(opts...).RequestID
+
 	client := resty.New()
 	client.SetTimeout(20 * time.Second)
 	client.SetRetryCount(1)
@@ -206,6 +379,7 @@ func (gw PermataGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, acco
 		"X-APP":        os.Getenv("PERMATA_API_KEY"),
 	}
 	resp, err := client.R().
+		SetContext(ctx).
 		SetHeaders(header).
 		SetBody(payload).
 		SetResult(&result).Post(url)
@@ -216,16 +390,33 @@ func (gw PermataGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, acco
 	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "Permata Inquiry API Call ")
 
 	if err != nil {
-		return "", utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
+		return InquiryResult{}, utils.ErrorInternalServer(paramLog, utils.OYApiCallFailed, err.Error())
 	}
 
 	if len(result.ResponseCode) >= 3 {
 		if result.ResponseCode[:3] == "200" {
-			return result.BeneficiaryAccountName, nil
+			return InquiryResult{
+				BankCode:      bankCode,
+				AccountNumber: accountNumber,
+				AccountName:   result.BeneficiaryAccountName,
+			}, nil
 		} else {
-			return "", utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, result.ResponseMessage)
+			return InquiryResult{}, utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, result.ResponseMessage)
 		}
 	} else {
-		return "", utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Unknown response")
+		return InquiryResult{}, utils.ErrorBadRequest(paramLog, utils.InquiryAccountHolderNameNotFound, "Unknown response")
 	}
 }
+
+// permataCustomerNo turns an ObjectID into digits, its seconds and its counter keep it unique
+func permataCustomerNo(externalID string) (string, error) {
+	ID, err := primitive.ObjectIDFromHex(externalID)
+	if err != nil {
+		return "", err
+	}
+
+	seconds := binary.BigEndian.Uint32(ID[0:4])
+	counter := uint32(ID[9])<<16 | uint32(ID[10])<<8 | uint32(ID[11])
+
+	return fmt.Sprintf("%010d%08d", seconds, counter), nil
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -29,28 +30,45 @@ const (
 type StripeGateway struct {
 }
 
+func init() {
+	Register(StripeGateway{})
+}
+
 func (gateway StripeGateway) Name() string {
 	return Stripe
 }
 
-func (gateway StripeGateway) CreateVA(paramLog *basic.ParamLog, balanceID string, nameVA string, bankCode string) (string, error) {
-	return "", nil
+// Capabilities is empty, Stripe only accepts card payments through its own methods
+func (gateway StripeGateway) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (gateway StripeGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error) {
+	return VAResult{}, notSupported(paramLog, gateway, "virtual account")
+}
+
+func (gateway StripeGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error) {
+	return VACallback{}, notSupported(requestTracing(r), gateway, "virtual account")
+}
+
+func (gateway StripeGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error {
+	return notSupported(paramLog, gateway, "virtual account")
 }
 
-func (gateway StripeGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (string, int, domain.Bank, string, error) {
-	return "", 0, domain.Bank{}, "", nil
+func (gateway StripeGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error) {
+	return TransferResult{}, notSupported(paramLog, gateway, "transfer")
 }
 
-func (gateway StripeGateway) CreateTransfer(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
-	return "", nil
+func (gateway StripeGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error) {
+	return TransferCallback{}, notSupported(requestTracing(r), gateway, "transfer callback")
 }
 
-func (gateway StripeGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error) {
-	return "", "", "", nil
+func (gateway StripeGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error) {
+	return TransferCallback{}, notSupported(paramLog, gateway, "transfer status")
 }
 
-func (gateway StripeGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, accountNumber string) (string, error) {
-	return "", nil
+func (gateway StripeGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error) {
+	return InquiryResult{}, notSupported(paramLog, gateway, "inquiry")
 }
 
 func (gateway StripeGateway) ChargeCard(paramLog *basic.ParamLog, balanceID string, amount int, returnURL string, card domain.Card, externalID string) (string, string, error) {
@@ -1,11 +1,10 @@
 package gateway
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -22,11 +21,23 @@ import (
 type XenditGateway struct {
 }
 
+func init() {
+	Register(XenditGateway{})
+}
+
 func (gateway XenditGateway) Name() string {
 	return Xendit
 }
 
-func (gateway XenditGateway) CreateVA(paramLog *basic.ParamLog, balanceID string, nameVA string, bankCode string) (string, error) {
+func (gateway XenditGateway) Capabilities() Capabilities {
+	return Capabilities{VA: true, Transfer: true, TransferStatus: true}
+}
+
+func (gateway XenditGateway) CreateVA(ctx context.Context, paramLog *basic.ParamLog, request VARequest, opts ...Option) (VAResult, error) {
+	balanceID := request.ExternalID
+	nameVA := request.Name
+	bankCode := request.BankCode
+
 	client := resty.New().SetTimeout(60 * time.Second)
 	url := os.Getenv("XENDIT_VA_API_URL")
 
@@ -37,63 +48,67 @@ func (gateway XenditGateway) CreateVA(paramLog *basic.ParamLog, balanceID string
 		"Content-Type":  "application/x-www-form-urlencoded",
 		"Authorization": basicAuth,
 	})
-	client.SetFormData(map[string]string{
+	formData := map[string]string{
 		"external_id": balanceID,
 		"bank_code":   bankCode,
 		"name":        nameVA,
-	})
+	}
+	if request.Amount > 0 {
+		formData["expected_amount"] = strconv.Itoa(request.Amount)
+		formData["is_closed"] = "true"
+		formData["is_single_use"] = "true"
+	}
+	if !request.ExpiresAt.IsZero() {
+		formData["expiration_date"] = request.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	client.SetFormData(formData)
 	client.SetRetryCount(1)
 
 	var result XenditCreateVAResponse
-	resp, err := client.R().SetResult(&result).Post(url)
+	resp, err := client.R().SetContext(ctx).SetResult(&result).Post(url)
 
-	utils.LoggingAPICall(paramLog, resp.StatusCode(), map[string]string{
-		"external_id": balanceID,
-		"bank_code":   bankCode,
-		"name":        nameVA,
-	}, result, "Xendit Create VA API ")
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), formData, result, "Xendit Create VA API ")
 
 	if err != nil || resp.StatusCode() != 200 {
-		return "", utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, "Failed call xendit")
+		return VAResult{}, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, "Failed call xendit")
 	}
 
-	return result.AccountNumber, nil
+	return VAResult{BankCode: bankCode, AccountNumber: result.AccountNumber, Reference: result.ID}, nil
 }
 
-func (gateway XenditGateway) TransferToPartner1(paramLog *basic.ParamLog, payload string, header http.Header, query url.Values) {
-	client := &http.Client{}
-	client.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	var data = strings.NewReader(payload)
-	url := os.Getenv("PARTNERCALLBACK1_URL_PAID") + "?" + query.Encode()
-	basic.LogInformation2(paramLog, "TransferToPartner1.URL", url)
-	req, err := http.NewRequest("POST", url, data)
-	if err != nil {
-		basic.LogInformation2(paramLog, "TransferToPartner1.Error1", err.Error())
-		return
-	}
-	header.Del("Connection")
-	req.Header = header
-	basic.LogInformation2(paramLog, "TransferToPartner1.Header", req.Header)
-	resp, err := client.Do(req)
-	if err != nil {
-		basic.LogInformation2(paramLog, "TransferToPartner1.Error2", err.Error())
-		return
+// CloseVA expires the fixed virtual account at once, Xendit has no other way to close it
+func (gateway XenditGateway) CloseVA(ctx context.Context, paramLog *basic.ParamLog, va VAResult, opts ...Option) error {
+	client := resty.New().SetTimeout(60 * time.Second)
+	url := os.Getenv("XENDIT_VA_API_URL") + "/" + va.Reference
+
+	token := fmt.Sprintf("%v:", os.Getenv("XENDIT_API_KEY"))
+	basicAuth := fmt.Sprintf("Basic %v", base64.StdEncoding.EncodeToString([]byte(token)))
+
+	payload := map[string]string{
+		"expiration_date": time.Now().UTC().Format(time.RFC3339),
 	}
-	defer resp.Body.Close()
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		basic.LogInformation2(paramLog, "TransferToPartner1.Error3", err.Error())
-		return
+
+	var result XenditCreateVAResponse
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeaders(map[string]string{
+			"Content-Type":  "application/json",
+			"Authorization": basicAuth,
+		}).
+		SetBody(payload).
+		SetResult(&result).Patch(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), payload, result, "Xendit Close VA API ")
+
+	if err != nil || resp.StatusCode() != 200 {
+		return utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, "Failed call xendit")
 	}
-	basic.LogInformation2(paramLog, "TransferToPartner1.Respons", string(bodyText))
+
+	return nil
 }
 
-func (gateway XenditGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (
-	string, int, domain.Bank, string, error) {
-	ioCloser, span, tag := basic.RequestToTracing(r)
-	paramLog := &basic.ParamLog{Span: span, TrCloser: ioCloser, Tag: tag}
+func (gateway XenditGateway) CallbackVA(w http.ResponseWriter, r *http.Request) (VACallback, error) {
+	paramLog := requestTracing(r)
 	basic.LogInformation(paramLog, "------------------------ Xendit hit callback topup ------------------------")
 
 	// Convert json body to struct
@@ -101,43 +116,33 @@ func (gateway XenditGateway) CallbackVA(w http.ResponseWriter, r *http.Request)
 	token := r.Header.Get("x-callback-token")
 	err := utils.LoadPayload(r, &payload)
 	if err != nil {
-		return "", 0, domain.Bank{}, "", err
+		return VACallback{}, err
 	}
-	//TRANSFER TO PARTNER IF MATCH
 	b, _ := json.Marshal(payload)
-
-	keyword := os.Getenv("PARTNERCALLBACK1_KEYWORD")
-	if keyword != "" {
-		indexPartner1 := strings.Index(payload.BalanceID, keyword)
-		basic.LogInformation2(paramLog, "IndexPartner1", map[string]interface{}{"keyword": keyword, "index": indexPartner1})
-		if indexPartner1 == 0 {
-			gateway.TransferToPartner1(paramLog, string(b), r.Header, r.URL.Query())
-		}
-	}
-
 	basic.LogInformation(paramLog, "Xendit topup callback payload :"+string(b))
 
 	err = validateCallbackToken(paramLog, token)
 	if err != nil {
-		return "", 0, domain.Bank{}, "", err
+		return VACallback{}, err
 	}
 
 	basic.LogInformation(paramLog, fmt.Sprintf("Callback body : %v", payload))
 
-	balanceID := payload.BalanceID
-	amount := payload.Amount
-	bank := domain.Bank{
-		BankCode:      payload.BankCode,
+	return VACallback{
+		ExternalID:    payload.BalanceID,
 		AccountNumber: payload.AccountNumber,
-		Name:          payload.AccountHolderName,
-	}
-
-	reference := payload.PaymentID
-
-	return balanceID, amount, bank, reference, nil
+		Amount:        payload.Amount,
+		From: domain.Bank{
+			BankCode:      payload.BankCode,
+			AccountNumber: payload.AccountNumber,
+			Name:          payload.AccountHolderName,
+		},
+		Reference: payload.PaymentID,
+		Payload:   callbackPayload(r),
+	}, nil
 }
 
-func (gateway XenditGateway) CreateTransfer(paramLog *basic.ParamLog, transaction domain.Transaction) (string, error) {
+func (gateway XenditGateway) CreateTransfer(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferResult, error) {
 	apiUrl := os.Getenv("XENDIT_TRANSFER_API_URL")
 	data := url.Values{}
 	data.Set("external_id", transaction.TransactionCode)
@@ -150,15 +155,19 @@ func (gateway XenditGateway) CreateTransfer(paramLog *basic.ParamLog, transactio
 	token := fmt.Sprintf("%v:", os.Getenv("XENDIT_API_KEY"))
 	basicAuth := fmt.Sprintf("Basic %v", base64.StdEncoding.EncodeToString([]byte(token)))
 
-	r, _ := http.NewRequest("POST", apiUrl, strings.NewReader(data.Encode()+fmt.Sprintf("&amount=%v", transaction.SubAmount))) // URL-encoded payload
+	r, _ := http.NewRequestWithContext(ctx, "POST", apiUrl, strings.NewReader(data.Encode()+fmt.Sprintf("&amount=%v", transaction.SubAmount))) // URL-encoded payload
 	r.Header.Add("Authorization", basicAuth)
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
 
-	disbursementID := ""
 	resp, error := client.Do(r)
 	if error != nil {
-		return disbursementID, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, error.Error())
+		return TransferResult{}, utils.ErrorUnavailable(paramLog, utils.XenditApiCallFailed, error.Error())
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return TransferResult{}, utils.ErrorUnavailable(paramLog, utils.XenditApiCallFailed,
+			fmt.Sprintf("Xendit API status %v", resp.StatusCode))
 	}
 
 	var resMap map[string]interface{}
@@ -166,42 +175,74 @@ func (gateway XenditGateway) CreateTransfer(paramLog *basic.ParamLog, transactio
 	err := decoder.Decode(&resMap)
 	basic.LogInformation(paramLog, fmt.Sprintf("Response from xendit disbursement API body [ %v ]", resMap))
 	if err != nil {
-		return disbursementID, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, fmt.Sprintf("Xendit API failed : %v",
+		return TransferResult{}, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, fmt.Sprintf("Xendit API failed : %v",
 			resp.Body))
 	}
 
 	if resp.StatusCode != 200 {
-		return disbursementID, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, fmt.Sprintf("Xendit API failed : %v", resp.Body))
+		return TransferResult{}, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, fmt.Sprintf("Xendit API failed : %v", resp.Body))
 	}
 
-	disbursementID = resMap["id"].(string)
+	disbursementID, _ := resMap["id"].(string)
 
-	return disbursementID, nil
+	return TransferResult{Reference: disbursementID}, nil
 }
 
-func (gateway XenditGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (string, string, string, error) {
-	ioCloser, span, tag := basic.RequestToTracing(r)
-	paramLog := &basic.ParamLog{Span: span, TrCloser: ioCloser, Tag: tag}
+func (gateway XenditGateway) CallbackTransfer(w http.ResponseWriter, r *http.Request) (TransferCallback, error) {
+	paramLog := requestTracing(r)
 	basic.LogInformation(paramLog, "------------------------ Xendit hit callback transfer ------------------------")
 
 	// Convert json body to struct
 	var payload XenditTransferBankCallback
 	err := utils.LoadPayload(r, &payload)
 	if err != nil {
-		return "", "", "", err
+		return TransferCallback{}, err
 	}
 	b, _ := json.Marshal(payload)
 	basic.LogInformation(paramLog, "Xendit transfer callback payload :"+string(b))
 
-	transactionCode := payload.ExternalID
-	reference := payload.ID
-	status := convertStatusXendit(payload.Status)
+	return TransferCallback{
+		TransactionCode: payload.ExternalID,
+		Reference:       payload.ID,
+		Status:          convertStatusXendit(payload.Status),
+		Payload:         callbackPayload(r),
+	}, nil
+}
+
+// TransferStatus reads the disbursement back from Xendit, one still pending stays pending
+func (gateway XenditGateway) TransferStatus(ctx context.Context, paramLog *basic.ParamLog, transaction domain.Transaction, opts ...Option) (TransferCallback, error) {
+	client := resty.New().SetTimeout(20 * time.Second)
+	url := os.Getenv("XENDIT_TRANSFER_API_URL") + "/" + transaction.GatewayReference
+
+	token := fmt.Sprintf("%v:", os.Getenv("XENDIT_API_KEY"))
+	basicAuth := fmt.Sprintf("Basic %v", base64.StdEncoding.EncodeToString([]byte(token)))
+
+	var result XenditTransferBankCallback
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", basicAuth).
+		SetResult(&result).Get(url)
+
+	utils.LoggingAPICall(paramLog, resp.StatusCode(), url, result, "Xendit Transfer Status API ")
+
+	if err != nil || resp.StatusCode() != 200 {
+		return TransferCallback{}, utils.ErrorInternalServer(paramLog, utils.XenditApiCallFailed, "Failed call xendit")
+	}
+
+	status := convertStatusXendit(result.Status)
+	if result.Status == "PENDING" {
+		status = domain.PENDING_STATUS
+	}
 
-	return transactionCode, reference, status, nil
+	return TransferCallback{
+		TransactionCode: result.ExternalID,
+		Reference:       result.ID,
+		Status:          status,
+	}, nil
 }
 
-func (gateway XenditGateway) Inquiry(paramLog *basic.ParamLog, bankCode string, accountNumber string) (string, error) {
-	return "", nil
+func (gateway XenditGateway) Inquiry(ctx context.Context, paramLog *basic.ParamLog, request InquiryRequest, opts ...Option) (InquiryResult, error) {
+	return InquiryResult{}, notSupported(paramLog, gateway, "inquiry")
 }
 
 func validateCallbackToken(paramLog *basic.ParamLog, token string) error {
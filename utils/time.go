@@ -8,3 +8,7 @@ import (
 func TimestampNow() string {
 	return time.Now().Format(os.Getenv("TIME_FORMAT"))
 }
+
+func ParseTimestamp(value string) (time.Time, error) {
+	return time.ParseInLocation(os.Getenv("TIME_FORMAT"), value, time.Local)
+}